@@ -34,6 +34,7 @@ type IngestRequest struct {
 	Source   string            `json:"source"`
 	Data     string            `json:"data"`
 	Metadata map[string]string `json:"metadata"`
+	DelayMs  int64             `json:"delayMs,omitempty"`
 }
 
 type IngestResponse struct {
@@ -87,6 +88,7 @@ func (g *HTTP2Gateway) ingestHandler(w http.ResponseWriter, r *http.Request) {
 		Source:   req.Source,
 		Data:     []byte(req.Data),
 		Metadata: req.Metadata,
+		DelayMs:  req.DelayMs,
 	}
 
 	// Вызываем gRPC сервис с timeout
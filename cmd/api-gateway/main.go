@@ -226,6 +226,7 @@ func initializeServices(cfg *config.Config) {
 	services = []ServiceInfo{
 		{Name: "ingest", Endpoint: getIngestURL(), Path: "/ingest"},
 		{Name: "processor", Endpoint: getProcessorURL(), Path: "/enqueue"},
+		{Name: "processor-dlq", Endpoint: getProcessorURL(), Path: "/dlq"},
 	}
 }
 
@@ -242,30 +243,35 @@ func handleProxy(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Метки метрик - шаблон маршрута, а не сырой путь: иначе каждый /dlq/{id} порождает новую серию.
 	if targetService == nil {
-		metrics.GatewayRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "404").Inc()
-		metrics.GatewayRequestDuration.WithLabelValues(r.Method, r.URL.Path, "404").Observe(time.Since(start).Seconds())
+		metrics.GatewayRequestsTotal.WithLabelValues(r.Method, r.Pattern, "404").Inc()
+		metrics.GatewayRequestDuration.WithLabelValues(r.Method, r.Pattern, "404").Observe(time.Since(start).Seconds())
 		http.NotFound(w, r)
 		return
 	}
 
-	// Создаем URL для проксирования
+	route := targetService.Path
+
+	// Создаем URL для проксирования, сохраняя query string (например, /dlq?limit=...)
 	targetURL, err := url.Parse(targetService.Endpoint + r.URL.Path)
 	if err != nil {
-		metrics.GatewayRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "500").Inc()
-		metrics.GatewayRequestDuration.WithLabelValues(r.Method, r.URL.Path, "500").Observe(time.Since(start).Seconds())
+		metrics.GatewayRequestsTotal.WithLabelValues(r.Method, route, "500").Inc()
+		metrics.GatewayRequestDuration.WithLabelValues(r.Method, route, "500").Observe(time.Since(start).Seconds())
 		http.Error(w, "Invalid target URL", http.StatusInternalServerError)
 		return
 	}
 
+	targetURL.RawQuery = r.URL.RawQuery
+
 	// Создаем новый запрос
 	ctx, cancel := context.WithTimeout(r.Context(), proxyTimeout)
 	defer cancel()
 
 	proxyReq, err := http.NewRequestWithContext(ctx, r.Method, targetURL.String(), r.Body)
 	if err != nil {
-		metrics.GatewayRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "500").Inc()
-		metrics.GatewayRequestDuration.WithLabelValues(r.Method, r.URL.Path, "500").Observe(time.Since(start).Seconds())
+		metrics.GatewayRequestsTotal.WithLabelValues(r.Method, route, "500").Inc()
+		metrics.GatewayRequestDuration.WithLabelValues(r.Method, route, "500").Observe(time.Since(start).Seconds())
 		http.Error(w, "Failed to create proxy request", http.StatusInternalServerError)
 		return
 	}
@@ -280,8 +286,8 @@ func handleProxy(w http.ResponseWriter, r *http.Request) {
 	// Выполняем запрос
 	resp, err := httpClientWithTimeout.Do(proxyReq)
 	if err != nil {
-		metrics.GatewayRequestsTotal.WithLabelValues(r.Method, r.URL.Path, "503").Inc()
-		metrics.GatewayRequestDuration.WithLabelValues(r.Method, r.URL.Path, "503").Observe(time.Since(start).Seconds())
+		metrics.GatewayRequestsTotal.WithLabelValues(r.Method, route, "503").Inc()
+		metrics.GatewayRequestDuration.WithLabelValues(r.Method, route, "503").Observe(time.Since(start).Seconds())
 		metrics.GatewayUpstreamRequestsTotal.WithLabelValues(targetService.Name, "error").Inc()
 		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
 		return
@@ -305,8 +311,8 @@ func handleProxy(w http.ResponseWriter, r *http.Request) {
 
 	// Обновляем метрики
 	statusCode := strconv.Itoa(resp.StatusCode)
-	metrics.GatewayRequestsTotal.WithLabelValues(r.Method, r.URL.Path, statusCode).Inc()
-	metrics.GatewayRequestDuration.WithLabelValues(r.Method, r.URL.Path, statusCode).Observe(time.Since(start).Seconds())
+	metrics.GatewayRequestsTotal.WithLabelValues(r.Method, route, statusCode).Inc()
+	metrics.GatewayRequestDuration.WithLabelValues(r.Method, route, statusCode).Observe(time.Since(start).Seconds())
 	metrics.GatewayUpstreamRequestsTotal.WithLabelValues(targetService.Name, "success").Inc()
 }
 
@@ -17,6 +17,7 @@ import (
 	"github.com/stsolovey/diplom-distributed-system/internal/config"
 	"github.com/stsolovey/diplom-distributed-system/internal/metrics"
 	"github.com/stsolovey/diplom-distributed-system/internal/models"
+	"github.com/stsolovey/diplom-distributed-system/internal/queue"
 )
 
 const (
@@ -46,6 +47,7 @@ type IngestRequest struct {
 	Source   string            `json:"source"`
 	Data     string            `json:"data"`
 	Metadata map[string]string `json:"metadata,omitempty"`
+	DelayMs  int64             `json:"delayMs,omitempty"` // задержка доставки в миллисекундах
 }
 
 // IngestResponse представляет ответ сервиса.
@@ -118,7 +120,7 @@ func (app *App) handleIngest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req IngestRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.DelayMs < 0 {
 		metrics.IngestRequestsTotal.WithLabelValues("bad_request").Inc()
 		metrics.IngestRequestDuration.WithLabelValues("bad_request").Observe(time.Since(start).Seconds())
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -136,6 +138,7 @@ func (app *App) handleIngest(w http.ResponseWriter, r *http.Request) {
 		Payload:   []byte(req.Data),
 		Metadata:  req.Metadata,
 	}
+	queue.SetDelay(msg, time.Duration(req.DelayMs)*time.Millisecond)
 
 	// Отправляем в Processor
 	ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -22,32 +25,74 @@ const (
 	serverReadTimeout       = 10 * time.Second
 	serverWriteTimeout      = 10 * time.Second
 	serverReadHeaderTimeout = 5 * time.Second
+	defaultDeadLetterLimit  = 100
 )
 
 type App struct {
-	queueProvider queue.Provider
+	queueProvider *queue.MigratingProvider
+	publisher     queue.Publisher // queueProvider или маршрутизатор поверх него
 	pool          *processor.WorkerPool
+	factory       *queue.Factory // создает провайдеры для миграции очереди
 }
 
 func main() { //nolint:funlen
 	cfg := config.LoadConfig()
 
-	// Создаем провайдер очереди через фабрику.
+	// Создаем провайдер очереди через фабрику; его можно заменить без остановки через /admin/queue/migrate.
 	factory := queue.NewFactory(cfg)
 
-	queueProvider, err := factory.CreateProvider()
+	queueProvider, err := factory.CreateMigratingProvider()
 	if err != nil {
 		log.Printf("Failed to create queue provider: %v", err)
 		os.Exit(1)
 	}
 	defer queueProvider.Close()
 
+	// Брокер обслуживает дополнительные subject'ы и маршрутизацию через одно подключение.
+	var broker queue.MessageBroker
+
+	if len(cfg.ProcessorSubjects) > 0 || cfg.RoutingFile != "" {
+		broker, err = factory.CreateBroker(context.Background())
+		if err != nil {
+			log.Printf("Failed to create message broker: %v", err)
+			os.Exit(1) //nolint:gocritic
+		}
+		defer disconnectBroker(broker)
+	}
+
+	// Воркеры читают очередь и дополнительные subject'ы брокера из PROCESSOR_SUBJECTS.
+	var subscriber processor.Subscriber = queueProvider
+
+	if len(cfg.ProcessorSubjects) > 0 {
+		subscribers, err := subscribeSubjects(broker, cfg.ProcessorSubjects)
+		if err != nil {
+			log.Printf("Failed to subscribe to subjects %v: %v", cfg.ProcessorSubjects, err)
+			os.Exit(1) //nolint:gocritic
+		}
+		defer closeSubscribers(subscribers)
+
+		subscriber = queue.NewMultiSubscriber(append([]queue.Subscriber{queueProvider}, subscribers...)...)
+	}
+
+	// Сообщения из /enqueue публикуются по таблице маршрутизации, если она задана.
+	var publisher queue.Publisher = queueProvider
+
+	if cfg.RoutingFile != "" {
+		publisher, err = newRouter(cfg.RoutingFile, broker, queueProvider)
+		if err != nil {
+			log.Printf("Failed to create router: %v", err)
+			os.Exit(1) //nolint:gocritic
+		}
+	}
+
 	// Создаем worker pool с унифицированным интерфейсом.
-	pool := processor.NewWorkerPool(cfg.ProcessorWorkers, queueProvider)
+	pool := processor.NewWorkerPool(cfg.ProcessorWorkers, subscriber)
 
 	app := &App{
 		queueProvider: queueProvider,
+		publisher:     publisher,
 		pool:          pool,
+		factory:       factory,
 	}
 
 	// Контекст для graceful shutdown.
@@ -68,6 +113,8 @@ func main() { //nolint:funlen
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 
+		var reportedFailovers, reportedDropped int64
+
 		for {
 			select {
 			case <-ctx.Done():
@@ -81,6 +128,36 @@ func main() { //nolint:funlen
 				// queue.Stats имеет поле CurrentSize типа int
 				metrics.ProcessorQueueSize.Set(float64(queueStats.CurrentSize))
 
+				// Состояние consumer'а брокера и отставание по партициям Kafka
+				metrics.ProcessorQueueConsumerMessages.WithLabelValues("pending").Set(float64(queueStats.Pending))
+				metrics.ProcessorQueueConsumerMessages.WithLabelValues("ack_pending").Set(float64(queueStats.AckPending))
+				metrics.ProcessorQueueConsumerMessages.WithLabelValues("redelivered").Set(float64(queueStats.Redelivered))
+
+				for shard, size := range queueStats.ShardSizes {
+					metrics.ProcessorQueueShardSize.WithLabelValues(strconv.Itoa(shard)).Set(float64(size))
+				}
+
+				for _, lag := range queueStats.PartitionLag {
+					metrics.ProcessorQueuePartitionLag.
+						WithLabelValues(lag.Topic, strconv.Itoa(int(lag.Partition))).
+						Set(float64(lag.Lag))
+				}
+
+				// Состояние предохранителей composite-очереди (стратегия failover)
+				for _, breaker := range queueStats.Breakers {
+					metrics.ProcessorQueueBreakerState.WithLabelValues(breaker.Provider).Set(breakerStateValue(breaker.State))
+				}
+
+				if queueStats.Failovers > reportedFailovers {
+					metrics.ProcessorQueueFailoversTotal.Add(float64(queueStats.Failovers - reportedFailovers))
+					reportedFailovers = queueStats.Failovers
+				}
+
+				if queueStats.Dropped > reportedDropped {
+					metrics.ProcessorQueueDroppedTotal.Add(float64(queueStats.Dropped - reportedDropped))
+					reportedDropped = queueStats.Dropped
+				}
+
 				// Обновляем метрики обработки
 				metrics.ProcessorMessagesTotal.WithLabelValues("processed").Add(float64(stats.ProcessedCount))
 				if stats.ErrorCount > 0 {
@@ -96,6 +173,17 @@ func main() { //nolint:funlen
 	mux.HandleFunc("/stats", app.handleStats)
 	mux.HandleFunc("/enqueue", app.handleEnqueue) // Новый эндпоинт для приема сообщений.
 	mux.Handle("/metrics", promhttp.Handler())    // Добавляем endpoint для метрик
+	mux.HandleFunc("POST /enqueue/batch", app.handleEnqueueBatch)
+
+	// Dead-letter queue: просмотр, удаление и повторная отправка сообщений.
+	mux.HandleFunc("GET /dlq", app.handleDeadLetterList)
+	mux.HandleFunc("GET /dlq/{id}", app.handleDeadLetterGet)
+	mux.HandleFunc("DELETE /dlq/{id}", app.handleDeadLetterDelete)
+	mux.HandleFunc("POST /dlq/{id}/replay", app.handleDeadLetterReplay)
+
+	// Переключение очереди на другой провайдер без остановки; ход миграции - в /stats.
+	mux.HandleFunc("POST /admin/queue/migrate", app.handleQueueMigrate)
+	mux.HandleFunc("POST /admin/queue/migrate/abort", app.handleQueueMigrateAbort)
 
 	srv := &http.Server{
 		Addr:              ":" + cfg.ProcessorPort,
@@ -140,6 +228,57 @@ func main() { //nolint:funlen
 	}
 }
 
+// subscribeSubjects создает подписки на subject'ы брокера.
+func subscribeSubjects(broker queue.MessageBroker, subjects []string) ([]queue.Subscriber, error) {
+	subscribers := make([]queue.Subscriber, 0, len(subjects))
+
+	for _, subject := range subjects {
+		subscriber, err := broker.CreateSubscriber(subject)
+		if err != nil {
+			closeSubscribers(subscribers)
+
+			return nil, fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+		}
+
+		subscribers = append(subscribers, subscriber)
+	}
+
+	log.Printf("Processor subscribed to subjects: %v", subjects)
+
+	return subscribers, nil
+}
+
+func closeSubscribers(subscribers []queue.Subscriber) {
+	for _, subscriber := range subscribers {
+		if err := subscriber.Close(); err != nil {
+			log.Printf("Error closing subscriber: %v", err)
+		}
+	}
+}
+
+func disconnectBroker(broker queue.MessageBroker) {
+	if err := broker.Disconnect(); err != nil {
+		log.Printf("Error disconnecting message broker: %v", err)
+	}
+}
+
+// newRouter загружает таблицу маршрутизации и создает маршрутизатор поверх основной очереди.
+func newRouter(path string, broker queue.MessageBroker, fallback queue.Publisher) (*queue.Router, error) {
+	table, err := queue.LoadRoutingTable(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load routing table: %w", err)
+	}
+
+	router, err := queue.NewRouter(table, broker, fallback)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create router: %w", err)
+	}
+
+	log.Printf("Routing %d rules to subjects: %v", len(table.Routes), table.Subjects())
+
+	return router, nil
+}
+
 // handleEnqueue принимает сообщения от Ingest сервиса.
 func (a *App) handleEnqueue(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -156,7 +295,7 @@ func (a *App) handleEnqueue(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	if err := a.queueProvider.Publish(ctx, &msg); err != nil {
+	if err := a.publisher.Publish(ctx, &msg); err != nil {
 		if errors.Is(err, queue.ErrQueueFull) {
 			http.Error(w, "Queue is full", http.StatusServiceUnavailable)
 		} else {
@@ -170,6 +309,43 @@ func (a *App) handleEnqueue(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// enqueueResult - результат публикации одного сообщения пачки.
+type enqueueResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// handleEnqueueBatch принимает массив сообщений и публикует его одной пачкой.
+// Ответ содержит результат каждого сообщения в порядке запроса.
+func (a *App) handleEnqueueBatch(w http.ResponseWriter, r *http.Request) {
+	var msgs []*models.DataMessage
+	if err := json.NewDecoder(r.Body).Decode(&msgs); err != nil || len(msgs) == 0 || slices.Contains(msgs, nil) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+
+		return
+	}
+
+	errs := queue.PublishBatch(r.Context(), a.publisher, msgs)
+
+	results := make([]enqueueResult, len(msgs))
+	status := http.StatusAccepted
+
+	for i, err := range errs {
+		results[i] = enqueueResult{ID: msgs[i].GetId(), Status: "accepted"}
+
+		if err != nil {
+			log.Printf("Failed to enqueue message %s: %v", msgs[i].GetId(), err)
+
+			results[i].Status = "failed"
+			results[i].Error = err.Error()
+			status = http.StatusMultiStatus
+		}
+	}
+
+	writeJSON(w, status, results)
+}
+
 // handleHealth проверка здоровья сервиса.
 func (a *App) handleHealth(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -179,6 +355,17 @@ func (a *App) handleHealth(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
+// breakerStateValue переводит состояние предохранителя в значение метрики.
+func breakerStateValue(state string) float64 {
+	for _, s := range []queue.BreakerState{queue.BreakerOpen, queue.BreakerHalfOpen} {
+		if state == s.String() {
+			return float64(s)
+		}
+	}
+
+	return float64(queue.BreakerClosed)
+}
+
 // handleStats возвращает статистику.
 func (a *App) handleStats(w http.ResponseWriter, _ *http.Request) {
 	poolStats := a.pool.GetStats()
@@ -189,9 +376,214 @@ func (a *App) handleStats(w http.ResponseWriter, _ *http.Request) {
 		"pool":  poolStats,
 	}
 
+	if migration := a.queueProvider.Migration(); migration != nil {
+		stats["migration"] = migration
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 
 	if err := json.NewEncoder(w).Encode(stats); err != nil {
 		log.Printf("Failed to encode stats response: %v", err)
 	}
 }
+
+// migrateRequest - тело запроса POST /admin/queue/migrate.
+type migrateRequest struct {
+	QueueType string `json:"queueType"`
+}
+
+// handleQueueMigrate переключает очередь на провайдер queueType без остановки processor:
+// двойная запись, дренирование старого провайдера, проверка, что он пуст, и переключение.
+// Миграция идет в фоне, ответ содержит ее начальное состояние.
+func (a *App) handleQueueMigrate(w http.ResponseWriter, r *http.Request) {
+	var req migrateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.QueueType == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+
+		return
+	}
+
+	if err := queue.ValidateProviderType(req.QueueType); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if req.QueueType == a.queueProvider.Name() {
+		http.Error(w, "Queue already uses "+req.QueueType, http.StatusConflict)
+
+		return
+	}
+
+	provider, err := a.factory.CreateProviderOfType(queue.ProviderType(req.QueueType))
+	if err != nil {
+		log.Printf("Failed to create %s queue provider for migration: %v", req.QueueType, err)
+		http.Error(w, "Failed to create queue provider", http.StatusInternalServerError)
+
+		return
+	}
+
+	// Миграция переживает запрос и прерывается через /admin/queue/migrate/abort, по MIGRATION_DRAIN_TIMEOUT
+	// или закрытием очереди.
+	if err := a.queueProvider.Migrate(context.WithoutCancel(r.Context()), req.QueueType, provider); err != nil {
+		if closeErr := provider.Close(); closeErr != nil {
+			log.Printf("Error closing queue provider: %v", closeErr)
+		}
+
+		if errors.Is(err, queue.ErrMigrationInProgress) || errors.Is(err, queue.ErrMigrationSameProvider) {
+			http.Error(w, err.Error(), http.StatusConflict)
+
+			return
+		}
+
+		log.Printf("Failed to start queue migration to %s: %v", req.QueueType, err)
+		http.Error(w, "Failed to start queue migration", http.StatusInternalServerError)
+
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, a.queueProvider.Migration())
+}
+
+// handleQueueMigrateAbort прерывает текущую миграцию очереди. Откат на старый провайдер идет в фоне,
+// его ход - в /stats.
+func (a *App) handleQueueMigrateAbort(w http.ResponseWriter, _ *http.Request) {
+	if err := a.queueProvider.Abort(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, a.queueProvider.Migration())
+}
+
+// deadLetters возвращает DLQ провайдера очереди или пишет ошибку, если она не поддерживается.
+func (a *App) deadLetters(w http.ResponseWriter) (queue.DeadLetterQueue, bool) {
+	dlq := a.queueProvider.DeadLetters()
+	if dlq == nil {
+		http.Error(w, "Dead-letter queue is not supported by queue provider", http.StatusNotImplemented)
+
+		return nil, false
+	}
+
+	return dlq, true
+}
+
+// handleDeadLetterList возвращает сообщения из DLQ (параметр limit, по умолчанию 100).
+func (a *App) handleDeadLetterList(w http.ResponseWriter, r *http.Request) {
+	dlq, ok := a.deadLetters(w)
+	if !ok {
+		return
+	}
+
+	limit := defaultDeadLetterLimit
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+
+			return
+		}
+
+		limit = parsed
+	}
+
+	entries, err := dlq.List(r.Context(), limit)
+	if err != nil {
+		log.Printf("Failed to list dead letters: %v", err)
+		http.Error(w, "Failed to list dead letters", http.StatusInternalServerError)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// handleDeadLetterGet возвращает одно сообщение из DLQ.
+func (a *App) handleDeadLetterGet(w http.ResponseWriter, r *http.Request) {
+	dlq, ok := a.deadLetters(w)
+	if !ok {
+		return
+	}
+
+	dl, err := dlq.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeDeadLetterError(w, "get", err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dl)
+}
+
+// handleDeadLetterDelete удаляет сообщение из DLQ.
+func (a *App) handleDeadLetterDelete(w http.ResponseWriter, r *http.Request) {
+	dlq, ok := a.deadLetters(w)
+	if !ok {
+		return
+	}
+
+	if err := dlq.Delete(r.Context(), r.PathValue("id")); err != nil {
+		writeDeadLetterError(w, "delete", err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeadLetterReplay возвращает сообщение из DLQ в основную очередь и удаляет его из DLQ.
+func (a *App) handleDeadLetterReplay(w http.ResponseWriter, r *http.Request) {
+	dlq, ok := a.deadLetters(w)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	id := r.PathValue("id")
+
+	dl, err := dlq.Get(ctx, id)
+	if err != nil {
+		writeDeadLetterError(w, "replay", err)
+
+		return
+	}
+
+	if err := a.publisher.Publish(ctx, dl.Message); err != nil {
+		log.Printf("Failed to replay dead letter %s: %v", id, err)
+		http.Error(w, "Failed to replay dead letter", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	if err := dlq.Delete(ctx, id); err != nil {
+		log.Printf("Dead letter %s replayed but not deleted: %v", id, err)
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"id":        id,
+		"messageId": dl.Message.GetId(),
+		"status":    "replayed",
+	})
+}
+
+func writeDeadLetterError(w http.ResponseWriter, op string, err error) {
+	if errors.Is(err, queue.ErrDeadLetterNotFound) {
+		http.Error(w, "Dead letter not found", http.StatusNotFound)
+
+		return
+	}
+
+	log.Printf("Failed to %s dead letter: %v", op, err)
+	http.Error(w, "Failed to "+op+" dead letter", http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
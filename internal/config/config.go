@@ -4,11 +4,32 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
 	defaultProcessorWorkers = 4
 	defaultQueueSize        = 1000
+	defaultWALSegmentSize   = 64 << 20
+	defaultWALSyncInterval  = 100 * time.Millisecond
+	defaultWALRetain        = 1
+	defaultPriorityLevels   = 3
+	defaultQueueShards      = 8
+
+	defaultCompositeDedupWindow = 5 * time.Minute
+	defaultBreakerErrorRate     = 0.5
+	defaultBreakerLatency       = time.Second
+	defaultBreakerOpenTimeout   = 10 * time.Second
+	defaultCompressionThreshold = 1024
+	defaultKafkaCommitInterval  = time.Second
+	defaultNATSAsyncMaxPending  = 256
+	defaultRedisMaxLen          = 1000000
+	defaultRedisClaimIdle       = 30 * time.Second
+	defaultOverflowBlockTimeout = time.Second
+	defaultOverflowSampleRate   = 0.1
+	defaultMigrationDualWrite   = 10 * time.Second
+	defaultMigrationCheck       = time.Second
+	defaultMigrationDrain       = 5 * time.Minute
 )
 
 type Config struct {
@@ -22,43 +43,181 @@ type Config struct {
 	ProcessorPort    string
 	ProcessorWorkers int
 	ProcessorURL     string // для HTTP bridge
+	// Дополнительные subject'ы (топики), которые processor читает через одно подключение к брокеру
+	ProcessorSubjects []string
+	RoutingFile       string // JSON-таблица маршрутизации сообщений по subject'ам; пусто - без маршрутизации
 
 	// Размер очереди
 	QueueSize int
+	// Переполнение in-memory очереди: "reject", "block", "drop-oldest", "drop-newest" или "sample"
+	QueueOverflowPolicy       string
+	QueueOverflowBlockTimeout time.Duration // предельное ожидание места для политики block
+	QueueOverflowSampleRate   float64       // доля принимаемых при переполнении сообщений для политики sample
+	// Отладка аренд очереди memory-optimized: панику вызывают чтение сообщения после Release и повторный Release
+	QueueLeaseDebug bool
 
 	// Queue settings
-	QueueType string // "memory", "nats" или "kafka"
-	NATSURL   string // URL для подключения к NATS
+	// "memory", "memory-optimized", "ring", "sharded", "priority", "nats", "nats-embedded", "kafka", "redis", "wal",
+	// "composite" или имя провайдера, зарегистрированного через queue.Register
+	QueueType string
+	// Параметры зарегистрированных провайдеров: ключ "<провайдер>.<параметр>", например "s3.bucket"
+	QueueProviderOptions map[string]string
+
+	NATSURL     string // URL для подключения к NATS
+	NATSSubject string // основной subject очереди NATS
+	QueueCodec  string // кодек сообщений NATS и Kafka: "protobuf", "protojson" или "json"
+
+	// Сжатие сообщений NATS и Kafka
+	QueueCompression          string // "none", "gzip", "snappy" или "zstd"
+	QueueCompressionThreshold int    // тела меньше порога (в байтах) не сжимаются
+
+	// Публикация NATS: "sync" - ожидание ACK каждого сообщения, "async" - окно неподтвержденных публикаций
+	NATSPublishMode     string
+	NATSAsyncMaxPending int // размер окна в режиме async
+
+	// Встроенный nats-server (QUEUE_TYPE=nats-embedded)
+	NATSEmbeddedStoreDir string // каталог хранилища JetStream
+	NATSEmbeddedListen   string // host:port для внешних клиентов; пусто - только клиенты процесса
+
+	// Sharded queue settings: порядок сообщений внутри ключа
+	QueueShards           int    // число шардов; QueueSize делится между ними
+	QueueShardKey         string // "source" или "metadata"
+	QueueShardMetadataKey string // поле метаданных для ключа "metadata"
+
+	// Priority queue settings
+	PriorityLevels  int   // число уровней приоритета
+	PriorityWeights []int // веса уровней от низшего к высшему
+
+	// WAL settings
+	WALDir            string        // каталог сегментов лога
+	WALSegmentSize    int64         // размер сегмента в байтах
+	WALSyncPolicy     string        // "always", "interval" или "none"
+	WALSyncInterval   time.Duration // период fsync и checkpoint'а
+	WALRetainSegments int           // сколько прочитанных сегментов хранить
 
 	// Kafka settings
 	KafkaBrokers       []string // список брокеров
 	KafkaTopic         string   // топик для сообщений
 	KafkaConsumerGroup string   // consumer group name
+	// Ключ партиционирования: "id", "source", "metadata" или "explicit" (Metadata["partition"])
+	KafkaPartitionKey         string
+	KafkaPartitionMetadataKey string // поле метаданных для ключа "metadata"
+	KafkaConsumerMode         string // "parallel" или "ordered" (порядок внутри партиции)
+	// Фиксация offset'ов: "auto" - фоном sarama, "manual" - только непрерывный префикс обработанных записей
+	KafkaCommitMode     string
+	KafkaCommitInterval time.Duration // период фиксации в режиме manual
+	// Режим "transactional": результат и offset фиксируются одной транзакцией
+	KafkaTransactionalID string // уникален для экземпляра; пусто - "<group>-<hostname>"
+	KafkaResultsTopic    string // топик результатов; пусто - "<topic>.results"
+
+	// Redis Streams settings
+	RedisAddr      string
+	RedisPassword  string
+	RedisDB        int
+	RedisStream    string        // ключ stream'а сообщений
+	RedisGroup     string        // consumer group
+	RedisConsumer  string        // имя потребителя в группе; пусто - имя хоста
+	RedisMaxLen    int           // приблизительная длина stream'а; 0 - без ограничения
+	RedisClaimIdle time.Duration // простой, после которого неподтвержденное сообщение забирается (XAUTOCLAIM)
 
 	// Composite adapter settings
 	CompositeProviders []string // например: ["nats", "kafka"]
-	CompositeStrategy  string   // "fail-fast" или "best-effort"
+	CompositeStrategy  string   // "fail-fast", "best-effort" или "failover"
+	// Режим подписки: "first" - только первый провайдер, "merge" - все провайдеры с дедупликацией
+	CompositeSubscribeMode string
+	CompositeDedupWindow   time.Duration // окно дедупликации по DataMessage.Id в режиме merge
+
+	// Circuit breaker для стратегии "failover"
+	BreakerErrorRate   float64       // доля ошибок, при которой предохранитель размыкается
+	BreakerLatency     time.Duration // публикации медленнее порога считаются ошибками
+	BreakerOpenTimeout time.Duration // время до пробной публикации (half-open)
+
+	// Миграция очереди на другой провайдер без остановки (POST /admin/queue/migrate)
+	MigrationDualWrite     time.Duration // длительность двойной записи перед дренированием старого провайдера
+	MigrationCheckInterval time.Duration // период проверки, что старый провайдер пуст
+	MigrationDrainTimeout  time.Duration // предельное время дренирования; по истечении миграция откатывается
 }
 
 // LoadConfig загружает конфигурацию из переменных окружения.
 func LoadConfig() *Config {
 	return &Config{
-		APIPort:          getEnv("API_PORT", "8080"),
-		IngestPort:       getEnv("INGEST_PORT", "8081"),
-		ProcessorPort:    getEnv("PROCESSOR_PORT", "8082"),
-		ProcessorWorkers: getEnvAsInt("PROCESSOR_WORKERS", defaultProcessorWorkers),
-		ProcessorURL:     getEnv("PROCESSOR_URL", "http://localhost:8082"),
-		QueueSize:        getEnvAsInt("QUEUE_SIZE", defaultQueueSize),
+		APIPort:           getEnv("API_PORT", "8080"),
+		IngestPort:        getEnv("INGEST_PORT", "8081"),
+		ProcessorPort:     getEnv("PROCESSOR_PORT", "8082"),
+		ProcessorWorkers:  getEnvAsInt("PROCESSOR_WORKERS", defaultProcessorWorkers),
+		ProcessorURL:      getEnv("PROCESSOR_URL", "http://localhost:8082"),
+		ProcessorSubjects: getEnvAsStringSlice("PROCESSOR_SUBJECTS"),
+		RoutingFile:       getEnv("ROUTING_FILE", ""),
+		QueueSize:         getEnvAsInt("QUEUE_SIZE", defaultQueueSize),
+
+		QueueOverflowPolicy:       getEnv("QUEUE_OVERFLOW_POLICY", "reject"),
+		QueueOverflowBlockTimeout: getEnvAsDuration("QUEUE_OVERFLOW_BLOCK_TIMEOUT", defaultOverflowBlockTimeout),
+		QueueOverflowSampleRate:   getEnvAsFloat("QUEUE_OVERFLOW_SAMPLE_RATE", defaultOverflowSampleRate),
+		QueueLeaseDebug:           getEnvAsBool("QUEUE_LEASE_DEBUG", false),
+
+		QueueType:            getEnv("QUEUE_TYPE", "memory"),
+		QueueProviderOptions: getEnvAsStringMap("QUEUE_PROVIDER_OPTIONS"),
+
+		NATSURL:     getEnv("NATS_URL", "nats://localhost:4222"),
+		NATSSubject: getEnv("NATS_SUBJECT", "messages"),
+		QueueCodec:  getEnv("QUEUE_CODEC", "protobuf"),
+
+		QueueCompression:          getEnv("QUEUE_COMPRESSION", "none"),
+		QueueCompressionThreshold: getEnvAsInt("QUEUE_COMPRESSION_THRESHOLD", defaultCompressionThreshold),
+
+		NATSPublishMode:     getEnv("NATS_PUBLISH_MODE", "sync"),
+		NATSAsyncMaxPending: getEnvAsInt("NATS_ASYNC_MAX_PENDING", defaultNATSAsyncMaxPending),
+
+		NATSEmbeddedStoreDir: getEnv("NATS_EMBEDDED_STORE_DIR", "data/nats"),
+		NATSEmbeddedListen:   getEnv("NATS_EMBEDDED_LISTEN", ""),
 
-		QueueType: getEnv("QUEUE_TYPE", "memory"),
-		NATSURL:   getEnv("NATS_URL", "nats://localhost:4222"),
+		QueueShards:           getEnvAsInt("QUEUE_SHARDS", defaultQueueShards),
+		QueueShardKey:         getEnv("QUEUE_SHARD_KEY", "source"),
+		QueueShardMetadataKey: getEnv("QUEUE_SHARD_METADATA_KEY", ""),
+
+		PriorityLevels:  getEnvAsInt("PRIORITY_LEVELS", defaultPriorityLevels),
+		PriorityWeights: getEnvAsIntSlice("PRIORITY_WEIGHTS"),
+
+		WALDir:            getEnv("WAL_DIR", "data/wal"),
+		WALSegmentSize:    int64(getEnvAsInt("WAL_SEGMENT_SIZE", defaultWALSegmentSize)),
+		WALSyncPolicy:     getEnv("WAL_SYNC_POLICY", "interval"),
+		WALSyncInterval:   getEnvAsDuration("WAL_SYNC_INTERVAL", defaultWALSyncInterval),
+		WALRetainSegments: getEnvAsInt("WAL_RETAIN_SEGMENTS", defaultWALRetain),
 
 		KafkaBrokers:       getKafkaBrokers(),
 		KafkaTopic:         getEnv("KAFKA_TOPIC", "diplom-messages"),
 		KafkaConsumerGroup: getEnv("KAFKA_CONSUMER_GROUP", "processor-group"),
 
+		KafkaPartitionKey:         getEnv("KAFKA_PARTITION_KEY", "id"),
+		KafkaPartitionMetadataKey: getEnv("KAFKA_PARTITION_METADATA_KEY", ""),
+		KafkaConsumerMode:         getEnv("KAFKA_CONSUMER_MODE", "parallel"),
+		KafkaCommitMode:           getEnv("KAFKA_COMMIT_MODE", "auto"),
+		KafkaCommitInterval:       getEnvAsDuration("KAFKA_COMMIT_INTERVAL", defaultKafkaCommitInterval),
+		KafkaTransactionalID:      getEnv("KAFKA_TRANSACTIONAL_ID", ""),
+		KafkaResultsTopic:         getEnv("KAFKA_RESULTS_TOPIC", ""),
+
+		RedisAddr:      getEnv("REDIS_ADDR", "localhost:6379"),
+		RedisPassword:  getEnv("REDIS_PASSWORD", ""),
+		RedisDB:        getEnvAsInt("REDIS_DB", 0),
+		RedisStream:    getEnv("REDIS_STREAM", "diplom-messages"),
+		RedisGroup:     getEnv("REDIS_GROUP", "processor-group"),
+		RedisConsumer:  getEnv("REDIS_CONSUMER", ""),
+		RedisMaxLen:    getEnvAsInt("REDIS_MAXLEN", defaultRedisMaxLen),
+		RedisClaimIdle: getEnvAsDuration("REDIS_CLAIM_IDLE", defaultRedisClaimIdle),
+
 		CompositeProviders: getCompositeProviders(),
 		CompositeStrategy:  getEnv("COMPOSITE_STRATEGY", "fail-fast"),
+
+		CompositeSubscribeMode: getEnv("COMPOSITE_SUBSCRIBE_MODE", "first"),
+		CompositeDedupWindow:   getEnvAsDuration("COMPOSITE_DEDUP_WINDOW", defaultCompositeDedupWindow),
+
+		BreakerErrorRate:   getEnvAsFloat("BREAKER_ERROR_RATE", defaultBreakerErrorRate),
+		BreakerLatency:     getEnvAsDuration("BREAKER_LATENCY", defaultBreakerLatency),
+		BreakerOpenTimeout: getEnvAsDuration("BREAKER_OPEN_TIMEOUT", defaultBreakerOpenTimeout),
+
+		MigrationDualWrite:     getEnvAsDuration("MIGRATION_DUAL_WRITE", defaultMigrationDualWrite),
+		MigrationCheckInterval: getEnvAsDuration("MIGRATION_CHECK_INTERVAL", defaultMigrationCheck),
+		MigrationDrainTimeout:  getEnvAsDuration("MIGRATION_DRAIN_TIMEOUT", defaultMigrationDrain),
 	}
 }
 
@@ -79,6 +238,88 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+		return value
+	}
+
+	return defaultValue
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseBool(valueStr); err == nil {
+		return value
+	}
+
+	return defaultValue
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	valueStr := getEnv(key, "")
+	if value, err := time.ParseDuration(valueStr); err == nil {
+		return value
+	}
+
+	return defaultValue
+}
+
+// getEnvAsIntSlice разбирает список чисел через ","; при ошибке возвращает nil.
+func getEnvAsIntSlice(key string) []int {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return nil
+	}
+
+	parts := strings.Split(valueStr, ",")
+	values := make([]int, 0, len(parts))
+
+	for _, part := range parts {
+		value, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil
+		}
+
+		values = append(values, value)
+	}
+
+	return values
+}
+
+// getEnvAsStringSlice разбирает список строк через ","; пустые элементы пропускаются.
+func getEnvAsStringSlice(key string) []string {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return nil
+	}
+
+	parts := strings.Split(valueStr, ",")
+	values := make([]string, 0, len(parts))
+
+	for _, part := range parts {
+		if value := strings.TrimSpace(part); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// getEnvAsStringMap разбирает список пар "ключ=значение" через ","; элементы без "=" пропускаются.
+func getEnvAsStringMap(key string) map[string]string {
+	values := make(map[string]string)
+
+	for _, part := range getEnvAsStringSlice(key) {
+		name, value, ok := strings.Cut(part, "=")
+		if name = strings.TrimSpace(name); ok && name != "" {
+			values[name] = strings.TrimSpace(value)
+		}
+	}
+
+	return values
+}
+
 func getKafkaBrokers() []string {
 	brokers := getEnv("KAFKA_BROKERS", "localhost:9092")
 
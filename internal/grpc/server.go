@@ -10,6 +10,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/stsolovey/diplom-distributed-system/internal/client"
 	"github.com/stsolovey/diplom-distributed-system/internal/models"
+	"github.com/stsolovey/diplom-distributed-system/internal/queue"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -27,12 +28,9 @@ func NewIngestServer(processorURL string) *IngestServer {
 }
 
 func (s *IngestServer) Ingest(ctx context.Context, req *IngestRequest) (*IngestResponse, error) {
-	msg := &models.DataMessage{
-		Id:        uuid.New().String(),
-		Timestamp: time.Now().Unix(),
-		Source:    req.GetSource(),
-		Payload:   req.GetData(),
-		Metadata:  req.GetMetadata(),
+	msg, err := newDataMessage(req)
+	if err != nil {
+		return nil, err
 	}
 
 	if err := s.processorClient.SendMessage(ctx, msg); err != nil {
@@ -61,12 +59,9 @@ func (s *IngestServer) IngestStream(stream grpc.ClientStreamingServer[IngestRequ
 			return fmt.Errorf("stream receive failed: %w", err)
 		}
 
-		msg := &models.DataMessage{
-			Id:        uuid.New().String(),
-			Timestamp: time.Now().Unix(),
-			Source:    req.GetSource(),
-			Payload:   req.GetData(),
-			Metadata:  req.GetMetadata(),
+		msg, err := newDataMessage(req)
+		if err != nil {
+			return err
 		}
 
 		if err := s.processorClient.SendMessage(stream.Context(), msg); err != nil {
@@ -76,3 +71,22 @@ func (s *IngestServer) IngestStream(stream grpc.ClientStreamingServer[IngestRequ
 		processed++
 	}
 }
+
+// newDataMessage создает сообщение из запроса; delay_ms откладывает его доставку.
+func newDataMessage(req *IngestRequest) (*models.DataMessage, error) {
+	if req.GetDelayMs() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "delay_ms must not be negative: %d", req.GetDelayMs())
+	}
+
+	msg := &models.DataMessage{
+		Id:        uuid.New().String(),
+		Timestamp: time.Now().Unix(),
+		Source:    req.GetSource(),
+		Payload:   req.GetData(),
+		Metadata:  req.GetMetadata(),
+	}
+
+	queue.SetDelay(msg, time.Duration(req.GetDelayMs())*time.Millisecond)
+
+	return msg, nil
+}
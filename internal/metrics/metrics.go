@@ -57,6 +57,52 @@ var (
 		},
 	)
 
+	ProcessorQueueShardSize = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "processor_queue_shard_size",
+			Help: "Depth of each shard of the sharded in-memory queue",
+		},
+		[]string{"shard"},
+	)
+
+	ProcessorQueueConsumerMessages = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "processor_queue_consumer_messages",
+			Help: "Messages of the broker consumer by state (pending, ack_pending, redelivered)",
+		},
+		[]string{"state"},
+	)
+
+	ProcessorQueuePartitionLag = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "processor_queue_partition_lag",
+			Help: "Kafka consumer group lag per partition",
+		},
+		[]string{"topic", "partition"},
+	)
+
+	ProcessorQueueBreakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "processor_queue_breaker_state",
+			Help: "Circuit breaker state of composite queue providers (0 - closed, 1 - open, 2 - half-open)",
+		},
+		[]string{"provider"},
+	)
+
+	ProcessorQueueFailoversTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "processor_queue_failovers_total",
+			Help: "Total number of messages published to a secondary composite queue provider",
+		},
+	)
+
+	ProcessorQueueDroppedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "processor_queue_dropped_total",
+			Help: "Total number of messages dropped by the in-memory queue overflow policy",
+		},
+	)
+
 	ProcessorProcessingDuration = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "processor_processing_duration_seconds",
@@ -67,6 +113,43 @@ var (
 	)
 )
 
+// Метрики сжатия сообщений очередей
+var (
+	QueueCompressionRatio = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "queue_compression_ratio",
+			Help:    "Ratio of compressed to original message size",
+			Buckets: prometheus.LinearBuckets(0.1, 0.1, 10), //nolint:mnd // 0.1..1.0
+		},
+		[]string{"algorithm"},
+	)
+
+	QueueCompressionBytesSaved = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "queue_compression_bytes_saved_total",
+			Help: "Total number of bytes saved by compressing queue messages",
+		},
+		[]string{"algorithm"},
+	)
+)
+
+// QueueNATSAsyncPublishErrors - асинхронные публикации NATS, не получившие ACK.
+var QueueNATSAsyncPublishErrors = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Name: "queue_nats_async_publish_errors_total",
+		Help: "Total number of asynchronous NATS publishes that failed to be acknowledged",
+	},
+)
+
+// Метрики маршрутизации сообщений
+var QueueRoutedMessagesTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "queue_routed_messages_total",
+		Help: "Total number of messages published by routing rules",
+	},
+	[]string{"route", "status"},
+)
+
 // Метрики для API Gateway
 var (
 	GatewayRequestsTotal = promauto.NewCounterVec(
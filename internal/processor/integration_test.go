@@ -2,6 +2,7 @@ package processor
 
 import (
 	"context"
+	"strconv"
 	"testing"
 	"time"
 
@@ -12,7 +13,7 @@ import (
 )
 
 // setupNATSContainer запускает контейнер NATS для тестов и возвращает URL для подключения.
-func setupNATSContainer(t *testing.T) string {
+func setupNATSContainer(t testing.TB) string {
 	t.Helper()
 
 	ctx := context.Background()
@@ -151,6 +152,58 @@ func TestWorkerPool_WithNATS(t *testing.T) {
 		adapterStats.TotalEnqueued, adapterStats.TotalDequeued, adapterStats.CurrentSize)
 }
 
+// TestWorkerPool_WithEmbeddedNATS проверяет тот же путь через JetStream без Docker - на встроенном nats-server.
+func TestWorkerPool_WithEmbeddedNATS(t *testing.T) {
+	srv, err := queue.StartEmbeddedNATSServer(queue.EmbeddedNATSConfig{StoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to start embedded NATS server: %v", err)
+	}
+
+	adapter, err := queue.NewEmbeddedNATSAdapter(srv, queue.NATSConfig{
+		StreamName:    "TEST_STREAM",
+		SubjectPrefix: "test",
+	}, "embedded")
+	if err != nil {
+		srv.Shutdown()
+		t.Fatalf("Failed to create embedded NATS adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	workerPool := NewWorkerPool(2, adapter)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := workerPool.Start(ctx); err != nil {
+		t.Fatalf("Failed to start worker pool: %v", err)
+	}
+	defer workerPool.Stop()
+
+	const messageCount = 5
+
+	for i := range messageCount {
+		msg := &models.DataMessage{Id: "embedded" + strconv.Itoa(i), Payload: []byte("message")}
+		if err := adapter.Publish(ctx, msg); err != nil {
+			t.Fatalf("Failed to publish message %s: %v", msg.Id, err)
+		}
+	}
+
+	for i := range messageCount {
+		select {
+		case result := <-workerPool.Results():
+			if !result.Success {
+				t.Errorf("Message %s was not processed successfully", result.MessageId)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Timeout waiting for results. Got %d/%d results", i, messageCount)
+		}
+	}
+
+	if stats := adapter.Stats(); stats.TotalDequeued != messageCount {
+		t.Errorf("Expected TotalDequeued=%d, got %d", messageCount, stats.TotalDequeued)
+	}
+}
+
 // TestWorkerPool_WithMemory базовый тест для MemoryQueue для сравнения
 func TestWorkerPool_WithMemory(t *testing.T) {
 	// Создаем MemoryQueue
@@ -205,3 +258,44 @@ func TestWorkerPool_WithMemory(t *testing.T) {
 
 	t.Logf("Memory queue integration test completed successfully")
 }
+
+// BenchmarkNATSPublish сравнивает синхронную публикацию (ACK каждого сообщения) с асинхронной (окно ACK).
+func BenchmarkNATSPublish(b *testing.B) {
+	natsEndpoint := setupNATSContainer(b)
+
+	for _, mode := range []struct {
+		name  string
+		async bool
+	}{{"sync", false}, {"async", true}} {
+		b.Run(mode.name, func(b *testing.B) {
+			cfg := queue.NATSConfig{
+				URL:             natsEndpoint,
+				StreamName:      "DIPLOM_STREAM",
+				SubjectPrefix:   "diplom",
+				AsyncPublish:    mode.async,
+				AsyncMaxPending: queue.DefaultNATSAsyncMaxPending,
+			}
+
+			adapter, err := queue.NewNATSAdapterWithConfig(cfg, "bench-"+mode.name)
+			if err != nil {
+				b.Fatalf("Failed to create NATS adapter: %v", err)
+			}
+
+			msg := &models.DataMessage{Id: "bench", Source: "benchmark", Payload: []byte("benchmark data")}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for range b.N {
+				if err := adapter.Publish(context.Background(), msg); err != nil {
+					b.Fatalf("Failed to publish: %v", err)
+				}
+			}
+
+			// Close ждет ACK всех асинхронных публикаций, поэтому входит в измерение.
+			if err := adapter.Close(); err != nil {
+				b.Fatalf("Failed to close adapter: %v", err)
+			}
+		})
+	}
+}
@@ -2,22 +2,28 @@ package processor
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
 	"time"
 
 	"github.com/stsolovey/diplom-distributed-system/internal/models"
+	"github.com/stsolovey/diplom-distributed-system/internal/queue"
 )
 
 const (
 	// resultsBufferMultiplier defines how many extra slots the results channel has per worker.
 	resultsBufferMultiplier = 2
+	// defaultRetryDelay - задержка повторной доставки после первой неудачной попытки;
+	// с каждой следующей попыткой задержка удваивается, но не превышает maxRetryDelay.
+	defaultRetryDelay = time.Second
+	maxRetryDelay     = time.Minute
 )
 
 // Subscriber интерфейс для получения сообщений.
 type Subscriber interface {
-	Subscribe(ctx context.Context) (<-chan *models.DataMessage, error)
+	Subscribe(ctx context.Context) (<-chan queue.Delivery, error)
 }
 
 // WorkerPool управляет пулом воркеров для обработки сообщений.
@@ -28,22 +34,39 @@ type WorkerPool struct {
 	results    chan *models.ProcessingResult
 	stats      Stats
 	statsMu    sync.RWMutex
-	msgChan    <-chan *models.DataMessage // канал для получения сообщений
+	msgChan    <-chan queue.Delivery // канал для получения доставок
+	handle     func(msg *models.DataMessage) *models.ProcessingResult
+	retryDelay time.Duration
+
+	// DLQ провайдера: сообщение, не обработанное за maxAttempts попыток, уходит туда.
+	deadLetters queue.DeadLetterQueue
+	maxAttempts int
 }
 
 type Stats struct {
-	ProcessedCount int64
-	ErrorCount     int64
-	TotalDuration  time.Duration
+	ProcessedCount    int64
+	ErrorCount        int64
+	DeadLetteredCount int64
+	TotalDuration     time.Duration
 }
 
 // NewWorkerPool создает новый пул воркеров с унифицированным интерфейсом.
 func NewWorkerPool(workers int, subscriber Subscriber) *WorkerPool {
-	return &WorkerPool{
+	wp := &WorkerPool{
 		workers:    workers,
 		subscriber: subscriber,
 		results:    make(chan *models.ProcessingResult, workers*resultsBufferMultiplier),
+		retryDelay: defaultRetryDelay,
+	}
+	wp.handle = wp.processMessage
+
+	// Если провайдер поддерживает DLQ, исчерпавшие попытки сообщения отправляются в нее.
+	if dlp, ok := subscriber.(queue.DeadLetterProvider); ok && dlp.DeadLetters() != nil {
+		wp.deadLetters = dlp.DeadLetters()
+		wp.maxAttempts = dlp.MaxAttempts()
 	}
+
+	return wp
 }
 
 // Start запускает воркеры.
@@ -71,12 +94,12 @@ func (wp *WorkerPool) runWorker(ctx context.Context, workerID int) {
 	log.Printf("Worker %d started", workerID)
 
 	for {
-		var msg *models.DataMessage
+		var delivery queue.Delivery
 
 		// Получаем сообщение из канала подписки
 		select {
-		case msg = <-wp.msgChan:
-			if msg == nil {
+		case delivery = <-wp.msgChan:
+			if delivery == nil {
 				log.Printf("Worker %d stopping - channel closed", workerID)
 
 				return
@@ -87,16 +110,118 @@ func (wp *WorkerPool) runWorker(ctx context.Context, workerID int) {
 			return
 		}
 
-		result := wp.processMessage(msg)
+		result := wp.handle(delivery.Message())
 
 		select {
 		case wp.results <- result:
 		case <-ctx.Done():
+			// Результат не передан дальше - возвращаем сообщение в очередь.
+			if err := delivery.Nack(0); err != nil {
+				log.Printf("Worker %d failed to nack message %s: %v", workerID, result.GetMessageId(), err)
+			}
+
 			log.Printf("Worker %d stopping", workerID)
 
 			return
 		}
+
+		wp.settle(ctx, workerID, delivery, result)
+	}
+}
+
+// settle подтверждает доставку после получения результата:
+// успешная обработка - Ack, неудачная - Nack с экспоненциальной задержкой повторной доставки,
+// а после исчерпания попыток - перенос в DLQ.
+func (wp *WorkerPool) settle(
+	ctx context.Context,
+	workerID int,
+	delivery queue.Delivery,
+	result *models.ProcessingResult,
+) {
+	if result.GetSuccess() {
+		if err := wp.ack(ctx, delivery, result); err != nil {
+			log.Printf("Worker %d failed to ack message %s: %v", workerID, result.GetMessageId(), err)
+		}
+
+		return
+	}
+
+	if wp.deadLetters != nil && delivery.Attempt() >= wp.maxAttempts {
+		err := wp.deadLetter(ctx, delivery, result)
+		if err == nil {
+			return
+		}
+
+		log.Printf("Worker %d failed to dead-letter message %s: %v", workerID, result.GetMessageId(), err)
+	}
+
+	nackErr := delivery.Nack(wp.retryBackoff(delivery.Attempt()))
+	if nackErr == nil {
+		return
+	}
+
+	log.Printf("Worker %d failed to nack message %s: %v", workerID, result.GetMessageId(), nackErr)
+
+	// Сообщение не вернулось в очередь (например, очередь отложенных переполнена) - сохраняем его в DLQ.
+	if wp.deadLetters != nil && errors.Is(nackErr, queue.ErrRequeueFailed) {
+		if err := wp.deadLetter(ctx, delivery, result); err != nil {
+			log.Printf("Worker %d failed to dead-letter message %s: %v", workerID, result.GetMessageId(), err)
+		}
+	}
+}
+
+// ack подтверждает доставку; если провайдер умеет публиковать результат вместе с подтверждением
+// (транзакционный Kafka), результат публикуется атомарно с фиксацией offset'а.
+func (wp *WorkerPool) ack(ctx context.Context, delivery queue.Delivery, result *models.ProcessingResult) error {
+	var err error
+
+	if acker, ok := delivery.(queue.ResultAcknowledger); ok {
+		err = acker.AckWithResult(ctx, result)
+	} else {
+		err = delivery.Ack()
+	}
+
+	if err != nil {
+		return fmt.Errorf("ack failed: %w", err)
+	}
+
+	return nil
+}
+
+// retryBackoff возвращает экспоненциальную задержку повторной доставки после попытки attempt.
+func (wp *WorkerPool) retryBackoff(attempt int) time.Duration {
+	delay := wp.retryDelay
+
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
 	}
+
+	return min(delay, maxRetryDelay)
+}
+
+// deadLetter сохраняет сообщение в DLQ и окончательно отклоняет доставку.
+func (wp *WorkerPool) deadLetter(ctx context.Context, delivery queue.Delivery, result *models.ProcessingResult) error {
+	dl := &queue.DeadLetter{
+		Message:   delivery.Message(),
+		LastError: result.GetError(),
+		Attempts:  delivery.Attempt(),
+		FailedAt:  time.Now(),
+	}
+
+	if err := wp.deadLetters.Put(ctx, dl); err != nil {
+		return fmt.Errorf("failed to put message to dead-letter queue: %w", err)
+	}
+
+	wp.statsMu.Lock()
+	wp.stats.DeadLetteredCount++
+	wp.statsMu.Unlock()
+
+	// Сообщение уже в DLQ: ошибку Term только логируем, чтобы не вернуть его в очередь.
+	if err := delivery.Term(); err != nil {
+		log.Printf("Failed to term dead-lettered message %s: %v", dl.Message.GetId(), err)
+	}
+
+	return nil
 }
 
 // processMessage обрабатывает одно сообщение.
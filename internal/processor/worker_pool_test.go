@@ -60,6 +60,274 @@ func TestWorkerPool_ProcessMessages(t *testing.T) {
 	}
 }
 
+// recordingDelivery запоминает, как была завершена доставка.
+type recordingDelivery struct {
+	msg     *models.DataMessage
+	settled chan string
+}
+
+func (d *recordingDelivery) Message() *models.DataMessage { return d.msg }
+func (d *recordingDelivery) Attempt() int                 { return 1 }
+func (d *recordingDelivery) Ack() error                   { d.settled <- "ack"; return nil }
+func (d *recordingDelivery) Nack(time.Duration) error     { d.settled <- "nack"; return nil }
+func (d *recordingDelivery) InProgress() error            { return nil }
+func (d *recordingDelivery) Term() error                  { d.settled <- "term"; return nil }
+
+type channelSubscriber chan queue.Delivery
+
+func (s channelSubscriber) Subscribe(context.Context) (<-chan queue.Delivery, error) {
+	return s, nil
+}
+
+func TestWorkerPool_SettlesAfterResult(t *testing.T) {
+	deliveries := make(channelSubscriber, 2)
+	pool := NewWorkerPool(1, deliveries)
+	pool.handle = func(msg *models.DataMessage) *models.ProcessingResult {
+		return &models.ProcessingResult{MessageId: msg.GetId(), Success: msg.GetId() == "ok"}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := pool.Start(ctx); err != nil {
+		t.Fatalf("Failed to start pool: %v", err)
+	}
+
+	settled := make(chan string, 2)
+	deliveries <- &recordingDelivery{msg: &models.DataMessage{Id: "ok"}, settled: settled}
+	deliveries <- &recordingDelivery{msg: &models.DataMessage{Id: "fail"}, settled: settled}
+
+	for _, want := range []string{"ack", "nack"} {
+		select {
+		case result := <-pool.Results():
+			if got := <-settled; got != want {
+				t.Errorf("Message %s: expected %s, got %s", result.GetMessageId(), want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for result")
+		}
+	}
+}
+
+// resultDelivery подтверждается вместе с результатом, как транзакционный Kafka.
+type resultDelivery struct {
+	recordingDelivery
+
+	result *models.ProcessingResult
+}
+
+func (d *resultDelivery) AckWithResult(_ context.Context, result *models.ProcessingResult) error {
+	d.result = result
+	d.settled <- "ack-with-result"
+
+	return nil
+}
+
+func TestWorkerPool_AcksWithResult(t *testing.T) {
+	deliveries := make(channelSubscriber, 1)
+	pool := NewWorkerPool(1, deliveries)
+	pool.handle = func(msg *models.DataMessage) *models.ProcessingResult {
+		return &models.ProcessingResult{MessageId: msg.GetId(), Success: true}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := pool.Start(ctx); err != nil {
+		t.Fatalf("Failed to start pool: %v", err)
+	}
+
+	settled := make(chan string, 1)
+	delivery := &resultDelivery{recordingDelivery: recordingDelivery{msg: &models.DataMessage{Id: "ok"}, settled: settled}}
+	deliveries <- delivery
+
+	select {
+	case <-pool.Results():
+		if got := <-settled; got != "ack-with-result" {
+			t.Fatalf("Expected ack-with-result, got %s", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timeout waiting for result")
+	}
+
+	if delivery.result.GetMessageId() != "ok" {
+		t.Fatalf("Expected result for ok, got %+v", delivery.result)
+	}
+}
+
+// unrequeuableDelivery не может вернуться в очередь, как in-memory доставка при переполненной очереди.
+type unrequeuableDelivery struct {
+	recordingDelivery
+}
+
+func (d *unrequeuableDelivery) Nack(time.Duration) error {
+	d.settled <- "nack"
+
+	return queue.ErrRequeueFailed
+}
+
+func TestWorkerPool_DeadLettersUnrequeuableMessages(t *testing.T) {
+	deliveries := make(channelSubscriber, 1)
+	pool := NewWorkerPool(1, deliveries)
+	pool.deadLetters = queue.NewMemoryDeadLetterQueue(10)
+	pool.maxAttempts = 5
+	pool.handle = func(msg *models.DataMessage) *models.ProcessingResult {
+		return &models.ProcessingResult{MessageId: msg.GetId(), Error: "boom"}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := pool.Start(ctx); err != nil {
+		t.Fatalf("Failed to start pool: %v", err)
+	}
+
+	settled := make(chan string, 2)
+	deliveries <- &unrequeuableDelivery{recordingDelivery{msg: &models.DataMessage{Id: "lost"}, settled: settled}}
+
+	<-pool.Results()
+
+	for _, want := range []string{"nack", "term"} {
+		select {
+		case got := <-settled:
+			if got != want {
+				t.Fatalf("Expected %s, got %s", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %s", want)
+		}
+	}
+
+	entries, err := pool.deadLetters.List(ctx, 0)
+	if err != nil || len(entries) != 1 || entries[0].Message.GetId() != "lost" {
+		t.Fatalf("Expected message in dead-letter queue, got %v (%v)", entries, err)
+	}
+}
+
+func TestWorkerPool_DeadLettersExhaustedMessages(t *testing.T) {
+	adapter := queue.NewMemoryAdapter(10)
+	defer adapter.Close()
+
+	pool := NewWorkerPool(1, adapter)
+	pool.retryDelay = time.Millisecond
+	pool.handle = func(msg *models.DataMessage) *models.ProcessingResult {
+		return &models.ProcessingResult{MessageId: msg.GetId(), Error: "boom"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := pool.Start(ctx); err != nil {
+		t.Fatalf("Failed to start pool: %v", err)
+	}
+
+	go func() {
+		for range pool.Results() {
+		}
+	}()
+
+	if err := adapter.Publish(ctx, &models.DataMessage{Id: "poison"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	for {
+		entries, err := adapter.DeadLetters().List(ctx, 0)
+		if err != nil {
+			t.Fatalf("Failed to list dead letters: %v", err)
+		}
+
+		if len(entries) == 1 {
+			dl := entries[0]
+			if dl.Message.GetId() != "poison" || dl.LastError != "boom" || dl.Attempts != adapter.MaxAttempts() {
+				t.Errorf("Unexpected dead letter: %+v", dl)
+			}
+
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Timeout waiting for dead letter, pool stats: %+v", pool.GetStats())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestWorkerPool_DeadLettersThroughMultiSubscriber(t *testing.T) {
+	adapter := queue.NewMemoryAdapter(10)
+	defer adapter.Close()
+
+	broker := queue.NewMemoryBroker(10)
+	if err := broker.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer broker.Disconnect()
+
+	orders, err := broker.CreateSubscriber("orders")
+	if err != nil {
+		t.Fatalf("Failed to create subscriber: %v", err)
+	}
+
+	// Как при PROCESSOR_SUBJECTS: воркеры читают очередь и дополнительный subject брокера.
+	pool := NewWorkerPool(1, queue.NewMultiSubscriber(adapter, orders))
+	pool.retryDelay = time.Millisecond
+	pool.handle = func(msg *models.DataMessage) *models.ProcessingResult {
+		return &models.ProcessingResult{MessageId: msg.GetId(), Error: "boom"}
+	}
+
+	if pool.deadLetters == nil || pool.maxAttempts != adapter.MaxAttempts() {
+		t.Fatalf("Expected DLQ of the queue provider, got %v (max attempts %d)", pool.deadLetters, pool.maxAttempts)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := pool.Start(ctx); err != nil {
+		t.Fatalf("Failed to start pool: %v", err)
+	}
+
+	go func() {
+		for range pool.Results() {
+		}
+	}()
+
+	if err := adapter.Publish(ctx, &models.DataMessage{Id: "poison"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	for {
+		entries, err := adapter.DeadLetters().List(ctx, 0)
+		if err != nil {
+			t.Fatalf("Failed to list dead letters: %v", err)
+		}
+
+		if len(entries) == 1 && entries[0].Message.GetId() == "poison" {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Timeout waiting for dead letter, pool stats: %+v", pool.GetStats())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestWorkerPool_RetryBackoff(t *testing.T) {
+	pool := NewWorkerPool(1, channelSubscriber(nil))
+
+	for attempt, want := range map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		4:  8 * time.Second,
+		10: maxRetryDelay,
+	} {
+		if got := pool.retryBackoff(attempt); got != want {
+			t.Errorf("Attempt %d: expected %v, got %v", attempt, want, got)
+		}
+	}
+}
+
 func BenchmarkWorkerPool(b *testing.B) {
 	// Создаем контекст с отменой
 	ctx, cancel := context.WithCancel(context.Background())
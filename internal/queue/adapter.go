@@ -9,16 +9,16 @@ import (
 // MemoryAdapter адаптирует MemoryQueue для использования через интерфейсы.
 // Это позволит легко заменить на NATS в Фазе 2.
 type MemoryAdapter struct {
-	queue *MemoryQueue
+	queue       *MemoryQueue
+	deadLetters *MemoryDeadLetterQueue
 }
 
-const memoryAdapterBufferSize = 100
-
 // revive:disable:ireturn
 // NewMemoryAdapter создает новый адаптер.
 func NewMemoryAdapter(size int) *MemoryAdapter {
 	return &MemoryAdapter{
-		queue: NewMemoryQueue(size),
+		queue:       NewMemoryQueue(size),
+		deadLetters: NewMemoryDeadLetterQueue(memoryDeadLetterQueueSize),
 	}
 }
 
@@ -29,30 +29,30 @@ func (a *MemoryAdapter) Publish(ctx context.Context, msg *models.DataMessage) er
 	return a.queue.Publish(ctx, msg)
 }
 
-// Subscribe реализует интерфейс Subscriber.
-// Для MemoryQueue используем простой подход через канал.
-func (a *MemoryAdapter) Subscribe(ctx context.Context) (<-chan *models.DataMessage, error) {
-	msgChan := make(chan *models.DataMessage, memoryAdapterBufferSize)
+// PublishBatch реализует интерфейс BatchPublisher.
+func (a *MemoryAdapter) PublishBatch(ctx context.Context, msgs []*models.DataMessage) []error {
+	return a.queue.PublishBatch(ctx, msgs)
+}
 
-	// Запускаем горутину для чтения из очереди.
-	go func() {
-		defer close(msgChan)
+// SetOverflow задает политику переполнения очереди.
+func (a *MemoryAdapter) SetOverflow(cfg OverflowConfig) error {
+	return a.queue.SetOverflow(cfg)
+}
 
-		for {
-			msg, err := a.queue.Dequeue(ctx)
-			if err != nil {
-				return
-			}
+// Subscribe реализует интерфейс Subscriber.
+// Доставки подтверждаются через Delivery: Nack возвращает сообщение в MemoryQueue.
+func (a *MemoryAdapter) Subscribe(ctx context.Context) (<-chan Delivery, error) {
+	return a.queue.Subscribe(ctx)
+}
 
-			select {
-			case msgChan <- msg:
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
+// DeadLetters реализует интерфейс DeadLetterProvider.
+func (a *MemoryAdapter) DeadLetters() DeadLetterQueue { //nolint:ireturn // interface by design
+	return a.deadLetters
+}
 
-	return msgChan, nil
+// MaxAttempts реализует интерфейс DeadLetterProvider.
+func (a *MemoryAdapter) MaxAttempts() int {
+	return defaultMaxDeliveryAttempts
 }
 
 // Stats возвращает статистику.
@@ -0,0 +1,37 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+// PublishBatch публикует пачку через BatchPublisher, а если publisher пачки не поддерживает -
+// по одному сообщению. Результат содержит ошибку каждого сообщения по его индексу.
+func PublishBatch(ctx context.Context, publisher Publisher, msgs []*models.DataMessage) []error {
+	if batcher, ok := publisher.(BatchPublisher); ok {
+		return batcher.PublishBatch(ctx, msgs)
+	}
+
+	return publishEach(ctx, publisher, msgs)
+}
+
+// publishEach публикует сообщения пачки по одному.
+func publishEach(ctx context.Context, publisher Publisher, msgs []*models.DataMessage) []error {
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		errs[i] = publisher.Publish(ctx, msg)
+	}
+
+	return errs
+}
+
+// failBatch возвращает одну и ту же ошибку для всех сообщений пачки.
+func failBatch(n int, err error) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+
+	return errs
+}
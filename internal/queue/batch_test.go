@@ -0,0 +1,187 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func batchOf(n int) []*models.DataMessage {
+	msgs := make([]*models.DataMessage, n)
+	for i := range msgs {
+		msgs[i] = &models.DataMessage{Id: strconv.Itoa(i)}
+	}
+
+	return msgs
+}
+
+func TestMemoryQueue_PublishBatchReportsOverflowPerMessage(t *testing.T) {
+	q := NewMemoryQueue(2)
+	defer q.Close()
+
+	errs := q.PublishBatch(context.Background(), batchOf(3))
+
+	if errs[0] != nil || errs[1] != nil {
+		t.Fatalf("Expected first two messages to be enqueued, got %v", errs)
+	}
+
+	if !errors.Is(errs[2], ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull for the third message, got %v", errs[2])
+	}
+
+	if stats := q.Stats(); stats.TotalEnqueued != 2 {
+		t.Errorf("Expected 2 enqueued messages, got %d", stats.TotalEnqueued)
+	}
+}
+
+func TestPriorityQueue_PublishBatch(t *testing.T) {
+	q, err := NewPriorityQueue(PriorityConfig{Levels: 2, Weights: []int{1, 1}, LevelSize: 1})
+	if err != nil {
+		t.Fatalf("Failed to create priority queue: %v", err)
+	}
+	defer q.Close()
+
+	errs := q.PublishBatch(context.Background(), batchOf(2))
+
+	if errs[0] != nil || !errors.Is(errs[1], ErrQueueFull) {
+		t.Errorf("Expected [nil, ErrQueueFull], got %v", errs)
+	}
+}
+
+func TestWALQueue_PublishBatchSurvivesReopen(t *testing.T) {
+	cfg := WALConfig{Dir: t.TempDir(), SegmentSize: 64, SyncPolicy: WALSyncAlways}
+
+	q, err := NewWALQueue(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open WAL queue: %v", err)
+	}
+
+	for i, err := range q.PublishBatch(context.Background(), batchOf(5)) {
+		if err != nil {
+			t.Fatalf("Failed to publish message %d: %v", i, err)
+		}
+	}
+
+	if err := q.Close(); err != nil {
+		t.Fatalf("Failed to close WAL queue: %v", err)
+	}
+
+	q, err = NewWALQueue(cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen WAL queue: %v", err)
+	}
+	defer q.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	deliveries, err := q.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	for i := range 5 {
+		select {
+		case delivery := <-deliveries:
+			if delivery.Message().GetId() != strconv.Itoa(i) {
+				t.Errorf("Expected message %d, got %s", i, delivery.Message().GetId())
+			}
+
+			_ = delivery.Ack()
+		case <-ctx.Done():
+			t.Fatalf("Timeout waiting for message %d", i)
+		}
+	}
+}
+
+func TestCompositeAdapter_PublishBatchFailFast(t *testing.T) {
+	healthy := &MockProvider{}
+	failing := &MockProvider{publishError: errors.New("provider down")}
+
+	composite := NewCompositeAdapter([]Provider{healthy, failing}, FailFast)
+
+	for i, err := range composite.PublishBatch(context.Background(), batchOf(2)) {
+		if err == nil {
+			t.Errorf("Expected error for message %d", i)
+		}
+	}
+
+	if len(healthy.messages) != 2 {
+		t.Errorf("Expected healthy provider to receive 2 messages, got %d", len(healthy.messages))
+	}
+}
+
+func TestCompositeAdapter_PublishBatchBestEffort(t *testing.T) {
+	healthy := &MockProvider{}
+	failing := &MockProvider{publishError: errors.New("provider down")}
+
+	composite := NewCompositeAdapter([]Provider{healthy, failing}, BestEffort)
+
+	for i, err := range composite.PublishBatch(context.Background(), batchOf(2)) {
+		if err != nil {
+			t.Errorf("Expected no error for message %d in best-effort mode, got %v", i, err)
+		}
+	}
+}
+
+func TestCompositeAdapter_PublishBatchFailover(t *testing.T) {
+	primary := &MockProvider{publishError: errors.New("primary down")}
+	secondary := &MockProvider{}
+
+	composite := NewFailoverCompositeAdapter([]Provider{primary, secondary}, CircuitBreakerConfig{
+		Window:             1,
+		MinRequests:        1,
+		ErrorRateThreshold: 1,
+		OpenTimeout:        time.Minute,
+	})
+
+	// Ошибка пачки размыкает предохранитель основного провайдера, и пачка уходит на резервный.
+	for i, err := range composite.PublishBatch(context.Background(), batchOf(3)) {
+		if err != nil {
+			t.Errorf("Expected message %d to fail over, got %v", i, err)
+		}
+	}
+
+	if len(secondary.messages) != 3 {
+		t.Errorf("Expected secondary provider to receive 3 messages, got %d", len(secondary.messages))
+	}
+
+	if stats := composite.Stats(); stats.Failovers != 3 {
+		t.Errorf("Expected 3 failovers, got %d", stats.Failovers)
+	}
+}
+
+func TestRouter_PublishBatch(t *testing.T) {
+	broker := NewMemoryBroker(1)
+	if err := broker.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer broker.Disconnect()
+
+	table := RoutingTable{Routes: []Route{{Name: "odd", Subject: "odd", Metadata: map[string]string{"odd": ""}}}}
+
+	fallback := NewMemoryAdapter(1)
+	defer fallback.Close()
+
+	router, err := NewRouter(table, broker, fallback)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	msgs := batchOf(3)
+	msgs[1].Metadata = map[string]string{"odd": "true"}
+
+	errs := PublishBatch(context.Background(), router, msgs)
+
+	if errs[0] != nil || errs[1] != nil {
+		t.Errorf("Expected messages 0 and 1 to be routed, got %v", errs)
+	}
+
+	if !errors.Is(errs[2], ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull for message 2, got %v", errs[2])
+	}
+}
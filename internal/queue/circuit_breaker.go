@@ -0,0 +1,241 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a provider circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed - calls go through, results are tracked.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen - calls are rejected until OpenTimeout passes.
+	BreakerOpen
+	// BreakerHalfOpen - a limited number of probe calls decide whether to close or reopen.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerConfig configures a per-provider circuit breaker.
+type CircuitBreakerConfig struct {
+	// Window is the number of recent calls the error rate is computed over.
+	Window int
+	// MinRequests is the number of calls in the window required before the breaker can open.
+	MinRequests int
+	// ErrorRateThreshold opens the breaker when the share of failed calls reaches it (0..1].
+	ErrorRateThreshold float64
+	// LatencyThreshold counts successful calls slower than it as failures; 0 disables the check.
+	LatencyThreshold time.Duration
+	// OpenTimeout is how long the breaker stays open before probing the provider.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of successful probes required to close the breaker.
+	HalfOpenProbes int
+}
+
+// DefaultCircuitBreakerConfig returns the breaker settings used when none are configured.
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		Window:             20,
+		MinRequests:        5,
+		ErrorRateThreshold: 0.5,
+		LatencyThreshold:   time.Second,
+		OpenTimeout:        10 * time.Second,
+		HalfOpenProbes:     1,
+	}
+}
+
+// BreakerStats is a snapshot of a provider circuit breaker.
+type BreakerStats struct {
+	Provider  string
+	State     string
+	ErrorRate float64
+	Opened    int64 // how many times the breaker has opened
+}
+
+// circuitBreaker tracks the outcome of the last Window calls of one provider.
+type circuitBreaker struct {
+	mu  sync.Mutex
+	cfg CircuitBreakerConfig
+	now func() time.Time
+
+	state    BreakerState
+	outcomes []bool // ring buffer: true - failed call
+	next     int
+	count    int
+	failures int
+
+	openedAt       time.Time
+	probes         int // probes in flight in half-open state
+	probeSuccesses int
+	opened         int64
+}
+
+func newCircuitBreaker(cfg CircuitBreakerConfig) *circuitBreaker {
+	defaults := DefaultCircuitBreakerConfig()
+
+	if cfg.Window <= 0 {
+		cfg.Window = defaults.Window
+	}
+
+	if cfg.MinRequests <= 0 || cfg.MinRequests > cfg.Window {
+		cfg.MinRequests = min(defaults.MinRequests, cfg.Window)
+	}
+
+	if cfg.ErrorRateThreshold <= 0 || cfg.ErrorRateThreshold > 1 {
+		cfg.ErrorRateThreshold = defaults.ErrorRateThreshold
+	}
+
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = defaults.OpenTimeout
+	}
+
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = defaults.HalfOpenProbes
+	}
+
+	return &circuitBreaker{
+		cfg:      cfg,
+		now:      time.Now,
+		outcomes: make([]bool, cfg.Window),
+	}
+}
+
+// allow reports whether a call may go through. In half-open state at most
+// HalfOpenProbes calls are let through until their results are recorded.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			return false
+		}
+
+		b.state = BreakerHalfOpen
+		b.probes = 0
+		b.probeSuccesses = 0
+	case BreakerHalfOpen:
+	}
+
+	if b.probes >= b.cfg.HalfOpenProbes {
+		return false
+	}
+
+	b.probes++
+
+	return true
+}
+
+// record registers the result of an allowed call and reports whether the breaker is open afterwards.
+func (b *circuitBreaker) record(err error, latency time.Duration) bool {
+	failed := err != nil || (b.cfg.LatencyThreshold > 0 && latency > b.cfg.LatencyThreshold)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probes--
+
+		if failed {
+			b.open()
+
+			return true
+		}
+
+		b.probeSuccesses++
+		if b.probeSuccesses >= b.cfg.HalfOpenProbes {
+			b.reset()
+		}
+
+		return false
+	case BreakerOpen:
+		// A call allowed before the breaker opened has finished; the breaker stays open.
+		return true
+	case BreakerClosed:
+	}
+
+	b.push(failed)
+
+	if b.count >= b.cfg.MinRequests && b.errorRate() >= b.cfg.ErrorRateThreshold {
+		b.open()
+
+		return true
+	}
+
+	return false
+}
+
+// push adds a call outcome to the ring buffer. Called with b.mu held.
+func (b *circuitBreaker) push(failed bool) {
+	if b.count == len(b.outcomes) {
+		if b.outcomes[b.next] {
+			b.failures--
+		}
+	} else {
+		b.count++
+	}
+
+	b.outcomes[b.next] = failed
+	if failed {
+		b.failures++
+	}
+
+	b.next = (b.next + 1) % len(b.outcomes)
+}
+
+func (b *circuitBreaker) errorRate() float64 {
+	if b.count == 0 {
+		return 0
+	}
+
+	return float64(b.failures) / float64(b.count)
+}
+
+// open moves the breaker to the open state. Called with b.mu held.
+func (b *circuitBreaker) open() {
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+	b.opened++
+}
+
+// reset closes the breaker with a clean window. Called with b.mu held.
+func (b *circuitBreaker) reset() {
+	b.state = BreakerClosed
+	b.next = 0
+	b.count = 0
+	b.failures = 0
+	clear(b.outcomes)
+}
+
+func (b *circuitBreaker) snapshot(provider string) BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return BreakerStats{
+		Provider:  provider,
+		State:     b.state.String(),
+		ErrorRate: b.errorRate(),
+		Opened:    b.opened,
+	}
+}
@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_OpensAndRecoversThroughHalfOpen(t *testing.T) {
+	now := time.Now()
+	breaker := newCircuitBreaker(CircuitBreakerConfig{
+		Window:             4,
+		MinRequests:        2,
+		ErrorRateThreshold: 0.5,
+		OpenTimeout:        time.Second,
+		HalfOpenProbes:     1,
+	})
+	breaker.now = func() time.Time { return now }
+
+	errPublish := errors.New("publish failed")
+
+	breaker.record(nil, 0)
+
+	if !breaker.record(errPublish, 0) {
+		t.Fatal("Expected breaker to open at 50% error rate")
+	}
+
+	if breaker.allow() {
+		t.Fatal("Open breaker must reject calls")
+	}
+
+	now = now.Add(time.Second)
+
+	if !breaker.allow() {
+		t.Fatal("Expected a probe after open timeout")
+	}
+
+	if breaker.allow() {
+		t.Fatal("Only one probe may be in flight")
+	}
+
+	if breaker.record(nil, 0) {
+		t.Fatal("Successful probe must close the breaker")
+	}
+
+	if stats := breaker.snapshot("p"); stats.State != "closed" || stats.Opened != 1 {
+		t.Fatalf("Unexpected breaker stats: %+v", stats)
+	}
+}
+
+func TestCircuitBreaker_SlowCallsCountAsFailures(t *testing.T) {
+	breaker := newCircuitBreaker(CircuitBreakerConfig{
+		Window:             2,
+		MinRequests:        2,
+		ErrorRateThreshold: 1,
+		LatencyThreshold:   10 * time.Millisecond,
+	})
+
+	breaker.record(nil, time.Second)
+
+	if !breaker.record(nil, time.Second) {
+		t.Fatal("Expected breaker to open on slow calls")
+	}
+}
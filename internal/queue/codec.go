@@ -0,0 +1,167 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// codecHeader - заголовок NATS-сообщения / Kafka-записи с именем кодека тела.
+	codecHeader = "codec"
+
+	ProtobufCodecName  = "protobuf"
+	ProtoJSONCodecName = "protojson"
+	JSONCodecName      = "json"
+
+	// DefaultCodecName - кодек, которым публикуют NATS и Kafka, если другой не задан.
+	DefaultCodecName = ProtobufCodecName
+)
+
+var ErrUnknownCodec = errors.New("unknown codec")
+
+// Codec сериализует DataMessage для передачи через брокер.
+type Codec interface {
+	Name() string
+	Marshal(msg *models.DataMessage) ([]byte, error)
+	Unmarshal(data []byte, msg *models.DataMessage) error
+}
+
+//nolint:gochecknoglobals // registry of codecs shared by all providers
+var codecs = struct {
+	sync.RWMutex
+	byName map[string]Codec
+}{
+	byName: map[string]Codec{
+		ProtobufCodecName:  protobufCodec{},
+		ProtoJSONCodecName: protoJSONCodec{},
+		JSONCodecName:      jsonCodec{},
+	},
+}
+
+// RegisterCodec добавляет кодек в реестр (или заменяет кодек с тем же именем).
+func RegisterCodec(codec Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+
+	codecs.byName[codec.Name()] = codec
+}
+
+// LookupCodec возвращает кодек по имени.
+func LookupCodec(name string) (Codec, error) { //nolint:ireturn // registry returns interface
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	codec, ok := codecs.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCodec, name)
+	}
+
+	return codec, nil
+}
+
+// CodecNames возвращает имена зарегистрированных кодеков.
+func CodecNames() []string {
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	names := make([]string, 0, len(codecs.byName))
+	for name := range codecs.byName {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// decodeMessage декодирует тело по имени кодека из заголовка.
+// Сообщения без заголовка опубликованы до появления кодеков и закодированы в JSON.
+func decodeMessage(codecName string, data []byte, msg *models.DataMessage) error {
+	if codecName == "" {
+		codecName = JSONCodecName
+	}
+
+	codec, err := LookupCodec(codecName)
+	if err != nil {
+		return err
+	}
+
+	if err := codec.Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("failed to decode message with %s codec: %w", codecName, err)
+	}
+
+	return nil
+}
+
+// protobufCodec - бинарный protobuf, кодек по умолчанию.
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string { return ProtobufCodecName }
+
+func (protobufCodec) Marshal(msg *models.DataMessage) ([]byte, error) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal protobuf: %w", err)
+	}
+
+	return data, nil
+}
+
+func (protobufCodec) Unmarshal(data []byte, msg *models.DataMessage) error {
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("failed to unmarshal protobuf: %w", err)
+	}
+
+	return nil
+}
+
+// protoJSONCodec - каноническое JSON-представление protobuf.
+type protoJSONCodec struct{}
+
+func (protoJSONCodec) Name() string { return ProtoJSONCodecName }
+
+func (protoJSONCodec) Marshal(msg *models.DataMessage) ([]byte, error) {
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal protojson: %w", err)
+	}
+
+	return data, nil
+}
+
+func (protoJSONCodec) Unmarshal(data []byte, msg *models.DataMessage) error {
+	if err := protojson.Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("failed to unmarshal protojson: %w", err)
+	}
+
+	return nil
+}
+
+// jsonCodec - encoding/json, прежний формат NATS и Kafka.
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return JSONCodecName }
+
+func (jsonCodec) Marshal(msg *models.DataMessage) ([]byte, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal json: %w", err)
+	}
+
+	return data, nil
+}
+
+func (jsonCodec) Unmarshal(data []byte, msg *models.DataMessage) error {
+	if err := json.Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("failed to unmarshal json: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	original := &models.DataMessage{
+		Id:        "msg-1",
+		Source:    "test",
+		Payload:   []byte("payload"),
+		Timestamp: 1700000000,
+		Metadata:  map[string]string{"priority": "2"},
+	}
+
+	for _, name := range []string{ProtobufCodecName, ProtoJSONCodecName, JSONCodecName} {
+		codec, err := LookupCodec(name)
+		if err != nil {
+			t.Fatalf("Codec %s not registered: %v", name, err)
+		}
+
+		data, err := codec.Marshal(original)
+		if err != nil {
+			t.Fatalf("%s: failed to marshal: %v", name, err)
+		}
+
+		var decoded models.DataMessage
+		if err := decodeMessage(name, data, &decoded); err != nil {
+			t.Fatalf("%s: failed to decode: %v", name, err)
+		}
+
+		if decoded.GetId() != original.GetId() || string(decoded.GetPayload()) != string(original.GetPayload()) ||
+			decoded.GetMetadata()["priority"] != "2" || decoded.GetTimestamp() != original.GetTimestamp() {
+			t.Fatalf("%s: round trip mismatch: %+v", name, &decoded)
+		}
+	}
+}
+
+func TestDecodeMessage_LegacyJSONWithoutHeader(t *testing.T) {
+	data, err := json.Marshal(&models.DataMessage{Id: "legacy"})
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+
+	var msg models.DataMessage
+	if err := decodeMessage("", data, &msg); err != nil {
+		t.Fatalf("Failed to decode legacy message: %v", err)
+	}
+
+	if msg.GetId() != "legacy" {
+		t.Fatalf("Expected legacy, got %s", msg.GetId())
+	}
+
+	if err := decodeMessage("avro", data, &msg); !errors.Is(err, ErrUnknownCodec) {
+		t.Fatalf("Expected ErrUnknownCodec, got %v", err)
+	}
+}
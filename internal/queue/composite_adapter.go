@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/stsolovey/diplom-distributed-system/internal/models"
 	"golang.org/x/sync/errgroup"
@@ -21,21 +23,79 @@ const (
 	FailFast CompositeStrategy = iota
 	// BestEffort - try to write everywhere, ignore errors.
 	BestEffort
+	// Failover - write to the primary provider; fall back to the next one
+	// only while the circuit breakers of the preceding providers are open.
+	Failover
 )
 
+var ErrAllProvidersUnavailable = errors.New("all providers are unavailable")
+
 // CompositeAdapter allows writing to multiple queues simultaneously.
 type CompositeAdapter struct {
 	providers []Provider
 	strategy  CompositeStrategy
 	mu        sync.RWMutex
+
+	// dedup is set in merge mode: Subscribe consumes from all providers
+	// and suppresses copies of a message already delivered by another provider.
+	dedup      *dedupCache
+	duplicates atomic.Int64
+
+	// breakers are used by the Failover strategy, one per provider.
+	breakers  []*circuitBreaker
+	failovers atomic.Int64
 }
 
-// NewCompositeAdapter creates a new composite adapter.
+// NewCompositeAdapter creates a new composite adapter that consumes from the first provider.
+// With the Failover strategy it consumes from all providers, since messages may land on any of them.
 func NewCompositeAdapter(providers []Provider, strategy CompositeStrategy) *CompositeAdapter {
-	return &CompositeAdapter{
+	return newCompositeAdapter(providers, strategy, DefaultCircuitBreakerConfig(), 0)
+}
+
+// NewMergingCompositeAdapter creates a composite adapter that consumes from all providers
+// and de-duplicates messages by ID within dedupWindow.
+func NewMergingCompositeAdapter(
+	providers []Provider,
+	strategy CompositeStrategy,
+	dedupWindow time.Duration,
+) *CompositeAdapter {
+	if dedupWindow <= 0 {
+		dedupWindow = DefaultCompositeDedupWindow
+	}
+
+	return newCompositeAdapter(providers, strategy, DefaultCircuitBreakerConfig(), dedupWindow)
+}
+
+// NewFailoverCompositeAdapter creates a composite adapter with the Failover strategy
+// and the given circuit breaker settings for every provider.
+func NewFailoverCompositeAdapter(providers []Provider, breaker CircuitBreakerConfig) *CompositeAdapter {
+	return newCompositeAdapter(providers, Failover, breaker, 0)
+}
+
+// newCompositeAdapter creates the adapter; dedupWindow > 0 enables merge mode.
+func newCompositeAdapter(
+	providers []Provider,
+	strategy CompositeStrategy,
+	breaker CircuitBreakerConfig,
+	dedupWindow time.Duration,
+) *CompositeAdapter {
+	c := &CompositeAdapter{
 		providers: providers,
 		strategy:  strategy,
 	}
+
+	if dedupWindow > 0 {
+		c.dedup = newDedupCache(dedupWindow, compositeDedupMaxEntries)
+	}
+
+	if strategy == Failover {
+		c.breakers = make([]*circuitBreaker, len(providers))
+		for i := range providers {
+			c.breakers[i] = newCircuitBreaker(breaker)
+		}
+	}
+
+	return c
 }
 
 // Publish sends message to all configured providers.
@@ -49,6 +109,10 @@ func (c *CompositeAdapter) Publish(ctx context.Context, msg *models.DataMessage)
 		return ErrNoProvidersConfigured
 	}
 
+	if c.strategy == Failover {
+		return c.publishFailover(ctx, providers, msg)
+	}
+
 	if c.strategy == FailFast {
 		// Use errgroup for parallel writing with error handling.
 		g, groupCtx := errgroup.WithContext(ctx)
@@ -99,9 +163,180 @@ func (c *CompositeAdapter) Publish(ctx context.Context, msg *models.DataMessage)
 	return nil
 }
 
-// Subscribe returns message channel from the first provider.
-// In the future, this could merge channels from all providers.
-func (c *CompositeAdapter) Subscribe(ctx context.Context) (<-chan *models.DataMessage, error) {
+// publishFailover publishes to the first provider whose circuit breaker lets the call through.
+// An error is returned to the caller unless it opens the provider's breaker; then the next provider is tried.
+func (c *CompositeAdapter) publishFailover(ctx context.Context, providers []Provider, msg *models.DataMessage) error {
+	lastErr := ErrCircuitOpen
+
+	for i, provider := range providers {
+		breaker := c.breakers[i]
+		if !breaker.allow() {
+			continue
+		}
+
+		start := time.Now()
+		err := provider.Publish(ctx, msg)
+		opened := breaker.record(err, time.Since(start))
+
+		if err == nil {
+			if i > 0 {
+				c.failovers.Add(1)
+			}
+
+			return nil
+		}
+
+		if !opened {
+			return fmt.Errorf("failed to publish to provider %s: %w", providerName(provider), err)
+		}
+
+		log.Printf("CompositeAdapter: circuit breaker of provider %s opened: %v", providerName(provider), err)
+
+		lastErr = err
+	}
+
+	return fmt.Errorf("%w: %w", ErrAllProvidersUnavailable, lastErr)
+}
+
+// PublishBatch implements BatchPublisher with the strategy of Publish: every provider receives the whole batch,
+// and each message gets its own result.
+func (c *CompositeAdapter) PublishBatch(ctx context.Context, msgs []*models.DataMessage) []error {
+	c.mu.RLock()
+	providers := make([]Provider, len(c.providers))
+	copy(providers, c.providers)
+	c.mu.RUnlock()
+
+	if len(providers) == 0 {
+		return failBatch(len(msgs), ErrNoProvidersConfigured)
+	}
+
+	if c.strategy == Failover {
+		return c.publishBatchFailover(ctx, providers, msgs)
+	}
+
+	results := make([][]error, len(providers))
+
+	var wg sync.WaitGroup
+
+	for i, provider := range providers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			results[i] = provider.PublishBatch(ctx, msgs)
+		}()
+	}
+
+	wg.Wait()
+
+	errs := make([]error, len(msgs))
+	errorCount := 0
+
+	for _, providerErrs := range results {
+		for j, err := range providerErrs {
+			if err == nil {
+				continue
+			}
+
+			errorCount++
+
+			if c.strategy == FailFast && errs[j] == nil {
+				errs[j] = fmt.Errorf("failed to publish to all providers: %w", err)
+			}
+		}
+	}
+
+	// BestEffort strategy - log errors but don't return them.
+	if c.strategy == BestEffort && errorCount > 0 {
+		log.Printf("CompositeAdapter: %d message publishes failed during best-effort batch publish to %d providers",
+			errorCount, len(providers))
+	}
+
+	return errs
+}
+
+// publishBatchFailover publishes the batch to the first provider whose circuit breaker lets the call through.
+// Messages rejected by a provider whose breaker opened on this batch are retried on the next provider.
+func (c *CompositeAdapter) publishBatchFailover(
+	ctx context.Context,
+	providers []Provider,
+	msgs []*models.DataMessage,
+) []error {
+	errs := make([]error, len(msgs))
+
+	pending := make([]int, len(msgs))
+	for i := range pending {
+		pending[i] = i
+	}
+
+	lastErr := ErrCircuitOpen
+
+	for i, provider := range providers {
+		if len(pending) == 0 {
+			break
+		}
+
+		breaker := c.breakers[i]
+		if !breaker.allow() {
+			continue
+		}
+
+		batch := make([]*models.DataMessage, len(pending))
+		for k, j := range pending {
+			batch[k] = msgs[j]
+		}
+
+		start := time.Now()
+		results := provider.PublishBatch(ctx, batch)
+		opened := breaker.record(firstBatchErr(results), time.Since(start))
+
+		retry := make([]int, 0, len(pending))
+
+		for k, err := range results {
+			j := pending[k]
+
+			switch {
+			case err == nil:
+				if i > 0 {
+					c.failovers.Add(1)
+				}
+			case opened:
+				retry = append(retry, j)
+				lastErr = err
+			default:
+				errs[j] = fmt.Errorf("failed to publish to provider %s: %w", providerName(provider), err)
+			}
+		}
+
+		if opened {
+			log.Printf("CompositeAdapter: circuit breaker of provider %s opened: %v", providerName(provider), lastErr)
+		}
+
+		pending = retry
+	}
+
+	for _, j := range pending {
+		errs[j] = fmt.Errorf("%w: %w", ErrAllProvidersUnavailable, lastErr)
+	}
+
+	return errs
+}
+
+// firstBatchErr returns the first error of a batch, so a batch counts as one call for the circuit breaker.
+func firstBatchErr(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Subscribe returns message channel from the first provider,
+// or a merged channel of all providers in merge mode and with the Failover strategy.
+func (c *CompositeAdapter) Subscribe(ctx context.Context) (<-chan Delivery, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
@@ -109,7 +344,10 @@ func (c *CompositeAdapter) Subscribe(ctx context.Context) (<-chan *models.DataMe
 		return nil, ErrNoProvidersConfigured
 	}
 
-	// For the first version - use channel from the first provider.
+	if c.dedup != nil || c.strategy == Failover {
+		return c.subscribeMerged(ctx)
+	}
+
 	msgChan, err := c.providers[0].Subscribe(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to subscribe to first provider: %w", err)
@@ -118,6 +356,98 @@ func (c *CompositeAdapter) Subscribe(ctx context.Context) (<-chan *models.DataMe
 	return msgChan, nil
 }
 
+// subscribeMerged fans in deliveries from all providers. In merge mode a message already
+// delivered by another provider is acknowledged and dropped. Called with c.mu held.
+func (c *CompositeAdapter) subscribeMerged(ctx context.Context) (<-chan Delivery, error) {
+	channels := make([]<-chan Delivery, len(c.providers))
+
+	for i, provider := range c.providers {
+		msgChan, err := provider.Subscribe(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to subscribe to provider %d: %w", i, err)
+		}
+
+		channels[i] = msgChan
+	}
+
+	merged := make(chan Delivery)
+
+	var wg sync.WaitGroup
+
+	for i, msgChan := range channels {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for delivery := range msgChan {
+				if c.dedup != nil && c.dedup.duplicate(delivery.Message().GetId(), i) {
+					c.duplicates.Add(1)
+
+					if err := delivery.Ack(); err != nil {
+						log.Printf("CompositeAdapter: failed to ack duplicate %s: %v", delivery.Message().GetId(), err)
+					}
+
+					continue
+				}
+
+				select {
+				case merged <- delivery:
+				case <-ctx.Done():
+					// The delivery never reached a consumer: return it to its provider.
+					if err := delivery.Nack(0); err != nil {
+						log.Printf("CompositeAdapter: failed to nack %s: %v", delivery.Message().GetId(), err)
+					}
+
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	return merged, nil
+}
+
+// DeadLetters implements DeadLetterProvider.
+// The first provider's DLQ is used, in merge mode as well.
+func (c *CompositeAdapter) DeadLetters() DeadLetterQueue { //nolint:ireturn // interface by design
+	if dlp := c.deadLetterProvider(); dlp != nil {
+		return dlp.DeadLetters()
+	}
+
+	return nil
+}
+
+// MaxAttempts implements DeadLetterProvider.
+func (c *CompositeAdapter) MaxAttempts() int {
+	if dlp := c.deadLetterProvider(); dlp != nil {
+		return dlp.MaxAttempts()
+	}
+
+	return defaultMaxDeliveryAttempts
+}
+
+func (c *CompositeAdapter) deadLetterProvider() DeadLetterProvider { //nolint:ireturn // interface by design
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.providers) == 0 {
+		return nil
+	}
+
+	dlp, ok := c.providers[0].(DeadLetterProvider)
+	if !ok {
+		return nil
+	}
+
+	return dlp
+}
+
 // Stats returns aggregated statistics from all providers.
 func (c *CompositeAdapter) Stats() Stats {
 	c.mu.RLock()
@@ -130,6 +460,18 @@ func (c *CompositeAdapter) Stats() Stats {
 		aggregated.TotalEnqueued += stats.TotalEnqueued
 		aggregated.TotalDequeued += stats.TotalDequeued
 		aggregated.CurrentSize += stats.CurrentSize
+		aggregated.Pending += stats.Pending
+		aggregated.AckPending += stats.AckPending
+		aggregated.Redelivered += stats.Redelivered
+		aggregated.PartitionLag = append(aggregated.PartitionLag, stats.PartitionLag...)
+		aggregated.Dropped += stats.Dropped
+	}
+
+	aggregated.DuplicatesSuppressed = c.duplicates.Load()
+	aggregated.Failovers = c.failovers.Load()
+
+	for i, breaker := range c.breakers {
+		aggregated.Breakers = append(aggregated.Breakers, breaker.snapshot(providerName(c.providers[i])))
 	}
 
 	return aggregated
@@ -157,3 +499,33 @@ func (c *CompositeAdapter) Close() error {
 
 	return nil
 }
+
+// providerName returns a short name of the provider for logs, stats and metrics labels.
+func providerName(provider Provider) string {
+	switch provider.(type) {
+	case *MemoryAdapter:
+		return "memory"
+	case *OptimizedMemoryQueue:
+		return "memory-optimized"
+	case *RingQueue:
+		return "ring"
+	case *ShardedQueue:
+		return "sharded"
+	case *PriorityQueue:
+		return "priority"
+	case *NATSAdapter:
+		return "nats"
+	case *EmbeddedNATSAdapter:
+		return "nats-embedded"
+	case *KafkaAdapter:
+		return "kafka"
+	case *RedisQueue:
+		return "redis"
+	case *WALQueue:
+		return "wal"
+	case *CompositeAdapter:
+		return "composite"
+	default:
+		return fmt.Sprintf("%T", provider)
+	}
+}
@@ -28,14 +28,18 @@ func (m *MockProvider) Publish(ctx context.Context, msg *models.DataMessage) err
 	return nil
 }
 
-func (m *MockProvider) Subscribe(ctx context.Context) (<-chan *models.DataMessage, error) {
-	ch := make(chan *models.DataMessage, 10)
+func (m *MockProvider) PublishBatch(ctx context.Context, msgs []*models.DataMessage) []error {
+	return publishEach(ctx, m, msgs)
+}
+
+func (m *MockProvider) Subscribe(ctx context.Context) (<-chan Delivery, error) {
+	ch := make(chan Delivery, 10)
 	// Send all stored messages
 	go func() {
 		defer close(ch)
 		for _, msg := range m.messages {
 			select {
-			case ch <- msg:
+			case ch <- newMemoryDelivery(msg, 1, func(*models.DataMessage, int) error { return nil }):
 			case <-ctx.Done():
 				return
 			}
@@ -190,7 +194,8 @@ func TestCompositeAdapter_Subscribe(t *testing.T) {
 
 	// Should receive message from first adapter.
 	select {
-	case receivedMsg := <-msgChan:
+	case delivery := <-msgChan:
+		receivedMsg := delivery.Message()
 		if receivedMsg.GetId() != msg.GetId() {
 			t.Errorf("Expected message ID %s, got %s", msg.GetId(), receivedMsg.GetId())
 		}
@@ -242,3 +247,155 @@ func TestCompositeAdapter_Close(t *testing.T) {
 		t.Error("Expected mockProvider2 to be closed")
 	}
 }
+
+func TestCompositeAdapter_MergedSubscribeDeduplicates(t *testing.T) {
+	adapter1 := NewMemoryAdapter(10)
+	adapter2 := NewMemoryAdapter(10)
+
+	composite := NewMergingCompositeAdapter([]Provider{adapter1, adapter2}, FailFast, time.Minute)
+	defer composite.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	msgChan, err := composite.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	// Каждое сообщение попадает в оба провайдера.
+	for _, id := range []string{"a", "b"} {
+		if err := composite.Publish(ctx, &models.DataMessage{Id: id}); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+
+	received := map[string]int{}
+
+	for range 2 {
+		select {
+		case delivery := <-msgChan:
+			received[delivery.Message().GetId()]++
+			delivery.Ack()
+		case <-ctx.Done():
+			t.Fatal("Timeout waiting for merged delivery")
+		}
+	}
+
+	if received["a"] != 1 || received["b"] != 1 {
+		t.Fatalf("Expected each message once, got %v", received)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for composite.Stats().DuplicatesSuppressed != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 2 suppressed duplicates, got %d", composite.Stats().DuplicatesSuppressed)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case delivery := <-msgChan:
+		t.Fatalf("Unexpected duplicate delivery of %s", delivery.Message().GetId())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDedupCache_RedeliveryFromSameProviderPasses(t *testing.T) {
+	cache := newDedupCache(time.Minute, 2)
+
+	if cache.duplicate("a", 0) || cache.duplicate("a", 0) {
+		t.Fatal("Redelivery from the first provider must not be a duplicate")
+	}
+
+	if !cache.duplicate("a", 1) {
+		t.Fatal("Copy from another provider must be a duplicate")
+	}
+
+	// Лимит в 2 записи вытесняет самую старую.
+	cache.duplicate("b", 0)
+	cache.duplicate("c", 0)
+
+	if cache.duplicate("a", 1) {
+		t.Fatal("Evicted ID must not be reported as duplicate")
+	}
+}
+
+func TestDedupCache_IgnoresEmptyIDs(t *testing.T) {
+	cache := newDedupCache(time.Minute, 10)
+
+	if cache.duplicate("", 0) || cache.duplicate("", 1) {
+		t.Fatal("Messages without an ID must not be reported as duplicates")
+	}
+}
+
+func TestCompositeAdapter_MergedSubscribeNacksOnCancel(t *testing.T) {
+	adapter1 := NewMemoryAdapter(10)
+	adapter2 := NewMemoryAdapter(10)
+
+	composite := NewMergingCompositeAdapter([]Provider{adapter1, adapter2}, FailFast, time.Minute)
+	defer composite.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if _, err := composite.Subscribe(ctx); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	if err := adapter1.Publish(ctx, &models.DataMessage{Id: "held"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	// Доставку забирает горутина слияния, но потребитель ее не читает.
+	deadline := time.Now().Add(time.Second)
+	for adapter1.Stats().TotalDequeued != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timeout waiting for the merged subscription to take the delivery")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer waitCancel()
+
+	expectDelivery(waitCtx, t, adapter1, "held")
+}
+
+func TestCompositeAdapter_FailoverAfterBreakerOpens(t *testing.T) {
+	primary := &MockProvider{publishError: errors.New("primary down")}
+	secondary := &MockProvider{}
+
+	composite := NewFailoverCompositeAdapter([]Provider{primary, secondary}, CircuitBreakerConfig{
+		Window:             2,
+		MinRequests:        2,
+		ErrorRateThreshold: 1,
+		OpenTimeout:        time.Minute,
+	})
+
+	ctx := context.Background()
+
+	// Пока предохранитель замкнут, ошибка основного провайдера возвращается вызывающему.
+	if err := composite.Publish(ctx, &models.DataMessage{Id: "1"}); err == nil {
+		t.Fatal("Expected primary error while breaker is closed")
+	}
+
+	// Вторая ошибка размыкает предохранитель, и сообщение уходит на резервный провайдер.
+	for _, id := range []string{"2", "3"} {
+		if err := composite.Publish(ctx, &models.DataMessage{Id: id}); err != nil {
+			t.Fatalf("Expected failover for %s, got: %v", id, err)
+		}
+	}
+
+	if len(secondary.messages) != 2 {
+		t.Fatalf("Expected 2 messages on secondary, got %d", len(secondary.messages))
+	}
+
+	stats := composite.Stats()
+	if stats.Failovers != 2 || len(stats.Breakers) != 2 || stats.Breakers[0].State != "open" {
+		t.Fatalf("Unexpected failover stats: %+v", stats)
+	}
+}
@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCompositeDedupWindow is how long a message ID is remembered by the merging subscription.
+	DefaultCompositeDedupWindow = 5 * time.Minute
+	// compositeDedupMaxEntries bounds the cache if the window holds more messages than expected.
+	compositeDedupMaxEntries = 100_000
+)
+
+type dedupEntry struct {
+	id     string
+	seenAt time.Time
+}
+
+// dedupCache remembers which provider delivered a message ID first within a time window.
+type dedupCache struct {
+	mu         sync.Mutex
+	window     time.Duration
+	maxEntries int
+	owners     map[string]int // message ID -> index of the provider that delivered it first
+	order      []dedupEntry   // IDs in the order they were first seen, for expiration
+	head       int            // first live entry in order
+}
+
+func newDedupCache(window time.Duration, maxEntries int) *dedupCache {
+	return &dedupCache{
+		window:     window,
+		maxEntries: maxEntries,
+		owners:     make(map[string]int),
+	}
+}
+
+// duplicate reports whether the message was already delivered by another provider.
+// Redeliveries from the provider that delivered the message first are not duplicates.
+// Messages without an ID are never duplicates: unrelated ID-less messages would collide.
+func (c *dedupCache) duplicate(id string, provider int) bool {
+	if id == "" {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.expire(now)
+
+	if owner, ok := c.owners[id]; ok {
+		return owner != provider
+	}
+
+	c.owners[id] = provider
+	c.order = append(c.order, dedupEntry{id: id, seenAt: now})
+
+	return false
+}
+
+// transfer makes provider the owner of a message already seen, so its redelivery
+// from that provider is not suppressed.
+func (c *dedupCache) transfer(id string, provider int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.owners[id]; ok {
+		c.owners[id] = provider
+	}
+}
+
+// expire drops entries older than the window or above the size limit. Called with c.mu held.
+func (c *dedupCache) expire(now time.Time) {
+	for c.head < len(c.order) &&
+		(now.Sub(c.order[c.head].seenAt) > c.window || len(c.order)-c.head >= c.maxEntries) {
+		delete(c.owners, c.order[c.head].id)
+		c.order[c.head] = dedupEntry{}
+		c.head++
+	}
+
+	// Compact once the dropped prefix dominates the slice.
+	if c.head > 0 && c.head >= len(c.order)/2 {
+		c.order = append(c.order[:0], c.order[c.head:]...)
+		c.head = 0
+	}
+}
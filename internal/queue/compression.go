@@ -0,0 +1,168 @@
+package queue
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stsolovey/diplom-distributed-system/internal/metrics"
+)
+
+const (
+	// compressionHeader - заголовок NATS-сообщения / Kafka-записи с алгоритмом сжатия тела.
+	// Отсутствует, если тело не сжато.
+	compressionHeader = "compression"
+
+	CompressionNone   = "none"
+	CompressionGzip   = "gzip"
+	CompressionSnappy = "snappy"
+	CompressionZstd   = "zstd"
+
+	// DefaultCompressionThreshold - тела меньше порога (в байтах) не сжимаются.
+	DefaultCompressionThreshold = 1024
+
+	// maxDecompressedSize ограничивает размер распакованного тела (защита от zip-бомб).
+	maxDecompressedSize = 64 << 20
+)
+
+var (
+	ErrUnknownCompression = errors.New("unknown compression algorithm")
+	ErrDecompressedTooBig = errors.New("decompressed message exceeds size limit")
+)
+
+// CompressionConfig задает сжатие публикуемых сообщений.
+type CompressionConfig struct {
+	Algorithm string // "none", "gzip", "snappy" или "zstd"
+	Threshold int    // минимальный размер тела для сжатия, байт
+}
+
+// Validate проверяет, что алгоритм сжатия поддерживается.
+func (c CompressionConfig) Validate() error {
+	switch c.Algorithm {
+	case "", CompressionNone, CompressionGzip, CompressionSnappy, CompressionZstd:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownCompression, c.Algorithm)
+	}
+}
+
+func (c CompressionConfig) enabled() bool {
+	return c.Algorithm != "" && c.Algorithm != CompressionNone
+}
+
+// zstd-кодеры потокобезопасны в режиме EncodeAll/DecodeAll и создаются один раз.
+//
+//nolint:gochecknoglobals // shared stateless zstd coders
+var (
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) { return zstd.NewWriter(nil) })
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressedSize))
+	})
+)
+
+// compressBody сжимает тело, если оно не меньше порога, и возвращает алгоритм для заголовка.
+// Пустой алгоритм означает, что тело отправляется как есть: сжатие выключено, тело меньше
+// порога или сжатие не уменьшило размер.
+func compressBody(cfg CompressionConfig, data []byte) ([]byte, string, error) {
+	if !cfg.enabled() || len(data) < cfg.Threshold {
+		return data, "", nil
+	}
+
+	compressed, err := compress(cfg.Algorithm, data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(compressed) >= len(data) {
+		return data, "", nil
+	}
+
+	metrics.QueueCompressionRatio.WithLabelValues(cfg.Algorithm).Observe(float64(len(compressed)) / float64(len(data)))
+	metrics.QueueCompressionBytesSaved.WithLabelValues(cfg.Algorithm).Add(float64(len(data) - len(compressed)))
+
+	return compressed, cfg.Algorithm, nil
+}
+
+func compress(algorithm string, data []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionGzip:
+		var buf bytes.Buffer
+
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to gzip message: %w", err)
+		}
+
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip message: %w", err)
+		}
+
+		return buf.Bytes(), nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	case CompressionZstd:
+		encoder, err := zstdEncoder()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+
+		return encoder.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCompression, algorithm)
+	}
+}
+
+// decompressBody распаковывает тело по алгоритму из заголовка; пустой алгоритм - тело не сжато.
+func decompressBody(algorithm string, data []byte) ([]byte, error) {
+	switch algorithm {
+	case "", CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to gunzip message: %w", err)
+		}
+		defer reader.Close()
+
+		out, err := io.ReadAll(io.LimitReader(reader, maxDecompressedSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to gunzip message: %w", err)
+		}
+
+		if len(out) > maxDecompressedSize {
+			return nil, ErrDecompressedTooBig
+		}
+
+		return out, nil
+	case CompressionSnappy:
+		if size, err := snappy.DecodedLen(data); err == nil && size > maxDecompressedSize {
+			return nil, ErrDecompressedTooBig
+		}
+
+		out, err := snappy.Decode(nil, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode snappy message: %w", err)
+		}
+
+		return out, nil
+	case CompressionZstd:
+		decoder, err := zstdDecoder()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+
+		out, err := decoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode zstd message: %w", err)
+		}
+
+		return out, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCompression, algorithm)
+	}
+}
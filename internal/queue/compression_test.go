@@ -0,0 +1,48 @@
+package queue
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCompressBody_RoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("compressible payload "), 200)
+
+	for _, algorithm := range []string{CompressionGzip, CompressionSnappy, CompressionZstd} {
+		compressed, header, err := compressBody(CompressionConfig{Algorithm: algorithm, Threshold: 1024}, data)
+		if err != nil {
+			t.Fatalf("%s: failed to compress: %v", algorithm, err)
+		}
+
+		if header != algorithm || len(compressed) >= len(data) {
+			t.Fatalf("%s: expected compressed body, got header %q and %d bytes", algorithm, header, len(compressed))
+		}
+
+		restored, err := decompressBody(header, compressed)
+		if err != nil {
+			t.Fatalf("%s: failed to decompress: %v", algorithm, err)
+		}
+
+		if !bytes.Equal(restored, data) {
+			t.Fatalf("%s: round trip mismatch", algorithm)
+		}
+	}
+}
+
+func TestCompressBody_BelowThresholdSentAsIs(t *testing.T) {
+	data := []byte("small")
+
+	body, header, err := compressBody(CompressionConfig{Algorithm: CompressionZstd, Threshold: 1024}, data)
+	if err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+
+	if header != "" || !bytes.Equal(body, data) {
+		t.Fatalf("Expected uncompressed body, got header %q", header)
+	}
+
+	if err := (CompressionConfig{Algorithm: "lzma"}).Validate(); !errors.Is(err, ErrUnknownCompression) {
+		t.Fatalf("Expected ErrUnknownCompression, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+const (
+	// defaultMaxDeliveryAttempts - число попыток доставки, после которого сообщение уходит в DLQ.
+	defaultMaxDeliveryAttempts = 3
+	// memoryDeadLetterQueueSize - емкость in-memory DLQ по умолчанию.
+	memoryDeadLetterQueueSize = 1000
+)
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter - сообщение, исчерпавшее попытки доставки.
+type DeadLetter struct {
+	ID        string              `json:"id"`
+	Message   *models.DataMessage `json:"message"`
+	LastError string              `json:"lastError"`
+	Attempts  int                 `json:"attempts"`
+	FailedAt  time.Time           `json:"failedAt"`
+}
+
+// DeadLetterQueue - хранилище сообщений, которые не удалось обработать.
+type DeadLetterQueue interface {
+	// Put сохраняет сообщение и присваивает ему ID.
+	Put(ctx context.Context, dl *DeadLetter) error
+	// List возвращает до limit сообщений в порядке поступления (limit <= 0 - без ограничения).
+	List(ctx context.Context, limit int) ([]*DeadLetter, error)
+	// Get возвращает сообщение по ID или ErrDeadLetterNotFound.
+	Get(ctx context.Context, id string) (*DeadLetter, error)
+	// Delete удаляет сообщение по ID или возвращает ErrDeadLetterNotFound.
+	Delete(ctx context.Context, id string) error
+}
+
+// DeadLetterProvider реализуется провайдерами, у которых есть собственная DLQ.
+type DeadLetterProvider interface {
+	// DeadLetters возвращает DLQ провайдера или nil, если она не настроена.
+	DeadLetters() DeadLetterQueue
+	// MaxAttempts возвращает номер попытки доставки, после неудачи которой сообщение уходит в DLQ.
+	MaxAttempts() int
+}
+
+// MemoryDeadLetterQueue - ограниченная in-memory DLQ. При переполнении вытесняются самые старые записи.
+type MemoryDeadLetterQueue struct {
+	mu       sync.Mutex
+	capacity int
+	nextID   uint64
+	entries  []*DeadLetter
+}
+
+// NewMemoryDeadLetterQueue создает in-memory DLQ заданной емкости.
+func NewMemoryDeadLetterQueue(capacity int) *MemoryDeadLetterQueue {
+	return &MemoryDeadLetterQueue{
+		capacity: capacity,
+		entries:  make([]*DeadLetter, 0, capacity),
+	}
+}
+
+// Put реализует интерфейс DeadLetterQueue.
+func (q *MemoryDeadLetterQueue) Put(_ context.Context, dl *DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextID++
+	dl.ID = strconv.FormatUint(q.nextID, 10)
+
+	if len(q.entries) >= q.capacity {
+		log.Printf("Dead-letter queue is full, evicting message %s", q.entries[0].Message.GetId())
+		q.entries = q.entries[1:]
+	}
+
+	q.entries = append(q.entries, dl)
+
+	return nil
+}
+
+// List реализует интерфейс DeadLetterQueue.
+func (q *MemoryDeadLetterQueue) List(_ context.Context, limit int) ([]*DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := len(q.entries)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+
+	result := make([]*DeadLetter, n)
+	copy(result, q.entries[:n])
+
+	return result, nil
+}
+
+// Get реализует интерфейс DeadLetterQueue.
+func (q *MemoryDeadLetterQueue) Get(_ context.Context, id string) (*DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, dl := range q.entries {
+		if dl.ID == id {
+			return dl, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+}
+
+// Delete реализует интерфейс DeadLetterQueue.
+func (q *MemoryDeadLetterQueue) Delete(_ context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, dl := range q.entries {
+		if dl.ID == id {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+}
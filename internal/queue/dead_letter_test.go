@@ -0,0 +1,37 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func TestMemoryDeadLetterQueue_EvictsOldest(t *testing.T) {
+	dlq := NewMemoryDeadLetterQueue(2)
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := dlq.Put(ctx, &DeadLetter{Message: &models.DataMessage{Id: id}}); err != nil {
+			t.Fatalf("Failed to put dead letter: %v", err)
+		}
+	}
+
+	entries, err := dlq.List(ctx, 0)
+	if err != nil {
+		t.Fatalf("Failed to list dead letters: %v", err)
+	}
+
+	if len(entries) != 2 || entries[0].Message.GetId() != "b" || entries[1].Message.GetId() != "c" {
+		t.Fatalf("Expected [b c] after eviction, got %+v", entries)
+	}
+
+	if err := dlq.Delete(ctx, entries[0].ID); err != nil {
+		t.Fatalf("Failed to delete dead letter: %v", err)
+	}
+
+	if _, err := dlq.Get(ctx, entries[0].ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Expected ErrDeadLetterNotFound after delete, got %v", err)
+	}
+}
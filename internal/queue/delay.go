@@ -0,0 +1,190 @@
+package queue
+
+import (
+	"container/heap"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+// DeliverAtMetadataKey - ключ метаданных DataMessage с моментом, раньше которого
+// сообщение не должно доставляться потребителю (RFC 3339, UTC).
+const DeliverAtMetadataKey = "deliver_at"
+
+// delayedReleaseRetry - пауза перед повторной попыткой выпустить созревшее сообщение в заполненную очередь.
+const delayedReleaseRetry = 100 * time.Millisecond
+
+// DeliverAt возвращает момент отложенной доставки сообщения, если он задан.
+func DeliverAt(msg *models.DataMessage) (time.Time, bool) {
+	value, ok := msg.GetMetadata()[DeliverAtMetadataKey]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	deliverAt, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return deliverAt, true
+}
+
+// SetDeliverAt откладывает доставку сообщения до deliverAt.
+func SetDeliverAt(msg *models.DataMessage, deliverAt time.Time) {
+	if msg.Metadata == nil {
+		msg.Metadata = make(map[string]string)
+	}
+
+	msg.Metadata[DeliverAtMetadataKey] = deliverAt.UTC().Format(time.RFC3339Nano)
+}
+
+// SetDelay откладывает доставку сообщения на delay от текущего момента.
+func SetDelay(msg *models.DataMessage, delay time.Duration) {
+	if delay > 0 {
+		SetDeliverAt(msg, time.Now().Add(delay))
+	}
+}
+
+// deliveryDelay возвращает, сколько сообщению осталось ждать до доставки.
+func deliveryDelay(msg *models.DataMessage) time.Duration {
+	deliverAt, ok := DeliverAt(msg)
+	if !ok {
+		return 0
+	}
+
+	return max(time.Until(deliverAt), 0)
+}
+
+type delayedMessage struct {
+	msg *models.DataMessage
+	at  time.Time
+}
+
+// delayHeap - min-heap отложенных сообщений по времени доставки.
+type delayHeap []delayedMessage
+
+func (h delayHeap) Len() int           { return len(h) }
+func (h delayHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h delayHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *delayHeap) Push(x any) {
+	item, _ := x.(delayedMessage)
+	*h = append(*h, item)
+}
+
+func (h *delayHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = delayedMessage{}
+	*h = old[:len(old)-1]
+
+	return item
+}
+
+// delayScheduler держит отложенные сообщения in-memory очередей и выпускает их
+// через release по одному таймеру, взведенному на ближайшее сообщение.
+type delayScheduler struct {
+	mu      sync.Mutex
+	items   delayHeap
+	timer   *time.Timer
+	release func(msg *models.DataMessage) error
+	closed  bool
+}
+
+func newDelayScheduler(release func(msg *models.DataMessage) error) *delayScheduler {
+	return &delayScheduler{release: release}
+}
+
+// schedule откладывает сообщение до момента at.
+func (s *delayScheduler) schedule(msg *models.DataMessage, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	heap.Push(&s.items, delayedMessage{msg: msg, at: at})
+	s.resetTimer()
+}
+
+// resetTimer взводит таймер на ближайшее сообщение. Вызывается под s.mu.
+func (s *delayScheduler) resetTimer() {
+	if len(s.items) == 0 {
+		return
+	}
+
+	wait := max(time.Until(s.items[0].at), 0)
+
+	if s.timer == nil {
+		s.timer = time.AfterFunc(wait, s.fire)
+
+		return
+	}
+
+	s.timer.Reset(wait)
+}
+
+// fire выпускает созревшие сообщения. Если очередь заполнена, сообщение ждет delayedReleaseRetry.
+func (s *delayScheduler) fire() {
+	s.mu.Lock()
+
+	var due []delayedMessage
+
+	now := time.Now()
+	for len(s.items) > 0 && !s.items[0].at.After(now) {
+		item, _ := heap.Pop(&s.items).(delayedMessage)
+		due = append(due, item)
+	}
+
+	s.mu.Unlock()
+
+	for _, item := range due {
+		err := s.release(item.msg)
+		if err == nil {
+			continue
+		}
+
+		if errors.Is(err, ErrQueueClosed) {
+			return
+		}
+
+		if !errors.Is(err, ErrQueueFull) {
+			log.Printf("Failed to release delayed message %s: %v", item.msg.GetId(), err)
+
+			continue
+		}
+
+		s.schedule(item.msg, now.Add(delayedReleaseRetry))
+	}
+
+	s.mu.Lock()
+	if !s.closed {
+		s.resetTimer()
+	}
+	s.mu.Unlock()
+}
+
+// len возвращает число ожидающих сообщений.
+func (s *delayScheduler) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.items)
+}
+
+// close останавливает таймер и отбрасывает ожидающие сообщения.
+func (s *delayScheduler) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	s.items = nil
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+}
@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func TestMemoryQueue_DelayedMessageInvisibleUntilDue(t *testing.T) {
+	q := NewMemoryQueue(10)
+	defer q.Close()
+
+	delayed := &models.DataMessage{Id: "later"}
+	SetDelay(delayed, 100*time.Millisecond)
+
+	ctx := context.Background()
+
+	if err := q.Enqueue(ctx, delayed); err != nil {
+		t.Fatalf("Failed to enqueue delayed message: %v", err)
+	}
+
+	if err := q.Enqueue(ctx, &models.DataMessage{Id: "now"}); err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+
+	if stats := q.Stats(); stats.CurrentSize != 1 || stats.DelayedSize != 1 {
+		t.Fatalf("Expected 1 visible and 1 delayed message, got %+v", stats)
+	}
+
+	start := time.Now()
+
+	for _, want := range []string{"now", "later"} {
+		dequeueCtx, cancel := context.WithTimeout(ctx, time.Second)
+		msg, err := q.Dequeue(dequeueCtx)
+
+		cancel()
+
+		if err != nil {
+			t.Fatalf("Failed to dequeue %s: %v", want, err)
+		}
+
+		if msg.GetId() != want {
+			t.Fatalf("Expected %s, got %s", want, msg.GetId())
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("Delayed message delivered too early: %v", elapsed)
+	}
+}
+
+func TestMemoryQueue_NackWithDelayPostponesRedelivery(t *testing.T) {
+	q := NewMemoryQueue(10)
+	defer q.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	ch, _ := q.Subscribe(ctx)
+
+	if err := q.Enqueue(ctx, &models.DataMessage{Id: "retry"}); err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+
+	start := time.Now()
+
+	if err := (<-ch).Nack(100 * time.Millisecond); err != nil {
+		t.Fatalf("Failed to nack: %v", err)
+	}
+
+	delivery := <-ch
+	if delivery.Attempt() != 2 {
+		t.Fatalf("Expected attempt 2, got %d", delivery.Attempt())
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("Message redelivered too early: %v", elapsed)
+	}
+}
+
+func TestKafkaDelayTier(t *testing.T) {
+	for remaining, want := range map[time.Duration]time.Duration{
+		100 * time.Millisecond: time.Second,
+		30 * time.Second:       10 * time.Second,
+		90 * time.Minute:       time.Hour,
+	} {
+		if got := kafkaDelayTier(remaining); got != want {
+			t.Errorf("Remaining %v: expected tier %v, got %v", remaining, want, got)
+		}
+	}
+
+	if topic := kafkaDelayTopic("diplom-messages", time.Minute); topic != "diplom-messages.delay-60s" {
+		t.Errorf("Unexpected delay topic: %s", topic)
+	}
+}
@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+var (
+	ErrDeliverySettled = errors.New("delivery already settled")
+	ErrRequeueFailed   = errors.New("failed to requeue message")
+)
+
+// deliveryState гарантирует, что доставка завершается только один раз.
+type deliveryState struct {
+	settled atomic.Bool
+}
+
+// settle помечает доставку завершенной или возвращает ErrDeliverySettled при повторном вызове.
+func (s *deliveryState) settle() error {
+	if !s.settled.CompareAndSwap(false, true) {
+		return ErrDeliverySettled
+	}
+
+	return nil
+}
+
+// requeueFunc возвращает сообщение в in-memory очередь для попытки доставки attempt.
+type requeueFunc func(msg *models.DataMessage, attempt int) error
+
+// attemptTracker хранит номера попыток для сообщений, возвращенных в очередь через Nack.
+// Ключ - копия сообщения, которую Nack возвращает в очередь, а не его ID: сообщения без ID
+// или с одинаковым ID не делят счетчик попыток.
+type attemptTracker struct {
+	pending  atomic.Int64
+	mu       sync.Mutex
+	attempts map[*models.DataMessage]int
+}
+
+// requeued запоминает номер следующей попытки доставки сообщения.
+func (t *attemptTracker) requeued(msg *models.DataMessage, attempt int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.attempts == nil {
+		t.attempts = make(map[*models.DataMessage]int)
+	}
+
+	if _, ok := t.attempts[msg]; !ok {
+		t.pending.Add(1)
+	}
+
+	t.attempts[msg] = attempt
+}
+
+// next возвращает номер текущей попытки доставки сообщения.
+func (t *attemptTracker) next(msg *models.DataMessage) int {
+	// Быстрый путь: повторных доставок нет, мьютекс не нужен.
+	if t.pending.Load() == 0 {
+		return 1
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	attempt, ok := t.attempts[msg]
+	if !ok {
+		return 1
+	}
+
+	delete(t.attempts, msg)
+	t.pending.Add(-1)
+
+	return attempt
+}
+
+// memoryDelivery - доставка для in-memory очередей.
+// Ack и Term только завершают доставку, Nack возвращает сообщение в очередь.
+type memoryDelivery struct {
+	deliveryState
+
+	msg     *models.DataMessage
+	attempt int
+	requeue requeueFunc
+}
+
+func newMemoryDelivery(msg *models.DataMessage, attempt int, requeue requeueFunc) *memoryDelivery {
+	return &memoryDelivery{
+		msg:     msg,
+		attempt: attempt,
+		requeue: requeue,
+	}
+}
+
+// Message реализует интерфейс Delivery.
+func (d *memoryDelivery) Message() *models.DataMessage {
+	return d.msg
+}
+
+// Attempt реализует интерфейс Delivery.
+func (d *memoryDelivery) Attempt() int {
+	return d.attempt
+}
+
+// Ack реализует интерфейс Delivery.
+func (d *memoryDelivery) Ack() error {
+	return d.settle()
+}
+
+// Nack реализует интерфейс Delivery.
+// При delay > 0 сообщение возвращается в очередь с deliver_at и станет видимым через delay.
+// В очередь уходит копия: исходное сообщение может разделяться с другими провайдерами composite.
+// Если вернуть сообщение не удалось, доставка остается незавершенной, и ее можно завершить через Term.
+func (d *memoryDelivery) Nack(delay time.Duration) error {
+	if err := d.settle(); err != nil {
+		return err
+	}
+
+	msg := cloneMessage(d.msg)
+	SetDelay(msg, delay)
+
+	if err := d.requeue(msg, d.attempt+1); err != nil {
+		d.settled.Store(false)
+
+		return fmt.Errorf("%w: %w", ErrRequeueFailed, err)
+	}
+
+	return nil
+}
+
+// InProgress реализует интерфейс Delivery. Для in-memory очередей таймаута подтверждения нет.
+func (d *memoryDelivery) InProgress() error {
+	return nil
+}
+
+// Term реализует интерфейс Delivery.
+func (d *memoryDelivery) Term() error {
+	return d.settle()
+}
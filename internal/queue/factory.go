@@ -1,9 +1,14 @@
 package queue
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/stsolovey/diplom-distributed-system/internal/config"
 )
@@ -12,6 +17,13 @@ var (
 	ErrUnsupportedQueueType           = errors.New("unsupported queue type")
 	ErrNoCompositeProvidersConfigured = errors.New("no composite providers configured")
 	ErrUnsupportedCompositeStrategy   = errors.New("unsupported composite strategy")
+
+	ErrUnsupportedCompositeSubscribeMode = errors.New("unsupported composite subscribe mode")
+	ErrUnsupportedKafkaConsumerMode      = errors.New("unsupported Kafka consumer mode")
+	ErrUnsupportedNATSPublishMode        = errors.New("unsupported NATS publish mode")
+
+	ErrEmbeddedNATSRunning    = errors.New("embedded NATS server is already running")
+	ErrEmbeddedNATSNotStarted = errors.New("embedded NATS server is not started, create the provider first")
 )
 
 // ProviderType defines the type of queue provider.
@@ -19,14 +31,28 @@ type ProviderType string
 
 const (
 	MemoryProviderType    ProviderType = "memory"
+	PriorityProviderType  ProviderType = "priority"
+	OptimizedProviderType ProviderType = "memory-optimized"
+	RingProviderType      ProviderType = "ring"
+	ShardedProviderType   ProviderType = "sharded"
 	NATSProviderType      ProviderType = "nats"
 	KafkaProviderType     ProviderType = "kafka"
+	RedisProviderType     ProviderType = "redis"
+	WALProviderType       ProviderType = "wal"
 	CompositeProviderType ProviderType = "composite"
+
+	// NATSEmbeddedProviderType runs nats-server with JetStream inside the process.
+	NATSEmbeddedProviderType ProviderType = "nats-embedded"
 )
 
 // Factory creates queue providers.
 type Factory struct {
 	config *config.Config
+
+	// embeddedNATS is the server started for the nats-embedded provider; brokers connect to it too.
+	// It is cleared when the provider that owns it is closed.
+	embeddedMu   sync.Mutex
+	embeddedNATS *EmbeddedNATSServer
 }
 
 // NewFactory creates a new queue factory.
@@ -38,37 +64,156 @@ func NewFactory(cfg *config.Config) *Factory {
 
 // CreateProvider creates a queue provider based on configuration.
 func (f *Factory) CreateProvider() (Provider, error) { //nolint:ireturn // factory pattern
-	queueType := ProviderType(f.config.QueueType)
+	return f.CreateProviderOfType(ProviderType(f.config.QueueType))
+}
 
+// CreateProviderOfType creates a provider of the given registered type; other settings come from configuration.
+func (f *Factory) CreateProviderOfType(queueType ProviderType) (Provider, error) { //nolint:ireturn // factory pattern
 	log.Printf("Creating queue provider of type: %s", queueType)
 
-	switch queueType {
-	case MemoryProviderType:
-		return f.createMemoryProvider()
-	case NATSProviderType:
-		return f.createNATSProvider()
-	case KafkaProviderType:
-		return f.createKafkaProvider()
-	case CompositeProviderType:
-		return f.createCompositeProvider()
-	default:
-		return nil, fmt.Errorf("%w: %s", ErrUnsupportedQueueType, queueType)
+	constructor, err := lookupProvider(queueType)
+	if err != nil {
+		return nil, err
+	}
+
+	return constructor(f.providerOptions(queueType, false))
+}
+
+// CreateMigratingProvider creates the configured provider wrapped for live migration to other providers.
+func (f *Factory) CreateMigratingProvider() (*MigratingProvider, error) {
+	provider, err := f.CreateProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMigratingProvider(provider, f.config.QueueType, f.migrationConfig()), nil
+}
+
+// migrationConfig builds the live migration settings; copies written to both providers
+// are de-duplicated within the composite dedup window.
+func (f *Factory) migrationConfig() MigrationConfig {
+	return MigrationConfig{
+		DualWrite:     f.config.MigrationDualWrite,
+		CheckInterval: f.config.MigrationCheckInterval,
+		DrainTimeout:  f.config.MigrationDrainTimeout,
+		DedupWindow:   f.config.CompositeDedupWindow,
+	}
+}
+
+// providerOptions returns the options passed to the constructor of a registered provider.
+func (f *Factory) providerOptions(name ProviderType, member bool) ProviderOptions {
+	return ProviderOptions{
+		Name:    name,
+		Config:  f.config,
+		Member:  member,
+		factory: f,
 	}
 }
 
 // createMemoryProvider creates a provider for in-memory queue.
 func (f *Factory) createMemoryProvider() (Provider, error) { //nolint:ireturn // factory pattern
-	log.Printf("Creating memory queue with size: %d", f.config.QueueSize)
+	log.Printf("Creating memory queue with size: %d, overflow policy: %s", f.config.QueueSize, f.config.QueueOverflowPolicy)
+
+	return f.newMemoryAdapter()
+}
+
+// newMemoryAdapter creates an in-memory adapter with the configured overflow policy.
+func (f *Factory) newMemoryAdapter() (*MemoryAdapter, error) {
+	adapter := NewMemoryAdapter(f.config.QueueSize)
+	if err := adapter.SetOverflow(f.overflowConfig()); err != nil {
+		adapter.Close()
+
+		return nil, err
+	}
+
+	return adapter, nil
+}
 
-	return NewMemoryAdapter(f.config.QueueSize), nil
+// overflowConfig builds the in-memory queue overflow settings from the configuration.
+func (f *Factory) overflowConfig() OverflowConfig {
+	return OverflowConfig{
+		Policy:       OverflowPolicy(f.config.QueueOverflowPolicy),
+		BlockTimeout: f.config.QueueOverflowBlockTimeout,
+		SampleRate:   f.config.QueueOverflowSampleRate,
+	}
+}
+
+// createOptimizedProvider creates a provider for in-memory queue with pooled messages.
+func (f *Factory) createOptimizedProvider() (Provider, error) { //nolint:ireturn // factory pattern
+	log.Printf("Creating optimized memory queue with size: %d, lease debug: %t", f.config.QueueSize, f.config.QueueLeaseDebug)
+
+	return f.newOptimizedMemoryQueue(), nil
+}
+
+// newOptimizedMemoryQueue creates an in-memory queue with pooled messages and the configured lease debug mode.
+func (f *Factory) newOptimizedMemoryQueue() *OptimizedMemoryQueue {
+	q := NewOptimizedMemoryQueue(f.config.QueueSize)
+	q.SetDebug(f.config.QueueLeaseDebug)
+
+	return q
+}
+
+// createRingProvider creates a provider for lock-free in-memory ring buffer queue.
+func (f *Factory) createRingProvider() (Provider, error) { //nolint:ireturn // factory pattern
+	q := NewRingQueue(f.config.QueueSize)
+
+	log.Printf("Creating ring buffer queue with capacity: %d", q.Cap())
+
+	return q, nil
+}
+
+// createShardedProvider creates a provider for in-memory queue with per-key ordering.
+func (f *Factory) createShardedProvider() (Provider, error) { //nolint:ireturn // factory pattern
+	log.Printf("Creating sharded queue with %d shards by %s", f.config.QueueShards, f.config.QueueShardKey)
+
+	adapter, err := NewShardedQueue(f.shardedConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sharded queue: %w", err)
+	}
+
+	return adapter, nil
+}
+
+// shardedConfig builds the sharded queue settings from the configuration.
+// QueueSize is the total capacity, split evenly between shards.
+func (f *Factory) shardedConfig() ShardedConfig {
+	shards := max(f.config.QueueShards, 1)
+
+	return ShardedConfig{
+		Shards:      shards,
+		Key:         ShardKey(f.config.QueueShardKey),
+		MetadataKey: f.config.QueueShardMetadataKey,
+		ShardSize:   (f.config.QueueSize + shards - 1) / shards,
+	}
+}
+
+// createPriorityProvider creates a provider for in-memory priority queue.
+func (f *Factory) createPriorityProvider() (Provider, error) { //nolint:ireturn // factory pattern
+	log.Printf("Creating priority queue with %d levels, weights: %v, level size: %d",
+		f.config.PriorityLevels, f.config.PriorityWeights, f.config.QueueSize)
+
+	adapter, err := NewPriorityQueue(f.priorityConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create priority queue: %w", err)
+	}
+
+	return adapter, nil
+}
+
+func (f *Factory) priorityConfig() PriorityConfig {
+	return PriorityConfig{
+		Levels:    f.config.PriorityLevels,
+		Weights:   f.config.PriorityWeights,
+		LevelSize: f.config.QueueSize,
+	}
 }
 
 // createNATSProvider creates a provider for NATS queue.
 func (f *Factory) createNATSProvider() (Provider, error) { //nolint:ireturn // factory pattern
-	log.Printf("Creating NATS queue with URL: %s", f.config.NATSURL)
+	log.Printf("Creating NATS queue with URL: %s, codec: %s, compression: %s, publish mode: %s",
+		f.config.NATSURL, f.config.QueueCodec, f.config.QueueCompression, f.config.NATSPublishMode)
 
-	// Use standard subject "messages" for all messages.
-	adapter, err := NewNATSAdapter(f.config.NATSURL, "messages")
+	adapter, err := f.newNATSAdapter()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create NATS adapter: %w", err)
 	}
@@ -78,12 +223,30 @@ func (f *Factory) createNATSProvider() (Provider, error) { //nolint:ireturn // f
 	return adapter, nil
 }
 
+// createNATSEmbeddedProvider creates a provider for NATS queue served by the embedded server.
+func (f *Factory) createNATSEmbeddedProvider() (Provider, error) { //nolint:ireturn // factory pattern
+	log.Printf("Creating embedded NATS queue with store dir: %s, listen: %q, codec: %s, compression: %s",
+		f.config.NATSEmbeddedStoreDir, f.config.NATSEmbeddedListen, f.config.QueueCodec, f.config.QueueCompression)
+
+	adapter, err := f.newEmbeddedNATSAdapter()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedded NATS adapter: %w", err)
+	}
+
+	log.Printf("Embedded NATS queue provider created successfully")
+
+	return adapter, nil
+}
+
 // createKafkaProvider creates a provider for Kafka queue.
 func (f *Factory) createKafkaProvider() (Provider, error) { //nolint:ireturn // factory pattern
-	log.Printf("Creating Kafka queue with brokers: %v, topic: %s, consumer group: %s",
-		f.config.KafkaBrokers, f.config.KafkaTopic, f.config.KafkaConsumerGroup)
+	log.Printf("Creating Kafka queue with brokers: %v, topic: %s, consumer group: %s, codec: %s, compression: %s, "+
+		"partition key: %s, consumer mode: %s, commit mode: %s",
+		f.config.KafkaBrokers, f.config.KafkaTopic, f.config.KafkaConsumerGroup,
+		f.config.QueueCodec, f.config.QueueCompression, f.config.KafkaPartitionKey, f.config.KafkaConsumerMode,
+		f.config.KafkaCommitMode)
 
-	adapter, err := NewKafkaAdapter(f.config.KafkaBrokers, f.config.KafkaTopic, f.config.KafkaConsumerGroup)
+	adapter, err := f.newKafkaAdapter()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kafka adapter: %w", err)
 	}
@@ -93,6 +256,327 @@ func (f *Factory) createKafkaProvider() (Provider, error) { //nolint:ireturn //
 	return adapter, nil
 }
 
+// createRedisProvider creates a provider for Redis Streams queue.
+func (f *Factory) createRedisProvider() (Provider, error) { //nolint:ireturn // factory pattern
+	log.Printf("Creating Redis queue with addr: %s, stream: %s, group: %s, codec: %s, compression: %s",
+		f.config.RedisAddr, f.config.RedisStream, f.config.RedisGroup, f.config.QueueCodec, f.config.QueueCompression)
+
+	adapter, err := f.newRedisQueue()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Redis queue: %w", err)
+	}
+
+	log.Printf("Redis queue provider created successfully")
+
+	return adapter, nil
+}
+
+// newNATSAdapter creates a NATS adapter with the configured codec and compression.
+func (f *Factory) newNATSAdapter() (*NATSAdapter, error) {
+	codec, compression, err := f.wireFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := f.natsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	adapter, err := NewNATSAdapterWithConfig(cfg, f.natsSubject())
+	if err != nil {
+		return nil, err
+	}
+
+	adapter.SetCodec(codec)
+	adapter.SetCompression(compression)
+
+	return adapter, nil
+}
+
+// newEmbeddedNATSAdapter starts the embedded server and creates an adapter connected to it in-process.
+// The adapter owns the server and shuts it down on Close, after which the provider can be created again.
+func (f *Factory) newEmbeddedNATSAdapter() (*EmbeddedNATSAdapter, error) {
+	f.embeddedMu.Lock()
+	defer f.embeddedMu.Unlock()
+
+	if f.embeddedNATS != nil {
+		return nil, ErrEmbeddedNATSRunning
+	}
+
+	codec, compression, err := f.wireFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := f.natsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	srv, err := StartEmbeddedNATSServer(EmbeddedNATSConfig{
+		StoreDir: f.config.NATSEmbeddedStoreDir,
+		Listen:   f.config.NATSEmbeddedListen,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	adapter, err := NewEmbeddedNATSAdapter(srv, cfg, f.natsSubject())
+	if err != nil {
+		srv.Shutdown()
+
+		return nil, err
+	}
+
+	adapter.SetCodec(codec)
+	adapter.SetCompression(compression)
+
+	f.embeddedNATS = srv
+	adapter.onClose = func() {
+		f.embeddedMu.Lock()
+		defer f.embeddedMu.Unlock()
+
+		if f.embeddedNATS == srv {
+			f.embeddedNATS = nil
+		}
+	}
+
+	return adapter, nil
+}
+
+// natsConfig returns connection and publish settings of NATS providers.
+func (f *Factory) natsConfig() (NATSConfig, error) {
+	cfg := defaultNATSConfig(f.config.NATSURL)
+
+	switch f.config.NATSPublishMode {
+	case "", "sync":
+	case "async":
+		cfg.AsyncPublish = true
+	default:
+		return NATSConfig{}, fmt.Errorf("%w: %s", ErrUnsupportedNATSPublishMode, f.config.NATSPublishMode)
+	}
+
+	if f.config.NATSAsyncMaxPending > 0 {
+		cfg.AsyncMaxPending = f.config.NATSAsyncMaxPending
+	}
+
+	return cfg, nil
+}
+
+// natsSubject returns the configured NATS subject, "messages" by default.
+func (f *Factory) natsSubject() string {
+	if f.config.NATSSubject != "" {
+		return f.config.NATSSubject
+	}
+
+	return "messages"
+}
+
+// newKafkaAdapter creates a Kafka adapter with the configured codec and compression.
+func (f *Factory) newKafkaAdapter() (*KafkaAdapter, error) {
+	codec, compression, err := f.wireFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	partitioning := KafkaPartitionConfig{
+		Strategy:    KafkaPartitionStrategy(f.config.KafkaPartitionKey),
+		MetadataKey: f.config.KafkaPartitionMetadataKey,
+	}
+	if err := partitioning.Validate(); err != nil {
+		return nil, err
+	}
+
+	ordered, err := parseKafkaConsumerMode(f.config.KafkaConsumerMode)
+	if err != nil {
+		return nil, err
+	}
+
+	adapter, err := NewKafkaAdapterWithConfig(KafkaConfig{
+		Brokers:         f.config.KafkaBrokers,
+		Topic:           f.config.KafkaTopic,
+		ConsumerGroup:   f.config.KafkaConsumerGroup,
+		CommitMode:      KafkaCommitMode(f.config.KafkaCommitMode),
+		CommitInterval:  f.config.KafkaCommitInterval,
+		TransactionalID: f.kafkaTransactionalID(),
+		ResultsTopic:    f.config.KafkaResultsTopic,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	adapter.SetCodec(codec)
+	adapter.SetCompression(compression)
+	adapter.SetPartitioning(partitioning)
+	adapter.SetOrdered(ordered)
+
+	return adapter, nil
+}
+
+// newRedisQueue creates a Redis Streams queue with the configured codec and compression.
+func (f *Factory) newRedisQueue() (*RedisQueue, error) {
+	codec, compression, err := f.wireFormat()
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := NewRedisQueue(RedisConfig{
+		Addr:      f.config.RedisAddr,
+		Password:  f.config.RedisPassword,
+		DB:        f.config.RedisDB,
+		Stream:    f.config.RedisStream,
+		Group:     f.config.RedisGroup,
+		Consumer:  f.config.RedisConsumer,
+		MaxLen:    int64(f.config.RedisMaxLen),
+		ClaimIdle: f.config.RedisClaimIdle,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	q.SetCodec(codec)
+	q.SetCompression(compression)
+
+	return q, nil
+}
+
+// kafkaTransactionalID returns the configured transactional ID or derives one unique per host,
+// so replicas of the processor do not fence each other.
+func (f *Factory) kafkaTransactionalID() string {
+	if f.config.KafkaTransactionalID != "" {
+		return f.config.KafkaTransactionalID
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = strconv.Itoa(os.Getpid())
+	}
+
+	return f.config.KafkaConsumerGroup + "-" + hostname
+}
+
+// parseKafkaConsumerMode reports whether the Kafka consumer must preserve per-partition order.
+func parseKafkaConsumerMode(mode string) (bool, error) {
+	switch mode {
+	case "", "parallel":
+		return false, nil
+	case "ordered":
+		return true, nil
+	default:
+		return false, fmt.Errorf("%w: %s", ErrUnsupportedKafkaConsumerMode, mode)
+	}
+}
+
+// wireFormat resolves the codec and compression of broker-backed providers.
+// It is checked before connecting so a typo does not leave a connection open.
+func (f *Factory) wireFormat() (Codec, CompressionConfig, error) { //nolint:ireturn // registry returns interface
+	codec, err := LookupCodec(f.config.QueueCodec)
+	if err != nil {
+		return nil, CompressionConfig{}, err
+	}
+
+	compression := CompressionConfig{
+		Algorithm: f.config.QueueCompression,
+		Threshold: f.config.QueueCompressionThreshold,
+	}
+	if err := compression.Validate(); err != nil {
+		return nil, CompressionConfig{}, err
+	}
+
+	return codec, compression, nil
+}
+
+// CreateBroker creates a connected message broker of the configured queue type.
+// One broker connection serves publishers and subscribers of any number of subjects (Kafka topics).
+func (f *Factory) CreateBroker(ctx context.Context) (MessageBroker, error) { //nolint:ireturn // factory pattern
+	queueType := ProviderType(f.config.QueueType)
+
+	log.Printf("Creating message broker of type: %s", queueType)
+
+	var broker MessageBroker
+
+	switch queueType {
+	case MemoryProviderType:
+		memoryBroker := NewMemoryBroker(f.config.QueueSize)
+		if err := memoryBroker.SetOverflow(f.overflowConfig()); err != nil {
+			return nil, err
+		}
+
+		broker = memoryBroker
+	case NATSProviderType, NATSEmbeddedProviderType:
+		codec, compression, err := f.wireFormat()
+		if err != nil {
+			return nil, err
+		}
+
+		cfg, err := f.natsConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		if queueType == NATSEmbeddedProviderType {
+			f.embeddedMu.Lock()
+			srv := f.embeddedNATS
+			f.embeddedMu.Unlock()
+
+			if srv == nil {
+				return nil, ErrEmbeddedNATSNotStarted
+			}
+
+			cfg = srv.NATSConfig(cfg)
+		}
+
+		natsBroker := newNATSBroker(cfg)
+		natsBroker.SetCodec(codec)
+		natsBroker.SetCompression(compression)
+		broker = natsBroker
+	case KafkaProviderType:
+		codec, compression, err := f.wireFormat()
+		if err != nil {
+			return nil, err
+		}
+
+		kafkaBroker := NewKafkaBroker(f.config.KafkaBrokers, f.config.KafkaConsumerGroup)
+		kafkaBroker.SetCodec(codec)
+		kafkaBroker.SetCompression(compression)
+		broker = kafkaBroker
+	default:
+		return nil, fmt.Errorf("%w: %s: message broker supports %s, %s, %s and %s", ErrUnsupportedQueueType,
+			queueType, MemoryProviderType, NATSProviderType, NATSEmbeddedProviderType, KafkaProviderType)
+	}
+
+	if err := broker.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("failed to connect message broker: %w", err)
+	}
+
+	return broker, nil
+}
+
+// createWALProvider creates a provider for disk-backed WAL queue.
+func (f *Factory) createWALProvider() (Provider, error) { //nolint:ireturn // factory pattern
+	log.Printf("Creating WAL queue in %s with sync policy: %s", f.config.WALDir, f.config.WALSyncPolicy)
+
+	adapter, err := NewWALQueue(f.walConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WAL queue: %w", err)
+	}
+
+	log.Printf("WAL queue provider created successfully")
+
+	return adapter, nil
+}
+
+func (f *Factory) walConfig() WALConfig {
+	return WALConfig{
+		Dir:            f.config.WALDir,
+		SegmentSize:    f.config.WALSegmentSize,
+		SyncPolicy:     WALSyncPolicy(f.config.WALSyncPolicy),
+		SyncInterval:   f.config.WALSyncInterval,
+		RetainSegments: f.config.WALRetainSegments,
+	}
+}
+
 // createCompositeProvider creates a provider for composite (dual-write) queue.
 func (f *Factory) createCompositeProvider() (Provider, error) { //nolint:ireturn // factory pattern
 	log.Printf("Creating composite queue with providers: %v, strategy: %s",
@@ -102,7 +586,7 @@ func (f *Factory) createCompositeProvider() (Provider, error) { //nolint:ireturn
 		return nil, ErrNoCompositeProvidersConfigured
 	}
 
-	providers, err := f.createProviders(f.config.CompositeProviders)
+	merge, err := f.parseCompositeSubscribeMode(f.config.CompositeSubscribeMode)
 	if err != nil {
 		return nil, err
 	}
@@ -112,18 +596,40 @@ func (f *Factory) createCompositeProvider() (Provider, error) { //nolint:ireturn
 		return nil, err
 	}
 
-	adapter := NewCompositeAdapter(providers, strategy)
-	log.Printf("Composite queue provider created successfully with %d providers", len(providers))
+	providers, err := f.createProviders(f.config.CompositeProviders)
+	if err != nil {
+		return nil, err
+	}
+
+	var dedupWindow time.Duration
+	if merge {
+		dedupWindow = f.config.CompositeDedupWindow
+		if dedupWindow <= 0 {
+			dedupWindow = DefaultCompositeDedupWindow
+		}
+	}
+
+	adapter := newCompositeAdapter(providers, strategy, f.circuitBreakerConfig(), dedupWindow)
+
+	log.Printf("Composite queue provider created successfully with %d providers, subscribe mode: %s",
+		len(providers), f.config.CompositeSubscribeMode)
 
 	return adapter, nil
 }
 
+// createProviders creates composite members. If one fails, the members created before it are closed.
 func (f *Factory) createProviders(providerTypes []string) ([]Provider, error) {
 	providers := make([]Provider, 0, len(providerTypes))
 
 	for _, providerType := range providerTypes {
 		provider, err := f.createSingleProvider(ProviderType(providerType))
 		if err != nil {
+			for _, created := range providers {
+				if closeErr := created.Close(); closeErr != nil {
+					log.Printf("Error closing composite member: %v", closeErr)
+				}
+			}
+
 			return nil, err
 		}
 
@@ -133,28 +639,25 @@ func (f *Factory) createProviders(providerTypes []string) ([]Provider, error) {
 	return providers, nil
 }
 
+// createSingleProvider creates a composite member with the constructor registered under providerType.
+//
 //nolint:ireturn // factory pattern
 func (f *Factory) createSingleProvider(providerType ProviderType) (Provider, error) {
-	switch providerType {
-	case MemoryProviderType:
-		return NewMemoryAdapter(f.config.QueueSize), nil
-	case NATSProviderType:
-		adapter, err := NewNATSAdapter(f.config.NATSURL, "messages")
-		if err != nil {
-			return nil, fmt.Errorf("failed to create NATS adapter for composite: %w", err)
-		}
+	if providerType == CompositeProviderType {
+		return nil, fmt.Errorf("unsupported provider type in composite: %s: %w", providerType, ErrUnsupportedQueueType)
+	}
 
-		return adapter, nil
-	case KafkaProviderType:
-		adapter, err := NewKafkaAdapter(f.config.KafkaBrokers, f.config.KafkaTopic, f.config.KafkaConsumerGroup)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create Kafka adapter for composite: %w", err)
-		}
+	constructor, err := lookupProvider(providerType)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported provider type in composite: %w", err)
+	}
 
-		return adapter, nil
-	default:
-		return nil, fmt.Errorf("unsupported provider type in composite: %s: %w", providerType, ErrUnsupportedQueueType)
+	provider, err := constructor(f.providerOptions(providerType, true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s provider for composite: %w", providerType, err)
 	}
+
+	return provider, nil
 }
 
 func (f *Factory) parseCompositeStrategy(strategyStr string) (CompositeStrategy, error) {
@@ -163,18 +666,47 @@ func (f *Factory) parseCompositeStrategy(strategyStr string) (CompositeStrategy,
 		return FailFast, nil
 	case "best-effort":
 		return BestEffort, nil
+	case "failover":
+		return Failover, nil
 	default:
 		return FailFast, fmt.Errorf("%w: %s", ErrUnsupportedCompositeStrategy, strategyStr)
 	}
 }
 
-// ValidateProviderType checks if the given queue type is supported.
-func ValidateProviderType(queueType string) error {
-	switch ProviderType(queueType) {
-	case MemoryProviderType, NATSProviderType, KafkaProviderType, CompositeProviderType:
-		return nil
+// circuitBreakerConfig returns breaker settings of the Failover strategy; unset values use defaults.
+func (f *Factory) circuitBreakerConfig() CircuitBreakerConfig {
+	cfg := DefaultCircuitBreakerConfig()
+
+	if f.config.BreakerErrorRate > 0 {
+		cfg.ErrorRateThreshold = f.config.BreakerErrorRate
+	}
+
+	if f.config.BreakerLatency > 0 {
+		cfg.LatencyThreshold = f.config.BreakerLatency
+	}
+
+	if f.config.BreakerOpenTimeout > 0 {
+		cfg.OpenTimeout = f.config.BreakerOpenTimeout
+	}
+
+	return cfg
+}
+
+// parseCompositeSubscribeMode reports whether the composite adapter should merge all providers.
+func (f *Factory) parseCompositeSubscribeMode(mode string) (bool, error) {
+	switch mode {
+	case "", "first":
+		return false, nil
+	case "merge":
+		return true, nil
 	default:
-		return fmt.Errorf("%w: %s. Supported types: %s, %s, %s, %s",
-			ErrUnsupportedQueueType, queueType, MemoryProviderType, NATSProviderType, KafkaProviderType, CompositeProviderType)
+		return false, fmt.Errorf("%w: %s", ErrUnsupportedCompositeSubscribeMode, mode)
 	}
 }
+
+// ValidateProviderType checks if the given queue type is registered.
+func ValidateProviderType(queueType string) error {
+	_, err := lookupProvider(ProviderType(queueType))
+
+	return err
+}
@@ -2,6 +2,7 @@ package queue
 
 import (
 	"context"
+	"time"
 
 	"github.com/stsolovey/diplom-distributed-system/internal/models"
 )
@@ -11,20 +12,51 @@ type Publisher interface {
 	Publish(ctx context.Context, msg *models.DataMessage) error
 }
 
+// BatchPublisher публикует пачку сообщений за один обмен с брокером.
+// Результат содержит ошибку каждого сообщения по его индексу; nil - сообщение опубликовано.
+type BatchPublisher interface {
+	PublishBatch(ctx context.Context, msgs []*models.DataMessage) []error
+}
+
+// Delivery - полученное сообщение вместе с управлением его подтверждением.
+// Потребитель обязан завершить каждую доставку ровно одним из Ack, Nack или Term.
+type Delivery interface {
+	// Message возвращает полученное сообщение.
+	Message() *models.DataMessage
+	// Attempt возвращает номер попытки доставки, начиная с 1.
+	Attempt() int
+	// Ack подтверждает успешную обработку сообщения.
+	Ack() error
+	// Nack возвращает сообщение в очередь для повторной доставки через delay.
+	Nack(delay time.Duration) error
+	// InProgress сообщает брокеру, что обработка еще идет, и продлевает таймаут подтверждения.
+	InProgress() error
+	// Term окончательно отклоняет сообщение без повторной доставки.
+	Term() error
+}
+
+// ResultAcknowledger реализуют доставки, которые публикуют результат обработки атомарно с подтверждением
+// (например, Kafka в транзакционном режиме). Для остальных доставок достаточно Ack.
+type ResultAcknowledger interface {
+	AckWithResult(ctx context.Context, result *models.ProcessingResult) error
+}
+
 // Subscriber интерфейс для подписки на сообщения.
 type Subscriber interface {
-	Subscribe(ctx context.Context) (<-chan *models.DataMessage, error)
+	Subscribe(ctx context.Context) (<-chan Delivery, error)
 	Close() error
 }
 
 // Provider объединяет Publisher и Subscriber.
 type Provider interface {
 	Publisher
+	BatchPublisher
 	Subscriber
 	Stats() Stats
 }
 
-// MessageBroker интерфейс для брокеров сообщений (для будущей интеграции с NATS/Kafka).
+// MessageBroker - подключение к брокеру сообщений, которое обслуживает publisher'ы и subscriber'ы
+// любого числа subject'ов (топиков) через одно соединение.
 type MessageBroker interface {
 	Connect(ctx context.Context) error
 	Disconnect() error
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/stsolovey/diplom-distributed-system/internal/models"
 )
@@ -20,12 +22,19 @@ var (
 	ErrKafkaPublishFailed   = errors.New("kafka publish failed")
 	ErrKafkaSubscribeFailed = errors.New("kafka subscribe failed")
 	ErrKafkaAdapterClose    = errors.New("kafka adapter close errors")
+
+	ErrKafkaRequeueUnavailable = errors.New("kafka requeue is not configured")
 )
 
 type KafkaAdapter struct {
-	producer *KafkaProducer
-	consumer *KafkaConsumer
-	stats    *kafkaStats
+	producer    *KafkaProducer
+	consumer    *KafkaConsumer
+	delays      *kafkaDelayForwarder
+	delayOnce   sync.Once
+	txn         *kafkaTransactor // nil unless offsets are committed in transactions
+	deadLetters *KafkaDeadLetterQueue
+	lag         *kafkaLagReader
+	stats       *kafkaStats
 }
 
 type kafkaStats struct {
@@ -33,30 +42,123 @@ type kafkaStats struct {
 	consumed  int64
 }
 
+// KafkaConfig configures a Kafka adapter.
+type KafkaConfig struct {
+	Brokers       []string
+	Topic         string
+	ConsumerGroup string
+	// CommitMode defines when consumed offsets are committed; empty means KafkaCommitAuto.
+	CommitMode KafkaCommitMode
+	// CommitInterval is how often KafkaCommitManual commits settled offsets.
+	CommitInterval time.Duration
+	// TransactionalID identifies the transactional producer of KafkaCommitTransactional;
+	// it must be unique per running instance.
+	TransactionalID string
+	// ResultsTopic receives processing results in KafkaCommitTransactional; defaults to "<topic>.results".
+	ResultsTopic string
+}
+
 func NewKafkaAdapter(brokers []string, topic, consumerGroup string) (*KafkaAdapter, error) {
+	return NewKafkaAdapterWithConfig(KafkaConfig{
+		Brokers:       brokers,
+		Topic:         topic,
+		ConsumerGroup: consumerGroup,
+	})
+}
+
+// NewKafkaAdapterWithConfig creates a Kafka adapter with explicit consumer settings.
+func NewKafkaAdapterWithConfig(cfg KafkaConfig) (*KafkaAdapter, error) {
+	brokers, topic, consumerGroup := cfg.Brokers, cfg.Topic, cfg.ConsumerGroup
+
 	log.Printf("Creating Kafka adapter with brokers: %v, topic: %s, consumer group: %s", brokers, topic, consumerGroup)
 
+	commitMode, err := ParseKafkaCommitMode(string(cfg.CommitMode))
+	if err != nil {
+		return nil, err
+	}
+
+	if commitMode == KafkaCommitTransactional && cfg.TransactionalID == "" {
+		return nil, ErrKafkaTransactionalIDRequired
+	}
+
 	producer, err := NewKafkaProducer(brokers, topic)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrKafkaProducerCreate, err)
 	}
 
-	consumer, err := NewKafkaConsumer(brokers, topic, consumerGroup)
+	consumer, err := newKafkaConsumer(brokers, topic, consumerGroup, commitMode, cfg.CommitInterval)
 	if err != nil {
 		producer.Close() // Clean up producer if consumer creation fails
 
 		return nil, fmt.Errorf("%w: %w", ErrKafkaConsumerCreate, err)
 	}
 
+	consumer.SetRequeue(producer.Requeue)
+
+	var txn *kafkaTransactor
+
+	if commitMode == KafkaCommitTransactional {
+		resultsTopic := cfg.ResultsTopic
+		if resultsTopic == "" {
+			resultsTopic = topic + kafkaResultsTopicSuffix
+		}
+
+		txn, err = newKafkaTransactor(brokers, cfg.TransactionalID, consumerGroup, resultsTopic, producer)
+		if err != nil {
+			consumer.Close()
+			producer.Close()
+
+			return nil, fmt.Errorf("%w: %w", ErrKafkaProducerCreate, err)
+		}
+
+		consumer.setTransactor(txn)
+	}
+
+	delays, err := newKafkaDelayForwarder(brokers, topic, consumerGroup, producer)
+	if err != nil {
+		if txn != nil {
+			txn.Close()
+		}
+
+		consumer.Close()
+		producer.Close()
+
+		return nil, fmt.Errorf("%w: %w", ErrKafkaConsumerCreate, err)
+	}
+
 	log.Printf("Kafka adapter created successfully")
 
 	return &KafkaAdapter{
-		producer: producer,
-		consumer: consumer,
-		stats:    &kafkaStats{},
+		producer:    producer,
+		consumer:    consumer,
+		delays:      delays,
+		txn:         txn,
+		deadLetters: NewKafkaDeadLetterQueue(brokers, topic+kafkaDeadLetterTopicSuffix, producer.producer),
+		lag:         newKafkaLagReader(brokers, topic, consumerGroup),
+		stats:       &kafkaStats{},
 	}, nil
 }
 
+// SetCodec sets the codec of published records. Consumers decode records by their codec header.
+func (a *KafkaAdapter) SetCodec(codec Codec) {
+	a.producer.SetCodec(codec)
+}
+
+// SetCompression sets per-message compression of published records.
+func (a *KafkaAdapter) SetCompression(cfg CompressionConfig) {
+	a.producer.SetCompression(cfg)
+}
+
+// SetPartitioning sets how the record key and partition are derived from the message.
+func (a *KafkaAdapter) SetPartitioning(cfg KafkaPartitionConfig) {
+	a.producer.SetPartitioning(cfg)
+}
+
+// SetOrdered enables per-partition ordered consumption. Must be called before Subscribe.
+func (a *KafkaAdapter) SetOrdered(ordered bool) {
+	a.consumer.SetOrdered(ordered)
+}
+
 func (a *KafkaAdapter) Publish(ctx context.Context, msg *models.DataMessage) error {
 	err := a.producer.Publish(ctx, msg)
 	if err != nil {
@@ -68,14 +170,34 @@ func (a *KafkaAdapter) Publish(ctx context.Context, msg *models.DataMessage) err
 	return nil
 }
 
-func (a *KafkaAdapter) Subscribe(ctx context.Context) (<-chan *models.DataMessage, error) {
+// PublishBatch implements BatchPublisher.
+func (a *KafkaAdapter) PublishBatch(ctx context.Context, msgs []*models.DataMessage) []error {
+	errs := a.producer.PublishBatch(ctx, msgs)
+
+	for i, err := range errs {
+		if err != nil {
+			errs[i] = fmt.Errorf("%w: %w", ErrKafkaPublishFailed, err)
+
+			continue
+		}
+
+		atomic.AddInt64(&a.stats.published, 1)
+	}
+
+	return errs
+}
+
+func (a *KafkaAdapter) Subscribe(ctx context.Context) (<-chan Delivery, error) {
 	msgChan, err := a.consumer.Subscribe(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrKafkaSubscribeFailed, err)
 	}
 
+	// Delayed messages are released to the topic only while someone consumes it.
+	a.delayOnce.Do(func() { a.delays.Start(ctx) })
+
 	// Wrap channel to count consumed messages
-	countedChan := make(chan *models.DataMessage, kafkaAdapterChanSize)
+	countedChan := make(chan Delivery, kafkaAdapterChanSize)
 
 	go func() {
 		defer close(countedChan)
@@ -98,14 +220,32 @@ func (a *KafkaAdapter) Subscribe(ctx context.Context) (<-chan *models.DataMessag
 func (a *KafkaAdapter) Close() error {
 	var errs []error
 
-	if err := a.producer.Close(); err != nil {
-		errs = append(errs, fmt.Errorf("producer close error: %w", err))
+	// The delay forwarder publishes through the producer, so it is stopped first.
+	if err := a.delays.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("delay forwarder close error: %w", err))
 	}
 
 	if err := a.consumer.Close(); err != nil {
 		errs = append(errs, fmt.Errorf("consumer close error: %w", err))
 	}
 
+	// In-flight deliveries commit through the transactional producer until the consumer stops.
+	if a.txn != nil {
+		if err := a.txn.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("transactional producer close error: %w", err))
+		}
+	}
+
+	// Nack requeues and the dead-letter queue publish through the producer,
+	// so it outlives the deliveries that are still in flight while the consumer stops.
+	if err := a.producer.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("producer close error: %w", err))
+	}
+
+	if err := a.lag.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("lag reader close error: %w", err))
+	}
+
 	if len(errs) > 0 {
 		return fmt.Errorf("%w: %v", ErrKafkaAdapterClose, errs)
 	}
@@ -115,10 +255,37 @@ func (a *KafkaAdapter) Close() error {
 	return nil
 }
 
+// DeadLetters implements DeadLetterProvider.
+func (a *KafkaAdapter) DeadLetters() DeadLetterQueue { //nolint:ireturn // interface by design
+	return a.deadLetters
+}
+
+// MaxAttempts implements DeadLetterProvider.
+func (a *KafkaAdapter) MaxAttempts() int {
+	return defaultMaxDeliveryAttempts
+}
+
+// Stats reports the queue depth as the consumer group lag summed over the topic partitions.
+// If the lag cannot be fetched, CurrentSize is -1.
 func (a *KafkaAdapter) Stats() Stats {
-	return Stats{
+	stats := Stats{
 		TotalEnqueued: atomic.LoadInt64(&a.stats.published),
 		TotalDequeued: atomic.LoadInt64(&a.stats.consumed),
-		CurrentSize:   0, // Kafka queue size is not directly measurable
+		CurrentSize:   -1,
+	}
+
+	lags, err := a.lag.lag()
+	if err != nil {
+		return stats
 	}
+
+	var total int64
+	for _, lag := range lags {
+		total += lag.Lag
+	}
+
+	stats.CurrentSize = int(total)
+	stats.PartitionLag = lags
+
+	return stats
 }
@@ -6,10 +6,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/IBM/sarama"
 	"github.com/google/uuid"
 	"github.com/stsolovey/diplom-distributed-system/internal/models"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/kafka"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestKafkaAdapter_Integration(t *testing.T) {
@@ -78,11 +80,16 @@ func TestKafkaAdapter_Integration(t *testing.T) {
 
 	// Wait for message
 	select {
-	case receivedMsg := <-msgChan:
-		if receivedMsg == nil {
+	case delivery := <-msgChan:
+		if delivery == nil {
 			t.Fatal("Received nil message")
 		}
 
+		receivedMsg := delivery.Message()
+		if err := delivery.Ack(); err != nil {
+			t.Errorf("Failed to ack message: %v", err)
+		}
+
 		if receivedMsg.GetId() != testMsg.GetId() {
 			t.Errorf("Expected message ID %s, got %s", testMsg.GetId(), receivedMsg.GetId())
 		}
@@ -184,9 +191,13 @@ func TestKafkaAdapter_PublishMultiple(t *testing.T) {
 
 	for receivedCount < messageCount {
 		select {
-		case receivedMsg := <-msgChan:
-			if receivedMsg != nil {
+		case delivery := <-msgChan:
+			if delivery != nil {
 				receivedCount++
+
+				if err := delivery.Ack(); err != nil {
+					t.Errorf("Failed to ack message: %v", err)
+				}
 			}
 
 		case <-timeout:
@@ -204,3 +215,188 @@ func TestKafkaAdapter_PublishMultiple(t *testing.T) {
 		t.Errorf("Expected %d dequeued messages, got %d", messageCount, stats.TotalDequeued)
 	}
 }
+
+func TestKafkaAdapter_TransactionalResults(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	// Start Kafka container
+	kafkaContainer, err := kafka.Run(ctx,
+		"confluentinc/cp-kafka:7.5.0",
+		kafka.WithClusterID("test-cluster-transactional"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to start Kafka container: %v", err)
+	}
+	defer func() {
+		if err := testcontainers.TerminateContainer(kafkaContainer); err != nil {
+			t.Logf("Failed to terminate Kafka container: %v", err)
+		}
+	}()
+
+	brokers, err := kafkaContainer.Brokers(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get Kafka brokers: %v", err)
+	}
+
+	// Wait for Kafka to stabilize
+	time.Sleep(5 * time.Second)
+
+	topic := "test-topic-transactional"
+	consumerGroup := "test-group-transactional"
+	resultsTopic := topic + ".results"
+
+	adapter, err := NewKafkaAdapterWithConfig(KafkaConfig{
+		Brokers:         brokers,
+		Topic:           topic,
+		ConsumerGroup:   consumerGroup,
+		CommitMode:      KafkaCommitTransactional,
+		TransactionalID: "test-transactional-id",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Kafka adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	msgChan, err := adapter.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	// Wait for consumer to be ready
+	time.Sleep(2 * time.Second)
+
+	testMsg := &models.DataMessage{
+		Id:        uuid.New().String(),
+		Timestamp: time.Now().Unix(),
+		Source:    "test-source",
+		Payload:   []byte("test payload"),
+	}
+
+	if err := adapter.Publish(ctx, testMsg); err != nil {
+		t.Fatalf("Failed to publish message: %v", err)
+	}
+
+	select {
+	case delivery := <-msgChan:
+		acker, ok := delivery.(ResultAcknowledger)
+		if !ok {
+			t.Fatal("Kafka delivery does not implement ResultAcknowledger")
+		}
+
+		result := &models.ProcessingResult{
+			MessageId:   delivery.Message().GetId(),
+			ProcessedAt: time.Now().Unix(),
+			Success:     true,
+		}
+		if err := acker.AckWithResult(ctx, result); err != nil {
+			t.Fatalf("Failed to ack message with result: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Timeout waiting for message")
+	}
+
+	// The result is visible to read_committed consumers.
+	consumer, err := sarama.NewConsumer(brokers, getKafkaConsumerConfig())
+	if err != nil {
+		t.Fatalf("Failed to create results consumer: %v", err)
+	}
+	defer consumer.Close()
+
+	partition, err := consumer.ConsumePartition(resultsTopic, 0, sarama.OffsetOldest)
+	if err != nil {
+		t.Fatalf("Failed to consume results topic: %v", err)
+	}
+	defer partition.Close()
+
+	select {
+	case record := <-partition.Messages():
+		var result models.ProcessingResult
+		if err := proto.Unmarshal(record.Value, &result); err != nil {
+			t.Fatalf("Failed to unmarshal result: %v", err)
+		}
+
+		if result.GetMessageId() != testMsg.GetId() {
+			t.Errorf("Expected result for %s, got %s", testMsg.GetId(), result.GetMessageId())
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Timeout waiting for result")
+	}
+
+	// The consumed offset was committed in the same transaction.
+	admin, err := sarama.NewClusterAdmin(brokers, getKafkaConsumerConfig())
+	if err != nil {
+		t.Fatalf("Failed to create cluster admin: %v", err)
+	}
+	defer admin.Close()
+
+	offsets, err := admin.ListConsumerGroupOffsets(consumerGroup, map[string][]int32{topic: {0}})
+	if err != nil {
+		t.Fatalf("Failed to list consumer group offsets: %v", err)
+	}
+
+	if block := offsets.GetBlock(topic, 0); block == nil || block.Offset != 1 {
+		t.Errorf("Expected committed offset 1, got %+v", block)
+	}
+}
+
+func TestKafkaAdapter_PartitionLag(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+
+	kafkaContainer, err := kafka.Run(ctx,
+		"confluentinc/cp-kafka:7.5.0",
+		kafka.WithClusterID("test-cluster-lag"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to start Kafka container: %v", err)
+	}
+	defer func() {
+		if err := testcontainers.TerminateContainer(kafkaContainer); err != nil {
+			t.Logf("Failed to terminate Kafka container: %v", err)
+		}
+	}()
+
+	brokers, err := kafkaContainer.Brokers(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get Kafka brokers: %v", err)
+	}
+
+	time.Sleep(5 * time.Second)
+
+	adapter, err := NewKafkaAdapter(brokers, "test-topic-lag", "test-group-lag")
+	if err != nil {
+		t.Fatalf("Failed to create Kafka adapter: %v", err)
+	}
+	defer adapter.Close()
+
+	// Nobody consumes, so every published message counts as lag.
+	messageCount := 3
+	for i := 0; i < messageCount; i++ {
+		msg := &models.DataMessage{Id: uuid.New().String(), Payload: []byte("lag " + strconv.Itoa(i))}
+		if err := adapter.Publish(ctx, msg); err != nil {
+			t.Fatalf("Failed to publish message %d: %v", i, err)
+		}
+	}
+
+	stats := adapter.Stats()
+	if stats.CurrentSize != messageCount {
+		t.Errorf("Expected queue depth %d, got %d", messageCount, stats.CurrentSize)
+	}
+
+	if len(stats.PartitionLag) == 0 {
+		t.Fatal("Expected per-partition lag to be reported")
+	}
+
+	for _, lag := range stats.PartitionLag {
+		if lag.Topic != "test-topic-lag" {
+			t.Errorf("Expected lag of test-topic-lag, got %s", lag.Topic)
+		}
+	}
+}
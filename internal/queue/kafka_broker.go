@@ -0,0 +1,175 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+var ErrKafkaBrokerNotConnected = errors.New("kafka broker is not connected")
+
+// KafkaBroker implements MessageBroker: one client connection and one producer serve
+// publishers and subscribers of any number of topics.
+type KafkaBroker struct {
+	mu       sync.Mutex
+	brokers  []string
+	groupID  string
+	client   sarama.Client
+	producer sarama.SyncProducer
+
+	// Wire format of publishers created by CreatePublisher.
+	codec       Codec
+	compression CompressionConfig
+}
+
+// NewKafkaBroker creates a broker; subscribers join the given consumer group. Call Connect before use.
+func NewKafkaBroker(brokers []string, groupID string) *KafkaBroker {
+	return &KafkaBroker{
+		brokers: brokers,
+		groupID: groupID,
+		codec:   protobufCodec{},
+	}
+}
+
+// Connect implements MessageBroker. Calling it on a connected broker is a no-op.
+func (b *KafkaBroker) Connect(_ context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.client != nil && !b.client.Closed() {
+		return nil
+	}
+
+	client, err := sarama.NewClient(b.brokers, getKafkaClientConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+
+		return fmt.Errorf("%w: %w", ErrKafkaProducerCreate, err)
+	}
+
+	b.client = client
+	b.producer = producer
+
+	return nil
+}
+
+// Disconnect implements MessageBroker. Subscribers must be closed first.
+func (b *KafkaBroker) Disconnect() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.client == nil {
+		return nil
+	}
+
+	var errs []error
+
+	if err := b.producer.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("producer close error: %w", err))
+	}
+
+	if err := b.client.Close(); err != nil && !errors.Is(err, sarama.ErrClosedClient) {
+		errs = append(errs, fmt.Errorf("client close error: %w", err))
+	}
+
+	b.client = nil
+	b.producer = nil
+
+	return errors.Join(errs...)
+}
+
+// SetCodec sets the codec of publishers created by CreatePublisher.
+func (b *KafkaBroker) SetCodec(codec Codec) {
+	b.codec = codec
+}
+
+// SetCompression sets the compression of publishers created by CreatePublisher.
+func (b *KafkaBroker) SetCompression(cfg CompressionConfig) {
+	b.compression = cfg
+}
+
+// CreatePublisher implements MessageBroker: the publisher writes to the topic through the shared producer.
+func (b *KafkaBroker) CreatePublisher(topic string) (Publisher, error) { //nolint:ireturn // MessageBroker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.client == nil {
+		return nil, ErrKafkaBrokerNotConnected
+	}
+
+	return b.newProducer(topic), nil
+}
+
+// CreateSubscriber implements MessageBroker: the subscriber consumes the topic and its delay topics
+// in the broker's consumer group over the shared client.
+func (b *KafkaBroker) CreateSubscriber(topic string) (Subscriber, error) { //nolint:ireturn // MessageBroker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.client == nil {
+		return nil, ErrKafkaBrokerNotConnected
+	}
+
+	group, err := sarama.NewConsumerGroupFromClient(b.groupID, b.client)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKafkaConsumerCreate, err)
+	}
+
+	delayGroup, err := sarama.NewConsumerGroupFromClient(b.groupID+kafkaDelayGroupSuffix, b.client)
+	if err != nil {
+		group.Close()
+
+		return nil, fmt.Errorf("%w: %w", ErrKafkaConsumerCreate, err)
+	}
+
+	producer := b.newProducer(topic)
+
+	consumer := newKafkaGroupConsumer(group, topic)
+	consumer.SetRequeue(producer.Requeue)
+
+	return &kafkaTopicSubscriber{
+		consumer: consumer,
+		delays:   newKafkaGroupDelayForwarder(delayGroup, topic, producer),
+	}, nil
+}
+
+// newProducer creates a publisher of the topic on the shared producer. Called with b.mu held.
+func (b *KafkaBroker) newProducer(topic string) *KafkaProducer {
+	producer := newSharedKafkaProducer(b.producer, topic)
+	producer.SetCodec(b.codec)
+	producer.SetCompression(b.compression)
+
+	return producer
+}
+
+// kafkaTopicSubscriber consumes one topic of a KafkaBroker and releases its delayed records.
+type kafkaTopicSubscriber struct {
+	consumer  *KafkaConsumer
+	delays    *kafkaDelayForwarder
+	delayOnce sync.Once
+}
+
+// Subscribe implements Subscriber.
+func (s *kafkaTopicSubscriber) Subscribe(ctx context.Context) (<-chan Delivery, error) {
+	deliveries, err := s.consumer.Subscribe(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKafkaSubscribeFailed, err)
+	}
+
+	s.delayOnce.Do(func() { s.delays.Start(ctx) })
+
+	return deliveries, nil
+}
+
+// Close implements Subscriber. The shared client and producer stay open until the broker disconnects.
+func (s *kafkaTopicSubscriber) Close() error {
+	return errors.Join(s.delays.Close(), s.consumer.Close())
+}
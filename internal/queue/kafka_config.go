@@ -32,6 +32,7 @@ func getKafkaProducerConfig() *sarama.Config {
 	config.Producer.RequiredAcks = sarama.WaitForAll
 	config.Producer.Retry.Max = kafkaProducerRetryMax
 	config.Producer.Return.Successes = true
+	config.Producer.Partitioner = newKafkaPartitioner
 
 	// Required for idempotency.
 	config.Net.MaxOpenRequests = 1
@@ -48,16 +49,41 @@ func getKafkaProducerConfig() *sarama.Config {
 	return config
 }
 
+// getKafkaTransactionalProducerConfig returns configuration for a transactional Producer.
+// The transactional ID must be unique per running instance: a newer producer with the same ID fences the older one.
+func getKafkaTransactionalProducerConfig(transactionalID string) *sarama.Config {
+	config := getKafkaProducerConfig()
+	config.Producer.Transaction.ID = transactionalID
+
+	return config
+}
+
 // getKafkaConsumerConfig returns configuration for Consumer.
 func getKafkaConsumerConfig() *sarama.Config {
 	config := sarama.NewConfig()
 	config.Version = sarama.V3_5_0_0
 
+	applyKafkaConsumerConfig(config)
+
+	return config
+}
+
+// getKafkaClientConfig returns configuration for a client shared by producers and consumer groups.
+func getKafkaClientConfig() *sarama.Config {
+	config := getKafkaProducerConfig()
+	applyKafkaConsumerConfig(config)
+
+	return config
+}
+
+func applyKafkaConsumerConfig(config *sarama.Config) {
 	// Consumer group settings.
 	config.Consumer.Group.Rebalance.Strategy = sarama.NewBalanceStrategyRoundRobin()
 	config.Consumer.Offsets.Initial = sarama.OffsetOldest // Read from beginning.
 	config.Consumer.Offsets.AutoCommit.Enable = true
 	config.Consumer.Offsets.AutoCommit.Interval = 1 * time.Second
+	// Records of aborted transactions are never delivered.
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
 
 	// Session timeouts.
 	config.Consumer.Group.Session.Timeout = kafkaSessionTimeout
@@ -66,6 +92,4 @@ func getKafkaConsumerConfig() *sarama.Config {
 	// Processing settings.
 	config.Consumer.MaxProcessingTime = 1 * time.Minute
 	config.Consumer.Fetch.Default = kafkaFetchDefaultSize
-
-	return config
 }
@@ -2,10 +2,11 @@ package queue
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/stsolovey/diplom-distributed-system/internal/models"
@@ -24,29 +25,95 @@ type KafkaConsumer struct {
 }
 
 type kafkaConsumerHandler struct {
-	msgChan chan *models.DataMessage
+	msgChan chan Delivery
 	ready   chan bool
+	requeue kafkaRequeueFunc
+	ordered bool
+
+	// Transactional commit mode: offsets are committed in the transaction that settles the record.
+	txn *kafkaTransactor
+	// restart ends the current group session so revoked work is re-read from the committed offsets.
+	restart context.CancelFunc
+
+	// Manual commit mode: offsets are committed by the handler, not by sarama.
+	manualCommit   bool
+	commitInterval time.Duration
+	stopCommits    context.CancelFunc
+	commitsDone    chan struct{}
 }
 
 func NewKafkaConsumer(brokers []string, topic, groupID string) (*KafkaConsumer, error) {
+	return newKafkaConsumer(brokers, topic, groupID, KafkaCommitAuto, 0)
+}
+
+func newKafkaConsumer(
+	brokers []string,
+	topic, groupID string,
+	commitMode KafkaCommitMode,
+	commitInterval time.Duration,
+) (*KafkaConsumer, error) {
 	config := getKafkaConsumerConfig()
 
+	manualCommit := commitMode == KafkaCommitManual
+	if manualCommit {
+		config.Consumer.Offsets.AutoCommit.Enable = false
+
+		if commitInterval <= 0 {
+			commitInterval = DefaultKafkaCommitInterval
+		}
+	}
+
+	// Transactions commit offsets themselves.
+	if commitMode == KafkaCommitTransactional {
+		config.Consumer.Offsets.AutoCommit.Enable = false
+	}
+
 	consumerGroup, err := sarama.NewConsumerGroup(brokers, groupID, config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create consumer group: %w", err)
 	}
 
+	consumer := newKafkaGroupConsumer(consumerGroup, topic)
+	consumer.handler.manualCommit = manualCommit
+	consumer.handler.commitInterval = commitInterval
+
+	return consumer, nil
+}
+
+// newKafkaGroupConsumer consumes the topic through an existing consumer group.
+func newKafkaGroupConsumer(consumerGroup sarama.ConsumerGroup, topic string) *KafkaConsumer {
 	return &KafkaConsumer{
 		consumerGroup: consumerGroup,
 		topic:         topic,
 		handler: &kafkaConsumerHandler{
-			msgChan: make(chan *models.DataMessage, kafkaConsumerChanSize),
+			msgChan: make(chan Delivery, kafkaConsumerChanSize),
 			ready:   make(chan bool),
 		},
-	}, nil
+	}
+}
+
+// setTransactor enables the transactional commit mode. Must be called before Subscribe.
+func (c *KafkaConsumer) setTransactor(txn *kafkaTransactor) {
+	c.handler.txn = txn
+}
+
+// kafkaRequeueFunc republishes a message to the topic for the given delivery attempt.
+type kafkaRequeueFunc func(ctx context.Context, msg *models.DataMessage, attempt int) error
+
+// SetRequeue sets the function used by Delivery.Nack to put a message back to the topic.
+// Kafka has no per-message negative acknowledgment, so redelivery is done by republishing.
+func (c *KafkaConsumer) SetRequeue(requeue kafkaRequeueFunc) {
+	c.handler.requeue = requeue
 }
 
-func (c *KafkaConsumer) Subscribe(ctx context.Context) (<-chan *models.DataMessage, error) {
+// SetOrdered switches the consumer to ordered mode: a partition hands out its next record only
+// after the previous one has been settled, while different partitions are still consumed in parallel.
+// Must be called before Subscribe.
+func (c *KafkaConsumer) SetOrdered(ordered bool) {
+	c.handler.ordered = ordered
+}
+
+func (c *KafkaConsumer) Subscribe(ctx context.Context) (<-chan Delivery, error) {
 	// Create cancellable context for proper shutdown
 	consumeCtx, cancel := context.WithCancel(ctx)
 	c.cancel = cancel
@@ -58,12 +125,17 @@ func (c *KafkaConsumer) Subscribe(ctx context.Context) (<-chan *models.DataMessa
 		defer close(c.handler.msgChan)
 
 		for {
+			sessionCtx, restart := context.WithCancel(consumeCtx)
+			c.handler.restart = restart
+
 			// Consumer group will handle reconnections automatically
-			err := c.consumerGroup.Consume(consumeCtx, []string{c.topic}, c.handler)
+			err := c.consumerGroup.Consume(sessionCtx, []string{c.topic}, c.handler)
 			if err != nil {
 				log.Printf("Error from consumer: %v", err)
 			}
 
+			restart()
+
 			// Check if context was cancelled (shutdown requested)
 			if consumeCtx.Err() != nil {
 				return
@@ -98,20 +170,65 @@ func (c *KafkaConsumer) Close() error {
 }
 
 // ConsumerGroupHandler interface implementation.
-func (h *kafkaConsumerHandler) Setup(sarama.ConsumerGroupSession) error {
+func (h *kafkaConsumerHandler) Setup(session sarama.ConsumerGroupSession) error {
+	if h.manualCommit {
+		h.startCommits(session)
+	}
+
 	close(h.ready)
 
 	return nil
 }
 
-func (h *kafkaConsumerHandler) Cleanup(sarama.ConsumerGroupSession) error {
+func (h *kafkaConsumerHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	if h.manualCommit {
+		h.stopCommits()
+		<-h.commitsDone
+
+		// Commit what was settled before the partitions are handed to another member.
+		session.Commit()
+	}
+
 	return nil
 }
 
+// startCommits periodically commits the offsets marked by settled deliveries of the session.
+func (h *kafkaConsumerHandler) startCommits(session sarama.ConsumerGroupSession) {
+	ctx, cancel := context.WithCancel(session.Context())
+	h.stopCommits = cancel
+	h.commitsDone = make(chan struct{})
+
+	go func() {
+		defer close(h.commitsDone)
+
+		ticker := time.NewTicker(h.commitInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				session.Commit()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
 func (h *kafkaConsumerHandler) ConsumeClaim(
 	session sarama.ConsumerGroupSession,
 	claim sarama.ConsumerGroupClaim,
 ) error {
+	// In manual commit mode every claim tracks its own partition's settled offsets.
+	var offsets *kafkaOffsetTracker
+	if h.manualCommit {
+		offsets = newKafkaOffsetTracker()
+	}
+
+	// Transactions settle a partition strictly in order, so every transaction
+	// commits the offset right after its own record.
+	ordered := h.ordered || h.txn != nil
+
 	for {
 		select {
 		case message := <-claim.Messages():
@@ -119,23 +236,248 @@ func (h *kafkaConsumerHandler) ConsumeClaim(
 				return nil
 			}
 
+			if offsets != nil {
+				offsets.track(message.Offset)
+			}
+
 			var msg models.DataMessage
-			if err := json.Unmarshal(message.Value, &msg); err != nil {
+			if err := decodeKafkaRecord(message, &msg); err != nil {
 				log.Printf("Failed to unmarshal Kafka message: %v", err)
-				session.MarkMessage(message, "")
+				markKafkaRecord(session, offsets, message)
 
 				continue
 			}
 
+			delivery := &kafkaDelivery{
+				session: session,
+				message: message,
+				msg:     &msg,
+				attempt: kafkaRecordAttempt(message),
+				requeue: h.requeue,
+				offsets: offsets,
+				txn:     h.txn,
+			}
+			if ordered {
+				delivery.done = make(chan struct{})
+			}
+
+			// The offset is marked only when the consumer acknowledges the delivery.
 			select {
-			case h.msgChan <- &msg:
-				session.MarkMessage(message, "")
+			case h.msgChan <- delivery:
 			case <-session.Context().Done():
 				return nil
 			}
 
+			// Each claim is one partition, so blocking here keeps that partition in order
+			// without holding back the others.
+			if ordered {
+				select {
+				case <-delivery.done:
+				case <-session.Context().Done():
+					return nil
+				}
+
+				// A failed transaction left the record uncommitted: rejoin the group so the
+				// partition is consumed again from the last committed offset.
+				if delivery.err != nil {
+					log.Printf("Restarting Kafka consumer session after failed transaction: %v", delivery.err)
+					h.restart()
+
+					return nil
+				}
+			}
+
 		case <-session.Context().Done():
 			return nil
 		}
 	}
 }
+
+// kafkaDelivery acknowledges a Kafka record by marking its offset in the consumer group session.
+type kafkaDelivery struct {
+	deliveryState
+
+	session sarama.ConsumerGroupSession
+	message *sarama.ConsumerMessage
+	msg     *models.DataMessage
+	attempt int
+	requeue kafkaRequeueFunc
+	done    chan struct{}       // closed once the delivery is settled; nil unless the consumer is ordered
+	offsets *kafkaOffsetTracker // nil unless offsets are committed manually
+	txn     *kafkaTransactor    // nil unless offsets are committed in transactions
+	err     error               // failed transaction; read by the handler after done is closed
+}
+
+// markKafkaRecord marks a settled record. With manual commits the partition offset only moves
+// once all earlier records are settled too.
+func markKafkaRecord(session sarama.ConsumerGroupSession, offsets *kafkaOffsetTracker, message *sarama.ConsumerMessage) {
+	if offsets == nil {
+		session.MarkMessage(message, "")
+
+		return
+	}
+
+	if next, ok := offsets.complete(message.Offset); ok {
+		session.MarkOffset(message.Topic, message.Partition, next, "")
+	}
+}
+
+// finish releases the next record of the partition in ordered mode.
+func (d *kafkaDelivery) finish() {
+	if d.done != nil {
+		close(d.done)
+	}
+}
+
+// kafkaRecordAttempt reads the delivery attempt from the record header; records without it are first attempts.
+func kafkaRecordAttempt(message *sarama.ConsumerMessage) int {
+	if attempt, err := strconv.Atoi(kafkaRecordHeader(message, kafkaAttemptHeader)); err == nil && attempt > 0 {
+		return attempt
+	}
+
+	return 1
+}
+
+// decodeKafkaRecord decompresses and decodes the record value according to its headers.
+// Records without a codec header are JSON, records without a compression header are not compressed.
+func decodeKafkaRecord(message *sarama.ConsumerMessage, msg *models.DataMessage) error {
+	data, err := decompressBody(kafkaRecordHeader(message, compressionHeader), message.Value)
+	if err != nil {
+		return err
+	}
+
+	return decodeMessage(kafkaRecordHeader(message, codecHeader), data, msg)
+}
+
+// kafkaRecordHeader returns the value of the record header or "" if it is missing.
+func kafkaRecordHeader(message *sarama.ConsumerMessage, key string) string {
+	for _, header := range message.Headers {
+		if header != nil && string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+
+	return ""
+}
+
+// Message implements Delivery.
+func (d *kafkaDelivery) Message() *models.DataMessage {
+	return d.msg
+}
+
+// Attempt implements Delivery.
+func (d *kafkaDelivery) Attempt() int {
+	return d.attempt
+}
+
+// Ack implements Delivery.
+func (d *kafkaDelivery) Ack() error {
+	if err := d.settle(); err != nil {
+		return err
+	}
+	defer d.finish()
+
+	if d.txn != nil {
+		return d.commit()
+	}
+
+	markKafkaRecord(d.session, d.offsets, d.message)
+
+	return nil
+}
+
+// AckWithResult implements ResultAcknowledger: in the transactional commit mode the result is published
+// to the results topic in the same transaction that commits the record offset. Otherwise it is a plain Ack.
+func (d *kafkaDelivery) AckWithResult(_ context.Context, result *models.ProcessingResult) error {
+	if d.txn == nil {
+		return d.Ack()
+	}
+
+	if err := d.settle(); err != nil {
+		return err
+	}
+	defer d.finish()
+
+	record, err := d.txn.resultRecord(result)
+	if err != nil {
+		d.err = err
+
+		return err
+	}
+
+	return d.commit(record)
+}
+
+// commit runs the transaction that publishes the records and commits the record offset.
+func (d *kafkaDelivery) commit(records ...*sarama.ProducerMessage) error {
+	if err := d.txn.commit(d.message, records...); err != nil {
+		d.err = err
+
+		return fmt.Errorf("failed to commit Kafka message %s: %w", d.msg.GetId(), err)
+	}
+
+	return nil
+}
+
+// Nack implements Delivery by republishing the message to the topic.
+// A positive delay routes the copy through the delay topics. The original offset
+// is marked only once the copy has been published. If the copy cannot be published,
+// the delivery stays unsettled so the caller can retry the Nack or Term the record.
+func (d *kafkaDelivery) Nack(delay time.Duration) error {
+	if d.requeue == nil {
+		return ErrKafkaRequeueUnavailable
+	}
+
+	if err := d.settle(); err != nil {
+		return err
+	}
+
+	// The copy carries the delay; Message() keeps returning the record as it was consumed.
+	msg := cloneMessage(d.msg)
+	SetDelay(msg, delay)
+
+	if d.txn != nil {
+		defer d.finish()
+
+		record, err := d.txn.records.requeueMessage(msg, d.attempt+1)
+		if err != nil {
+			d.err = err
+
+			return err
+		}
+
+		return d.commit(record)
+	}
+
+	if err := d.requeue(context.Background(), msg, d.attempt+1); err != nil {
+		d.settled.Store(false)
+
+		return fmt.Errorf("%w: Kafka message %s: %w", ErrRequeueFailed, d.msg.GetId(), err)
+	}
+
+	markKafkaRecord(d.session, d.offsets, d.message)
+	d.finish()
+
+	return nil
+}
+
+// InProgress implements Delivery. Kafka has no per-message acknowledgment timeout.
+func (d *kafkaDelivery) InProgress() error {
+	return nil
+}
+
+// Term implements Delivery by skipping the record.
+func (d *kafkaDelivery) Term() error {
+	if err := d.settle(); err != nil {
+		return err
+	}
+	defer d.finish()
+
+	if d.txn != nil {
+		return d.commit()
+	}
+
+	markKafkaRecord(d.session, d.offsets, d.message)
+
+	return nil
+}
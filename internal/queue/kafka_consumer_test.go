@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+// markingSession records the offsets marked by deliveries.
+type markingSession struct {
+	sarama.ConsumerGroupSession
+
+	marked []int64
+}
+
+func (s *markingSession) MarkMessage(message *sarama.ConsumerMessage, _ string) {
+	s.marked = append(s.marked, message.Offset)
+}
+
+func TestKafkaDelivery_FailedRequeueStaysUnsettled(t *testing.T) {
+	errPublish := errors.New("broker unavailable")
+	session := &markingSession{}
+
+	delivery := &kafkaDelivery{
+		session: session,
+		message: &sarama.ConsumerMessage{Topic: "messages", Offset: 7},
+		msg:     &models.DataMessage{Id: "retry"},
+		attempt: 1,
+		requeue: func(context.Context, *models.DataMessage, int) error { return errPublish },
+		done:    make(chan struct{}),
+	}
+
+	if err := delivery.Nack(0); !errors.Is(err, ErrRequeueFailed) || !errors.Is(err, errPublish) {
+		t.Fatalf("Expected ErrRequeueFailed, got %v", err)
+	}
+
+	// The offset must not move past a record that was not stored anywhere.
+	if len(session.marked) != 0 {
+		t.Fatalf("Expected no marked offsets, got %v", session.marked)
+	}
+
+	select {
+	case <-delivery.done:
+		t.Fatal("Expected the partition to wait for the unsettled delivery")
+	default:
+	}
+
+	if err := delivery.Term(); err != nil {
+		t.Fatalf("Expected Term to settle the delivery, got %v", err)
+	}
+
+	if len(session.marked) != 1 || session.marked[0] != 7 {
+		t.Fatalf("Expected offset 7 marked after Term, got %v", session.marked)
+	}
+}
+
+func TestKafkaDelivery_NackDelaysCopy(t *testing.T) {
+	session := &markingSession{}
+	msg := &models.DataMessage{Id: "delayed"}
+
+	var requeued *models.DataMessage
+
+	delivery := &kafkaDelivery{
+		session: session,
+		message: &sarama.ConsumerMessage{Topic: "messages", Offset: 3},
+		msg:     msg,
+		attempt: 1,
+		requeue: func(_ context.Context, copied *models.DataMessage, _ int) error {
+			requeued = copied
+
+			return nil
+		},
+		done: make(chan struct{}),
+	}
+
+	if err := delivery.Nack(time.Minute); err != nil {
+		t.Fatalf("Failed to nack: %v", err)
+	}
+
+	if requeued == nil || requeued == msg {
+		t.Fatal("Expected a copy of the message to be requeued")
+	}
+
+	if _, ok := DeliverAt(requeued); !ok {
+		t.Error("Expected the requeued copy to carry deliver_at")
+	}
+
+	if _, ok := DeliverAt(delivery.Message()); ok {
+		t.Error("Expected the consumed message to stay without deliver_at")
+	}
+}
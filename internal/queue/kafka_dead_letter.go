@@ -0,0 +1,219 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/google/uuid"
+)
+
+const (
+	// kafkaDeadLetterTopicSuffix is appended to the main topic name to get the DLQ topic.
+	kafkaDeadLetterTopicSuffix = ".dlq"
+	// kafkaDeadLetterReadTimeout bounds a single DLQ partition scan.
+	kafkaDeadLetterReadTimeout = 10 * time.Second
+)
+
+// KafkaDeadLetterQueue stores dead letters in a separate topic keyed by entry ID.
+// Kafka cannot delete individual records, so Delete writes a tombstone (nil value)
+// for the key and readers fold the topic into its latest state.
+type KafkaDeadLetterQueue struct {
+	brokers  []string
+	topic    string
+	producer sarama.SyncProducer
+}
+
+// NewKafkaDeadLetterQueue creates a DLQ on the given topic reusing an existing producer.
+func NewKafkaDeadLetterQueue(brokers []string, topic string, producer sarama.SyncProducer) *KafkaDeadLetterQueue {
+	return &KafkaDeadLetterQueue{
+		brokers:  brokers,
+		topic:    topic,
+		producer: producer,
+	}
+}
+
+// Put implements DeadLetterQueue.
+func (q *KafkaDeadLetterQueue) Put(_ context.Context, dl *DeadLetter) error {
+	dl.ID = uuid.New().String()
+
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+
+	_, _, err = q.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: q.topic,
+		Key:   sarama.StringEncoder(dl.ID),
+		Value: sarama.ByteEncoder(data),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send dead letter to Kafka: %w", err)
+	}
+
+	return nil
+}
+
+// List implements DeadLetterQueue. Entries are ordered by failure time.
+func (q *KafkaDeadLetterQueue) List(ctx context.Context, limit int) ([]*DeadLetter, error) {
+	entries, err := q.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*DeadLetter, 0, len(entries))
+	for _, dl := range entries {
+		result = append(result, dl)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].FailedAt.Before(result[j].FailedAt)
+	})
+
+	if limit > 0 && limit < len(result) {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+// Get implements DeadLetterQueue.
+func (q *KafkaDeadLetterQueue) Get(ctx context.Context, id string) (*DeadLetter, error) {
+	entries, err := q.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dl, ok := entries[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+
+	return dl, nil
+}
+
+// Delete implements DeadLetterQueue by writing a tombstone for the entry key.
+func (q *KafkaDeadLetterQueue) Delete(ctx context.Context, id string) error {
+	if _, err := q.Get(ctx, id); err != nil {
+		return err
+	}
+
+	_, _, err := q.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: q.topic,
+		Key:   sarama.StringEncoder(id),
+		Value: nil,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send dead letter tombstone to Kafka: %w", err)
+	}
+
+	return nil
+}
+
+// load reads the DLQ topic from the oldest offset up to the high-water mark of every partition.
+func (q *KafkaDeadLetterQueue) load(ctx context.Context) (map[string]*DeadLetter, error) {
+	client, err := sarama.NewClient(q.brokers, getKafkaConsumerConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+	defer client.Close()
+
+	partitions, err := client.Partitions(q.topic)
+	if err != nil {
+		// Topic is created on the first Put.
+		if errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+			return map[string]*DeadLetter{}, nil
+		}
+
+		return nil, fmt.Errorf("failed to get DLQ partitions: %w", err)
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka consumer: %w", err)
+	}
+	defer consumer.Close()
+
+	entries := make(map[string]*DeadLetter)
+
+	for _, partition := range partitions {
+		if err := q.loadPartition(ctx, client, consumer, partition, entries); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+func (q *KafkaDeadLetterQueue) loadPartition(
+	ctx context.Context,
+	client sarama.Client,
+	consumer sarama.Consumer,
+	partition int32,
+	entries map[string]*DeadLetter,
+) error {
+	oldest, err := client.GetOffset(q.topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return fmt.Errorf("failed to get oldest DLQ offset: %w", err)
+	}
+
+	newest, err := client.GetOffset(q.topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return fmt.Errorf("failed to get newest DLQ offset: %w", err)
+	}
+
+	if oldest >= newest {
+		return nil
+	}
+
+	partitionConsumer, err := consumer.ConsumePartition(q.topic, partition, oldest)
+	if err != nil {
+		return fmt.Errorf("failed to consume DLQ partition %d: %w", partition, err)
+	}
+	defer partitionConsumer.Close()
+
+	timeout := time.NewTimer(kafkaDeadLetterReadTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case message := <-partitionConsumer.Messages():
+			if message == nil {
+				return nil
+			}
+
+			applyKafkaDeadLetter(message, entries)
+
+			if message.Offset >= newest-1 {
+				return nil
+			}
+		case <-timeout.C:
+			return fmt.Errorf("timeout reading DLQ partition %d", partition)
+		case <-ctx.Done():
+			return fmt.Errorf("DLQ read canceled: %w", ctx.Err())
+		}
+	}
+}
+
+// applyKafkaDeadLetter folds a DLQ record into the current state: tombstones remove the key.
+func applyKafkaDeadLetter(message *sarama.ConsumerMessage, entries map[string]*DeadLetter) {
+	id := string(message.Key)
+
+	if message.Value == nil {
+		delete(entries, id)
+
+		return
+	}
+
+	var dl DeadLetter
+	if err := json.Unmarshal(message.Value, &dl); err != nil {
+		return
+	}
+
+	dl.ID = id
+	entries[id] = &dl
+}
@@ -0,0 +1,210 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+// kafkaDelayGroupSuffix is appended to the consumer group of the delay topic forwarder.
+const kafkaDelayGroupSuffix = "-delay"
+
+// kafkaDelayTiers are the fixed delays of the delay topics, shortest first.
+// Every record in a tier topic waits the same time, so each topic stays ordered by due time.
+//
+//nolint:gochecknoglobals // immutable tier table
+var kafkaDelayTiers = []time.Duration{
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+	10 * time.Minute,
+	time.Hour,
+}
+
+// kafkaDelayTopic returns the delay topic of the given tier, e.g. "diplom-messages.delay-60s".
+func kafkaDelayTopic(topic string, tier time.Duration) string {
+	return fmt.Sprintf("%s.delay-%ds", topic, int(tier.Seconds()))
+}
+
+// kafkaDelayTopics returns all delay topics of the topic.
+func kafkaDelayTopics(topic string) []string {
+	topics := make([]string, len(kafkaDelayTiers))
+	for i, tier := range kafkaDelayTiers {
+		topics[i] = kafkaDelayTopic(topic, tier)
+	}
+
+	return topics
+}
+
+// kafkaDelayTier picks the longest tier that does not exceed the remaining delay.
+// Delays shorter than the first tier use the first tier and are released at deliver_at.
+func kafkaDelayTier(remaining time.Duration) time.Duration {
+	tier := kafkaDelayTiers[0]
+
+	for _, t := range kafkaDelayTiers {
+		if t <= remaining {
+			tier = t
+		}
+	}
+
+	return tier
+}
+
+// kafkaDelayForwarder moves due records from the delay topics back to the main topic
+// (or to a shorter tier if the message is still not due).
+type kafkaDelayForwarder struct {
+	consumerGroup sarama.ConsumerGroup
+	topics        []string
+	tiers         map[string]time.Duration
+	producer      *KafkaProducer
+	wg            sync.WaitGroup
+	cancel        context.CancelFunc
+}
+
+func newKafkaDelayForwarder(
+	brokers []string,
+	topic, groupID string,
+	producer *KafkaProducer,
+) (*kafkaDelayForwarder, error) {
+	consumerGroup, err := sarama.NewConsumerGroup(brokers, groupID+kafkaDelayGroupSuffix, getKafkaConsumerConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create delay consumer group: %w", err)
+	}
+
+	return newKafkaGroupDelayForwarder(consumerGroup, topic, producer), nil
+}
+
+// newKafkaGroupDelayForwarder forwards the delay topics of the topic through an existing consumer group.
+func newKafkaGroupDelayForwarder(
+	consumerGroup sarama.ConsumerGroup,
+	topic string,
+	producer *KafkaProducer,
+) *kafkaDelayForwarder {
+	tiers := make(map[string]time.Duration, len(kafkaDelayTiers))
+	for _, tier := range kafkaDelayTiers {
+		tiers[kafkaDelayTopic(topic, tier)] = tier
+	}
+
+	return &kafkaDelayForwarder{
+		consumerGroup: consumerGroup,
+		topics:        kafkaDelayTopics(topic),
+		tiers:         tiers,
+		producer:      producer,
+	}
+}
+
+// Start runs the forwarder until Close is called.
+func (f *kafkaDelayForwarder) Start(ctx context.Context) {
+	consumeCtx, cancel := context.WithCancel(ctx)
+	f.cancel = cancel
+
+	f.wg.Add(1)
+
+	go func() {
+		defer f.wg.Done()
+
+		for {
+			if err := f.consumerGroup.Consume(consumeCtx, f.topics, f); err != nil {
+				log.Printf("Error from delay consumer: %v", err)
+			}
+
+			if consumeCtx.Err() != nil {
+				return
+			}
+		}
+	}()
+}
+
+func (f *kafkaDelayForwarder) Close() error {
+	if f.cancel != nil {
+		f.cancel()
+	}
+
+	err := f.consumerGroup.Close()
+
+	f.wg.Wait()
+
+	if err != nil {
+		return fmt.Errorf("failed to close delay consumer group: %w", err)
+	}
+
+	return nil
+}
+
+// Setup implements sarama.ConsumerGroupHandler.
+func (f *kafkaDelayForwarder) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup implements sarama.ConsumerGroupHandler.
+func (f *kafkaDelayForwarder) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim implements sarama.ConsumerGroupHandler.
+// Records are forwarded in order; the offset is marked only after the record has been republished.
+func (f *kafkaDelayForwarder) ConsumeClaim(
+	session sarama.ConsumerGroupSession,
+	claim sarama.ConsumerGroupClaim,
+) error {
+	tier := f.tiers[claim.Topic()]
+
+	for {
+		select {
+		case message := <-claim.Messages():
+			if message == nil {
+				return nil
+			}
+
+			var msg models.DataMessage
+			if err := decodeKafkaRecord(message, &msg); err != nil {
+				log.Printf("Failed to unmarshal delayed Kafka message: %v", err)
+				session.MarkMessage(message, "")
+
+				continue
+			}
+
+			releaseAt := message.Timestamp.Add(tier)
+			if deliverAt, ok := DeliverAt(&msg); ok && deliverAt.Before(releaseAt) {
+				releaseAt = deliverAt
+			}
+
+			timer := time.NewTimer(time.Until(releaseAt))
+
+			select {
+			case <-timer.C:
+			case <-session.Context().Done():
+				timer.Stop()
+
+				return nil
+			}
+
+			if err := f.forward(session.Context(), &msg, message); err != nil {
+				// The record stays unmarked and is forwarded again after a rebalance or restart.
+				log.Printf("Failed to forward delayed Kafka message %s: %v", msg.GetId(), err)
+
+				return err
+			}
+
+			session.MarkMessage(message, "")
+
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// forward republishes the message keeping its delivery attempt; the producer routes it
+// to the main topic or, if it is still not due, to the next delay tier.
+func (f *kafkaDelayForwarder) forward(ctx context.Context, msg *models.DataMessage, message *sarama.ConsumerMessage) error {
+	if attempt := kafkaRecordAttempt(message); attempt > 1 {
+		return f.producer.Requeue(ctx, msg, attempt)
+	}
+
+	return f.producer.Publish(ctx, msg)
+}
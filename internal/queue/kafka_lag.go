@@ -0,0 +1,122 @@
+package queue
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// kafkaLagReader computes the consumer group lag of a topic: the high-water mark of every partition
+// minus the group's committed offset. The admin connection is opened on first use.
+type kafkaLagReader struct {
+	mu      sync.Mutex
+	brokers []string
+	topic   string
+	groupID string
+
+	client sarama.Client
+	admin  sarama.ClusterAdmin
+}
+
+func newKafkaLagReader(brokers []string, topic, groupID string) *kafkaLagReader {
+	return &kafkaLagReader{
+		brokers: brokers,
+		topic:   topic,
+		groupID: groupID,
+	}
+}
+
+// lag returns the lag of every partition of the topic.
+// Partitions without a committed offset lag by everything still retained in them.
+func (r *kafkaLagReader) lag() ([]PartitionLag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.connect(); err != nil {
+		return nil, err
+	}
+
+	partitions, err := r.client.Partitions(r.topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions of %s: %w", r.topic, err)
+	}
+
+	committed, err := r.admin.ListConsumerGroupOffsets(r.groupID, map[string][]int32{r.topic: partitions})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch committed offsets of %s: %w", r.groupID, err)
+	}
+
+	lags := make([]PartitionLag, 0, len(partitions))
+
+	for _, partition := range partitions {
+		highWater, err := r.client.GetOffset(r.topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch high-water mark of %s/%d: %w", r.topic, partition, err)
+		}
+
+		offset := int64(-1)
+		if block := committed.GetBlock(r.topic, partition); block != nil {
+			offset = block.Offset
+		}
+
+		if offset < 0 {
+			// Nothing committed yet: the group starts from the oldest retained record.
+			if offset, err = r.client.GetOffset(r.topic, partition, sarama.OffsetOldest); err != nil {
+				return nil, fmt.Errorf("failed to fetch oldest offset of %s/%d: %w", r.topic, partition, err)
+			}
+		}
+
+		lags = append(lags, PartitionLag{
+			Topic:     r.topic,
+			Partition: partition,
+			Lag:       max(highWater-offset, 0),
+		})
+	}
+
+	return lags, nil
+}
+
+// connect opens the client and admin connection. Called with r.mu held.
+func (r *kafkaLagReader) connect() error {
+	if r.admin != nil {
+		return nil
+	}
+
+	client, err := sarama.NewClient(r.brokers, getKafkaConsumerConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+
+		return fmt.Errorf("failed to create Kafka cluster admin: %w", err)
+	}
+
+	r.client = client
+	r.admin = admin
+
+	return nil
+}
+
+// Close closes the admin connection together with its client.
+func (r *kafkaLagReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.admin == nil {
+		return nil
+	}
+
+	err := r.admin.Close()
+	r.admin = nil
+	r.client = nil
+
+	if err != nil {
+		return fmt.Errorf("failed to close Kafka cluster admin: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// KafkaCommitMode defines when consumed offsets are committed to the consumer group.
+type KafkaCommitMode string
+
+const (
+	// KafkaCommitAuto marks a record as soon as its delivery is settled and lets sarama commit
+	// marked offsets in the background. An out-of-order Ack may mark past unfinished records.
+	KafkaCommitAuto KafkaCommitMode = "auto"
+	// KafkaCommitManual commits only the contiguous prefix of settled records of each partition,
+	// so a crash never skips a record that is still being processed.
+	KafkaCommitManual KafkaCommitMode = "manual"
+	// KafkaCommitTransactional commits the offset of a record in the same Kafka transaction that
+	// publishes its processing result (or requeued copy). Partitions are consumed in order and
+	// consumers read only committed records, which makes consume-process-produce exactly-once.
+	KafkaCommitTransactional KafkaCommitMode = "transactional"
+
+	// DefaultKafkaCommitInterval is how often the manual mode commits the marked offsets.
+	DefaultKafkaCommitInterval = time.Second
+)
+
+var ErrUnsupportedKafkaCommitMode = errors.New("unsupported Kafka commit mode")
+
+// ParseKafkaCommitMode validates the commit mode; an empty string means KafkaCommitAuto.
+func ParseKafkaCommitMode(mode string) (KafkaCommitMode, error) {
+	switch KafkaCommitMode(mode) {
+	case "", KafkaCommitAuto:
+		return KafkaCommitAuto, nil
+	case KafkaCommitManual:
+		return KafkaCommitManual, nil
+	case KafkaCommitTransactional:
+		return KafkaCommitTransactional, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedKafkaCommitMode, mode)
+	}
+}
+
+// kafkaOffsetTracker tracks the records of one partition claim that are handed out but not settled.
+// Records may be settled in any order; the committable offset only advances past a record
+// once it and every record before it are settled.
+type kafkaOffsetTracker struct {
+	mu      sync.Mutex
+	pending []int64        // offsets in the order they were handed out
+	done    map[int64]bool // settled offsets that are not yet at the head of pending
+	head    int            // first unsettled entry in pending
+}
+
+func newKafkaOffsetTracker() *kafkaOffsetTracker {
+	return &kafkaOffsetTracker{done: make(map[int64]bool)}
+}
+
+// track registers a record handed out to the consumer. Offsets of one partition arrive in increasing
+// order but need not be contiguous (compaction and transaction markers leave gaps).
+func (t *kafkaOffsetTracker) track(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pending = append(t.pending, offset)
+}
+
+// complete settles the record and returns the next offset to commit if the contiguous prefix advanced.
+func (t *kafkaOffsetTracker) complete(offset int64) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done[offset] = true
+
+	advanced := false
+	next := int64(0)
+
+	for t.head < len(t.pending) && t.done[t.pending[t.head]] {
+		delete(t.done, t.pending[t.head])
+		next = t.pending[t.head] + 1
+		advanced = true
+		t.head++
+	}
+
+	// Compact once the settled prefix dominates the slice.
+	if t.head > 0 && t.head >= len(t.pending)/2 {
+		t.pending = append(t.pending[:0], t.pending[t.head:]...)
+		t.head = 0
+	}
+
+	return next, advanced
+}
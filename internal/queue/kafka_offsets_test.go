@@ -0,0 +1,40 @@
+package queue
+
+import "testing"
+
+func TestKafkaOffsetTracker_CommitsContiguousPrefix(t *testing.T) {
+	tracker := newKafkaOffsetTracker()
+
+	// Offset 13 is missing, as after a transaction marker.
+	for _, offset := range []int64{10, 11, 12, 14} {
+		tracker.track(offset)
+	}
+
+	if _, ok := tracker.complete(11); ok {
+		t.Fatal("Offset must not advance past unsettled record 10")
+	}
+
+	if _, ok := tracker.complete(14); ok {
+		t.Fatal("Offset must not advance past unsettled record 10")
+	}
+
+	next, ok := tracker.complete(10)
+	if !ok || next != 12 {
+		t.Fatalf("Expected next offset 12, got %d (%v)", next, ok)
+	}
+
+	next, ok = tracker.complete(12)
+	if !ok || next != 15 {
+		t.Fatalf("Expected next offset 15 across the gap, got %d (%v)", next, ok)
+	}
+}
+
+func TestParseKafkaCommitMode(t *testing.T) {
+	if mode, err := ParseKafkaCommitMode(""); err != nil || mode != KafkaCommitAuto {
+		t.Fatalf("Expected auto by default, got %s: %v", mode, err)
+	}
+
+	if _, err := ParseKafkaCommitMode("sometimes"); err == nil {
+		t.Fatal("Expected error for unknown commit mode")
+	}
+}
@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/IBM/sarama"
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+// KafkaPartitionMetadataKey is the metadata field holding the target partition for the explicit strategy.
+const KafkaPartitionMetadataKey = "partition"
+
+// KafkaPartitionStrategy defines how the record key (and therefore the partition) is chosen.
+type KafkaPartitionStrategy string
+
+const (
+	// PartitionByID keys records by message ID: even spread, no ordering between messages.
+	PartitionByID KafkaPartitionStrategy = "id"
+	// PartitionBySource keys records by DataMessage.Source: messages of one source stay ordered.
+	PartitionBySource KafkaPartitionStrategy = "source"
+	// PartitionByMetadata keys records by a metadata field; messages without it fall back to the ID.
+	PartitionByMetadata KafkaPartitionStrategy = "metadata"
+	// PartitionExplicit sends records to the partition from Metadata["partition"];
+	// messages without a valid partition are keyed by ID.
+	PartitionExplicit KafkaPartitionStrategy = "explicit"
+)
+
+var (
+	ErrUnsupportedKafkaPartitionStrategy = errors.New("unsupported Kafka partition strategy")
+	ErrKafkaPartitionMetadataKeyRequired = errors.New("metadata partition strategy requires a metadata key")
+	ErrKafkaPartitionOutOfRange          = errors.New("kafka partition out of range")
+)
+
+// KafkaPartitionConfig configures the partition key of published records.
+type KafkaPartitionConfig struct {
+	Strategy    KafkaPartitionStrategy
+	MetadataKey string // metadata field used by PartitionByMetadata
+}
+
+// Validate checks that the strategy is known and has the settings it needs.
+func (c KafkaPartitionConfig) Validate() error {
+	switch c.Strategy {
+	case "", PartitionByID, PartitionBySource, PartitionExplicit:
+		return nil
+	case PartitionByMetadata:
+		if c.MetadataKey == "" {
+			return ErrKafkaPartitionMetadataKeyRequired
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedKafkaPartitionStrategy, c.Strategy)
+	}
+}
+
+// key returns the record key of the message.
+func (c KafkaPartitionConfig) key(msg *models.DataMessage) string {
+	switch c.Strategy {
+	case PartitionBySource:
+		if source := msg.GetSource(); source != "" {
+			return source
+		}
+	case PartitionByMetadata:
+		if value := msg.GetMetadata()[c.MetadataKey]; value != "" {
+			return value
+		}
+	case "", PartitionByID, PartitionExplicit:
+	}
+
+	return msg.GetId()
+}
+
+// partition returns the explicit partition of the message, if the strategy and metadata provide one.
+func (c KafkaPartitionConfig) partition(msg *models.DataMessage) (int32, bool) {
+	if c.Strategy != PartitionExplicit {
+		return 0, false
+	}
+
+	partition, err := strconv.ParseInt(msg.GetMetadata()[KafkaPartitionMetadataKey], 10, 32)
+	if err != nil || partition < 0 {
+		return 0, false
+	}
+
+	return int32(partition), true
+}
+
+// kafkaExplicitPartition is stored in sarama.ProducerMessage.Metadata to pin a record to a partition.
+type kafkaExplicitPartition int32
+
+// kafkaPartitioner hashes record keys like sarama's default partitioner,
+// but honours an explicit partition carried in the record metadata.
+type kafkaPartitioner struct {
+	hash sarama.Partitioner
+}
+
+func newKafkaPartitioner(topic string) sarama.Partitioner { //nolint:ireturn // sarama.PartitionerConstructor
+	return &kafkaPartitioner{hash: sarama.NewHashPartitioner(topic)}
+}
+
+// Partition implements sarama.Partitioner.
+func (p *kafkaPartitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if partition, ok := msg.Metadata.(kafkaExplicitPartition); ok {
+		if int32(partition) >= numPartitions {
+			return 0, fmt.Errorf("%w: %d of %d", ErrKafkaPartitionOutOfRange, partition, numPartitions)
+		}
+
+		return int32(partition), nil
+	}
+
+	partition, err := p.hash.Partition(msg, numPartitions)
+	if err != nil {
+		return 0, fmt.Errorf("failed to hash record key: %w", err)
+	}
+
+	return partition, nil
+}
+
+// RequiresConsistency implements sarama.Partitioner: a key always maps to the same partition.
+func (p *kafkaPartitioner) RequiresConsistency() bool {
+	return true
+}
@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func TestKafkaPartitionConfig_Key(t *testing.T) {
+	msg := &models.DataMessage{
+		Id:       "id-1",
+		Source:   "sensor-7",
+		Metadata: map[string]string{"tenant": "acme"},
+	}
+
+	cases := []struct {
+		cfg  KafkaPartitionConfig
+		want string
+	}{
+		{KafkaPartitionConfig{}, "id-1"},
+		{KafkaPartitionConfig{Strategy: PartitionBySource}, "sensor-7"},
+		{KafkaPartitionConfig{Strategy: PartitionByMetadata, MetadataKey: "tenant"}, "acme"},
+		{KafkaPartitionConfig{Strategy: PartitionByMetadata, MetadataKey: "region"}, "id-1"},
+	}
+
+	for _, tc := range cases {
+		if got := tc.cfg.key(msg); got != tc.want {
+			t.Errorf("Strategy %q: expected key %s, got %s", tc.cfg.Strategy, tc.want, got)
+		}
+	}
+
+	if err := (KafkaPartitionConfig{Strategy: PartitionByMetadata}).Validate(); !errors.Is(
+		err, ErrKafkaPartitionMetadataKeyRequired) {
+		t.Errorf("Expected ErrKafkaPartitionMetadataKeyRequired, got %v", err)
+	}
+}
+
+func TestKafkaPartitioner_ExplicitAndHashed(t *testing.T) {
+	cfg := KafkaPartitionConfig{Strategy: PartitionExplicit}
+	partitioner := newKafkaPartitioner("topic")
+
+	msg := &models.DataMessage{Id: "id-1", Metadata: map[string]string{KafkaPartitionMetadataKey: "2"}}
+
+	partition, ok := cfg.partition(msg)
+	if !ok || partition != 2 {
+		t.Fatalf("Expected explicit partition 2, got %d (%v)", partition, ok)
+	}
+
+	got, err := partitioner.Partition(&sarama.ProducerMessage{Metadata: kafkaExplicitPartition(partition)}, 4)
+	if err != nil || got != 2 {
+		t.Fatalf("Expected partition 2, got %d: %v", got, err)
+	}
+
+	if _, err := partitioner.Partition(&sarama.ProducerMessage{Metadata: kafkaExplicitPartition(5)}, 4); !errors.Is(
+		err, ErrKafkaPartitionOutOfRange) {
+		t.Fatalf("Expected ErrKafkaPartitionOutOfRange, got %v", err)
+	}
+
+	// Records with the same key always land in the same partition.
+	first, _ := partitioner.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("sensor-7")}, 4)
+	second, _ := partitioner.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("sensor-7")}, 4)
+
+	if first != second {
+		t.Fatalf("Same key mapped to partitions %d and %d", first, second)
+	}
+}
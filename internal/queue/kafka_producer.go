@@ -2,17 +2,27 @@ package queue
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/stsolovey/diplom-distributed-system/internal/models"
 )
 
+// kafkaAttemptHeader carries the delivery attempt number of a requeued record.
+const kafkaAttemptHeader = "attempt"
+
 type KafkaProducer struct {
-	producer sarama.SyncProducer
-	topic    string
+	producer    sarama.SyncProducer
+	topic       string
+	codec       Codec
+	compression CompressionConfig
+	partition   KafkaPartitionConfig
+
+	// shared is set when the producer belongs to a KafkaBroker: Close leaves it open.
+	shared bool
 }
 
 func NewKafkaProducer(brokers []string, topic string) (*KafkaProducer, error) {
@@ -26,18 +36,133 @@ func NewKafkaProducer(brokers []string, topic string) (*KafkaProducer, error) {
 	return &KafkaProducer{
 		producer: producer,
 		topic:    topic,
+		codec:    protobufCodec{},
 	}, nil
 }
 
+// newSharedKafkaProducer publishes to the topic through an existing producer, e.g. one owned by KafkaBroker.
+func newSharedKafkaProducer(producer sarama.SyncProducer, topic string) *KafkaProducer {
+	return &KafkaProducer{
+		producer: producer,
+		topic:    topic,
+		codec:    protobufCodec{},
+		shared:   true,
+	}
+}
+
+// SetCodec sets the codec of published records. Its name travels in the record header.
+func (p *KafkaProducer) SetCodec(codec Codec) {
+	p.codec = codec
+}
+
+// SetCompression sets per-message compression of published records.
+// The algorithm travels in the record header; records below the threshold are sent as is.
+func (p *KafkaProducer) SetCompression(cfg CompressionConfig) {
+	p.compression = cfg
+}
+
+// SetPartitioning sets how the record key and partition are derived from the message.
+func (p *KafkaProducer) SetPartitioning(cfg KafkaPartitionConfig) {
+	p.partition = cfg
+}
+
 func (p *KafkaProducer) Publish(_ context.Context, msg *models.DataMessage) error {
-	data, err := json.Marshal(msg)
+	kafkaMsg, err := p.newProducerMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	return p.send(kafkaMsg)
+}
+
+// PublishBatch sends the batch with a single SendMessages call.
+// Records that fail to marshal are skipped; broker errors are mapped back to their messages.
+func (p *KafkaProducer) PublishBatch(_ context.Context, msgs []*models.DataMessage) []error {
+	errs := make([]error, len(msgs))
+	records := make([]*sarama.ProducerMessage, 0, len(msgs))
+	index := make(map[*sarama.ProducerMessage]int, len(msgs))
+
+	for i, msg := range msgs {
+		kafkaMsg, err := p.newProducerMessage(msg)
+		if err != nil {
+			errs[i] = err
+
+			continue
+		}
+
+		records = append(records, kafkaMsg)
+		index[kafkaMsg] = i
+	}
+
+	if len(records) == 0 {
+		return errs
+	}
+
+	err := p.producer.SendMessages(records)
+	if err == nil {
+		return errs
+	}
+
+	var producerErrs sarama.ProducerErrors
+	if !errors.As(err, &producerErrs) {
+		for _, record := range records {
+			errs[index[record]] = fmt.Errorf("failed to send messages to Kafka: %w", err)
+		}
+
+		return errs
+	}
+
+	for _, producerErr := range producerErrs {
+		if i, ok := index[producerErr.Msg]; ok {
+			errs[i] = fmt.Errorf("failed to send message to Kafka: %w", producerErr.Err)
+		}
+	}
+
+	return errs
+}
+
+// Requeue republishes a message for the given delivery attempt.
+// The attempt number travels in the record header so consumers can route exhausted messages to the DLQ.
+func (p *KafkaProducer) Requeue(_ context.Context, msg *models.DataMessage, attempt int) error {
+	kafkaMsg, err := p.requeueMessage(msg, attempt)
+	if err != nil {
+		return err
+	}
+
+	return p.send(kafkaMsg)
+}
+
+// requeueMessage builds the record of a message for the given delivery attempt.
+func (p *KafkaProducer) requeueMessage(msg *models.DataMessage, attempt int) (*sarama.ProducerMessage, error) {
+	kafkaMsg, err := p.newProducerMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	kafkaMsg.Headers = append(kafkaMsg.Headers, sarama.RecordHeader{
+		Key:   []byte(kafkaAttemptHeader),
+		Value: []byte(strconv.Itoa(attempt)),
+	})
+
+	return kafkaMsg, nil
+}
+
+func (p *KafkaProducer) newProducerMessage(msg *models.DataMessage) (*sarama.ProducerMessage, error) {
+	data, err := p.codec.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	data, algorithm, err := compressBody(p.compression, data)
 	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+		return nil, err
 	}
 
+	topic := p.topicFor(msg)
+
 	kafkaMsg := &sarama.ProducerMessage{
-		Topic:     p.topic,
-		Key:       sarama.StringEncoder(msg.GetId()),
+		Topic:     topic,
+		Key:       sarama.StringEncoder(p.partition.key(msg)),
 		Value:     sarama.ByteEncoder(data),
 		Timestamp: time.Now(),
 		Headers: []sarama.RecordHeader{
@@ -49,9 +174,38 @@ func (p *KafkaProducer) Publish(_ context.Context, msg *models.DataMessage) erro
 				Key:   []byte("message_id"),
 				Value: []byte(msg.GetId()),
 			},
+			{
+				Key:   []byte(codecHeader),
+				Value: []byte(p.codec.Name()),
+			},
 		},
 	}
 
+	// Delay topics may have a different partition count, so only the main topic is pinned.
+	if partition, ok := p.partition.partition(msg); ok && topic == p.topic {
+		kafkaMsg.Metadata = kafkaExplicitPartition(partition)
+	}
+
+	if algorithm != "" {
+		kafkaMsg.Headers = append(kafkaMsg.Headers, sarama.RecordHeader{
+			Key:   []byte(compressionHeader),
+			Value: []byte(algorithm),
+		})
+	}
+
+	return kafkaMsg, nil
+}
+
+// topicFor routes messages with a future deliver_at to a delay topic.
+func (p *KafkaProducer) topicFor(msg *models.DataMessage) string {
+	if delay := deliveryDelay(msg); delay > 0 {
+		return kafkaDelayTopic(p.topic, kafkaDelayTier(delay))
+	}
+
+	return p.topic
+}
+
+func (p *KafkaProducer) send(kafkaMsg *sarama.ProducerMessage) error {
 	partition, offset, err := p.producer.SendMessage(kafkaMsg)
 	if err != nil {
 		return fmt.Errorf("failed to send message to Kafka: %w", err)
@@ -65,6 +219,10 @@ func (p *KafkaProducer) Publish(_ context.Context, msg *models.DataMessage) erro
 }
 
 func (p *KafkaProducer) Close() error {
+	if p.shared {
+		return nil
+	}
+
 	if err := p.producer.Close(); err != nil {
 		return fmt.Errorf("failed to close Kafka producer: %w", err)
 	}
@@ -0,0 +1,118 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+	"google.golang.org/protobuf/proto"
+)
+
+// kafkaResultsTopicSuffix is appended to the topic when no results topic is configured.
+const kafkaResultsTopicSuffix = ".results"
+
+var ErrKafkaTransactionalIDRequired = errors.New("transactional commit mode requires a transactional ID")
+
+// kafkaTransactor publishes records and commits the offset of the consumed record in one Kafka transaction.
+// A transactional producer runs one transaction at a time, so transactions are serialized.
+type kafkaTransactor struct {
+	mu           sync.Mutex
+	producer     sarama.SyncProducer
+	groupID      string
+	resultsTopic string
+	records      *KafkaProducer // builds requeued records with the configured codec and partitioning
+}
+
+func newKafkaTransactor(
+	brokers []string,
+	transactionalID, groupID, resultsTopic string,
+	records *KafkaProducer,
+) (*kafkaTransactor, error) {
+	producer, err := sarama.NewSyncProducer(brokers, getKafkaTransactionalProducerConfig(transactionalID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transactional Kafka producer: %w", err)
+	}
+
+	return &kafkaTransactor{
+		producer:     producer,
+		groupID:      groupID,
+		resultsTopic: resultsTopic,
+		records:      records,
+	}, nil
+}
+
+// commit publishes the records and commits the offset after the consumed record atomically.
+// On failure the transaction is aborted: neither the records nor the offset become visible.
+func (t *kafkaTransactor) commit(consumed *sarama.ConsumerMessage, records ...*sarama.ProducerMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.producer.BeginTxn(); err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := t.send(consumed, records); err != nil {
+		if abortErr := t.producer.AbortTxn(); abortErr != nil {
+			log.Printf("Failed to abort Kafka transaction: %v", abortErr)
+		}
+
+		return err
+	}
+
+	if err := t.producer.CommitTxn(); err != nil {
+		if abortErr := t.producer.AbortTxn(); abortErr != nil {
+			log.Printf("Failed to abort Kafka transaction: %v", abortErr)
+		}
+
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (t *kafkaTransactor) send(consumed *sarama.ConsumerMessage, records []*sarama.ProducerMessage) error {
+	if len(records) > 0 {
+		if err := t.producer.SendMessages(records); err != nil {
+			return fmt.Errorf("failed to send records in transaction: %w", err)
+		}
+	}
+
+	if err := t.producer.AddMessageToTxn(consumed, t.groupID, nil); err != nil {
+		return fmt.Errorf("failed to add consumed offset to transaction: %w", err)
+	}
+
+	return nil
+}
+
+// resultRecord encodes the processing result for the results topic, keyed by the source message ID.
+func (t *kafkaTransactor) resultRecord(result *models.ProcessingResult) (*sarama.ProducerMessage, error) {
+	data, err := proto.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal processing result: %w", err)
+	}
+
+	return &sarama.ProducerMessage{
+		Topic:     t.resultsTopic,
+		Key:       sarama.StringEncoder(result.GetMessageId()),
+		Value:     sarama.ByteEncoder(data),
+		Timestamp: time.Now(),
+		Headers: []sarama.RecordHeader{
+			{
+				Key:   []byte(codecHeader),
+				Value: []byte(ProtobufCodecName),
+			},
+		},
+	}, nil
+}
+
+func (t *kafkaTransactor) Close() error {
+	if err := t.producer.Close(); err != nil {
+		return fmt.Errorf("failed to close transactional Kafka producer: %w", err)
+	}
+
+	return nil
+}
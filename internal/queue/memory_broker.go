@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrMemoryBrokerNotConnected = errors.New("memory broker is not connected")
+
+// MemoryBroker реализует MessageBroker поверх in-memory очередей: у каждого subject своя MemoryQueue.
+type MemoryBroker struct {
+	mu        sync.Mutex
+	size      int
+	overflow  OverflowConfig
+	queues    map[string]*MemoryAdapter
+	connected bool
+}
+
+// NewMemoryBroker создает брокер; size - емкость очереди каждого subject.
+func NewMemoryBroker(size int) *MemoryBroker {
+	return &MemoryBroker{size: size, overflow: OverflowConfig{Policy: OverflowReject}}
+}
+
+// SetOverflow задает политику переполнения очередей subject'ов, создаваемых после вызова.
+func (b *MemoryBroker) SetOverflow(cfg OverflowConfig) error {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.overflow = cfg
+	b.mu.Unlock()
+
+	return nil
+}
+
+// Connect реализует интерфейс MessageBroker.
+func (b *MemoryBroker) Connect(_ context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.connected {
+		b.queues = make(map[string]*MemoryAdapter)
+		b.connected = true
+	}
+
+	return nil
+}
+
+// Disconnect реализует интерфейс MessageBroker и закрывает очереди всех subject'ов.
+func (b *MemoryBroker) Disconnect() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	errs := make([]error, 0, len(b.queues))
+	for _, adapter := range b.queues {
+		errs = append(errs, adapter.Close())
+	}
+
+	b.queues = nil
+	b.connected = false
+
+	return errors.Join(errs...)
+}
+
+// CreatePublisher реализует интерфейс MessageBroker.
+func (b *MemoryBroker) CreatePublisher(subject string) (Publisher, error) { //nolint:ireturn // MessageBroker
+	return b.queue(subject)
+}
+
+// CreateSubscriber реализует интерфейс MessageBroker.
+// Close подписчика не закрывает очередь subject: ее закрывает Disconnect.
+func (b *MemoryBroker) CreateSubscriber(subject string) (Subscriber, error) { //nolint:ireturn // MessageBroker
+	adapter, err := b.queue(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memorySubscriber{MemoryAdapter: adapter}, nil
+}
+
+// queue возвращает очередь subject, создавая ее при первом обращении.
+func (b *MemoryBroker) queue(subject string) (*MemoryAdapter, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.connected {
+		return nil, ErrMemoryBrokerNotConnected
+	}
+
+	adapter, ok := b.queues[subject]
+	if !ok {
+		adapter = NewMemoryAdapter(b.size)
+		_ = adapter.SetOverflow(b.overflow) // настройки проверены в SetOverflow брокера
+		b.queues[subject] = adapter
+	}
+
+	return adapter, nil
+}
+
+// memorySubscriber - подписка на очередь subject, которой владеет MemoryBroker.
+type memorySubscriber struct {
+	*MemoryAdapter
+}
+
+// Close реализует интерфейс Subscriber. Подписка завершается отменой контекста Subscribe.
+func (s *memorySubscriber) Close() error {
+	return nil
+}
@@ -0,0 +1,124 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func TestMemoryBroker_MultiSubject(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	broker := NewMemoryBroker(10)
+	if err := broker.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer broker.Disconnect()
+
+	subjects := []string{"orders", "payments"}
+	subscribers := make([]Subscriber, 0, len(subjects))
+
+	for _, subject := range subjects {
+		publisher, err := broker.CreatePublisher(subject)
+		if err != nil {
+			t.Fatalf("Failed to create publisher for %s: %v", subject, err)
+		}
+
+		if err := publisher.Publish(ctx, &models.DataMessage{Id: subject}); err != nil {
+			t.Fatalf("Failed to publish to %s: %v", subject, err)
+		}
+
+		subscriber, err := broker.CreateSubscriber(subject)
+		if err != nil {
+			t.Fatalf("Failed to create subscriber for %s: %v", subject, err)
+		}
+
+		subscribers = append(subscribers, subscriber)
+	}
+
+	multi := NewMultiSubscriber(subscribers...)
+	defer multi.Close()
+
+	deliveries, err := multi.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	received := make(map[string]bool)
+
+	for len(received) < len(subjects) {
+		select {
+		case delivery := <-deliveries:
+			received[delivery.Message().GetId()] = true
+
+			if err := delivery.Ack(); err != nil {
+				t.Fatalf("Failed to ack: %v", err)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Timeout: received %v", received)
+		}
+	}
+
+	for _, subject := range subjects {
+		if !received[subject] {
+			t.Errorf("Expected message from subject %s", subject)
+		}
+	}
+}
+
+func TestMemoryBroker_SubjectsAreIsolated(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	broker := NewMemoryBroker(10)
+	if err := broker.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer broker.Disconnect()
+
+	publisher, err := broker.CreatePublisher("orders")
+	if err != nil {
+		t.Fatalf("Failed to create publisher: %v", err)
+	}
+
+	if err := publisher.Publish(ctx, &models.DataMessage{Id: "order-1"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	subscriber, err := broker.CreateSubscriber("payments")
+	if err != nil {
+		t.Fatalf("Failed to create subscriber: %v", err)
+	}
+
+	subCtx, subCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer subCancel()
+
+	deliveries, err := subscriber.Subscribe(subCtx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	select {
+	case delivery, ok := <-deliveries:
+		if ok {
+			t.Errorf("Unexpected message %s on another subject", delivery.Message().GetId())
+		}
+	case <-subCtx.Done():
+	}
+}
+
+func TestMemoryBroker_NotConnected(t *testing.T) {
+	broker := NewMemoryBroker(10)
+
+	if _, err := broker.CreatePublisher("orders"); !errors.Is(err, ErrMemoryBrokerNotConnected) {
+		t.Errorf("Expected ErrMemoryBrokerNotConnected, got %v", err)
+	}
+
+	if _, err := broker.CreateSubscriber("orders"); !errors.Is(err, ErrMemoryBrokerNotConnected) {
+		t.Errorf("Expected ErrMemoryBrokerNotConnected, got %v", err)
+	}
+}
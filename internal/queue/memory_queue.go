@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/stsolovey/diplom-distributed-system/internal/models"
 )
@@ -16,10 +18,17 @@ var (
 
 // MemoryQueue - потокобезопасная in-memory очередь.
 type MemoryQueue struct {
-	messages chan *models.DataMessage
-	mu       sync.RWMutex
-	closed   bool
-	stats    Stats
+	messages  chan *models.DataMessage
+	mu        sync.RWMutex
+	closed    bool
+	closing   chan struct{} // закрывается до захвата mu в Close, чтобы прервать ожидание OverflowBlock
+	closeOnce sync.Once
+	overflow  OverflowConfig
+	enqueued  atomic.Int64
+	dequeued  atomic.Int64
+	dropped   atomic.Int64
+	attempts  attemptTracker
+	delayed   *delayScheduler
 }
 
 const memoryQueueBufferSize = 100
@@ -29,13 +38,41 @@ type Stats struct {
 	TotalEnqueued int64
 	TotalDequeued int64
 	CurrentSize   int
+	DelayedSize   int   `json:"DelayedSize,omitempty"` // отложенные сообщения, еще не видимые потребителю
+	LevelSizes    []int `json:"LevelSizes,omitempty"`  // глубина уровней приоритетной очереди
+	ShardSizes    []int `json:"ShardSizes,omitempty"`  // глубина шардов шардированной очереди
+	// Дубликаты, отброшенные CompositeAdapter в режиме merge.
+	DuplicatesSuppressed int64 `json:"DuplicatesSuppressed,omitempty"`
+	// Публикации CompositeAdapter (Failover), ушедшие на резервный провайдер, и состояние предохранителей.
+	Failovers int64          `json:"Failovers,omitempty"`
+	Breakers  []BreakerStats `json:"Breakers,omitempty"`
+	// Состояние consumer'а брокера: ожидают доставки, доставлены без подтверждения, доставлены повторно (NATS).
+	Pending     int64 `json:"Pending,omitempty"`
+	AckPending  int64 `json:"AckPending,omitempty"`
+	Redelivered int64 `json:"Redelivered,omitempty"`
+	// Отставание consumer group по партициям (Kafka).
+	PartitionLag []PartitionLag `json:"PartitionLag,omitempty"`
+	// Сообщения, отброшенные политикой переполнения MemoryQueue.
+	Dropped int64 `json:"Dropped,omitempty"`
+}
+
+// PartitionLag - разница между high-water mark партиции и зафиксированным offset'ом consumer group.
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	Lag       int64
 }
 
 // NewMemoryQueue создает новую очередь заданного размера.
 func NewMemoryQueue(size int) *MemoryQueue {
-	return &MemoryQueue{
+	q := &MemoryQueue{
 		messages: make(chan *models.DataMessage, size),
+		closing:  make(chan struct{}),
+		overflow: OverflowConfig{Policy: OverflowReject},
 	}
+	q.delayed = newDelayScheduler(q.releaseDelayed)
+
+	return q
 }
 
 // Publish реализует интерфейс Publisher (алиас для Enqueue).
@@ -43,28 +80,194 @@ func (q *MemoryQueue) Publish(ctx context.Context, msg *models.DataMessage) erro
 	return q.Enqueue(ctx, msg)
 }
 
-// Enqueue добавляет сообщение в очередь (неблокирующий).
+// SetOverflow задает политику переполнения (по умолчанию OverflowReject).
+func (q *MemoryQueue) SetOverflow(cfg OverflowConfig) error {
+	cfg, err := cfg.normalize()
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	q.overflow = cfg
+	q.mu.Unlock()
+
+	return nil
+}
+
+// Enqueue добавляет сообщение в очередь; при заполненной очереди действует политика переполнения.
+// Сообщение с deliver_at в будущем попадает в очередь только в момент доставки.
 func (q *MemoryQueue) Enqueue(ctx context.Context, msg *models.DataMessage) error {
+	return q.enqueue(ctx, msg, false)
+}
+
+// enqueue добавляет сообщение в очередь. Внутренние вставки (созревшие отложенные сообщения,
+// повторы после Nack) всегда используют OverflowReject: они не вытесняют чужие сообщения и не блокируют.
+func (q *MemoryQueue) enqueue(ctx context.Context, msg *models.DataMessage, internal bool) error {
+	if delay := deliveryDelay(msg); delay > 0 {
+		return q.enqueueDelayed(msg, delay)
+	}
+
+	// Держим read-lock на время отправки, чтобы Close не закрыл канал между проверкой и записью.
 	q.mu.RLock()
-	if q.closed {
-		q.mu.RUnlock()
+	defer q.mu.RUnlock()
 
+	if q.closed {
 		return ErrQueueClosed
 	}
-	q.mu.RUnlock()
 
+	overflow := q.overflow
+	if internal {
+		overflow = OverflowConfig{Policy: OverflowReject}
+	}
+
+	enqueued, err := q.push(ctx, msg, overflow)
+	if enqueued {
+		q.enqueued.Add(1)
+	}
+
+	return err
+}
+
+// push отправляет сообщение в канал по политике overflow. Вызывается под read-lock.
+// Возвращает false без ошибки, если политика отбросила новое сообщение.
+func (q *MemoryQueue) push(ctx context.Context, msg *models.DataMessage, overflow OverflowConfig) (bool, error) {
 	select {
 	case q.messages <- msg:
-		q.mu.Lock()
-		q.stats.TotalEnqueued++
-		q.mu.Unlock()
-
-		return nil
+		return true, nil
 	case <-ctx.Done():
-		return fmt.Errorf("enqueue canceled: %w", ctx.Err())
+		return false, fmt.Errorf("enqueue canceled: %w", ctx.Err())
+	default:
+	}
+
+	switch overflow.Policy {
+	case OverflowBlock:
+		return q.pushBlocking(ctx, msg, overflow.BlockTimeout)
+	case OverflowDropOldest, OverflowDropNewest, OverflowSample:
+		return q.pushEvicting(msg, overflow.admit()), nil
 	default:
+		return false, ErrQueueFull
+	}
+}
+
+// pushBlocking ждет места в очереди не дольше timeout.
+func (q *MemoryQueue) pushBlocking(ctx context.Context, msg *models.DataMessage, timeout time.Duration) (bool, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case q.messages <- msg:
+		return true, nil
+	case <-timer.C:
+		return false, ErrQueueFull
+	case <-q.closing:
+		return false, ErrQueueClosed
+	case <-ctx.Done():
+		return false, fmt.Errorf("enqueue canceled: %w", ctx.Err())
+	}
+}
+
+// pushEvicting вытесняет самые старые сообщения, пока новое не поместится (evict),
+// либо отбрасывает новое сообщение.
+func (q *MemoryQueue) pushEvicting(msg *models.DataMessage, evict bool) bool {
+	if !evict {
+		q.dropped.Add(1)
+
+		return false
+	}
+
+	for {
+		select {
+		case q.messages <- msg:
+			return true
+		default:
+		}
+
+		select {
+		case oldest := <-q.messages:
+			// Вытесненное сообщение больше не будет доставлено: забываем номер его попытки.
+			q.attempts.next(oldest)
+			q.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+// PublishBatch реализует интерфейс BatchPublisher: сообщения пачки добавляются под одной блокировкой,
+// к каждому применяется политика переполнения.
+func (q *MemoryQueue) PublishBatch(ctx context.Context, msgs []*models.DataMessage) []error {
+	errs := make([]error, len(msgs))
+	immediate := make([]int, 0, len(msgs))
+
+	for i, msg := range msgs {
+		if delay := deliveryDelay(msg); delay > 0 {
+			errs[i] = q.enqueueDelayed(msg, delay)
+		} else {
+			immediate = append(immediate, i)
+		}
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	for _, i := range immediate {
+		if q.closed {
+			errs[i] = ErrQueueClosed
+
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			errs[i] = fmt.Errorf("enqueue canceled: %w", err)
+
+			continue
+		}
+
+		enqueued, err := q.push(ctx, msgs[i], q.overflow)
+		if enqueued {
+			q.enqueued.Add(1)
+		}
+
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// enqueueDelayed откладывает сообщение. Отложенных сообщений не больше емкости очереди.
+func (q *MemoryQueue) enqueueDelayed(msg *models.DataMessage, delay time.Duration) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	if q.delayed.len() >= cap(q.messages) {
 		return ErrQueueFull
 	}
+
+	q.delayed.schedule(msg, time.Now().Add(delay))
+
+	return nil
+}
+
+// releaseDelayed переносит созревшее сообщение в очередь.
+func (q *MemoryQueue) releaseDelayed(msg *models.DataMessage) error {
+	return q.enqueue(context.Background(), msg, true)
+}
+
+// requeue возвращает сообщение в очередь после Nack.
+// Номер попытки запоминается до постановки в очередь, чтобы его увидел любой потребитель.
+func (q *MemoryQueue) requeue(msg *models.DataMessage, attempt int) error {
+	q.attempts.requeued(msg, attempt)
+
+	if err := q.enqueue(context.Background(), msg, true); err != nil {
+		q.attempts.next(msg)
+
+		return err
+	}
+
+	return nil
 }
 
 // Dequeue извлекает сообщение из очереди (блокирующий).
@@ -75,9 +278,7 @@ func (q *MemoryQueue) Dequeue(ctx context.Context) (*models.DataMessage, error)
 			return nil, ErrQueueClosed
 		}
 
-		q.mu.Lock()
-		q.stats.TotalDequeued++
-		q.mu.Unlock()
+		q.dequeued.Add(1)
 
 		return msg, nil
 	case <-ctx.Done():
@@ -86,8 +287,8 @@ func (q *MemoryQueue) Dequeue(ctx context.Context) (*models.DataMessage, error)
 }
 
 // Subscribe реализует интерфейс Subscriber для совместимости с WorkerPool.
-func (q *MemoryQueue) Subscribe(ctx context.Context) (<-chan *models.DataMessage, error) {
-	msgChan := make(chan *models.DataMessage, memoryQueueBufferSize)
+func (q *MemoryQueue) Subscribe(ctx context.Context) (<-chan Delivery, error) {
+	msgChan := make(chan Delivery, memoryQueueBufferSize)
 
 	go func() {
 		defer close(msgChan)
@@ -95,7 +296,7 @@ func (q *MemoryQueue) Subscribe(ctx context.Context) (<-chan *models.DataMessage
 		for {
 			msg, err := q.Dequeue(ctx)
 			if err != nil {
-				if errors.Is(err, context.Canceled) || errors.Is(err, ErrQueueClosed) {
+				if ctx.Err() != nil || errors.Is(err, ErrQueueClosed) {
 					return
 				}
 
@@ -104,7 +305,7 @@ func (q *MemoryQueue) Subscribe(ctx context.Context) (<-chan *models.DataMessage
 			}
 
 			select {
-			case msgChan <- msg:
+			case msgChan <- newMemoryDelivery(msg, q.attempts.next(msg), q.requeue):
 			case <-ctx.Done():
 				return
 			}
@@ -116,22 +317,26 @@ func (q *MemoryQueue) Subscribe(ctx context.Context) (<-chan *models.DataMessage
 
 // Stats возвращает статистику очереди.
 func (q *MemoryQueue) Stats() Stats {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
-	stats := q.stats
-	stats.CurrentSize = len(q.messages)
-
-	return stats
+	return Stats{
+		TotalEnqueued: q.enqueued.Load(),
+		TotalDequeued: q.dequeued.Load(),
+		CurrentSize:   len(q.messages),
+		DelayedSize:   q.delayed.len(),
+		Dropped:       q.dropped.Load(),
+	}
 }
 
 // Close закрывает очередь.
 func (q *MemoryQueue) Close() error {
+	q.closeOnce.Do(func() { close(q.closing) })
+
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
 	if !q.closed {
 		q.closed = true
 		close(q.messages)
+		q.delayed.close()
 	}
 
 	return nil
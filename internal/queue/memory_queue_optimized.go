@@ -5,107 +5,251 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/stsolovey/diplom-distributed-system/internal/models"
 )
 
+var ErrLeaseReleased = errors.New("message lease already released")
+
+// pooledMessage - объект пула: сообщение и поколение его аренды.
+// Поколение увеличивается при каждом Release, поэтому устаревшая аренда отличима от текущей.
+type pooledMessage struct {
+	msg     *models.DataMessage
+	gen     atomic.Uint64
+	attempt int // номер попытки доставки; задается при публикации
+}
+
 // Оптимизированная версия с object pool.
 //
 //nolint:gochecknoglobals // object pool requires global scope for performance
 var messagePool = sync.Pool{
 	New: func() interface{} {
-		return &models.DataMessage{
-			Metadata: make(map[string]string),
+		return &pooledMessage{
+			msg: &models.DataMessage{
+				Metadata: make(map[string]string),
+			},
 		}
 	},
 }
 
+// MessageLease - аренда сообщения из пула OptimizedMemoryQueue.
+// Сообщение действительно до Release; после Release объект возвращается в пул и переиспользуется,
+// поэтому потребитель не должен хранить указатель на сообщение или его Payload.
+type MessageLease struct {
+	entry *pooledMessage
+	gen   uint64
+	debug bool
+}
+
+// Message возвращает арендованное сообщение.
+// В отладочном режиме обращение после Release вызывает панику с ErrLeaseReleased.
+func (l MessageLease) Message() *models.DataMessage {
+	if l.entry == nil {
+		return nil
+	}
+
+	if l.debug && l.entry.gen.Load() != l.gen {
+		panic(fmt.Errorf("%w: message read after release", ErrLeaseReleased))
+	}
+
+	return l.entry.msg
+}
+
+// Release возвращает сообщение в пул. Повторный Release игнорируется,
+// а в отладочном режиме вызывает панику с ErrLeaseReleased.
+func (l MessageLease) Release() {
+	if l.entry == nil {
+		return
+	}
+
+	if !l.entry.gen.CompareAndSwap(l.gen, l.gen+1) {
+		if l.debug {
+			panic(fmt.Errorf("%w: double release", ErrLeaseReleased))
+		}
+
+		return
+	}
+
+	if l.debug {
+		// Объект не переиспользуется, а затирается: чтение сохраненного указателя
+		// видно по пустым полям и по гонке под -race.
+		l.entry.msg.Reset()
+
+		return
+	}
+
+	messagePool.Put(l.entry)
+}
+
 // OptimizedMemoryQueue - версия с пулом объектов.
+// Сообщения выдаются в аренду (MessageLease): объект возвращается в пул только после Release,
+// для доставок Subscribe - после Ack, Nack или Term.
 type OptimizedMemoryQueue struct {
-	messages chan *models.DataMessage
-	mu       sync.RWMutex
-	closed   bool
-	stats    Stats
+	messages    chan *pooledMessage
+	mu          sync.RWMutex
+	closed      bool
+	debug       atomic.Bool
+	stats       Stats
+	attempts    attemptTracker
+	delayed     *delayScheduler
+	deadLetters pooledDeadLetterQueue
 }
 
 func NewOptimizedMemoryQueue(size int) *OptimizedMemoryQueue {
-	return &OptimizedMemoryQueue{
-		messages: make(chan *models.DataMessage, size),
+	q := &OptimizedMemoryQueue{
+		messages:    make(chan *pooledMessage, size),
+		deadLetters: pooledDeadLetterQueue{NewMemoryDeadLetterQueue(memoryDeadLetterQueueSize)},
 	}
+	q.delayed = newDelayScheduler(q.releaseDelayed)
+
+	return q
+}
+
+// SetDebug включает отладочный режим аренд: обращение к сообщению после Release и повторный Release
+// вызывают панику, освобожденные объекты не переиспользуются. Вызывается до начала работы с очередью.
+func (q *OptimizedMemoryQueue) SetDebug(debug bool) {
+	q.debug.Store(debug)
 }
 
 func (q *OptimizedMemoryQueue) Publish(ctx context.Context, msg *models.DataMessage) error {
+	return q.publish(ctx, msg, 1)
+}
+
+// publish копирует сообщение в объект из пула вместе с номером попытки доставки.
+func (q *OptimizedMemoryQueue) publish(ctx context.Context, msg *models.DataMessage, attempt int) error {
+	// Отложенное сообщение копируется в объект из пула только в момент доставки
+	if delay := deliveryDelay(msg); delay > 0 {
+		return q.publishDelayed(msg, delay, attempt)
+	}
+
 	// Копируем в объект из пула
-	pooledMsg, ok := messagePool.Get().(*models.DataMessage)
+	entry, ok := messagePool.Get().(*pooledMessage)
 	if !ok {
 		return ErrQueueFull
 	}
 
-	pooledMsg.Id = msg.GetId()
-	pooledMsg.Timestamp = msg.GetTimestamp()
-	pooledMsg.Source = msg.GetSource()
-	pooledMsg.Payload = append(pooledMsg.Payload[:0], msg.GetPayload()...)
+	copyMessage(entry.msg, msg)
+	entry.attempt = attempt
 
-	// Очищаем и копируем metadata
-	for k := range pooledMsg.GetMetadata() {
-		delete(pooledMsg.GetMetadata(), k)
+	if err := q.send(ctx, entry); err != nil {
+		messagePool.Put(entry)
+
+		return err
 	}
 
-	for k, v := range msg.GetMetadata() {
-		pooledMsg.GetMetadata()[k] = v
+	q.mu.Lock()
+	q.stats.TotalEnqueued++
+	q.mu.Unlock()
+
+	return nil
+}
+
+// send кладет объект в канал очереди. Read-lock не дает Close закрыть канал во время отправки,
+// поэтому повтор после Nack, пришедший после Close, получает ErrQueueClosed.
+func (q *OptimizedMemoryQueue) send(ctx context.Context, entry *pooledMessage) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
 	}
 
 	select {
-	case q.messages <- pooledMsg:
-		q.mu.Lock()
-		q.stats.TotalEnqueued++
-		q.mu.Unlock()
-
+	case q.messages <- entry:
 		return nil
 	case <-ctx.Done():
-		messagePool.Put(pooledMsg)
-
 		return fmt.Errorf("publish context cancelled: %w", ctx.Err())
 	default:
-		messagePool.Put(pooledMsg)
-
 		return ErrQueueFull
 	}
 }
 
+// PublishBatch реализует интерфейс BatchPublisher.
+func (q *OptimizedMemoryQueue) PublishBatch(ctx context.Context, msgs []*models.DataMessage) []error {
+	errs := make([]error, len(msgs))
+
+	for i, msg := range msgs {
+		errs[i] = q.Publish(ctx, msg)
+	}
+
+	return errs
+}
+
 func (q *OptimizedMemoryQueue) Enqueue(ctx context.Context, msg *models.DataMessage) error {
 	return q.Publish(ctx, msg)
 }
 
-func (q *OptimizedMemoryQueue) Dequeue(ctx context.Context) (*models.DataMessage, error) {
+// publishDelayed откладывает копию сообщения: оригинал может принадлежать пулу (повтор после Nack)
+// или вызывающему, который вправе изменить его после Publish. Номер попытки запоминается для копии.
+func (q *OptimizedMemoryQueue) publishDelayed(msg *models.DataMessage, delay time.Duration, attempt int) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	if q.delayed.len() >= cap(q.messages) {
+		return ErrQueueFull
+	}
+
+	clone := cloneMessage(msg)
+	if attempt > 1 {
+		q.attempts.requeued(clone, attempt)
+	}
+
+	q.delayed.schedule(clone, time.Now().Add(delay))
+
+	return nil
+}
+
+func (q *OptimizedMemoryQueue) releaseDelayed(msg *models.DataMessage) error {
+	attempt := q.attempts.next(msg)
+
+	err := q.publish(context.Background(), msg, attempt)
+	if errors.Is(err, ErrQueueFull) && attempt > 1 {
+		// Планировщик повторит выпуск того же сообщения: номер попытки сохраняется.
+		q.attempts.requeued(msg, attempt)
+	}
+
+	return err
+}
+
+// requeue возвращает сообщение в очередь после Nack (копируя его в объект из пула).
+func (q *OptimizedMemoryQueue) requeue(msg *models.DataMessage, attempt int) error {
+	return q.publish(context.Background(), msg, attempt)
+}
+
+// Dequeue извлекает сообщение из очереди (блокирующий).
+// Потребитель обязан вызвать Release, когда сообщение больше не нужно.
+func (q *OptimizedMemoryQueue) Dequeue(ctx context.Context) (MessageLease, error) {
 	select {
-	case msg := <-q.messages:
-		if msg == nil {
-			return nil, ErrQueueClosed
+	case entry := <-q.messages:
+		if entry == nil {
+			return MessageLease{}, ErrQueueClosed
 		}
 
 		q.mu.Lock()
 		q.stats.TotalDequeued++
 		q.mu.Unlock()
 
-		// Возвращаем сообщение в пул после использования
-		// ВНИМАНИЕ: потребитель должен скопировать данные если нужно их сохранить
-		defer messagePool.Put(msg)
-
-		return msg, nil
+		return MessageLease{entry: entry, gen: entry.gen.Load(), debug: q.debug.Load()}, nil
 	case <-ctx.Done():
-		return nil, fmt.Errorf("dequeue context cancelled: %w", ctx.Err())
+		return MessageLease{}, fmt.Errorf("dequeue context cancelled: %w", ctx.Err())
 	}
 }
 
-func (q *OptimizedMemoryQueue) Subscribe(ctx context.Context) (<-chan *models.DataMessage, error) {
-	msgChan := make(chan *models.DataMessage, memoryQueueBufferSize)
+// Subscribe реализует интерфейс Subscriber. Аренда сообщения освобождается при завершении доставки.
+func (q *OptimizedMemoryQueue) Subscribe(ctx context.Context) (<-chan Delivery, error) {
+	msgChan := make(chan Delivery, memoryQueueBufferSize)
 
 	go func() {
 		defer close(msgChan)
 
 		for {
-			msg, err := q.Dequeue(ctx)
+			lease, err := q.Dequeue(ctx)
 			if err != nil {
 				if ctx.Err() != nil || errors.Is(err, ErrQueueClosed) {
 					return
@@ -114,9 +258,17 @@ func (q *OptimizedMemoryQueue) Subscribe(ctx context.Context) (<-chan *models.Da
 				continue
 			}
 
+			msg := lease.Message()
+			delivery := &leasedDelivery{
+				memoryDelivery: newMemoryDelivery(msg, lease.entry.attempt, q.requeue),
+				lease:          lease,
+			}
+
 			select {
-			case msgChan <- msg:
+			case msgChan <- delivery:
 			case <-ctx.Done():
+				lease.Release()
+
 				return
 			}
 		}
@@ -125,11 +277,22 @@ func (q *OptimizedMemoryQueue) Subscribe(ctx context.Context) (<-chan *models.Da
 	return msgChan, nil
 }
 
+// DeadLetters реализует интерфейс DeadLetterProvider.
+func (q *OptimizedMemoryQueue) DeadLetters() DeadLetterQueue { //nolint:ireturn // interface by design
+	return q.deadLetters
+}
+
+// MaxAttempts реализует интерфейс DeadLetterProvider.
+func (q *OptimizedMemoryQueue) MaxAttempts() int {
+	return defaultMaxDeliveryAttempts
+}
+
 func (q *OptimizedMemoryQueue) Stats() Stats {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
 	stats := q.stats
 	stats.CurrentSize = len(q.messages)
+	stats.DelayedSize = q.delayed.len()
 
 	return stats
 }
@@ -141,12 +304,91 @@ func (q *OptimizedMemoryQueue) Close() error {
 	if !q.closed {
 		q.closed = true
 		close(q.messages)
+		q.delayed.close()
 
 		// Очищаем очередь и возвращаем объекты в пул
-		for msg := range q.messages {
-			messagePool.Put(msg)
+		for entry := range q.messages {
+			messagePool.Put(entry)
 		}
 	}
 
 	return nil
 }
+
+// leasedDelivery - доставка OptimizedMemoryQueue: после Ack, Nack или Term аренда сообщения освобождается.
+// Nack успевает скопировать сообщение для повторной доставки до освобождения.
+type leasedDelivery struct {
+	*memoryDelivery
+
+	lease MessageLease
+}
+
+// Message реализует интерфейс Delivery.
+func (d *leasedDelivery) Message() *models.DataMessage {
+	return d.lease.Message()
+}
+
+// Ack реализует интерфейс Delivery.
+func (d *leasedDelivery) Ack() error {
+	return d.release(d.memoryDelivery.Ack())
+}
+
+// Nack реализует интерфейс Delivery.
+func (d *leasedDelivery) Nack(delay time.Duration) error {
+	return d.release(d.memoryDelivery.Nack(delay))
+}
+
+// Term реализует интерфейс Delivery.
+func (d *leasedDelivery) Term() error {
+	return d.release(d.memoryDelivery.Term())
+}
+
+// release освобождает аренду, если доставку завершил этот вызов.
+// Неудачный Nack оставляет доставку незавершенной, и аренда сохраняется.
+func (d *leasedDelivery) release(err error) error {
+	if !errors.Is(err, ErrDeliverySettled) && d.settled.Load() {
+		d.lease.Release()
+	}
+
+	return err
+}
+
+// pooledDeadLetterQueue сохраняет в DLQ копию сообщения: оригинал принадлежит пулу
+// и переиспользуется после Term.
+type pooledDeadLetterQueue struct {
+	*MemoryDeadLetterQueue
+}
+
+// Put реализует интерфейс DeadLetterQueue.
+func (q pooledDeadLetterQueue) Put(ctx context.Context, dl *DeadLetter) error {
+	dl.Message = cloneMessage(dl.Message)
+
+	return q.MemoryDeadLetterQueue.Put(ctx, dl)
+}
+
+// copyMessage копирует src в dst, переиспользуя буферы Payload и Metadata.
+func copyMessage(dst, src *models.DataMessage) {
+	dst.Id = src.GetId()
+	dst.Timestamp = src.GetTimestamp()
+	dst.Source = src.GetSource()
+	dst.Payload = append(dst.Payload[:0], src.GetPayload()...)
+
+	if dst.Metadata == nil {
+		dst.Metadata = make(map[string]string, len(src.GetMetadata()))
+	}
+
+	// Очищаем и копируем metadata
+	clear(dst.Metadata)
+
+	for k, v := range src.GetMetadata() {
+		dst.Metadata[k] = v
+	}
+}
+
+// cloneMessage возвращает копию сообщения вне пула.
+func cloneMessage(msg *models.DataMessage) *models.DataMessage {
+	clone := &models.DataMessage{}
+	copyMessage(clone, msg)
+
+	return clone
+}
@@ -0,0 +1,227 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/config"
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func expectLeasePanic(t *testing.T, name string, fn func()) {
+	t.Helper()
+
+	defer func() {
+		err, ok := recover().(error)
+		if !ok || !errors.Is(err, ErrLeaseReleased) {
+			t.Errorf("%s: expected panic with ErrLeaseReleased, got %v", name, err)
+		}
+	}()
+
+	fn()
+}
+
+func TestOptimizedMemoryQueue_LeaseDebugDetectsUseAfterRelease(t *testing.T) {
+	q := NewOptimizedMemoryQueue(1)
+	defer q.Close()
+
+	q.SetDebug(true)
+
+	if err := q.Publish(context.Background(), &models.DataMessage{Id: "leased"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	lease, err := q.Dequeue(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to dequeue: %v", err)
+	}
+
+	msg := lease.Message()
+	if msg.GetId() != "leased" {
+		t.Fatalf("Expected message leased, got %s", msg.GetId())
+	}
+
+	lease.Release()
+
+	// Сохраненный указатель затерт, а повторные обращения к аренде вызывают панику.
+	if msg.GetId() != "" {
+		t.Errorf("Expected released message to be wiped, got %s", msg.GetId())
+	}
+
+	expectLeasePanic(t, "Message", func() { lease.Message() })
+	expectLeasePanic(t, "Release", lease.Release)
+}
+
+func TestOptimizedMemoryQueue_StaleLeaseDoesNotReleaseReusedMessage(t *testing.T) {
+	q := NewOptimizedMemoryQueue(1)
+	defer q.Close()
+
+	_ = q.Publish(context.Background(), &models.DataMessage{Id: "first"})
+
+	stale, _ := q.Dequeue(context.Background())
+	stale.Release()
+
+	_ = q.Publish(context.Background(), &models.DataMessage{Id: "second"})
+
+	lease, _ := q.Dequeue(context.Background())
+	defer lease.Release()
+
+	// Повторный Release устаревшей аренды не должен вернуть в пул сообщение, которое уже выдано снова.
+	stale.Release()
+
+	if got := lease.Message().GetId(); got != "second" {
+		t.Errorf("Expected message second, got %s", got)
+	}
+}
+
+func TestOptimizedMemoryQueue_DeliveryReleasesLease(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	q := NewOptimizedMemoryQueue(100)
+	defer q.Close()
+
+	deliveries, err := q.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	var wg sync.WaitGroup
+
+	// Потребители читают сообщения, пока производитель публикует новые: под -race это проверяет,
+	// что объекты пула не переиспользуются до завершения доставки.
+	for range 4 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for delivery := range deliveries {
+				msg := delivery.Message()
+				if string(msg.GetPayload()) != "payload-"+msg.GetId() {
+					t.Errorf("Message %s has foreign payload %q", msg.GetId(), msg.GetPayload())
+				}
+
+				_ = delivery.Ack()
+			}
+		}()
+	}
+
+	for i := range 1000 {
+		id := fmt.Sprint(i)
+		for q.Publish(ctx, &models.DataMessage{Id: id, Payload: []byte("payload-" + id)}) != nil {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	for q.Stats().TotalDequeued < 1000 && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	wg.Wait()
+}
+
+func TestOptimizedMemoryQueue_NackAndDeadLetterCopyMessage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	q := NewOptimizedMemoryQueue(10)
+	defer q.Close()
+
+	q.SetDebug(true)
+
+	if err := q.Publish(ctx, &models.DataMessage{Id: "retry", Payload: []byte("data")}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	deliveries, err := q.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	if err := (<-deliveries).Nack(10 * time.Millisecond); err != nil {
+		t.Fatalf("Failed to nack: %v", err)
+	}
+
+	delivery := <-deliveries
+	if delivery.Attempt() != 2 || string(delivery.Message().GetPayload()) != "data" {
+		t.Fatalf("Expected intact message on attempt 2, got %v on attempt %d", delivery.Message(), delivery.Attempt())
+	}
+
+	dl := &DeadLetter{Message: delivery.Message(), Attempts: delivery.Attempt()}
+	if err := q.DeadLetters().Put(ctx, dl); err != nil {
+		t.Fatalf("Failed to put dead letter: %v", err)
+	}
+
+	if err := delivery.Term(); err != nil {
+		t.Fatalf("Failed to term: %v", err)
+	}
+
+	if err := delivery.Term(); !errors.Is(err, ErrDeliverySettled) {
+		t.Errorf("Expected ErrDeliverySettled, got %v", err)
+	}
+
+	got, err := q.DeadLetters().Get(ctx, dl.ID)
+	if err != nil || got.Message.GetId() != "retry" || string(got.Message.GetPayload()) != "data" {
+		t.Errorf("Dead letter lost its message after release: %v (%v)", got, err)
+	}
+}
+
+func TestOptimizedMemoryQueue_NackAfterClose(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	q := NewOptimizedMemoryQueue(10)
+
+	if err := q.Publish(ctx, &models.DataMessage{Id: "in-flight"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	deliveries, err := q.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	delivery := <-deliveries
+
+	if err := q.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	// Повтор в закрытую очередь не паникует, а возвращает ошибку; доставка остается незавершенной.
+	if err := delivery.Nack(0); !errors.Is(err, ErrRequeueFailed) || !errors.Is(err, ErrQueueClosed) {
+		t.Fatalf("Expected ErrRequeueFailed wrapping ErrQueueClosed, got %v", err)
+	}
+
+	if err := q.Publish(ctx, &models.DataMessage{Id: "late"}); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Expected ErrQueueClosed, got %v", err)
+	}
+}
+
+func TestFactory_OptimizedMemoryProvider(t *testing.T) {
+	factory := NewFactory(&config.Config{
+		QueueType:       string(OptimizedProviderType),
+		QueueSize:       10,
+		QueueLeaseDebug: true,
+	})
+
+	provider, err := factory.CreateProvider()
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	defer provider.Close()
+
+	q, ok := provider.(*OptimizedMemoryQueue)
+	if !ok {
+		t.Fatalf("Expected *OptimizedMemoryQueue, got %T", provider)
+	}
+
+	if !q.debug.Load() {
+		t.Error("Expected lease debug mode to be enabled")
+	}
+}
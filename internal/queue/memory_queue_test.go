@@ -2,7 +2,10 @@ package queue
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -128,3 +131,240 @@ func BenchmarkMemoryQueue_EnqueueOnly(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkRingQueue_EnqueueDequeue(b *testing.B) {
+	q := NewRingQueue(1000)
+	defer q.Close()
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			i++
+			msg := &models.DataMessage{
+				Id:      fmt.Sprintf("bench-%d", i),
+				Payload: []byte("benchmark data"),
+			}
+
+			if err := q.Enqueue(context.Background(), msg); err != nil {
+				b.Fatalf("Failed to enqueue: %v", err)
+			}
+
+			if _, err := q.Dequeue(context.Background()); err != nil {
+				b.Fatalf("Failed to dequeue: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkRingQueue_EnqueueOnly(b *testing.B) {
+	q := NewRingQueue(b.N + 1000)
+	defer q.Close()
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		msg := &models.DataMessage{
+			Id:      fmt.Sprintf("bench-%d", i),
+			Payload: []byte("benchmark data"),
+		}
+
+		if err := q.Enqueue(context.Background(), msg); err != nil {
+			b.Fatalf("Failed to enqueue: %v", err)
+		}
+	}
+}
+
+// BenchmarkRingQueue_DequeueBatch - производители и потребители в разных горутинах,
+// потребители забирают сообщения пачками по 64.
+func BenchmarkRingQueue_DequeueBatch(b *testing.B) {
+	q := NewRingQueue(4096)
+	defer q.Close()
+
+	msg := &models.DataMessage{Id: "bench", Payload: []byte("benchmark data")}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var consumed atomic.Int64
+
+	for range 4 {
+		go func() {
+			buf := make([]*models.DataMessage, 64)
+
+			for {
+				n, err := q.DequeueBatch(ctx, buf)
+				if err != nil {
+					return
+				}
+
+				consumed.Add(int64(n))
+			}
+		}()
+	}
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			for q.Enqueue(ctx, msg) != nil {
+				runtime.Gosched()
+			}
+		}
+	})
+
+	for consumed.Load() < int64(b.N) {
+		runtime.Gosched()
+	}
+}
+
+func TestMemoryQueue_SubscribeNackRedelivers(t *testing.T) {
+	q := NewMemoryQueue(10)
+	defer q.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	deliveries, err := q.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	if err := q.Enqueue(ctx, &models.DataMessage{Id: "retry"}); err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+
+	first := <-deliveries
+	if err := first.Nack(10 * time.Millisecond); err != nil {
+		t.Fatalf("Failed to nack: %v", err)
+	}
+
+	if err := first.Ack(); err != ErrDeliverySettled {
+		t.Errorf("Expected ErrDeliverySettled on second settle, got %v", err)
+	}
+
+	select {
+	case second := <-deliveries:
+		if second.Message().GetId() != "retry" {
+			t.Errorf("Expected redelivered message retry, got %s", second.Message().GetId())
+		}
+
+		if err := second.Ack(); err != nil {
+			t.Errorf("Failed to ack redelivered message: %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timeout waiting for redelivery")
+	}
+
+	stats := q.Stats()
+	if stats.TotalEnqueued != 2 || stats.TotalDequeued != 2 {
+		t.Errorf("Expected 2 enqueued and 2 dequeued after redelivery, got %+v", stats)
+	}
+}
+
+func TestMemoryQueue_NackRequeuesCopy(t *testing.T) {
+	q := NewMemoryQueue(10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	deliveries, err := q.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	if err := q.Enqueue(ctx, &models.DataMessage{Id: "retry"}); err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+
+	first := <-deliveries
+	if err := first.Nack(time.Hour); err != nil {
+		t.Fatalf("Failed to nack: %v", err)
+	}
+
+	// Исходное сообщение может разделяться с другими провайдерами composite и не меняется.
+	if _, ok := DeliverAt(first.Message()); ok {
+		t.Errorf("Expected original message without deliver_at, got %v", first.Message().GetMetadata())
+	}
+
+	if stats := q.Stats(); stats.DelayedSize != 1 {
+		t.Errorf("Expected delayed copy, got %+v", stats)
+	}
+
+	if err := q.Enqueue(ctx, &models.DataMessage{Id: "failed"}); err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+
+	second := <-deliveries
+
+	q.Close()
+
+	// Сообщение не удалось вернуть в очередь: доставка остается незавершенной.
+	if err := second.Nack(0); !errors.Is(err, ErrRequeueFailed) {
+		t.Fatalf("Expected ErrRequeueFailed, got %v", err)
+	}
+
+	if err := second.Term(); err != nil {
+		t.Errorf("Expected delivery to stay unsettled after failed requeue, got %v", err)
+	}
+}
+
+func TestInMemoryQueues_AttemptsAreTrackedPerMessage(t *testing.T) {
+	priority, err := NewPriorityQueue(PriorityConfig{Levels: 1, LevelSize: 10})
+	if err != nil {
+		t.Fatalf("Failed to create priority queue: %v", err)
+	}
+
+	queues := map[string]Provider{
+		"memory":    NewMemoryAdapter(10),
+		"optimized": NewOptimizedMemoryQueue(10),
+		"ring":      NewRingQueue(16),
+		"priority":  priority,
+	}
+
+	for name, q := range queues {
+		t.Run(name, func(t *testing.T) {
+			defer q.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			deliveries, err := q.Subscribe(ctx)
+			if err != nil {
+				t.Fatalf("Failed to subscribe: %v", err)
+			}
+
+			// Сообщения без ID: счетчик попыток одного не должен доставаться другому.
+			if err := q.Publish(ctx, &models.DataMessage{Payload: []byte("retried")}); err != nil {
+				t.Fatalf("Failed to publish: %v", err)
+			}
+
+			if err := (<-deliveries).Nack(10 * time.Millisecond); err != nil {
+				t.Fatalf("Failed to nack: %v", err)
+			}
+
+			if err := q.Publish(ctx, &models.DataMessage{Payload: []byte("fresh")}); err != nil {
+				t.Fatalf("Failed to publish: %v", err)
+			}
+
+			expected := map[string]int{"fresh": 1, "retried": 2}
+
+			for range expected {
+				select {
+				case delivery := <-deliveries:
+					payload := string(delivery.Message().GetPayload())
+					if delivery.Attempt() != expected[payload] {
+						t.Errorf("Message %s: expected attempt %d, got %d", payload, expected[payload], delivery.Attempt())
+					}
+
+					_ = delivery.Ack()
+				case <-ctx.Done():
+					t.Fatal("Timeout waiting for delivery")
+				}
+			}
+		})
+	}
+}
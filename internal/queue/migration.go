@@ -0,0 +1,790 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+// MigrationPhase - этап миграции очереди на другой провайдер.
+type MigrationPhase string
+
+const (
+	// MigrationDualWrite - сообщения публикуются в оба провайдера, воркеры читают оба с дедупликацией.
+	MigrationDualWrite MigrationPhase = "dual-write"
+	// MigrationDraining - сообщения публикуются только в новый провайдер, старый дочитывается до пустого.
+	MigrationDraining MigrationPhase = "draining"
+	// MigrationCompleted - старый провайдер пуст и закрыт, очередь работает на новом.
+	MigrationCompleted MigrationPhase = "completed"
+	// MigrationFailed - миграция прервана (Abort, истек DrainTimeout, остановка processor или закрытие очереди)
+	// и откатывается на старый провайдер.
+	MigrationFailed MigrationPhase = "failed"
+)
+
+const (
+	defaultMigrationDualWrite     = 10 * time.Second
+	defaultMigrationCheckInterval = time.Second
+	defaultMigrationDrainTimeout  = 5 * time.Minute
+)
+
+var (
+	ErrMigrationInProgress    = errors.New("queue migration is already in progress")
+	ErrMigrationSameProvider  = errors.New("queue already uses this provider")
+	ErrMigrationNotSubscribed = errors.New("queue migration requires an active subscription")
+	ErrAlreadySubscribed      = errors.New("migrating provider supports a single subscription")
+	ErrNoDeadLetterQueue      = errors.New("queue provider has no dead-letter queue")
+	ErrNoMigration            = errors.New("no queue migration in progress")
+	ErrMigrationAborted       = errors.New("queue migration aborted")
+	ErrMigrationDrainTimeout  = errors.New("queue migration drain timed out")
+)
+
+// MigrationConfig - настройки миграции.
+type MigrationConfig struct {
+	DualWrite     time.Duration // длительность двойной записи перед дренированием старого провайдера
+	CheckInterval time.Duration // период проверки, что старый провайдер пуст
+	DrainTimeout  time.Duration // предельное время дренирования; по истечении миграция прерывается
+	DedupWindow   time.Duration // окно дедупликации копий, записанных в оба провайдера
+}
+
+// MigrationStatus - ход миграции.
+type MigrationStatus struct {
+	Phase      MigrationPhase
+	From       string
+	To         string
+	StartedAt  time.Time
+	FinishedAt time.Time `json:"FinishedAt,omitzero"`
+	// Сообщения старого провайдера: в очереди, отложенные и выданные без подтверждения; -1 - глубина неизвестна.
+	// После сбоя - сообщения нового провайдера, которые дочитываются перед его закрытием.
+	Remaining int64
+	// Повторные доставки старого провайдера, перенесенные в новый при дренировании.
+	Redirected int64
+	// Копии двойной записи, отброшенные дедупликацией.
+	DuplicatesSuppressed int64
+	Error                string `json:"Error,omitempty"`
+}
+
+// migrationSource - провайдер, из которого MigratingProvider читает доставки.
+type migrationSource struct {
+	id       int // номер источника для дедупликации
+	name     string
+	provider Provider
+	inflight atomic.Int64 // выданные воркерам, но еще не завершенные доставки
+
+	deliveries <-chan Delivery // канал подписки на провайдер
+
+	// retire задается при дренировании: повторные доставки переносятся в новый провайдер миграции.
+	retire     atomic.Pointer[migration]
+	redirected atomic.Int64
+}
+
+// remaining возвращает число сообщений, которые еще не обработаны в источнике; -1 - глубина неизвестна.
+// Учитываются и доставки, которые провайдер уже выдал в канал подписки, но forward еще не прочитал.
+func (s *migrationSource) remaining() int64 {
+	stats := s.provider.Stats()
+	if stats.CurrentSize < 0 {
+		return -1
+	}
+
+	return int64(stats.CurrentSize+stats.DelayedSize+len(s.deliveries)) + s.inflight.Load()
+}
+
+// migration - одна миграция со старого провайдера на новый.
+type migration struct {
+	from, to *migrationSource
+
+	status     MigrationStatus // защищено MigratingProvider.mu
+	cancel     context.CancelCauseFunc
+	dedup      *dedupCache
+	dedupOn    atomic.Bool
+	duplicates atomic.Int64
+}
+
+// MigratingProvider - провайдер очереди, который можно переключить на другой бэкенд без остановки processor.
+// Migrate подключает новый провайдер и проходит этапы:
+//   - dual-write: публикация через CompositeAdapter в оба провайдера, воркеры читают оба,
+//     копии одного сообщения отбрасываются по DataMessage.Id;
+//   - draining: публикация только в новый провайдер; старый дочитывается, а его повторные доставки (Nack)
+//     переносятся в новый провайдер;
+//   - cutover: когда в старом провайдере нет ни сообщений, ни неподтвержденных доставок,
+//     его DLQ переносится в новый провайдер, а сам он закрывается.
+//
+// Если старый провайдер не опустел за DrainTimeout или вызван Abort, миграция откатывается:
+// публикация возвращается в старый провайдер, а новый дочитывается и закрывается.
+//
+// Подписка одна: Subscribe возвращает канал, который не меняется при переключении провайдеров.
+type MigratingProvider struct {
+	cfg MigrationConfig
+
+	mu        sync.RWMutex
+	source    *migrationSource  // активный провайдер
+	members   *CompositeAdapter // старый и новый провайдеры во время миграции
+	current   atomic.Pointer[migration]
+	sourceIDs int
+	closed    bool
+
+	// publisher - активный провайдер, CompositeAdapter двойной записи или новый провайдер при дренировании.
+	// Публикация удерживает pubMu, поэтому после смены этапа в старый провайдер больше ничего не пишется.
+	pubMu     sync.RWMutex
+	publisher Provider
+
+	subCtx     context.Context //nolint:containedctx // контекст единственной подписки, нужен для подключения новых провайдеров
+	subscribed bool
+	out        chan Delivery
+	sources    sync.WaitGroup
+}
+
+// NewMigratingProvider оборачивает провайдер name для миграции на другие провайдеры.
+func NewMigratingProvider(provider Provider, name string, cfg MigrationConfig) *MigratingProvider {
+	if cfg.DualWrite <= 0 {
+		cfg.DualWrite = defaultMigrationDualWrite
+	}
+
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = defaultMigrationCheckInterval
+	}
+
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = defaultMigrationDrainTimeout
+	}
+
+	if cfg.DedupWindow <= 0 {
+		cfg.DedupWindow = DefaultCompositeDedupWindow
+	}
+
+	return &MigratingProvider{
+		cfg:       cfg,
+		source:    &migrationSource{name: name, provider: provider},
+		publisher: provider,
+	}
+}
+
+// Name возвращает имя активного провайдера.
+func (p *MigratingProvider) Name() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.source.name
+}
+
+// Publish реализует интерфейс Publisher.
+func (p *MigratingProvider) Publish(ctx context.Context, msg *models.DataMessage) error {
+	p.pubMu.RLock()
+	defer p.pubMu.RUnlock()
+
+	return p.publisher.Publish(ctx, msg)
+}
+
+// PublishBatch реализует интерфейс BatchPublisher.
+func (p *MigratingProvider) PublishBatch(ctx context.Context, msgs []*models.DataMessage) []error {
+	p.pubMu.RLock()
+	defer p.pubMu.RUnlock()
+
+	return p.publisher.PublishBatch(ctx, msgs)
+}
+
+// setPublisher переключает публикацию; возвращается после завершения начатых публикаций.
+func (p *MigratingProvider) setPublisher(publisher Provider) {
+	p.pubMu.Lock()
+	defer p.pubMu.Unlock()
+
+	p.publisher = publisher
+}
+
+// Subscribe реализует интерфейс Subscriber. Канал получает доставки активного провайдера,
+// а во время миграции - обоих провайдеров; он закрывается после отмены ctx.
+func (p *MigratingProvider) Subscribe(ctx context.Context) (<-chan Delivery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.out != nil {
+		return nil, ErrAlreadySubscribed
+	}
+
+	p.subCtx = ctx
+	p.subscribed = true
+	p.out = make(chan Delivery, memoryQueueBufferSize)
+
+	if err := p.attachLocked(p.source); err != nil {
+		p.out = nil
+		p.subscribed = false
+
+		return nil, err
+	}
+
+	out := p.out
+
+	go func() {
+		<-ctx.Done()
+
+		p.mu.Lock()
+		p.subscribed = false
+		p.mu.Unlock()
+
+		p.sources.Wait()
+		close(out)
+	}()
+
+	return out, nil
+}
+
+// attachLocked подписывается на источник и пересылает его доставки в общий канал. Вызывается под p.mu.
+func (p *MigratingProvider) attachLocked(src *migrationSource) error {
+	deliveries, err := src.provider.Subscribe(p.subCtx)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s provider: %w", src.name, err)
+	}
+
+	src.deliveries = deliveries
+
+	p.sources.Add(1)
+
+	go func() {
+		defer p.sources.Done()
+
+		p.forward(p.subCtx, src, deliveries)
+	}()
+
+	return nil
+}
+
+// forward пересылает доставки источника до закрытия его канала.
+func (p *MigratingProvider) forward(ctx context.Context, src *migrationSource, deliveries <-chan Delivery) {
+	for delivery := range deliveries {
+		// Доставка считается незавершенной сразу после чтения из канала, чтобы remaining ее не пропустил.
+		src.inflight.Add(1)
+
+		if p.duplicate(src, delivery) {
+			src.inflight.Add(-1)
+
+			continue
+		}
+
+		wrapped := &migrationDelivery{Delivery: delivery, source: src}
+
+		select {
+		case p.out <- wrapped:
+		case <-ctx.Done():
+			if err := wrapped.Nack(0); err != nil {
+				log.Printf("MigratingProvider: failed to nack message %s: %v", delivery.Message().GetId(), err)
+			}
+
+			return
+		}
+	}
+}
+
+// duplicate подтверждает и отбрасывает копию сообщения, уже выданного другим провайдером миграции.
+func (p *MigratingProvider) duplicate(src *migrationSource, delivery Delivery) bool {
+	m := p.current.Load()
+	if m == nil || !m.dedupOn.Load() || !m.dedup.duplicate(delivery.Message().GetId(), src.id) {
+		return false
+	}
+
+	m.duplicates.Add(1)
+
+	if err := delivery.Ack(); err != nil {
+		log.Printf("MigratingProvider: failed to ack duplicate %s: %v", delivery.Message().GetId(), err)
+	}
+
+	return true
+}
+
+// Migrate начинает миграцию на провайдер to с именем name и возвращается сразу;
+// ход миграции возвращает Migration. ctx ограничивает всю миграцию, прервать ее можно через Abort.
+// При успешном запуске MigratingProvider владеет to и закрывает его сам.
+func (p *MigratingProvider) Migrate(ctx context.Context, name string, to Provider) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case p.closed:
+		return ErrQueueClosed
+	case !p.subscribed || p.subCtx.Err() != nil:
+		return ErrMigrationNotSubscribed
+	case p.members != nil:
+		return ErrMigrationInProgress
+	case name == p.source.name:
+		return fmt.Errorf("%w: %s", ErrMigrationSameProvider, name)
+	}
+
+	p.sourceIDs++
+
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	m := &migration{
+		from:   p.source,
+		to:     &migrationSource{id: p.sourceIDs, name: name, provider: to},
+		cancel: cancel,
+		dedup:  newDedupCache(p.cfg.DedupWindow, compositeDedupMaxEntries),
+		status: MigrationStatus{
+			Phase:     MigrationDualWrite,
+			From:      p.source.name,
+			To:        name,
+			StartedAt: time.Now(),
+			Remaining: -1,
+		},
+	}
+	m.dedupOn.Store(true)
+
+	// Дедупликация включается до подписки на новый провайдер, чтобы первые копии тоже отбрасывались.
+	previous := p.current.Swap(m)
+
+	if err := p.attachLocked(m.to); err != nil {
+		p.current.Store(previous)
+		cancel(err)
+
+		return err
+	}
+
+	p.members = NewCompositeAdapter([]Provider{m.from.provider, to}, FailFast)
+	p.setPublisher(p.members)
+
+	log.Printf("Queue migration %s -> %s started: dual-write for %s", m.from.name, name, p.cfg.DualWrite)
+
+	go p.run(ctx, m)
+
+	return nil
+}
+
+// run проводит миграцию по этапам dual-write, draining и cutover.
+func (p *MigratingProvider) run(ctx context.Context, m *migration) {
+	defer m.cancel(nil)
+
+	if err := p.wait(ctx, p.cfg.DualWrite); err != nil {
+		p.fail(m, err)
+
+		return
+	}
+
+	p.mu.Lock()
+	m.from.retire.Store(m)
+	m.status.Phase = MigrationDraining
+	p.setPublisher(m.to.provider)
+	p.mu.Unlock()
+
+	log.Printf("Queue migration %s -> %s: draining %s", m.from.name, m.to.name, m.from.name)
+
+	// В старый провайдер больше не пишут, а его повторные доставки уходят в новый,
+	// поэтому пустой старый провайдер пустым и останется.
+	if err := p.drain(ctx, m, m.from); err != nil {
+		p.fail(m, err)
+
+		return
+	}
+
+	p.cutover(ctx, m)
+}
+
+// drain ждет, пока в источнике src не останется сообщений, не дольше DrainTimeout.
+func (p *MigratingProvider) drain(ctx context.Context, m *migration, src *migrationSource) error {
+	deadline := time.Now().Add(p.cfg.DrainTimeout)
+
+	for {
+		remaining := src.remaining()
+
+		p.mu.Lock()
+		m.status.Remaining = remaining
+		p.mu.Unlock()
+
+		if remaining == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s still has %d messages after %s",
+				ErrMigrationDrainTimeout, src.name, remaining, p.cfg.DrainTimeout)
+		}
+
+		if err := p.wait(ctx, p.cfg.CheckInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// wait ждет delay; ошибка - если миграцию нужно прервать.
+func (p *MigratingProvider) wait(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return fmt.Errorf("queue migration canceled: %w", context.Cause(ctx))
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrQueueClosed
+	}
+
+	return nil
+}
+
+// cutover делает новый провайдер активным, переносит DLQ и закрывает старый провайдер.
+func (p *MigratingProvider) cutover(ctx context.Context, m *migration) {
+	p.mu.Lock()
+
+	if p.closed {
+		p.mu.Unlock()
+		p.fail(m, ErrQueueClosed)
+
+		return
+	}
+
+	// Abort, вызванный до переключения, еще откатывает миграцию; после него Abort вернет ErrNoMigration.
+	if ctx.Err() != nil {
+		p.mu.Unlock()
+		p.fail(m, fmt.Errorf("queue migration canceled: %w", context.Cause(ctx)))
+
+		return
+	}
+
+	p.source = m.to
+	p.members = nil
+	p.mu.Unlock()
+
+	// DLQ переносится без блокировки: операции с DLQ уже идут в новый провайдер,
+	// а перенос для брокеров - сетевой ввод-вывод.
+	moveDeadLetters(m.from.provider, m.to.provider)
+
+	p.mu.Lock()
+	m.status.Phase = MigrationCompleted
+	m.status.FinishedAt = time.Now()
+	m.status.Remaining = 0
+	p.mu.Unlock()
+
+	// Доставки, оставшиеся в канале подписки старого провайдера, дочитываются после закрытия.
+	if err := m.from.provider.Close(); err != nil {
+		log.Printf("Queue migration: failed to close %s provider: %v", m.from.name, err)
+	}
+
+	// Копии двойной записи могут еще лежать в новом провайдере: дедупликация работает до конца окна.
+	time.AfterFunc(p.cfg.DedupWindow, func() { m.dedupOn.Store(false) })
+
+	log.Printf("Queue migration %s -> %s completed", m.from.name, m.to.name)
+}
+
+// fail прерывает миграцию и откатывает ее на старый провайдер. Если очередь закрыта,
+// оба провайдера закрываются вместе с ней.
+func (p *MigratingProvider) fail(m *migration, err error) {
+	p.mu.Lock()
+
+	m.status.Phase = MigrationFailed
+	m.status.FinishedAt = time.Now()
+	m.status.Error = err.Error()
+
+	closed := p.closed
+	if !closed {
+		// Публикация возвращается в старый провайдер, а повторные доставки нового переносятся в старый.
+		m.from.retire.Store(nil)
+		m.to.retire.Store(&migration{from: m.to, to: m.from, dedup: m.dedup})
+		p.setPublisher(m.from.provider)
+	}
+
+	p.mu.Unlock()
+
+	log.Printf("Queue migration %s -> %s failed: %v", m.from.name, m.to.name, err)
+
+	if !closed {
+		p.rollback(m)
+	}
+}
+
+// rollback дочитывает новый провайдер прерванной миграции и закрывает его. Если он не опустел
+// за DrainTimeout, провайдер остается подключенным до закрытия очереди, а новая миграция невозможна.
+func (p *MigratingProvider) rollback(m *migration) {
+	if err := p.drain(context.Background(), m, m.to); err != nil {
+		log.Printf("Queue migration: %s provider stays attached until the queue is closed: %v", m.to.name, err)
+
+		return
+	}
+
+	p.mu.Lock()
+
+	if p.closed {
+		p.mu.Unlock()
+
+		return
+	}
+
+	p.members = nil
+	p.mu.Unlock()
+
+	if err := m.to.provider.Close(); err != nil {
+		log.Printf("Queue migration: failed to close %s provider: %v", m.to.name, err)
+	}
+
+	time.AfterFunc(p.cfg.DedupWindow, func() { m.dedupOn.Store(false) })
+
+	log.Printf("Queue migration %s -> %s rolled back", m.from.name, m.to.name)
+}
+
+// Abort прерывает текущую миграцию; откат идет в фоне, его ход возвращает Migration.
+// ErrNoMigration - миграция не идет, уже прервана или новый провайдер уже стал активным.
+func (p *MigratingProvider) Abort() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	m := p.current.Load()
+	if m == nil || p.members == nil || m.status.Phase == MigrationFailed {
+		return ErrNoMigration
+	}
+
+	m.cancel(ErrMigrationAborted)
+
+	return nil
+}
+
+// moveDeadLetters переносит DLQ старого провайдера в DLQ нового; ошибки только логируются.
+func moveDeadLetters(from, to Provider) {
+	fromDLQ, toDLQ := providerDeadLetters(from), providerDeadLetters(to)
+	if fromDLQ == nil || toDLQ == nil {
+		return
+	}
+
+	ctx := context.Background()
+
+	entries, err := fromDLQ.List(ctx, 0)
+	if err != nil {
+		log.Printf("Queue migration: failed to list dead letters: %v", err)
+
+		return
+	}
+
+	for _, dl := range entries {
+		id := dl.ID
+
+		if err := toDLQ.Put(ctx, dl); err != nil {
+			log.Printf("Queue migration: failed to move dead letter %s: %v", id, err)
+
+			continue
+		}
+
+		if err := fromDLQ.Delete(ctx, id); err != nil {
+			log.Printf("Queue migration: dead letter %s moved but not deleted: %v", id, err)
+		}
+	}
+}
+
+// providerDeadLetters возвращает DLQ провайдера или nil.
+func providerDeadLetters(provider Provider) DeadLetterQueue { //nolint:ireturn // interface by design
+	if dlp, ok := provider.(DeadLetterProvider); ok {
+		return dlp.DeadLetters()
+	}
+
+	return nil
+}
+
+// Migration возвращает ход текущей или последней миграции; nil - миграций не было.
+func (p *MigratingProvider) Migration() *MigrationStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	m := p.current.Load()
+	if m == nil {
+		return nil
+	}
+
+	status := m.status
+	status.Redirected = m.from.redirected.Load()
+	status.DuplicatesSuppressed = m.duplicates.Load()
+
+	return &status
+}
+
+// DeadLetters реализует интерфейс DeadLetterProvider: DLQ активного провайдера на момент вызова.
+func (p *MigratingProvider) DeadLetters() DeadLetterQueue { //nolint:ireturn // interface by design
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if providerDeadLetters(p.source.provider) == nil {
+		return nil
+	}
+
+	return &migratingDeadLetters{p: p}
+}
+
+// MaxAttempts реализует интерфейс DeadLetterProvider.
+func (p *MigratingProvider) MaxAttempts() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if dlp, ok := p.source.provider.(DeadLetterProvider); ok {
+		return dlp.MaxAttempts()
+	}
+
+	return defaultMaxDeliveryAttempts
+}
+
+// Stats возвращает статистику активного провайдера, а во время миграции - сумму по обоим провайдерам.
+func (p *MigratingProvider) Stats() Stats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.members != nil {
+		return p.members.Stats()
+	}
+
+	return p.source.provider.Stats()
+}
+
+// Close закрывает активный провайдер, а во время миграции - оба провайдера.
+func (p *MigratingProvider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+
+	p.closed = true
+
+	if p.members != nil {
+		return p.members.Close()
+	}
+
+	return p.source.provider.Close()
+}
+
+// migrationDelivery - доставка источника MigratingProvider. Считает незавершенные доставки источника,
+// а при дренировании переносит повторную доставку в новый провайдер.
+type migrationDelivery struct {
+	Delivery
+
+	source  *migrationSource
+	settled atomic.Bool
+}
+
+// Ack реализует интерфейс Delivery.
+func (d *migrationDelivery) Ack() error {
+	return d.done(d.Delivery.Ack())
+}
+
+// AckWithResult реализует интерфейс ResultAcknowledger, если его реализует исходная доставка.
+func (d *migrationDelivery) AckWithResult(ctx context.Context, result *models.ProcessingResult) error {
+	if acker, ok := d.Delivery.(ResultAcknowledger); ok {
+		return d.done(acker.AckWithResult(ctx, result))
+	}
+
+	return d.Ack()
+}
+
+// Nack реализует интерфейс Delivery. При дренировании сообщение публикуется в новый провайдер
+// (с задержкой delay), а доставка старого провайдера подтверждается.
+func (d *migrationDelivery) Nack(delay time.Duration) error {
+	if m := d.source.retire.Load(); m != nil {
+		return d.done(d.redirect(m, delay))
+	}
+
+	return d.done(d.Delivery.Nack(delay))
+}
+
+// Term реализует интерфейс Delivery.
+func (d *migrationDelivery) Term() error {
+	return d.done(d.Delivery.Term())
+}
+
+// redirect переносит повторную доставку в новый провайдер миграции. Номер попытки начинается заново.
+func (d *migrationDelivery) redirect(m *migration, delay time.Duration) error {
+	msg := cloneMessage(d.Message())
+	SetDelay(msg, delay)
+
+	// Повтор придет из нового провайдера и не должен считаться копией двойной записи.
+	m.dedup.transfer(msg.GetId(), m.to.id)
+
+	if err := m.to.provider.Publish(context.Background(), msg); err != nil {
+		log.Printf("MigratingProvider: failed to redirect message %s to %s: %v", msg.GetId(), m.to.name, err)
+
+		return d.Delivery.Nack(delay)
+	}
+
+	d.source.redirected.Add(1)
+
+	return d.Delivery.Ack()
+}
+
+// done отмечает доставку завершенной после первого вызова Ack, Nack или Term.
+func (d *migrationDelivery) done(err error) error {
+	if d.settled.CompareAndSwap(false, true) {
+		d.source.inflight.Add(-1)
+	}
+
+	return err
+}
+
+// migratingDeadLetters - DLQ активного провайдера MigratingProvider. Операции выполняются под read-lock,
+// поэтому не пересекаются со сменой активного провайдера. Пока при переключении переносится DLQ старого
+// провайдера, List может еще не содержать часть его записей.
+type migratingDeadLetters struct {
+	p *MigratingProvider
+}
+
+// activeLocked возвращает DLQ активного провайдера. Вызывается под p.mu.
+func (d *migratingDeadLetters) activeLocked() (DeadLetterQueue, error) { //nolint:ireturn // interface by design
+	dlq := providerDeadLetters(d.p.source.provider)
+	if dlq == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoDeadLetterQueue, d.p.source.name)
+	}
+
+	return dlq, nil
+}
+
+// Put реализует интерфейс DeadLetterQueue.
+func (d *migratingDeadLetters) Put(ctx context.Context, dl *DeadLetter) error {
+	d.p.mu.RLock()
+	defer d.p.mu.RUnlock()
+
+	dlq, err := d.activeLocked()
+	if err != nil {
+		return err
+	}
+
+	return dlq.Put(ctx, dl)
+}
+
+// List реализует интерфейс DeadLetterQueue.
+func (d *migratingDeadLetters) List(ctx context.Context, limit int) ([]*DeadLetter, error) {
+	d.p.mu.RLock()
+	defer d.p.mu.RUnlock()
+
+	dlq, err := d.activeLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	return dlq.List(ctx, limit)
+}
+
+// Get реализует интерфейс DeadLetterQueue.
+func (d *migratingDeadLetters) Get(ctx context.Context, id string) (*DeadLetter, error) {
+	d.p.mu.RLock()
+	defer d.p.mu.RUnlock()
+
+	dlq, err := d.activeLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	return dlq.Get(ctx, id)
+}
+
+// Delete реализует интерфейс DeadLetterQueue.
+func (d *migratingDeadLetters) Delete(ctx context.Context, id string) error {
+	d.p.mu.RLock()
+	defer d.p.mu.RUnlock()
+
+	dlq, err := d.activeLocked()
+	if err != nil {
+		return err
+	}
+
+	return dlq.Delete(ctx, id)
+}
@@ -0,0 +1,416 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func newTestMigratingProvider(t *testing.T) (*MigratingProvider, *MemoryAdapter) {
+	t.Helper()
+
+	return newTestMigratingProviderWithConfig(t, MigrationConfig{
+		DualWrite:     50 * time.Millisecond,
+		CheckInterval: 5 * time.Millisecond,
+	})
+}
+
+func newTestMigratingProviderWithConfig(t *testing.T, cfg MigrationConfig) (*MigratingProvider, *MemoryAdapter) {
+	t.Helper()
+
+	old := NewMemoryAdapter(1000)
+	p := NewMigratingProvider(old, "memory", cfg)
+
+	t.Cleanup(func() { p.Close() })
+
+	return p, old
+}
+
+func waitMigrationPhase(ctx context.Context, t *testing.T, p *MigratingProvider, phase MigrationPhase) {
+	t.Helper()
+
+	for {
+		if status := p.Migration(); status != nil && status.Phase == phase {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Timeout waiting for migration phase %s, status: %+v", phase, p.Migration())
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestMigratingProvider_MigratesWithoutLoss(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	p, old := newTestMigratingProvider(t)
+
+	deliveries, err := p.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	var (
+		mu        sync.Mutex
+		processed = make(map[string]int)
+		wg        sync.WaitGroup
+	)
+
+	for range 4 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for delivery := range deliveries {
+				mu.Lock()
+				processed[delivery.Message().GetId()]++
+				mu.Unlock()
+
+				_ = delivery.Ack()
+			}
+		}()
+	}
+
+	const backlog = 200
+
+	// Бэклог старого провайдера до начала миграции.
+	for i := range backlog {
+		if err := p.Publish(ctx, &models.DataMessage{Id: fmt.Sprint(i)}); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+
+	to := NewRingQueue(1000)
+	if err := p.Migrate(ctx, "ring", to); err != nil {
+		t.Fatalf("Failed to start migration: %v", err)
+	}
+
+	// Публикация продолжается на всех этапах миграции.
+	published := backlog
+
+	for p.Migration().Phase != MigrationCompleted && ctx.Err() == nil {
+		if err := p.Publish(ctx, &models.DataMessage{Id: fmt.Sprint(published)}); err != nil {
+			t.Fatalf("Failed to publish during migration: %v", err)
+		}
+
+		published++
+
+		time.Sleep(100 * time.Microsecond)
+	}
+
+	// После переключения сообщения идут только в новый провайдер.
+	for i := range 10 {
+		if err := p.Publish(ctx, &models.DataMessage{Id: fmt.Sprint(published + i)}); err != nil {
+			t.Fatalf("Failed to publish after cutover: %v", err)
+		}
+	}
+
+	published += 10
+
+	for ctx.Err() == nil {
+		mu.Lock()
+		done := len(processed) == published
+		mu.Unlock()
+
+		if done {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	if stats := to.Stats(); stats.TotalEnqueued == 0 {
+		t.Errorf("Expected messages in the new provider, got %+v", stats)
+	}
+
+	if err := old.Publish(ctx, &models.DataMessage{Id: "late"}); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Expected old provider to be closed, got %v", err)
+	}
+
+	status := p.Migration()
+	if status.From != "memory" || status.To != "ring" || status.Remaining != 0 || p.Name() != "ring" {
+		t.Errorf("Unexpected migration status: %+v", status)
+	}
+
+	cancel()
+	wg.Wait()
+
+	for i := range published {
+		if count := processed[fmt.Sprint(i)]; count != 1 {
+			t.Fatalf("Message %d processed %d times", i, count)
+		}
+	}
+
+	if status.DuplicatesSuppressed == 0 {
+		t.Errorf("Expected copies written to both providers to be suppressed, status: %+v", status)
+	}
+}
+
+func TestMigratingProvider_DrainRedirectsRetries(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p, _ := newTestMigratingProvider(t)
+
+	deliveries, err := p.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	if err := p.Publish(ctx, &models.DataMessage{Id: "retry"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	// Доставка старого провайдера остается незавершенной: дренирование ее ждет.
+	held := <-deliveries
+
+	if err := p.Migrate(ctx, "ring", NewRingQueue(16)); err != nil {
+		t.Fatalf("Failed to start migration: %v", err)
+	}
+
+	waitMigrationPhase(ctx, t, p, MigrationDraining)
+
+	time.Sleep(20 * time.Millisecond)
+
+	if status := p.Migration(); status.Phase != MigrationDraining || status.Remaining != 1 {
+		t.Fatalf("Expected migration to wait for the unfinished delivery, status: %+v", status)
+	}
+
+	if err := held.Nack(0); err != nil {
+		t.Fatalf("Failed to nack: %v", err)
+	}
+
+	waitMigrationPhase(ctx, t, p, MigrationCompleted)
+
+	select {
+	case delivery := <-deliveries:
+		if delivery.Message().GetId() != "retry" {
+			t.Errorf("Expected redirected message retry, got %s", delivery.Message().GetId())
+		}
+	case <-ctx.Done():
+		t.Fatal("Timeout waiting for redirected message")
+	}
+
+	if status := p.Migration(); status.Redirected != 1 {
+		t.Errorf("Expected 1 redirected message, status: %+v", status)
+	}
+}
+
+// waitMigrationAvailable ждет окончания отката: новая миграция запускается, когда новый провайдер закрыт.
+func waitMigrationAvailable(ctx context.Context, t *testing.T, p *MigratingProvider, name string, to Provider) {
+	t.Helper()
+
+	for {
+		err := p.Migrate(ctx, name, to)
+		if err == nil {
+			return
+		}
+
+		if !errors.Is(err, ErrMigrationInProgress) {
+			t.Fatalf("Failed to start migration: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Timeout waiting for rollback, status: %+v", p.Migration())
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestMigratingProvider_DrainTimeoutRollsBack(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p, old := newTestMigratingProviderWithConfig(t, MigrationConfig{
+		DualWrite:     10 * time.Millisecond,
+		CheckInterval: 5 * time.Millisecond,
+		DrainTimeout:  50 * time.Millisecond,
+	})
+
+	deliveries, err := p.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	if err := p.Publish(ctx, &models.DataMessage{Id: "held"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	// Незавершенная доставка не дает старому провайдеру опустеть до DrainTimeout.
+	held := <-deliveries
+
+	to := NewRingQueue(16)
+	if err := p.Migrate(ctx, "ring", to); err != nil {
+		t.Fatalf("Failed to start migration: %v", err)
+	}
+
+	waitMigrationPhase(ctx, t, p, MigrationFailed)
+
+	if status := p.Migration(); !strings.Contains(status.Error, ErrMigrationDrainTimeout.Error()) {
+		t.Errorf("Expected drain timeout, status: %+v", status)
+	}
+
+	// Публикация вернулась в старый провайдер.
+	if err := p.Publish(ctx, &models.DataMessage{Id: "after"}); err != nil {
+		t.Fatalf("Failed to publish after rollback: %v", err)
+	}
+
+	if stats := old.Stats(); stats.TotalEnqueued != 2 || p.Name() != "memory" {
+		t.Errorf("Expected old provider to stay active, got %s with %+v", p.Name(), stats)
+	}
+
+	if err := held.Ack(); err != nil {
+		t.Fatalf("Failed to ack: %v", err)
+	}
+
+	waitMigrationAvailable(ctx, t, p, "ring", NewRingQueue(16))
+
+	if err := to.Publish(ctx, &models.DataMessage{Id: "late"}); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Expected rolled back provider to be closed, got %v", err)
+	}
+}
+
+func TestMigratingProvider_Abort(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p, _ := newTestMigratingProviderWithConfig(t, MigrationConfig{
+		DualWrite:     time.Hour,
+		CheckInterval: 5 * time.Millisecond,
+	})
+
+	if err := p.Abort(); !errors.Is(err, ErrNoMigration) {
+		t.Errorf("Expected ErrNoMigration, got %v", err)
+	}
+
+	deliveries, err := p.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	to := NewRingQueue(16)
+	if err := p.Migrate(ctx, "ring", to); err != nil {
+		t.Fatalf("Failed to start migration: %v", err)
+	}
+
+	// Сообщение двойной записи лежит в обоих провайдерах; копия отбрасывается и при откате.
+	if err := p.Publish(ctx, &models.DataMessage{Id: "dual"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	if err := (<-deliveries).Ack(); err != nil {
+		t.Fatalf("Failed to ack: %v", err)
+	}
+
+	if err := p.Abort(); err != nil {
+		t.Fatalf("Failed to abort migration: %v", err)
+	}
+
+	waitMigrationPhase(ctx, t, p, MigrationFailed)
+
+	if status := p.Migration(); !strings.Contains(status.Error, ErrMigrationAborted.Error()) {
+		t.Errorf("Expected aborted migration, status: %+v", status)
+	}
+
+	if err := p.Abort(); !errors.Is(err, ErrNoMigration) {
+		t.Errorf("Expected ErrNoMigration after abort, got %v", err)
+	}
+
+	waitMigrationAvailable(ctx, t, p, "memory-optimized", NewOptimizedMemoryQueue(10))
+
+	if p.Name() != "memory" {
+		t.Errorf("Expected old provider to stay active, got %s", p.Name())
+	}
+
+	select {
+	case delivery := <-deliveries:
+		t.Errorf("Unexpected delivery %s", delivery.Message().GetId())
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestMigrationSource_RemainingCountsBufferedDeliveries(t *testing.T) {
+	deliveries := make(chan Delivery, 3)
+
+	for range 3 {
+		deliveries <- newMemoryDelivery(&models.DataMessage{}, 1, nil)
+	}
+
+	src := &migrationSource{provider: NewMemoryAdapter(10), deliveries: deliveries}
+	defer src.provider.Close()
+
+	src.inflight.Add(1)
+
+	if remaining := src.remaining(); remaining != 4 {
+		t.Errorf("Expected 4 remaining messages, got %d", remaining)
+	}
+}
+
+func TestMigratingProvider_MovesDeadLetters(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p, _ := newTestMigratingProvider(t)
+
+	if _, err := p.Subscribe(ctx); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	if err := p.DeadLetters().Put(ctx, &DeadLetter{Message: &models.DataMessage{Id: "dead"}}); err != nil {
+		t.Fatalf("Failed to put dead letter: %v", err)
+	}
+
+	to := NewOptimizedMemoryQueue(10)
+	if err := p.Migrate(ctx, "memory-optimized", to); err != nil {
+		t.Fatalf("Failed to start migration: %v", err)
+	}
+
+	waitMigrationPhase(ctx, t, p, MigrationCompleted)
+
+	entries, err := to.DeadLetters().List(ctx, 0)
+	if err != nil || len(entries) != 1 || entries[0].Message.GetId() != "dead" {
+		t.Fatalf("Expected dead letter in the new provider, got %v (%v)", entries, err)
+	}
+}
+
+func TestMigratingProvider_RejectsInvalidMigration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p, _ := newTestMigratingProvider(t)
+
+	if err := p.Migrate(ctx, "ring", NewRingQueue(16)); !errors.Is(err, ErrMigrationNotSubscribed) {
+		t.Errorf("Expected ErrMigrationNotSubscribed, got %v", err)
+	}
+
+	if _, err := p.Subscribe(ctx); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	if _, err := p.Subscribe(ctx); !errors.Is(err, ErrAlreadySubscribed) {
+		t.Errorf("Expected ErrAlreadySubscribed, got %v", err)
+	}
+
+	if err := p.Migrate(ctx, "memory", NewMemoryAdapter(10)); !errors.Is(err, ErrMigrationSameProvider) {
+		t.Errorf("Expected ErrMigrationSameProvider, got %v", err)
+	}
+
+	if err := p.Migrate(ctx, "ring", NewRingQueue(16)); err != nil {
+		t.Fatalf("Failed to start migration: %v", err)
+	}
+
+	if err := p.Migrate(ctx, "memory-optimized", NewOptimizedMemoryQueue(10)); !errors.Is(err, ErrMigrationInProgress) {
+		t.Errorf("Expected ErrMigrationInProgress, got %v", err)
+	}
+}
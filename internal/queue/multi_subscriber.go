@@ -0,0 +1,108 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MultiSubscriber объединяет подписки на несколько subject'ов (или топиков) в один поток доставок.
+// Порядок доставок между subject'ами не определен.
+type MultiSubscriber struct {
+	subscribers []Subscriber
+}
+
+// NewMultiSubscriber создает подписку на все переданные subscriber'ы.
+func NewMultiSubscriber(subscribers ...Subscriber) *MultiSubscriber {
+	return &MultiSubscriber{subscribers: subscribers}
+}
+
+// Subscribe реализует интерфейс Subscriber. Канал закрывается, когда закрыты каналы всех подписок.
+func (m *MultiSubscriber) Subscribe(ctx context.Context) (<-chan Delivery, error) {
+	subscribeCtx, cancel := context.WithCancel(ctx)
+
+	channels := make([]<-chan Delivery, 0, len(m.subscribers))
+
+	for i, subscriber := range m.subscribers {
+		ch, err := subscriber.Subscribe(subscribeCtx)
+		if err != nil {
+			// Останавливаем уже запущенные подписки.
+			cancel()
+
+			return nil, fmt.Errorf("failed to subscribe to subscriber %d: %w", i, err)
+		}
+
+		channels = append(channels, ch)
+	}
+
+	out := make(chan Delivery)
+
+	var wg sync.WaitGroup
+
+	for _, ch := range channels {
+		wg.Add(1)
+
+		go func(ch <-chan Delivery) {
+			defer wg.Done()
+
+			for delivery := range ch {
+				select {
+				case out <- delivery:
+				case <-subscribeCtx.Done():
+					// Доставка не передана потребителю - возвращаем ее брокеру.
+					_ = delivery.Nack(0)
+
+					return
+				}
+			}
+		}(ch)
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(out)
+	}()
+
+	return out, nil
+}
+
+// DeadLetters реализует интерфейс DeadLetterProvider: используется DLQ первого subscriber'а, у которого она есть,
+// чтобы сообщения всех subject'ов, исчерпавшие попытки, попадали в DLQ основной очереди.
+func (m *MultiSubscriber) DeadLetters() DeadLetterQueue { //nolint:ireturn // interface by design
+	if dlp := m.deadLetterProvider(); dlp != nil {
+		return dlp.DeadLetters()
+	}
+
+	return nil
+}
+
+// MaxAttempts реализует интерфейс DeadLetterProvider.
+func (m *MultiSubscriber) MaxAttempts() int {
+	if dlp := m.deadLetterProvider(); dlp != nil {
+		return dlp.MaxAttempts()
+	}
+
+	return defaultMaxDeliveryAttempts
+}
+
+func (m *MultiSubscriber) deadLetterProvider() DeadLetterProvider { //nolint:ireturn // interface by design
+	for _, subscriber := range m.subscribers {
+		if dlp, ok := subscriber.(DeadLetterProvider); ok && dlp.DeadLetters() != nil {
+			return dlp
+		}
+	}
+
+	return nil
+}
+
+// Close реализует интерфейс Subscriber и закрывает все подписки.
+func (m *MultiSubscriber) Close() error {
+	errs := make([]error, 0, len(m.subscribers))
+	for _, subscriber := range m.subscribers {
+		errs = append(errs, subscriber.Close())
+	}
+
+	return errors.Join(errs...)
+}
@@ -14,12 +14,14 @@ const (
 	natsAdapterBufferSize    = 100
 	natsAdapterMaxReconnects = 5
 	natsAdapterReconnectWait = 2 * time.Second
+	natsStatsTimeout         = 2 * time.Second
 )
 
 type NATSAdapter struct {
-	broker     *NATSBroker
-	publisher  *NATSPublisher
-	subscriber *NATSSubscriber
+	broker      *NATSBroker
+	publisher   *NATSPublisher
+	subscriber  *NATSSubscriber
+	deadLetters *NATSDeadLetterQueue
 
 	// Статистика - только атомарные операции, без мьютекса
 	totalEnqueued int64
@@ -29,17 +31,13 @@ type NATSAdapter struct {
 
 var ErrNATSAdapterClose = errors.New("errors closing NATS adapter")
 
-// NewNATSAdapter создает адаптер для NATS.
+// NewNATSAdapter создает адаптер для NATS с синхронной публикацией.
 func NewNATSAdapter(natsURL, subject string) (*NATSAdapter, error) {
-	// Конфигурация NATS
-	cfg := NATSConfig{
-		URL:           natsURL,
-		StreamName:    "DIPLOM_STREAM",
-		SubjectPrefix: "diplom",
-		MaxReconnects: natsAdapterMaxReconnects,
-		ReconnectWait: natsAdapterReconnectWait,
-	}
+	return NewNATSAdapterWithConfig(defaultNATSConfig(natsURL), subject)
+}
 
+// NewNATSAdapterWithConfig создает адаптер для NATS с заданными настройками подключения и публикации.
+func NewNATSAdapterWithConfig(cfg NATSConfig, subject string) (*NATSAdapter, error) {
 	// Создаем брокер
 	broker, err := NewNATSBroker(cfg)
 	if err != nil {
@@ -58,12 +56,23 @@ func NewNATSAdapter(natsURL, subject string) (*NATSAdapter, error) {
 	}
 
 	return &NATSAdapter{
-		broker:     broker,
-		publisher:  publisher,
-		subscriber: subscriber,
+		broker:      broker,
+		publisher:   publisher,
+		subscriber:  subscriber,
+		deadLetters: NewNATSDeadLetterQueue(broker),
 	}, nil
 }
 
+// SetCodec задает кодек публикуемых сообщений. Подписчик декодирует сообщения по заголовку.
+func (a *NATSAdapter) SetCodec(codec Codec) {
+	a.publisher.SetCodec(codec)
+}
+
+// SetCompression задает сжатие публикуемых сообщений. Подписчик распаковывает сообщения по заголовку.
+func (a *NATSAdapter) SetCompression(cfg CompressionConfig) {
+	a.publisher.SetCompression(cfg)
+}
+
 // Publish реализует интерфейс Publisher.
 func (a *NATSAdapter) Publish(ctx context.Context, msg *models.DataMessage) error {
 	err := a.publisher.Publish(ctx, msg)
@@ -79,8 +88,37 @@ func (a *NATSAdapter) Publish(ctx context.Context, msg *models.DataMessage) erro
 	return nil
 }
 
+// PublishAsync публикует сообщение без ожидания ACK; подтверждение ждет вызывающий через future.
+func (a *NATSAdapter) PublishAsync(msg *models.DataMessage) (*NATSPublishFuture, error) {
+	future, err := a.publisher.PublishAsync(msg)
+	if err != nil {
+		atomic.AddInt64(&a.errors, 1)
+
+		return nil, err
+	}
+
+	atomic.AddInt64(&a.totalEnqueued, 1)
+
+	return future, nil
+}
+
+// PublishBatch реализует интерфейс BatchPublisher.
+func (a *NATSAdapter) PublishBatch(ctx context.Context, msgs []*models.DataMessage) []error {
+	errs := a.publisher.PublishBatch(ctx, msgs)
+
+	for _, err := range errs {
+		if err != nil {
+			atomic.AddInt64(&a.errors, 1)
+		} else {
+			atomic.AddInt64(&a.totalEnqueued, 1)
+		}
+	}
+
+	return errs
+}
+
 // Subscribe реализует интерфейс Subscriber.
-func (a *NATSAdapter) Subscribe(ctx context.Context) (<-chan *models.DataMessage, error) {
+func (a *NATSAdapter) Subscribe(ctx context.Context) (<-chan Delivery, error) {
 	msgChan, err := a.subscriber.Subscribe(ctx)
 	if err != nil {
 		atomic.AddInt64(&a.errors, 1)
@@ -89,7 +127,7 @@ func (a *NATSAdapter) Subscribe(ctx context.Context) (<-chan *models.DataMessage
 	}
 
 	// Оборачиваем канал для подсчета статистики
-	wrappedChan := make(chan *models.DataMessage, natsAdapterBufferSize)
+	wrappedChan := make(chan Delivery, natsAdapterBufferSize)
 
 	go func() {
 		defer close(wrappedChan)
@@ -117,13 +155,40 @@ func (a *NATSAdapter) Subscribe(ctx context.Context) (<-chan *models.DataMessage
 	return wrappedChan, nil
 }
 
+// DeadLetters реализует интерфейс DeadLetterProvider.
+func (a *NATSAdapter) DeadLetters() DeadLetterQueue { //nolint:ireturn // interface by design
+	return a.deadLetters
+}
+
+// MaxAttempts реализует интерфейс DeadLetterProvider.
+// Совпадает с MaxDeliver consumer'а: после этой попытки JetStream больше не доставит сообщение.
+func (a *NATSAdapter) MaxAttempts() int {
+	return natsSubscriberMaxDeliver
+}
+
 // Stats возвращает статистику адаптера.
+// Глубина очереди берется из состояния durable consumer'а; если JetStream недоступен, CurrentSize равен -1.
 func (a *NATSAdapter) Stats() Stats {
-	return Stats{
+	stats := Stats{
 		TotalEnqueued: atomic.LoadInt64(&a.totalEnqueued),
 		TotalDequeued: atomic.LoadInt64(&a.totalDequeued),
-		CurrentSize:   -1, // JetStream не предоставляет точный размер очереди.
+		CurrentSize:   -1,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsStatsTimeout)
+	defer cancel()
+
+	info, err := a.subscriber.Info(ctx)
+	if err != nil {
+		return stats
 	}
+
+	stats.Pending = int64(info.NumPending) //nolint:gosec // счетчик сообщений stream'а
+	stats.AckPending = int64(info.NumAckPending)
+	stats.Redelivered = int64(info.NumRedelivered)
+	stats.CurrentSize = int(stats.Pending + stats.AckPending)
+
+	return stats
 }
 
 // Close закрывает адаптер.
@@ -5,16 +5,25 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stsolovey/diplom-distributed-system/internal/metrics"
 )
 
+// NATSBroker - одно подключение к NATS, которое обслуживает publisher'ы и subscriber'ы
+// любого числа subject'ов внутри stream'а. Реализует MessageBroker.
 type NATSBroker struct {
+	mu     sync.Mutex
 	nc     *nats.Conn
 	js     jetstream.JetStream
 	config NATSConfig
+
+	// Формат публикуемых сообщений для publisher'ов, созданных через CreatePublisher.
+	codec       Codec
+	compression CompressionConfig
 }
 
 type NATSConfig struct {
@@ -23,17 +32,75 @@ type NATSConfig struct {
 	SubjectPrefix string
 	MaxReconnects int
 	ReconnectWait time.Duration
+
+	// AsyncPublish включает асинхронную публикацию: Publish не ждет ACK от JetStream.
+	AsyncPublish bool
+	// AsyncMaxPending - окно неподтвержденных асинхронных публикаций; при заполнении публикация ждет.
+	AsyncMaxPending int
+
+	// InProcessServer - встроенный сервер, к которому клиент подключается без сети; URL тогда не используется.
+	InProcessServer nats.InProcessConnProvider
 }
 
 const (
 	natsBrokerMaxAge  = 24 * time.Hour
 	natsBrokerMaxMsgs = 1000000
+
+	// DefaultNATSAsyncMaxPending - окно асинхронных публикаций по умолчанию.
+	DefaultNATSAsyncMaxPending = 256
+	// natsFlushTimeout ограничивает ожидание ACK асинхронных публикаций при закрытии.
+	natsFlushTimeout = 5 * time.Second
 )
 
-var ErrNATSBrokerClose = errors.New("errors closing NATS broker")
+var (
+	ErrNATSBrokerClose        = errors.New("errors closing NATS broker")
+	ErrNATSBrokerNotConnected = errors.New("NATS broker is not connected")
+	ErrNATSFlushTimeout       = errors.New("NATS async publishes were not acknowledged")
+)
 
 // NewNATSBroker создает новое подключение к NATS.
 func NewNATSBroker(cfg NATSConfig) (*NATSBroker, error) {
+	broker := newNATSBroker(cfg)
+
+	if err := broker.Connect(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return broker, nil
+}
+
+// newNATSBroker создает брокер без подключения; подключение выполняет Connect.
+func newNATSBroker(cfg NATSConfig) *NATSBroker {
+	return &NATSBroker{
+		config: cfg,
+		codec:  protobufCodec{},
+	}
+}
+
+// defaultNATSConfig возвращает настройки подключения, общие для адаптера и брокера.
+func defaultNATSConfig(natsURL string) NATSConfig {
+	return NATSConfig{
+		URL:           natsURL,
+		StreamName:    "DIPLOM_STREAM",
+		SubjectPrefix: "diplom",
+		MaxReconnects: natsAdapterMaxReconnects,
+		ReconnectWait: natsAdapterReconnectWait,
+
+		AsyncMaxPending: DefaultNATSAsyncMaxPending,
+	}
+}
+
+// Connect реализует интерфейс MessageBroker. Повторный вызов при живом соединении ничего не делает.
+func (b *NATSBroker) Connect(_ context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.nc != nil && !b.nc.IsClosed() {
+		return nil
+	}
+
+	cfg := b.config
+
 	opts := []nats.Option{
 		nats.MaxReconnects(cfg.MaxReconnects),
 		nats.ReconnectWait(cfg.ReconnectWait),
@@ -47,41 +114,116 @@ func NewNATSBroker(cfg NATSConfig) (*NATSBroker, error) {
 		}),
 	}
 
+	if cfg.InProcessServer != nil {
+		opts = append(opts, nats.InProcessServer(cfg.InProcessServer))
+	}
+
 	nc, err := nats.Connect(cfg.URL, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+		return fmt.Errorf("failed to connect to NATS: %w", err)
 	}
 
-	js, err := jetstream.New(nc)
+	jsOpts := []jetstream.JetStreamOpt{
+		jetstream.WithPublishAsyncErrHandler(func(_ jetstream.JetStream, msg *nats.Msg, err error) {
+			metrics.QueueNATSAsyncPublishErrors.Inc()
+			log.Printf("NATS async publish to %s failed: %v", msg.Subject, err)
+		}),
+	}
+
+	if cfg.AsyncMaxPending > 0 {
+		jsOpts = append(jsOpts, jetstream.WithPublishAsyncMaxPending(cfg.AsyncMaxPending))
+	}
+
+	js, err := jetstream.New(nc, jsOpts...)
 	if err != nil {
 		nc.Close()
 
-		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+		return fmt.Errorf("failed to create JetStream context: %w", err)
 	}
 
-	broker := &NATSBroker{
-		nc:     nc,
-		js:     js,
-		config: cfg,
+	b.nc = nc
+	b.js = js
+
+	// Создаем stream'ы очереди и DLQ если не существуют
+	for _, streamConfig := range []jetstream.StreamConfig{b.streamConfig(), natsDeadLetterStreamConfig(b.config)} {
+		if err := b.ensureStream(streamConfig); err != nil {
+			nc.Close()
+
+			return err
+		}
 	}
 
-	// Создаем stream если не существует
-	if err := broker.ensureStream(); err != nil {
-		nc.Close()
+	return nil
+}
 
+// Disconnect реализует интерфейс MessageBroker.
+func (b *NATSBroker) Disconnect() error {
+	return b.Close()
+}
+
+// SetCodec задает кодек publisher'ов, создаваемых через CreatePublisher.
+func (b *NATSBroker) SetCodec(codec Codec) {
+	b.codec = codec
+}
+
+// SetCompression задает сжатие publisher'ов, создаваемых через CreatePublisher.
+func (b *NATSBroker) SetCompression(cfg CompressionConfig) {
+	b.compression = cfg
+}
+
+// CreatePublisher реализует интерфейс MessageBroker: publisher пишет в subject "<prefix>.<subject>".
+func (b *NATSBroker) CreatePublisher(subject string) (Publisher, error) { //nolint:ireturn // MessageBroker
+	if !b.connected() {
+		return nil, ErrNATSBrokerNotConnected
+	}
+
+	publisher := NewNATSPublisher(b, subject)
+	publisher.SetCodec(b.codec)
+	publisher.SetCompression(b.compression)
+
+	return publisher, nil
+}
+
+// CreateSubscriber реализует интерфейс MessageBroker: у каждого subject свой durable consumer.
+func (b *NATSBroker) CreateSubscriber(subject string) (Subscriber, error) { //nolint:ireturn // MessageBroker
+	if !b.connected() {
+		return nil, ErrNATSBrokerNotConnected
+	}
+
+	subscriber, err := NewNATSSubscriber(b, subject)
+	if err != nil {
 		return nil, err
 	}
 
-	return broker, nil
+	return subscriber, nil
+}
+
+func (b *NATSBroker) connected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.nc != nil && !b.nc.IsClosed()
+}
+
+// streamConfig возвращает конфигурацию основного stream'а очереди.
+func (b *NATSBroker) streamConfig() jetstream.StreamConfig {
+	return jetstream.StreamConfig{
+		Name:      b.config.StreamName,
+		Subjects:  []string{b.config.SubjectPrefix + ".*"},
+		Retention: jetstream.WorkQueuePolicy,
+		MaxAge:    natsBrokerMaxAge,
+		MaxMsgs:   natsBrokerMaxMsgs,
+		Storage:   jetstream.FileStorage,
+	}
 }
 
 // ensureStream создает JetStream stream если он не существует.
-func (b *NATSBroker) ensureStream() error {
+func (b *NATSBroker) ensureStream(streamConfig jetstream.StreamConfig) error {
 	// Проверяем существование stream
-	_, err := b.js.Stream(context.Background(), b.config.StreamName)
+	_, err := b.js.Stream(context.Background(), streamConfig.Name)
 	if err == nil {
 		// Stream уже существует
-		log.Printf("Using existing stream: %s", b.config.StreamName)
+		log.Printf("Using existing stream: %s", streamConfig.Name)
 
 		return nil
 	}
@@ -93,20 +235,11 @@ func (b *NATSBroker) ensureStream() error {
 	}
 
 	// Создаем новый stream
-	streamConfig := jetstream.StreamConfig{
-		Name:      b.config.StreamName,
-		Subjects:  []string{b.config.SubjectPrefix + ".*"},
-		Retention: jetstream.WorkQueuePolicy,
-		MaxAge:    natsBrokerMaxAge,
-		MaxMsgs:   natsBrokerMaxMsgs,
-		Storage:   jetstream.FileStorage,
-	}
-
 	_, err = b.js.CreateStream(context.Background(), streamConfig)
 	if err != nil {
 		// Проверяем, не был ли stream создан между временем проверки и созданием
 		if isStreamAlreadyExistsError(err) {
-			log.Printf("Stream was created concurrently: %s", b.config.StreamName)
+			log.Printf("Stream was created concurrently: %s", streamConfig.Name)
 
 			return nil
 		}
@@ -114,7 +247,7 @@ func (b *NATSBroker) ensureStream() error {
 		return fmt.Errorf("failed to create stream: %w", err)
 	}
 
-	log.Printf("Created new stream: %s", b.config.StreamName)
+	log.Printf("Created new stream: %s", streamConfig.Name)
 
 	return nil
 }
@@ -146,9 +279,37 @@ func isStreamAlreadyExistsError(err error) bool {
 		errMsg == "nats: stream name already in use"
 }
 
-// Close закрывает соединение с NATS.
+// Flush ждет подтверждения всех асинхронных публикаций соединения.
+func (b *NATSBroker) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	js := b.js
+	b.mu.Unlock()
+
+	if js == nil {
+		return nil
+	}
+
+	select {
+	case <-js.PublishAsyncComplete():
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %d publishes pending: %w", ErrNATSFlushTimeout, js.PublishAsyncPending(), ctx.Err())
+	}
+}
+
+// Close ждет подтверждения асинхронных публикаций (не дольше natsFlushTimeout) и закрывает соединение с NATS.
 func (b *NATSBroker) Close() error {
-	b.nc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), natsFlushTimeout)
+	defer cancel()
 
-	return nil
+	flushErr := b.Flush(ctx)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.nc != nil {
+		b.nc.Close()
+	}
+
+	return flushErr
 }
@@ -0,0 +1,158 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	// natsDeadLetterSubject - суффикс subject'а DLQ (полный subject: <prefix>.dlq.entries).
+	// Subject из двух токенов не попадает в <prefix>.* основного stream'а.
+	natsDeadLetterSubject = "dlq.entries"
+	// natsDeadLetterStreamSuffix - суффикс имени stream'а DLQ (полное имя: <stream>_DLQ).
+	natsDeadLetterStreamSuffix = "_DLQ"
+	// natsDeadLetterMaxMsgs ограничивает DLQ; при переполнении вытесняются самые старые записи.
+	natsDeadLetterMaxMsgs = 100000
+)
+
+// NATSDeadLetterQueue хранит DLQ в отдельном JetStream stream <stream>_DLQ.
+// В отличие от основного WorkQueue stream'а записи не истекают по MaxAge и хранятся до удаления.
+// ID записи - порядковый номер сообщения в stream'е DLQ.
+type NATSDeadLetterQueue struct {
+	js         jetstream.JetStream
+	streamName string
+	subject    string
+}
+
+// NewNATSDeadLetterQueue создает DLQ на subject <prefix>.dlq.entries.
+func NewNATSDeadLetterQueue(broker *NATSBroker) *NATSDeadLetterQueue {
+	streamConfig := natsDeadLetterStreamConfig(broker.config)
+
+	return &NATSDeadLetterQueue{
+		js:         broker.js,
+		streamName: streamConfig.Name,
+		subject:    streamConfig.Subjects[0],
+	}
+}
+
+// natsDeadLetterStreamConfig возвращает конфигурацию stream'а DLQ.
+func natsDeadLetterStreamConfig(cfg NATSConfig) jetstream.StreamConfig {
+	return jetstream.StreamConfig{
+		Name:      cfg.StreamName + natsDeadLetterStreamSuffix,
+		Subjects:  []string{cfg.SubjectPrefix + "." + natsDeadLetterSubject},
+		Retention: jetstream.LimitsPolicy,
+		MaxMsgs:   natsDeadLetterMaxMsgs,
+		Discard:   jetstream.DiscardOld,
+		Storage:   jetstream.FileStorage,
+	}
+}
+
+// Put реализует интерфейс DeadLetterQueue.
+func (q *NATSDeadLetterQueue) Put(ctx context.Context, dl *DeadLetter) error {
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+
+	ack, err := q.js.Publish(ctx, q.subject, data)
+	if err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
+
+	dl.ID = strconv.FormatUint(ack.Sequence, 10)
+
+	return nil
+}
+
+// List реализует интерфейс DeadLetterQueue, перебирая сообщения subject'а DLQ по порядку.
+func (q *NATSDeadLetterQueue) List(ctx context.Context, limit int) ([]*DeadLetter, error) {
+	stream, err := q.js.Stream(ctx, q.streamName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream: %w", err)
+	}
+
+	var result []*DeadLetter
+
+	for seq := uint64(1); limit <= 0 || len(result) < limit; {
+		raw, err := stream.GetMsg(ctx, seq, jetstream.WithGetMsgSubject(q.subject))
+		if err != nil {
+			if errors.Is(err, jetstream.ErrMsgNotFound) {
+				break
+			}
+
+			return nil, fmt.Errorf("failed to get dead letter: %w", err)
+		}
+
+		dl, err := decodeNATSDeadLetter(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, dl)
+		seq = raw.Sequence + 1
+	}
+
+	return result, nil
+}
+
+// Get реализует интерфейс DeadLetterQueue.
+func (q *NATSDeadLetterQueue) Get(ctx context.Context, id string) (*DeadLetter, error) {
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+
+	stream, err := q.js.Stream(ctx, q.streamName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stream: %w", err)
+	}
+
+	raw, err := stream.GetMsg(ctx, seq)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+		}
+
+		return nil, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+
+	return decodeNATSDeadLetter(raw)
+}
+
+// Delete реализует интерфейс DeadLetterQueue.
+func (q *NATSDeadLetterQueue) Delete(ctx context.Context, id string) error {
+	dl, err := q.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	stream, err := q.js.Stream(ctx, q.streamName)
+	if err != nil {
+		return fmt.Errorf("failed to get stream: %w", err)
+	}
+
+	seq, _ := strconv.ParseUint(dl.ID, 10, 64)
+
+	if err := stream.DeleteMsg(ctx, seq); err != nil {
+		return fmt.Errorf("failed to delete dead letter: %w", err)
+	}
+
+	return nil
+}
+
+// decodeNATSDeadLetter десериализует запись DLQ и проставляет ей ID.
+func decodeNATSDeadLetter(raw *jetstream.RawStreamMsg) (*DeadLetter, error) {
+	var dl DeadLetter
+	if err := json.Unmarshal(raw.Data, &dl); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dead letter: %w", err)
+	}
+
+	dl.ID = strconv.FormatUint(raw.Sequence, 10)
+
+	return &dl, nil
+}
@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+const (
+	embeddedNATSServerName   = "diplom-embedded"
+	embeddedNATSStartTimeout = 10 * time.Second
+)
+
+var (
+	ErrEmbeddedNATSStart  = errors.New("failed to start embedded NATS server")
+	ErrEmbeddedNATSListen = errors.New("invalid embedded NATS listen address")
+)
+
+// EmbeddedNATSConfig - настройки встроенного nats-server.
+type EmbeddedNATSConfig struct {
+	StoreDir string // каталог файлового хранилища JetStream
+	// Listen - адрес host:port для внешних клиентов; пусто - только подключения из процесса.
+	Listen string
+}
+
+// EmbeddedNATSServer - nats-server с JetStream, запущенный внутри процесса.
+// Клиенты процесса подключаются к нему без сети через NATSConfig.InProcessServer.
+type EmbeddedNATSServer struct {
+	server *server.Server
+}
+
+// StartEmbeddedNATSServer запускает встроенный сервер и ждет готовности к подключениям.
+func StartEmbeddedNATSServer(cfg EmbeddedNATSConfig) (*EmbeddedNATSServer, error) {
+	opts := &server.Options{
+		ServerName: embeddedNATSServerName,
+		JetStream:  true,
+		StoreDir:   cfg.StoreDir,
+		NoSigs:     true,
+		NoLog:      true,
+		DontListen: cfg.Listen == "",
+	}
+
+	if cfg.Listen != "" {
+		host, port, err := net.SplitHostPort(cfg.Listen)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrEmbeddedNATSListen, err)
+		}
+
+		opts.Host = host
+
+		if opts.Port, err = strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrEmbeddedNATSListen, cfg.Listen, err)
+		}
+	}
+
+	srv, err := server.NewServer(opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEmbeddedNATSStart, err)
+	}
+
+	go srv.Start()
+
+	if !srv.ReadyForConnections(embeddedNATSStartTimeout) {
+		srv.Shutdown()
+
+		return nil, fmt.Errorf("%w: not ready after %s", ErrEmbeddedNATSStart, embeddedNATSStartTimeout)
+	}
+
+	log.Printf("Embedded NATS server started, store dir: %s, listen: %q", cfg.StoreDir, cfg.Listen)
+
+	return &EmbeddedNATSServer{server: srv}, nil
+}
+
+// NATSConfig возвращает настройки подключения к встроенному серверу на основе base.
+func (s *EmbeddedNATSServer) NATSConfig(base NATSConfig) NATSConfig {
+	base.InProcessServer = s.server
+
+	return base
+}
+
+// ClientURL возвращает адрес для внешних клиентов; пусто, если сервер не слушает сеть.
+func (s *EmbeddedNATSServer) ClientURL() string {
+	if s.server.Addr() == nil {
+		return ""
+	}
+
+	return s.server.ClientURL()
+}
+
+// Shutdown останавливает сервер и ждет завершения; данные JetStream остаются в StoreDir.
+func (s *EmbeddedNATSServer) Shutdown() {
+	s.server.Shutdown()
+	s.server.WaitForShutdown()
+}
+
+// EmbeddedNATSAdapter - NATSAdapter, подключенный к встроенному серверу.
+// Сервер принадлежит адаптеру и останавливается при Close.
+type EmbeddedNATSAdapter struct {
+	*NATSAdapter
+
+	server  *EmbeddedNATSServer
+	onClose func() // вызывается после остановки сервера
+}
+
+// NewEmbeddedNATSAdapter создает адаптер поверх встроенного сервера.
+func NewEmbeddedNATSAdapter(srv *EmbeddedNATSServer, cfg NATSConfig, subject string) (*EmbeddedNATSAdapter, error) {
+	adapter, err := NewNATSAdapterWithConfig(srv.NATSConfig(cfg), subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EmbeddedNATSAdapter{
+		NATSAdapter: adapter,
+		server:      srv,
+	}, nil
+}
+
+// Close закрывает адаптер, затем останавливает сервер.
+func (a *EmbeddedNATSAdapter) Close() error {
+	err := a.NATSAdapter.Close()
+
+	a.server.Shutdown()
+
+	if a.onClose != nil {
+		a.onClose()
+	}
+
+	return err
+}
@@ -0,0 +1,370 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/config"
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func newEmbeddedAdapter(t *testing.T, storeDir string) *EmbeddedNATSAdapter {
+	t.Helper()
+
+	return newEmbeddedAdapterWithConfig(t, storeDir, defaultNATSConfig(""))
+}
+
+func newEmbeddedAdapterWithConfig(t *testing.T, storeDir string, cfg NATSConfig) *EmbeddedNATSAdapter {
+	t.Helper()
+
+	srv, err := StartEmbeddedNATSServer(EmbeddedNATSConfig{StoreDir: storeDir})
+	if err != nil {
+		t.Fatalf("Failed to start embedded NATS server: %v", err)
+	}
+
+	adapter, err := NewEmbeddedNATSAdapter(srv, cfg, "messages")
+	if err != nil {
+		srv.Shutdown()
+		t.Fatalf("Failed to create embedded NATS adapter: %v", err)
+	}
+
+	return adapter
+}
+
+func TestEmbeddedNATSAdapter_SurvivesRestart(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	storeDir := t.TempDir()
+
+	adapter := newEmbeddedAdapter(t, storeDir)
+
+	if err := adapter.Publish(ctx, &models.DataMessage{Id: "persisted"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	if stats := adapter.Stats(); stats.Pending != 1 {
+		t.Errorf("Expected 1 pending message, got %d", stats.Pending)
+	}
+
+	if err := adapter.Close(); err != nil {
+		t.Fatalf("Failed to close adapter: %v", err)
+	}
+
+	// Сообщение хранится в StoreDir и доставляется после перезапуска сервера.
+	adapter = newEmbeddedAdapter(t, storeDir)
+	defer adapter.Close()
+
+	expectDelivery(ctx, t, adapter, "persisted")
+}
+
+func TestFactory_NATSEmbeddedBroker(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cfg := &config.Config{
+		QueueType:            string(NATSEmbeddedProviderType),
+		NATSEmbeddedStoreDir: t.TempDir(),
+		QueueCodec:           "protobuf",
+	}
+
+	factory := NewFactory(cfg)
+
+	if _, err := factory.CreateBroker(ctx); !errors.Is(err, ErrEmbeddedNATSNotStarted) {
+		t.Fatalf("Expected ErrEmbeddedNATSNotStarted, got %v", err)
+	}
+
+	provider, err := factory.CreateProvider()
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	defer provider.Close()
+
+	broker, err := factory.CreateBroker(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create broker: %v", err)
+	}
+	defer broker.Disconnect()
+
+	publisher, err := broker.CreatePublisher("orders")
+	if err != nil {
+		t.Fatalf("Failed to create publisher: %v", err)
+	}
+
+	if err := publisher.Publish(ctx, &models.DataMessage{Id: "order"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	subscriber, err := broker.CreateSubscriber("orders")
+	if err != nil {
+		t.Fatalf("Failed to create subscriber: %v", err)
+	}
+	defer subscriber.Close()
+
+	expectDelivery(ctx, t, subscriber, "order")
+}
+
+func TestNATSDeadLetterQueue_DedicatedStream(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	adapter := newEmbeddedAdapter(t, t.TempDir())
+	defer adapter.Close()
+
+	dlq := adapter.DeadLetters()
+
+	if err := dlq.Put(ctx, &DeadLetter{Message: &models.DataMessage{Id: "dead"}, LastError: "boom"}); err != nil {
+		t.Fatalf("Failed to put dead letter: %v", err)
+	}
+
+	// Запись DLQ хранится в своем stream'е без MaxAge и не считается сообщением очереди.
+	stream, err := adapter.broker.js.Stream(ctx, adapter.broker.config.StreamName+natsDeadLetterStreamSuffix)
+	if err != nil {
+		t.Fatalf("Failed to get dead-letter stream: %v", err)
+	}
+
+	if info := stream.CachedInfo(); info.Config.MaxAge != 0 || info.State.Msgs != 1 {
+		t.Errorf("Unexpected dead-letter stream: %+v", info)
+	}
+
+	if stats := adapter.Stats(); stats.Pending != 0 {
+		t.Errorf("Expected no pending queue messages, got %d", stats.Pending)
+	}
+
+	entries, err := dlq.List(ctx, 0)
+	if err != nil || len(entries) != 1 || entries[0].Message.GetId() != "dead" {
+		t.Fatalf("Expected 1 dead letter, got %v (%v)", entries, err)
+	}
+
+	if dl, err := dlq.Get(ctx, entries[0].ID); err != nil || dl.LastError != "boom" {
+		t.Fatalf("Failed to get dead letter: %v (%v)", dl, err)
+	}
+
+	if err := dlq.Delete(ctx, entries[0].ID); err != nil {
+		t.Fatalf("Failed to delete dead letter: %v", err)
+	}
+
+	if _, err := dlq.Get(ctx, entries[0].ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Expected ErrDeadLetterNotFound after delete, got %v", err)
+	}
+}
+
+func TestNATSPublisher_PublishAsyncFuture(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	adapter := newEmbeddedAdapter(t, t.TempDir())
+	defer adapter.Close()
+
+	future, err := adapter.PublishAsync(&models.DataMessage{Id: "async"})
+	if err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	if err := future.Wait(ctx); err != nil {
+		t.Fatalf("Expected ACK, got %v", err)
+	}
+
+	// Повторный Wait возвращает тот же результат.
+	if err := future.Wait(ctx); err != nil {
+		t.Fatalf("Expected repeated Wait to succeed, got %v", err)
+	}
+
+	expectDelivery(ctx, t, adapter, "async")
+}
+
+func TestNATSPublisher_PublishBatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	adapter := newEmbeddedAdapter(t, t.TempDir())
+	defer adapter.Close()
+
+	msgs := make([]*models.DataMessage, 10)
+	for i := range msgs {
+		msgs[i] = &models.DataMessage{Id: fmt.Sprintf("batch-%d", i)}
+	}
+
+	for i, err := range adapter.PublishBatch(ctx, msgs) {
+		if err != nil {
+			t.Errorf("Message %d: unexpected error %v", i, err)
+		}
+	}
+
+	if stats := adapter.Stats(); stats.Pending != int64(len(msgs)) {
+		t.Errorf("Expected %d pending messages, got %d", len(msgs), stats.Pending)
+	}
+}
+
+func TestNATSPublisher_AsyncMaxPendingWindow(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const maxPending = 4
+
+	cfg := defaultNATSConfig("")
+	cfg.AsyncMaxPending = maxPending
+
+	adapter := newEmbeddedAdapterWithConfig(t, t.TempDir(), cfg)
+	defer adapter.Close()
+
+	js := adapter.broker.js
+
+	futures := make([]*NATSPublishFuture, 0, 100)
+
+	for i := range 100 {
+		future, err := adapter.PublishAsync(&models.DataMessage{Id: fmt.Sprintf("window-%d", i)})
+		if err != nil {
+			t.Fatalf("Failed to publish message %d: %v", i, err)
+		}
+
+		if pending := js.PublishAsyncPending(); pending > maxPending {
+			t.Fatalf("Expected at most %d pending publishes, got %d", maxPending, pending)
+		}
+
+		futures = append(futures, future)
+	}
+
+	for i, future := range futures {
+		if err := future.Wait(ctx); err != nil {
+			t.Fatalf("Message %d: expected ACK, got %v", i, err)
+		}
+	}
+}
+
+func TestNATSAdapter_AsyncPublishFlushedOnClose(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const count = 50
+
+	storeDir := t.TempDir()
+
+	cfg := defaultNATSConfig("")
+	cfg.AsyncPublish = true
+
+	adapter := newEmbeddedAdapterWithConfig(t, storeDir, cfg)
+
+	for i := range count {
+		if err := adapter.Publish(ctx, &models.DataMessage{Id: fmt.Sprintf("flush-%d", i)}); err != nil {
+			t.Fatalf("Failed to publish message %d: %v", i, err)
+		}
+	}
+
+	// Close ждет ACK всех асинхронных публикаций, поэтому после рестарта сообщения на месте.
+	if err := adapter.Close(); err != nil {
+		t.Fatalf("Failed to close adapter: %v", err)
+	}
+
+	adapter = newEmbeddedAdapter(t, storeDir)
+	defer adapter.Close()
+
+	if stats := adapter.Stats(); stats.Pending != count {
+		t.Errorf("Expected %d pending messages after restart, got %d", count, stats.Pending)
+	}
+}
+
+func TestFactory_NATSEmbeddedRecreatedAfterClose(t *testing.T) {
+	cfg := &config.Config{
+		QueueType:            string(NATSEmbeddedProviderType),
+		NATSEmbeddedStoreDir: t.TempDir(),
+		QueueCodec:           "protobuf",
+	}
+
+	factory := NewFactory(cfg)
+
+	provider, err := factory.CreateProvider()
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	if _, err := factory.CreateProvider(); !errors.Is(err, ErrEmbeddedNATSRunning) {
+		t.Fatalf("Expected ErrEmbeddedNATSRunning while the server runs, got %v", err)
+	}
+
+	if err := provider.Close(); err != nil {
+		t.Fatalf("Failed to close provider: %v", err)
+	}
+
+	// Сервер остановлен вместе с провайдером: его можно создать снова, например при миграции обратно.
+	provider, err = factory.CreateProvider()
+	if err != nil {
+		t.Fatalf("Failed to recreate provider: %v", err)
+	}
+
+	if err := provider.Close(); err != nil {
+		t.Fatalf("Failed to close provider: %v", err)
+	}
+}
+
+// receiveNATSDelivery ждет следующую доставку.
+func receiveNATSDelivery(ctx context.Context, t *testing.T, deliveries <-chan Delivery) Delivery {
+	t.Helper()
+
+	select {
+	case delivery := <-deliveries:
+		return delivery
+	case <-ctx.Done():
+		t.Fatal("Timeout waiting for NATS delivery")
+
+		return nil
+	}
+}
+
+func TestNATSSubscriber_CountsOnlyScheduledNakAsNonAttempt(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	adapter := newEmbeddedAdapter(t, t.TempDir())
+	defer adapter.Close()
+
+	// "scheduled" подписчик получает до deliver_at и откладывает через Nak;
+	// "late" сохранен до deliver_at, но подписчик получает его уже после.
+	scheduled := &models.DataMessage{Id: "scheduled"}
+	SetDelay(scheduled, 300*time.Millisecond)
+
+	late := &models.DataMessage{Id: "late"}
+	SetDelay(late, 50*time.Millisecond)
+
+	for _, msg := range []*models.DataMessage{scheduled, late} {
+		if err := adapter.Publish(ctx, msg); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	deliveries, err := adapter.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	attempts := make(map[string][]int)
+
+	for len(attempts["scheduled"]) < 2 || len(attempts["late"]) < 2 {
+		delivery := receiveNATSDelivery(ctx, t, deliveries)
+		id := delivery.Message().GetId()
+		attempts[id] = append(attempts[id], delivery.Attempt())
+
+		if len(attempts[id]) == 1 {
+			if err := delivery.Nack(0); err != nil {
+				t.Fatalf("Failed to nack: %v", err)
+			}
+
+			continue
+		}
+
+		if err := delivery.Ack(); err != nil {
+			t.Fatalf("Failed to ack: %v", err)
+		}
+	}
+
+	for id, got := range attempts {
+		if got[0] != 1 || got[1] != 2 {
+			t.Errorf("Message %s: expected attempts [1 2], got %v", id, got)
+		}
+	}
+}
@@ -2,19 +2,27 @@ package queue
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/stsolovey/diplom-distributed-system/internal/models"
 )
 
 type NATSPublisher struct {
-	js      jetstream.JetStream
-	subject string
+	js          jetstream.JetStream
+	subject     string
+	codec       Codec
+	compression CompressionConfig
+	async       bool
 }
 
+// natsPublishAckTimeout ограничивает ожидание ACK пачки, если у контекста запроса нет дедлайна.
+const natsPublishAckTimeout = 5 * time.Second
+
 var ErrNATSPublisherAck = errors.New("received nil acknowledgment from JetStream")
 
 // NewNATSPublisher создает publisher для конкретного subject.
@@ -22,18 +30,45 @@ func NewNATSPublisher(broker *NATSBroker, subject string) *NATSPublisher {
 	return &NATSPublisher{
 		js:      broker.js,
 		subject: broker.config.SubjectPrefix + "." + subject,
+		codec:   protobufCodec{},
+		async:   broker.config.AsyncPublish,
 	}
 }
 
+// SetCodec задает кодек публикуемых сообщений.
+func (p *NATSPublisher) SetCodec(codec Codec) {
+	p.codec = codec
+}
+
+// SetCompression задает сжатие публикуемых сообщений.
+func (p *NATSPublisher) SetCompression(cfg CompressionConfig) {
+	p.compression = cfg
+}
+
+// SetAsync включает асинхронный режим: Publish возвращается, не дожидаясь ACK, поэтому успешный Publish
+// не гарантирует сохранения сообщения. Ошибки подтверждения (NAK, таймаут) не возвращаются вызывающему:
+// они логируются брокером и учитываются в метрике queue_nats_async_publish_errors_total.
+// Если вызывающему нужен результат, он использует PublishAsync и ждет future.
+func (p *NATSPublisher) SetAsync(async bool) {
+	p.async = async
+}
+
 // Publish отправляет сообщение в NATS JetStream с гарантией доставки.
+// В асинхронном режиме сообщение только передается JetStream; ошибка ACK вызывающему не возвращается (см. SetAsync).
 func (p *NATSPublisher) Publish(ctx context.Context, msg *models.DataMessage) error {
-	data, err := json.Marshal(msg)
+	if p.async {
+		_, err := p.PublishAsync(msg)
+
+		return err
+	}
+
+	natsMsg, err := p.newMsg(msg)
 	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+		return err
 	}
 
 	// Публикуем с ожиданием ACK для гарантии персистентности
-	ack, err := p.js.Publish(ctx, p.subject, data)
+	ack, err := p.js.PublishMsg(ctx, natsMsg)
 	if err != nil {
 		return fmt.Errorf("failed to publish message: %w", err)
 	}
@@ -47,3 +82,96 @@ func (p *NATSPublisher) Publish(ctx context.Context, msg *models.DataMessage) er
 	// Сообщение гарантированно сохранено в stream
 	return nil
 }
+
+// PublishAsync публикует сообщение без ожидания ACK и возвращает future подтверждения.
+// Если окно неподтвержденных публикаций заполнено, вызов ждет его освобождения (около 200 мс),
+// затем возвращает ошибку.
+func (p *NATSPublisher) PublishAsync(msg *models.DataMessage) (*NATSPublishFuture, error) {
+	natsMsg, err := p.newMsg(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	ack, err := p.js.PublishMsgAsync(natsMsg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	return &NATSPublishFuture{ack: ack, done: make(chan struct{})}, nil
+}
+
+// PublishBatch реализует интерфейс BatchPublisher: сообщения публикуются асинхронно без ожидания
+// ACK каждого, затем пачка ждет подтверждения только своих публикаций (не дольше natsPublishAckTimeout).
+func (p *NATSPublisher) PublishBatch(ctx context.Context, msgs []*models.DataMessage) []error {
+	errs := make([]error, len(msgs))
+	futures := make([]*NATSPublishFuture, len(msgs))
+
+	for i, msg := range msgs {
+		futures[i], errs[i] = p.PublishAsync(msg)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, natsPublishAckTimeout)
+	defer cancel()
+
+	for i, future := range futures {
+		if future != nil {
+			errs[i] = future.Wait(ctx)
+		}
+	}
+
+	return errs
+}
+
+// NATSPublishFuture - ожидание ACK асинхронной публикации.
+type NATSPublishFuture struct {
+	ack  jetstream.PubAckFuture
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+// Wait ждет ACK от JetStream и возвращает ошибку публикации. Повторные вызовы возвращают тот же результат.
+func (f *NATSPublishFuture) Wait(ctx context.Context) error {
+	select {
+	case <-f.ack.Ok():
+		f.resolve(nil)
+	case err := <-f.ack.Err():
+		f.resolve(fmt.Errorf("failed to publish message: %w", err))
+	case <-f.done:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to publish message: %w", ctx.Err())
+	}
+
+	return f.err
+}
+
+func (f *NATSPublishFuture) resolve(err error) {
+	f.once.Do(func() {
+		f.err = err
+		close(f.done)
+	})
+}
+
+// newMsg кодирует сообщение для публикации.
+// Имя кодека и алгоритм сжатия передаются в заголовках, чтобы подписчики декодировали смешанный трафик.
+func (p *NATSPublisher) newMsg(msg *models.DataMessage) (*nats.Msg, error) {
+	data, err := p.codec.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	data, algorithm, err := compressBody(p.compression, data)
+	if err != nil {
+		return nil, err
+	}
+
+	natsMsg := nats.NewMsg(p.subject)
+	natsMsg.Data = data
+	natsMsg.Header.Set(codecHeader, p.codec.Name())
+
+	if algorithm != "" {
+		natsMsg.Header.Set(compressionHeader, algorithm)
+	}
+
+	return natsMsg, nil
+}
@@ -2,10 +2,10 @@ package queue
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go/jetstream"
@@ -13,19 +13,74 @@ import (
 )
 
 type NATSSubscriber struct {
-	js       jetstream.JetStream
-	subject  string
-	consumer jetstream.Consumer
+	js        jetstream.JetStream
+	subject   string
+	consumer  jetstream.Consumer
+	scheduled natsScheduled
 }
 
 const (
 	natsSubscriberBufferSize      = 100
 	natsSubscriberPullMaxMessages = 10
 	natsSubscriberMaxDeliver      = 3
+	natsScheduleDeliveries        = 1 // доставка, отложенная Nak с задержкой до deliver_at
 	natsSubscriberAckWait         = 30 * time.Second
 	natsSubscriberSleep           = 100 * time.Millisecond
+
+	// natsScheduledPruneSize - размер, после которого из natsScheduled удаляются давно созревшие отметки
+	// (их сообщения получил другой процесс с тем же consumer'ом).
+	natsScheduledPruneSize = 10000
+	natsScheduledRetention = time.Hour
 )
 
+// natsScheduled - сообщения, которые подписчик отложил через NakWithDelay до deliver_at,
+// по номеру в stream'е. Этот Nak остается в NumDelivered, поэтому отметка живет до Ack/Term.
+// Заголовки сохраненного сообщения JetStream не меняются, поэтому отметка хранится в процессе:
+// если отложенное сообщение получит другой процесс, Nak будет учтен как попытка (с запасом в MaxDeliver).
+type natsScheduled struct {
+	mu  sync.Mutex
+	seq map[uint64]time.Time // deliver_at
+}
+
+// mark отмечает сообщение, отложенное до deliverAt.
+func (s *natsScheduled) mark(seq uint64, deliverAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seq == nil {
+		s.seq = make(map[uint64]time.Time)
+	}
+
+	if len(s.seq) >= natsScheduledPruneSize {
+		cutoff := time.Now().Add(-natsScheduledRetention)
+
+		for pending, at := range s.seq {
+			if at.Before(cutoff) {
+				delete(s.seq, pending)
+			}
+		}
+	}
+
+	s.seq[seq] = deliverAt
+}
+
+// has сообщает, было ли сообщение отложено подписчиком.
+func (s *natsScheduled) has(seq uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.seq[seq]
+
+	return ok
+}
+
+// forget снимает отметку.
+func (s *natsScheduled) forget(seq uint64) {
+	s.mu.Lock()
+	delete(s.seq, seq)
+	s.mu.Unlock()
+}
+
 // NewNATSSubscriber создает subscriber для конкретного subject.
 func NewNATSSubscriber(broker *NATSBroker, subject string) (*NATSSubscriber, error) {
 	fullSubject := broker.config.SubjectPrefix + "." + subject
@@ -36,7 +91,7 @@ func NewNATSSubscriber(broker *NATSBroker, subject string) (*NATSSubscriber, err
 		Durable:       subject + "-consumer",
 		FilterSubject: fullSubject,
 		AckPolicy:     jetstream.AckExplicitPolicy,
-		MaxDeliver:    natsSubscriberMaxDeliver,
+		MaxDeliver:    natsSubscriberMaxDeliver + natsScheduleDeliveries,
 		AckWait:       natsSubscriberAckWait,
 	}
 
@@ -56,9 +111,19 @@ func NewNATSSubscriber(broker *NATSBroker, subject string) (*NATSSubscriber, err
 	}, nil
 }
 
+// Info возвращает состояние durable consumer'а: число ожидающих, неподтвержденных и повторных доставок.
+func (s *NATSSubscriber) Info(ctx context.Context) (*jetstream.ConsumerInfo, error) {
+	info, err := s.consumer.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get consumer info: %w", err)
+	}
+
+	return info, nil
+}
+
 // Subscribe создает канал для получения сообщений с правильным управлением ресурсами.
-func (s *NATSSubscriber) Subscribe(ctx context.Context) (<-chan *models.DataMessage, error) { //nolint:gocognit,cyclop
-	msgChan := make(chan *models.DataMessage, natsSubscriberBufferSize)
+func (s *NATSSubscriber) Subscribe(ctx context.Context) (<-chan Delivery, error) { //nolint:gocognit,cyclop
+	msgChan := make(chan Delivery, natsSubscriberBufferSize)
 
 	// Создаем pull subscription с back-pressure
 	iter, err := s.consumer.Messages(
@@ -99,7 +164,7 @@ func (s *NATSSubscriber) Subscribe(ctx context.Context) (<-chan *models.DataMess
 
 				// Десериализуем сообщение
 				var dataMsg models.DataMessage
-				if err := json.Unmarshal(msg.Data(), &dataMsg); err != nil {
+				if err := decodeNATSMessage(msg, &dataMsg); err != nil {
 					log.Printf("Failed to unmarshal message: %v", err)
 
 					_ = msg.Nak() // Ignore nak error for now
@@ -107,14 +172,20 @@ func (s *NATSSubscriber) Subscribe(ctx context.Context) (<-chan *models.DataMess
 					continue
 				}
 
-				// Отправляем в канал
+				// Отложенное сообщение возвращаем JetStream до наступления deliver_at.
+				if delay := deliveryDelay(&dataMsg); delay > 0 {
+					s.schedule(msg, &dataMsg, delay)
+
+					continue
+				}
+
+				// Отправляем в канал. Подтверждение выполняет потребитель через Delivery
+				// после обработки; неподтвержденное сообщение JetStream доставит повторно.
 				select {
-				case msgChan <- &dataMsg:
-					// Подтверждаем только после успешной отправки в канал
-					if err := msg.Ack(); err != nil {
-						log.Printf("Failed to ack message: %v", err)
-					}
+				case msgChan <- s.newDelivery(msg, &dataMsg):
 				case <-ctx.Done():
+					_ = msg.Nak() // Возвращаем сообщение без ожидания AckWait
+
 					return
 				}
 			}
@@ -124,8 +195,149 @@ func (s *NATSSubscriber) Subscribe(ctx context.Context) (<-chan *models.DataMess
 	return msgChan, nil
 }
 
+// decodeNATSMessage распаковывает и декодирует тело по заголовкам сообщения.
+func decodeNATSMessage(msg jetstream.Msg, dataMsg *models.DataMessage) error {
+	var codecName, algorithm string
+
+	if headers := msg.Headers(); headers != nil {
+		codecName = headers.Get(codecHeader)
+		algorithm = headers.Get(compressionHeader)
+	}
+
+	data, err := decompressBody(algorithm, msg.Data())
+	if err != nil {
+		return err
+	}
+
+	return decodeMessage(codecName, data, dataMsg)
+}
+
 // Close останавливает подписку.
 func (s *NATSSubscriber) Close() error {
 	// Consumer автоматически очищается при закрытии соединения
 	return nil
 }
+
+// schedule возвращает сообщение JetStream до deliver_at. Отметка ставится до Nak,
+// чтобы повторная доставка не была учтена как попытка обработки.
+func (s *NATSSubscriber) schedule(msg jetstream.Msg, data *models.DataMessage, delay time.Duration) {
+	meta, metaErr := msg.Metadata()
+	if metaErr == nil {
+		deliverAt, _ := DeliverAt(data)
+		s.scheduled.mark(meta.Sequence.Stream, deliverAt)
+	}
+
+	if err := msg.NakWithDelay(delay); err != nil {
+		log.Printf("Failed to delay message %s: %v", data.GetId(), err)
+
+		if metaErr == nil {
+			s.scheduled.forget(meta.Sequence.Stream)
+		}
+	}
+}
+
+// newDelivery создает доставку; Nak до deliver_at не считается попыткой обработки.
+func (s *NATSSubscriber) newDelivery(msg jetstream.Msg, data *models.DataMessage) *natsDelivery {
+	delivery := newNATSDelivery(msg, data)
+
+	meta, err := msg.Metadata()
+	if err != nil || !s.scheduled.has(meta.Sequence.Stream) {
+		return delivery
+	}
+
+	if delivery.attempt > 1 {
+		delivery.attempt -= natsScheduleDeliveries
+	}
+
+	delivery.done = func() { s.scheduled.forget(meta.Sequence.Stream) }
+
+	return delivery
+}
+
+// natsDelivery связывает десериализованное сообщение с исходным сообщением JetStream.
+type natsDelivery struct {
+	msg     jetstream.Msg
+	data    *models.DataMessage
+	attempt int
+	done    func() // вызывается после Ack/Term
+}
+
+func newNATSDelivery(msg jetstream.Msg, data *models.DataMessage) *natsDelivery {
+	attempt := 1
+
+	// Номер попытки берем из метаданных JetStream (NumDelivered).
+	if meta, err := msg.Metadata(); err == nil && meta.NumDelivered > 0 {
+		attempt = int(meta.NumDelivered) //nolint:gosec // bounded by MaxDeliver
+	}
+
+	return &natsDelivery{
+		msg:     msg,
+		data:    data,
+		attempt: attempt,
+	}
+}
+
+// Message реализует интерфейс Delivery.
+func (d *natsDelivery) Message() *models.DataMessage {
+	return d.data
+}
+
+// Attempt реализует интерфейс Delivery.
+func (d *natsDelivery) Attempt() int {
+	return d.attempt
+}
+
+// Ack реализует интерфейс Delivery.
+func (d *natsDelivery) Ack() error {
+	if err := d.msg.Ack(); err != nil {
+		return fmt.Errorf("failed to ack message: %w", err)
+	}
+
+	d.settled()
+
+	return nil
+}
+
+// Nack реализует интерфейс Delivery. JetStream повторит доставку через delay.
+func (d *natsDelivery) Nack(delay time.Duration) error {
+	var err error
+
+	if delay > 0 {
+		err = d.msg.NakWithDelay(delay)
+	} else {
+		err = d.msg.Nak()
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to nak message: %w", err)
+	}
+
+	return nil
+}
+
+// InProgress реализует интерфейс Delivery, сбрасывая таймер AckWait.
+func (d *natsDelivery) InProgress() error {
+	if err := d.msg.InProgress(); err != nil {
+		return fmt.Errorf("failed to mark message in progress: %w", err)
+	}
+
+	return nil
+}
+
+// Term реализует интерфейс Delivery.
+func (d *natsDelivery) Term() error {
+	if err := d.msg.Term(); err != nil {
+		return fmt.Errorf("failed to term message: %w", err)
+	}
+
+	d.settled()
+
+	return nil
+}
+
+// settled сообщает подписчику, что JetStream больше не доставит сообщение.
+func (d *natsDelivery) settled() {
+	if d.done != nil {
+		d.done()
+	}
+}
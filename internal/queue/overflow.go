@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// OverflowPolicy определяет поведение MemoryQueue при заполненном буфере.
+type OverflowPolicy string
+
+const (
+	// OverflowReject - Enqueue сразу возвращает ErrQueueFull.
+	OverflowReject OverflowPolicy = "reject"
+	// OverflowBlock - Enqueue ждет освобождения места не дольше BlockTimeout, затем возвращает ErrQueueFull.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropOldest - самое старое сообщение очереди вытесняется новым.
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowDropNewest - новое сообщение отбрасывается, Enqueue возвращает nil.
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+	// OverflowSample - новое сообщение с вероятностью SampleRate вытесняет самое старое, иначе отбрасывается.
+	OverflowSample OverflowPolicy = "sample"
+)
+
+const (
+	defaultOverflowBlockTimeout = time.Second
+	defaultOverflowSampleRate   = 0.1
+)
+
+var (
+	ErrUnsupportedOverflowPolicy = errors.New("unsupported overflow policy")
+	ErrInvalidOverflowSampleRate = errors.New("overflow sample rate must be in (0, 1]")
+)
+
+// OverflowConfig - настройки переполнения MemoryQueue. Отброшенные сообщения учитываются в Stats.Dropped.
+type OverflowConfig struct {
+	Policy       OverflowPolicy
+	BlockTimeout time.Duration // для OverflowBlock; 0 - 1s
+	SampleRate   float64       // для OverflowSample: доля принимаемых сообщений; 0 - 0.1
+}
+
+// normalize проверяет настройки и подставляет значения по умолчанию.
+func (c OverflowConfig) normalize() (OverflowConfig, error) {
+	switch c.Policy {
+	case OverflowReject, OverflowBlock, OverflowDropOldest, OverflowDropNewest, OverflowSample:
+	case "":
+		c.Policy = OverflowReject
+	default:
+		return c, fmt.Errorf("%w: %s", ErrUnsupportedOverflowPolicy, c.Policy)
+	}
+
+	if c.BlockTimeout <= 0 {
+		c.BlockTimeout = defaultOverflowBlockTimeout
+	}
+
+	if c.SampleRate == 0 {
+		c.SampleRate = defaultOverflowSampleRate
+	}
+
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return c, fmt.Errorf("%w: %v", ErrInvalidOverflowSampleRate, c.SampleRate)
+	}
+
+	return c, nil
+}
+
+// admit решает, вытесняет ли новое сообщение самое старое (true) или отбрасывается само (false).
+func (c OverflowConfig) admit() bool {
+	switch c.Policy {
+	case OverflowDropOldest:
+		return true
+	case OverflowSample:
+		return rand.Float64() < c.SampleRate //nolint:gosec // выборка, не криптография
+	default:
+		return false
+	}
+}
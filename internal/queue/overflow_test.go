@@ -0,0 +1,164 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func newOverflowQueue(t *testing.T, size int, cfg OverflowConfig) *MemoryQueue {
+	t.Helper()
+
+	q := NewMemoryQueue(size)
+	t.Cleanup(func() { q.Close() })
+
+	if err := q.SetOverflow(cfg); err != nil {
+		t.Fatalf("Failed to set overflow policy: %v", err)
+	}
+
+	return q
+}
+
+func drain(t *testing.T, q *MemoryQueue) []string {
+	t.Helper()
+
+	ids := make([]string, 0, q.Stats().CurrentSize)
+
+	for q.Stats().CurrentSize > 0 {
+		msg, err := q.Dequeue(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to dequeue: %v", err)
+		}
+
+		ids = append(ids, msg.GetId())
+	}
+
+	return ids
+}
+
+func TestMemoryQueue_OverflowDropPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      OverflowConfig
+		expected []string
+	}{
+		{"drop-oldest", OverflowConfig{Policy: OverflowDropOldest}, []string{"2", "3"}},
+		{"drop-newest", OverflowConfig{Policy: OverflowDropNewest}, []string{"0", "1"}},
+		{"sample all", OverflowConfig{Policy: OverflowSample, SampleRate: 1}, []string{"2", "3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newOverflowQueue(t, 2, tt.cfg)
+
+			for i, msg := range batchOf(4) {
+				if err := q.Enqueue(context.Background(), msg); err != nil {
+					t.Fatalf("Enqueue %d: expected no error, got %v", i, err)
+				}
+			}
+
+			if stats := q.Stats(); stats.Dropped != 2 {
+				t.Errorf("Expected 2 dropped messages, got %d", stats.Dropped)
+			}
+
+			ids := drain(t, q)
+			if len(ids) != len(tt.expected) || ids[0] != tt.expected[0] || ids[1] != tt.expected[1] {
+				t.Errorf("Expected messages %v, got %v", tt.expected, ids)
+			}
+		})
+	}
+}
+
+func TestMemoryQueue_OverflowSampleBatch(t *testing.T) {
+	q := newOverflowQueue(t, 10, OverflowConfig{Policy: OverflowSample, SampleRate: 0.5})
+
+	errs := q.PublishBatch(context.Background(), batchOf(1000))
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Message %d: expected no error, got %v", i, err)
+		}
+	}
+
+	// Половина из 990 лишних сообщений вытесняет старые, половина отбрасывается: всего 990 потерь.
+	stats := q.Stats()
+	if stats.Dropped != 990 || stats.CurrentSize != 10 {
+		t.Errorf("Expected 990 dropped and 10 queued messages, got %+v", stats)
+	}
+
+	if stats.TotalEnqueued < 400 || stats.TotalEnqueued > 600 {
+		t.Errorf("Expected about half of the messages to be accepted, got %d", stats.TotalEnqueued)
+	}
+}
+
+func TestMemoryQueue_OverflowBlock(t *testing.T) {
+	q := newOverflowQueue(t, 1, OverflowConfig{Policy: OverflowBlock, BlockTimeout: 50 * time.Millisecond})
+
+	if err := q.Enqueue(context.Background(), &models.DataMessage{Id: "0"}); err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+
+	start := time.Now()
+	if err := q.Enqueue(context.Background(), &models.DataMessage{Id: "1"}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Expected ErrQueueFull after timeout, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected Enqueue to wait for the block timeout, returned after %v", elapsed)
+	}
+
+	// Место, освобожденное потребителем во время ожидания, получает заблокированный производитель.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_, _ = q.Dequeue(context.Background())
+	}()
+
+	if err := q.Enqueue(context.Background(), &models.DataMessage{Id: "2"}); err != nil {
+		t.Fatalf("Expected blocked enqueue to succeed, got %v", err)
+	}
+
+	if stats := q.Stats(); stats.Dropped != 0 || stats.TotalEnqueued != 2 {
+		t.Errorf("Expected 2 enqueued and no dropped messages, got %+v", stats)
+	}
+}
+
+func TestMemoryQueue_OverflowBlockUnblocksOnClose(t *testing.T) {
+	q := newOverflowQueue(t, 1, OverflowConfig{Policy: OverflowBlock, BlockTimeout: time.Minute})
+
+	if err := q.Enqueue(context.Background(), &models.DataMessage{Id: "0"}); err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+
+	result := make(chan error, 1)
+
+	go func() {
+		result <- q.Enqueue(context.Background(), &models.DataMessage{Id: "1"})
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrQueueClosed) {
+			t.Errorf("Expected ErrQueueClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Blocked enqueue was not released by Close")
+	}
+}
+
+func TestMemoryQueue_SetOverflowValidates(t *testing.T) {
+	q := NewMemoryQueue(1)
+	defer q.Close()
+
+	if err := q.SetOverflow(OverflowConfig{Policy: "drop-everything"}); !errors.Is(err, ErrUnsupportedOverflowPolicy) {
+		t.Errorf("Expected ErrUnsupportedOverflowPolicy, got %v", err)
+	}
+
+	if err := q.SetOverflow(OverflowConfig{Policy: OverflowSample, SampleRate: 1.5}); !errors.Is(err, ErrInvalidOverflowSampleRate) {
+		t.Errorf("Expected ErrInvalidOverflowSampleRate, got %v", err)
+	}
+}
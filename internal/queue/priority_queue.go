@@ -0,0 +1,336 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+// PriorityMetadataKey - ключ метаданных DataMessage с приоритетом сообщения.
+const PriorityMetadataKey = "priority"
+
+const defaultPriorityLevels = 3
+
+var ErrInvalidPriorityConfig = errors.New("invalid priority queue config")
+
+// PriorityConfig - настройки приоритетной очереди.
+type PriorityConfig struct {
+	Levels    int   // число уровней приоритета; 0 - низший, Levels-1 - высший
+	Weights   []int // веса уровней от низшего к высшему; по умолчанию 1, 2, 4, ...
+	LevelSize int   // емкость каждого уровня
+}
+
+// priorityLevel - FIFO одного уровня приоритета.
+type priorityLevel struct {
+	messages []*models.DataMessage
+	capacity int
+	weight   int
+	current  int // текущий вес для smooth weighted round-robin
+}
+
+// PriorityQueue - in-memory очередь с несколькими уровнями приоритета.
+// Уровни выбираются взвешенным round-robin: старшие уровни обслуживаются чаще,
+// но младшие не голодают, пока у них есть ненулевой вес.
+type PriorityQueue struct {
+	mu       sync.Mutex
+	levels   []*priorityLevel
+	signal   chan struct{} // закрывается при появлении сообщений или закрытии
+	closed   bool
+	stats    Stats
+	attempts attemptTracker
+	delayed  *delayScheduler
+
+	deadLetters *MemoryDeadLetterQueue
+}
+
+// NewPriorityQueue создает приоритетную очередь.
+func NewPriorityQueue(cfg PriorityConfig) (*PriorityQueue, error) {
+	if cfg.Levels <= 0 {
+		cfg.Levels = defaultPriorityLevels
+	}
+
+	if cfg.LevelSize <= 0 {
+		return nil, fmt.Errorf("%w: level size must be positive", ErrInvalidPriorityConfig)
+	}
+
+	if len(cfg.Weights) == 0 {
+		cfg.Weights = make([]int, cfg.Levels)
+		for i := range cfg.Weights {
+			cfg.Weights[i] = 1 << i
+		}
+	}
+
+	if len(cfg.Weights) != cfg.Levels {
+		return nil, fmt.Errorf("%w: got %d weights for %d levels", ErrInvalidPriorityConfig, len(cfg.Weights), cfg.Levels)
+	}
+
+	levels := make([]*priorityLevel, cfg.Levels)
+
+	for i, weight := range cfg.Weights {
+		if weight <= 0 {
+			return nil, fmt.Errorf("%w: weight of level %d must be positive", ErrInvalidPriorityConfig, i)
+		}
+
+		levels[i] = &priorityLevel{capacity: cfg.LevelSize, weight: weight}
+	}
+
+	q := &PriorityQueue{
+		levels:      levels,
+		signal:      make(chan struct{}),
+		deadLetters: NewMemoryDeadLetterQueue(memoryDeadLetterQueueSize),
+	}
+	q.delayed = newDelayScheduler(q.releaseDelayed)
+
+	return q, nil
+}
+
+// priorityOf возвращает уровень сообщения. Отсутствующий или некорректный приоритет - низший уровень,
+// значения вне диапазона прижимаются к границам.
+func (q *PriorityQueue) priorityOf(msg *models.DataMessage) int {
+	priority, err := strconv.Atoi(msg.GetMetadata()[PriorityMetadataKey])
+	if err != nil || priority < 0 {
+		return 0
+	}
+
+	return min(priority, len(q.levels)-1)
+}
+
+// Publish реализует интерфейс Publisher (неблокирующий).
+// Сообщение с deliver_at в будущем попадает на свой уровень только в момент доставки.
+func (q *PriorityQueue) Publish(ctx context.Context, msg *models.DataMessage) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("enqueue canceled: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.publishLocked(msg); err != nil {
+		return err
+	}
+
+	q.notifyLocked()
+
+	return nil
+}
+
+// PublishBatch реализует интерфейс BatchPublisher: сообщения пачки добавляются под одной блокировкой,
+// потребители будятся один раз.
+func (q *PriorityQueue) PublishBatch(ctx context.Context, msgs []*models.DataMessage) []error {
+	errs := make([]error, len(msgs))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	published := false
+
+	for i, msg := range msgs {
+		if err := ctx.Err(); err != nil {
+			errs[i] = fmt.Errorf("enqueue canceled: %w", err)
+
+			continue
+		}
+
+		errs[i] = q.publishLocked(msg)
+		published = published || errs[i] == nil
+	}
+
+	if published {
+		q.notifyLocked()
+	}
+
+	return errs
+}
+
+// publishLocked ставит сообщение на его уровень или откладывает его. Вызывается под q.mu.
+func (q *PriorityQueue) publishLocked(msg *models.DataMessage) error {
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	level := q.levels[q.priorityOf(msg)]
+
+	if delay := deliveryDelay(msg); delay > 0 {
+		if q.delayed.len() >= level.capacity {
+			return ErrQueueFull
+		}
+
+		q.delayed.schedule(msg, time.Now().Add(delay))
+
+		return nil
+	}
+
+	if len(level.messages) >= level.capacity {
+		return ErrQueueFull
+	}
+
+	level.messages = append(level.messages, msg)
+	q.stats.TotalEnqueued++
+
+	return nil
+}
+
+// notifyLocked будит потребителей, ожидающих сообщений. Вызывается под q.mu.
+func (q *PriorityQueue) notifyLocked() {
+	close(q.signal)
+	q.signal = make(chan struct{})
+}
+
+// releaseDelayed переносит созревшее сообщение на его уровень.
+func (q *PriorityQueue) releaseDelayed(msg *models.DataMessage) error {
+	return q.Publish(context.Background(), msg)
+}
+
+// requeue возвращает сообщение на его уровень после Nack.
+func (q *PriorityQueue) requeue(msg *models.DataMessage, attempt int) error {
+	q.attempts.requeued(msg, attempt)
+
+	if err := q.Publish(context.Background(), msg); err != nil {
+		q.attempts.next(msg)
+
+		return err
+	}
+
+	return nil
+}
+
+// Dequeue извлекает сообщение с учетом весов уровней (блокирующий).
+func (q *PriorityQueue) Dequeue(ctx context.Context) (*models.DataMessage, error) {
+	for {
+		q.mu.Lock()
+
+		if q.closed {
+			q.mu.Unlock()
+
+			return nil, ErrQueueClosed
+		}
+
+		if msg := q.pop(); msg != nil {
+			q.stats.TotalDequeued++
+			q.mu.Unlock()
+
+			return msg, nil
+		}
+
+		signal := q.signal
+		q.mu.Unlock()
+
+		select {
+		case <-signal:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("dequeue canceled: %w", ctx.Err())
+		}
+	}
+}
+
+// pop выбирает уровень алгоритмом smooth weighted round-robin среди непустых уровней.
+// Вызывается под q.mu.
+func (q *PriorityQueue) pop() *models.DataMessage {
+	var (
+		selected *priorityLevel
+		total    int
+	)
+
+	for i := len(q.levels) - 1; i >= 0; i-- {
+		level := q.levels[i]
+		if len(level.messages) == 0 {
+			continue
+		}
+
+		level.current += level.weight
+		total += level.weight
+
+		if selected == nil || level.current > selected.current {
+			selected = level
+		}
+	}
+
+	if selected == nil {
+		return nil
+	}
+
+	selected.current -= total
+
+	msg := selected.messages[0]
+	selected.messages[0] = nil
+	selected.messages = selected.messages[1:]
+
+	if len(selected.messages) == 0 {
+		// Опустевший уровень не копит вес и не отбирает очередь у остальных.
+		selected.current = 0
+		selected.messages = nil
+	}
+
+	return msg
+}
+
+// Subscribe реализует интерфейс Subscriber. Канал небуферизованный: выбор уровня происходит
+// в момент, когда worker готов принять сообщение, поэтому старшие уровни вычерпываются первыми.
+func (q *PriorityQueue) Subscribe(ctx context.Context) (<-chan Delivery, error) {
+	msgChan := make(chan Delivery)
+
+	go func() {
+		defer close(msgChan)
+
+		for {
+			msg, err := q.Dequeue(ctx)
+			if err != nil {
+				return
+			}
+
+			select {
+			case msgChan <- newMemoryDelivery(msg, q.attempts.next(msg), q.requeue):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return msgChan, nil
+}
+
+// DeadLetters реализует интерфейс DeadLetterProvider.
+func (q *PriorityQueue) DeadLetters() DeadLetterQueue { //nolint:ireturn // interface by design
+	return q.deadLetters
+}
+
+// MaxAttempts реализует интерфейс DeadLetterProvider.
+func (q *PriorityQueue) MaxAttempts() int {
+	return defaultMaxDeliveryAttempts
+}
+
+// Stats возвращает статистику очереди с глубиной каждого уровня.
+func (q *PriorityQueue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := q.stats
+	stats.DelayedSize = q.delayed.len()
+	stats.LevelSizes = make([]int, len(q.levels))
+
+	for i, level := range q.levels {
+		stats.LevelSizes[i] = len(level.messages)
+		stats.CurrentSize += len(level.messages)
+	}
+
+	return stats
+}
+
+// Close закрывает очередь.
+func (q *PriorityQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.signal)
+		q.delayed.close()
+	}
+
+	return nil
+}
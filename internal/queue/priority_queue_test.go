@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func priorityMessage(id string, priority int) *models.DataMessage {
+	return &models.DataMessage{
+		Id:       id,
+		Metadata: map[string]string{PriorityMetadataKey: fmt.Sprint(priority)},
+	}
+}
+
+func TestPriorityQueue_WeightedDrainWithoutStarvation(t *testing.T) {
+	q, err := NewPriorityQueue(PriorityConfig{Levels: 2, Weights: []int{1, 3}, LevelSize: 10})
+	if err != nil {
+		t.Fatalf("Failed to create priority queue: %v", err)
+	}
+	defer q.Close()
+
+	ctx := context.Background()
+
+	for i := range 4 {
+		q.Publish(ctx, priorityMessage(fmt.Sprintf("low-%d", i), 0))
+		q.Publish(ctx, priorityMessage(fmt.Sprintf("high-%d", i), 1))
+	}
+
+	stats := q.Stats()
+	if stats.CurrentSize != 8 || stats.LevelSizes[0] != 4 || stats.LevelSizes[1] != 4 {
+		t.Fatalf("Unexpected stats before drain: %+v", stats)
+	}
+
+	var order []string
+
+	for range 4 {
+		msg, err := q.Dequeue(ctx)
+		if err != nil {
+			t.Fatalf("Failed to dequeue: %v", err)
+		}
+
+		order = append(order, msg.GetId())
+	}
+
+	// При весах 1:3 из первых четырех сообщений три старших и одно младшее.
+	want := []string{"high-0", "high-1", "low-0", "high-2"}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Fatalf("Expected order %v, got %v", want, order)
+	}
+}
+
+func TestPriorityQueue_UnknownPriorityUsesLowestLevel(t *testing.T) {
+	q, err := NewPriorityQueue(PriorityConfig{Levels: 3, LevelSize: 1})
+	if err != nil {
+		t.Fatalf("Failed to create priority queue: %v", err)
+	}
+	defer q.Close()
+
+	ctx := context.Background()
+
+	if err := q.Publish(ctx, &models.DataMessage{Id: "plain"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	if err := q.Publish(ctx, &models.DataMessage{Id: "bogus", Metadata: map[string]string{PriorityMetadataKey: "x"}}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Expected ErrQueueFull on lowest level, got %v", err)
+	}
+
+	if err := q.Publish(ctx, priorityMessage("urgent", 99)); err != nil {
+		t.Fatalf("Failed to publish clamped priority: %v", err)
+	}
+
+	if sizes := q.Stats().LevelSizes; sizes[0] != 1 || sizes[2] != 1 {
+		t.Fatalf("Expected messages on levels 0 and 2, got %v", sizes)
+	}
+}
+
+func TestPriorityQueue_SubscribeDeliversHighestFirst(t *testing.T) {
+	q, err := NewPriorityQueue(PriorityConfig{Levels: 2, Weights: []int{1, 100}, LevelSize: 10})
+	if err != nil {
+		t.Fatalf("Failed to create priority queue: %v", err)
+	}
+	defer q.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q.Publish(ctx, priorityMessage("low-0", 0))
+	q.Publish(ctx, priorityMessage("low-1", 0))
+	q.Publish(ctx, priorityMessage("high", 1))
+
+	ch, _ := q.Subscribe(ctx)
+
+	for _, want := range []string{"high", "low-0", "low-1"} {
+		select {
+		case delivery := <-ch:
+			if delivery.Message().GetId() != want {
+				t.Fatalf("Expected %s, got %s", want, delivery.Message().GetId())
+			}
+
+			delivery.Ack()
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for delivery")
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisDeadLetterKey - суффикс stream'а DLQ (полный ключ: <stream>:dlq).
+const redisDeadLetterKey = ":dlq"
+
+// RedisDeadLetterQueue хранит DLQ в отдельном stream'е Redis. ID записи - ID сообщения stream'а.
+type RedisDeadLetterQueue struct {
+	client *redis.Client
+	stream string
+}
+
+// NewRedisDeadLetterQueue создает DLQ в stream'е с ключом stream.
+func NewRedisDeadLetterQueue(client *redis.Client, stream string) *RedisDeadLetterQueue {
+	return &RedisDeadLetterQueue{
+		client: client,
+		stream: stream,
+	}
+}
+
+// Put реализует интерфейс DeadLetterQueue.
+func (q *RedisDeadLetterQueue) Put(ctx context.Context, dl *DeadLetter) error {
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+
+	id, err := q.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: q.stream,
+		Values: map[string]any{redisDataField: data},
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
+
+	dl.ID = id
+
+	return nil
+}
+
+// List реализует интерфейс DeadLetterQueue.
+func (q *RedisDeadLetterQueue) List(ctx context.Context, limit int) ([]*DeadLetter, error) {
+	var (
+		messages []redis.XMessage
+		err      error
+	)
+
+	if limit > 0 {
+		messages, err = q.client.XRangeN(ctx, q.stream, "-", "+", int64(limit)).Result()
+	} else {
+		messages, err = q.client.XRange(ctx, q.stream, "-", "+").Result()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+
+	result := make([]*DeadLetter, 0, len(messages))
+
+	for _, message := range messages {
+		dl, err := decodeRedisDeadLetter(message)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, dl)
+	}
+
+	return result, nil
+}
+
+// Get реализует интерфейс DeadLetterQueue.
+func (q *RedisDeadLetterQueue) Get(ctx context.Context, id string) (*DeadLetter, error) {
+	if !isRedisStreamID(id) {
+		return nil, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+
+	messages, err := q.client.XRange(ctx, q.stream, id, id).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+
+	return decodeRedisDeadLetter(messages[0])
+}
+
+// Delete реализует интерфейс DeadLetterQueue.
+func (q *RedisDeadLetterQueue) Delete(ctx context.Context, id string) error {
+	if !isRedisStreamID(id) {
+		return fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+
+	deleted, err := q.client.XDel(ctx, q.stream, id).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete dead letter: %w", err)
+	}
+
+	if deleted == 0 {
+		return fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+
+	return nil
+}
+
+// isRedisStreamID проверяет формат ID сообщения stream'а: "<миллисекунды>-<номер>".
+func isRedisStreamID(id string) bool {
+	ms, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return false
+	}
+
+	_, msErr := strconv.ParseUint(ms, 10, 64)
+	_, seqErr := strconv.ParseUint(seq, 10, 64)
+
+	return msErr == nil && seqErr == nil
+}
+
+// decodeRedisDeadLetter десериализует запись DLQ и проставляет ей ID.
+func decodeRedisDeadLetter(message redis.XMessage) (*DeadLetter, error) {
+	data, _ := message.Values[redisDataField].(string)
+
+	var dl DeadLetter
+	if err := json.Unmarshal([]byte(data), &dl); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dead letter: %w", err)
+	}
+
+	dl.ID = message.ID
+
+	return &dl, nil
+}
@@ -0,0 +1,629 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+const (
+	redisBufferSize    = 100
+	redisReadCount     = 10
+	redisReadBlock     = time.Second
+	redisClaimInterval = 5 * time.Second
+	redisDelayPoll     = 100 * time.Millisecond
+	redisDelayBatch    = 100
+	redisStatsTimeout  = 2 * time.Second
+
+	// DefaultRedisClaimIdle - через сколько неподтвержденное сообщение забирает другой потребитель группы.
+	DefaultRedisClaimIdle = 30 * time.Second
+
+	redisDataField    = "data"
+	redisAttemptField = "attempt"
+	redisDelayedKey   = ":delayed"
+)
+
+var (
+	ErrRedisConnect     = errors.New("failed to connect to Redis")
+	ErrRedisGroupCreate = errors.New("failed to create Redis consumer group")
+	ErrRedisQueueClose  = errors.New("errors closing Redis queue")
+)
+
+// redisReleaseScript переносит созревшие отложенные сообщения из sorted set в stream.
+// Элемент sorted set: "<codec>|<compression>|<attempt>|<uuid>|<тело>"; тело может быть бинарным.
+var redisReleaseScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, member in ipairs(due) do
+	local fields = {}
+	local pos = 1
+	for i = 1, 4 do
+		local sep = string.find(member, '|', pos, true)
+		fields[i] = string.sub(member, pos, sep - 1)
+		pos = sep + 1
+	end
+	local entry = {'codec', fields[1], 'compression', fields[2], 'attempt', fields[3], 'data', string.sub(member, pos)}
+	if tonumber(ARGV[3]) > 0 then
+		redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[3], '*', unpack(entry))
+	else
+		redis.call('XADD', KEYS[1], '*', unpack(entry))
+	end
+	redis.call('ZREM', KEYS[2], member)
+end
+return #due
+`)
+
+// RedisConfig - настройки провайдера на Redis Streams.
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+	Stream   string
+	Group    string
+	// Consumer - имя потребителя в группе; должно быть уникально для экземпляра.
+	Consumer string
+	// MaxLen - приблизительная длина stream'а (XADD MAXLEN ~); 0 - без ограничения.
+	MaxLen int64
+	// ClaimIdle - через сколько неподтвержденное сообщение переходит другому потребителю (XAUTOCLAIM).
+	ClaimIdle time.Duration
+}
+
+// RedisQueue - очередь на Redis Streams с consumer group.
+// Подтвержденные сообщения остаются в stream'е до обрезки по MaxLen; отложенные ждут в sorted set
+// "<stream>:delayed" и переносятся в stream при наступлении deliver_at.
+type RedisQueue struct {
+	client      *redis.Client
+	config      RedisConfig
+	codec       Codec
+	compression CompressionConfig
+	deadLetters *RedisDeadLetterQueue
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+
+	// Статистика - только атомарные операции
+	totalEnqueued int64
+	totalDequeued int64
+}
+
+// NewRedisQueue подключается к Redis, создает stream и consumer group, если их нет.
+func NewRedisQueue(cfg RedisConfig) (*RedisQueue, error) {
+	if cfg.ClaimIdle <= 0 {
+		cfg.ClaimIdle = DefaultRedisClaimIdle
+	}
+
+	if cfg.Consumer == "" {
+		cfg.Consumer = defaultRedisConsumer()
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:                  cfg.Addr,
+		Password:              cfg.Password,
+		DB:                    cfg.DB,
+		ContextTimeoutEnabled: true,
+	})
+
+	ctx := context.Background()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+
+		return nil, fmt.Errorf("%w: %w", ErrRedisConnect, err)
+	}
+
+	// Группа читает stream с начала: сообщения, опубликованные до ее создания, тоже будут доставлены.
+	err := client.XGroupCreateMkStream(ctx, cfg.Stream, cfg.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		client.Close()
+
+		return nil, fmt.Errorf("%w: %w", ErrRedisGroupCreate, err)
+	}
+
+	q := &RedisQueue{
+		client:      client,
+		config:      cfg,
+		codec:       protobufCodec{},
+		deadLetters: NewRedisDeadLetterQueue(client, cfg.Stream+redisDeadLetterKey),
+		done:        make(chan struct{}),
+	}
+
+	q.wg.Add(1)
+
+	go q.releaseDelayed()
+
+	return q, nil
+}
+
+// defaultRedisConsumer возвращает имя потребителя по имени хоста.
+func defaultRedisConsumer() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "consumer-" + strconv.Itoa(os.Getpid())
+	}
+
+	return hostname
+}
+
+// SetCodec задает кодек публикуемых сообщений. Подписчик декодирует сообщения по полю codec.
+func (q *RedisQueue) SetCodec(codec Codec) {
+	q.codec = codec
+}
+
+// SetCompression задает сжатие публикуемых сообщений. Подписчик распаковывает сообщения по полю compression.
+func (q *RedisQueue) SetCompression(cfg CompressionConfig) {
+	q.compression = cfg
+}
+
+// redisEntry - закодированное сообщение stream'а.
+type redisEntry struct {
+	codec       string
+	compression string
+	attempt     int
+	data        string
+}
+
+func (e redisEntry) values() map[string]any {
+	return map[string]any{
+		codecHeader:       e.codec,
+		compressionHeader: e.compression,
+		redisAttemptField: e.attempt,
+		redisDataField:    e.data,
+	}
+}
+
+// member кодирует сообщение как элемент sorted set отложенных сообщений (см. redisReleaseScript).
+func (e redisEntry) member() string {
+	return strings.Join([]string{e.codec, e.compression, strconv.Itoa(e.attempt), uuid.NewString(), e.data}, "|")
+}
+
+// newEntry кодирует сообщение для публикации.
+func (q *RedisQueue) newEntry(msg *models.DataMessage) (redisEntry, error) {
+	data, err := q.codec.Marshal(msg)
+	if err != nil {
+		return redisEntry{}, fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	data, algorithm, err := compressBody(q.compression, data)
+	if err != nil {
+		return redisEntry{}, err
+	}
+
+	return redisEntry{
+		codec:       q.codec.Name(),
+		compression: algorithm,
+		attempt:     1,
+		data:        string(data),
+	}, nil
+}
+
+// add добавляет сообщение в stream или, если delay > 0, в sorted set отложенных сообщений.
+func (q *RedisQueue) add(ctx context.Context, cmd redis.Cmdable, entry redisEntry, delay time.Duration) {
+	if delay > 0 {
+		cmd.ZAdd(ctx, q.config.Stream+redisDelayedKey, redis.Z{
+			Score:  float64(time.Now().Add(delay).UnixMilli()),
+			Member: entry.member(),
+		})
+
+		return
+	}
+
+	cmd.XAdd(ctx, &redis.XAddArgs{
+		Stream: q.config.Stream,
+		MaxLen: q.config.MaxLen,
+		Approx: q.config.MaxLen > 0,
+		Values: entry.values(),
+	})
+}
+
+// Publish реализует интерфейс Publisher.
+// Сообщение с deliver_at в будущем попадает в stream только в момент доставки.
+func (q *RedisQueue) Publish(ctx context.Context, msg *models.DataMessage) error {
+	entry, err := q.newEntry(msg)
+	if err != nil {
+		return err
+	}
+
+	if _, err := q.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		q.add(ctx, pipe, entry, deliveryDelay(msg))
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	atomic.AddInt64(&q.totalEnqueued, 1)
+
+	return nil
+}
+
+// PublishBatch реализует интерфейс BatchPublisher: пачка отправляется одним pipeline.
+func (q *RedisQueue) PublishBatch(ctx context.Context, msgs []*models.DataMessage) []error {
+	errs := make([]error, len(msgs))
+	indexes := make([]int, 0, len(msgs))
+	pipe := q.client.Pipeline()
+
+	for i, msg := range msgs {
+		entry, err := q.newEntry(msg)
+		if err != nil {
+			errs[i] = err
+
+			continue
+		}
+
+		q.add(ctx, pipe, entry, deliveryDelay(msg))
+		indexes = append(indexes, i)
+	}
+
+	if len(indexes) == 0 {
+		return errs
+	}
+
+	// Exec возвращает все команды pipeline'а, у каждой - своя ошибка.
+	cmds, _ := pipe.Exec(ctx)
+
+	for k, cmd := range cmds {
+		i := indexes[k]
+
+		if err := cmd.Err(); err != nil {
+			errs[i] = fmt.Errorf("failed to publish message: %w", err)
+
+			continue
+		}
+
+		atomic.AddInt64(&q.totalEnqueued, 1)
+	}
+
+	return errs
+}
+
+// Subscribe реализует интерфейс Subscriber.
+// Новые сообщения читаются через XREADGROUP; сообщения, не подтвержденные другими потребителями
+// дольше ClaimIdle, периодически забираются через XAUTOCLAIM.
+func (q *RedisQueue) Subscribe(ctx context.Context) (<-chan Delivery, error) {
+	msgChan := make(chan Delivery, redisBufferSize)
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	q.wg.Add(1)
+
+	go func() {
+		defer q.wg.Done()
+		defer close(msgChan)
+		defer cancel()
+
+		go func() {
+			select {
+			case <-q.done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		var lastClaim time.Time
+
+		for ctx.Err() == nil {
+			var messages []redis.XMessage
+
+			claimed := time.Since(lastClaim) >= redisClaimInterval
+			if claimed {
+				lastClaim = time.Now()
+				messages = q.claim(ctx)
+			}
+
+			if len(messages) == 0 {
+				claimed = false
+				messages = q.read(ctx)
+			}
+
+			for _, message := range messages {
+				delivery, ok := q.newDelivery(ctx, message, claimed)
+				if !ok {
+					continue
+				}
+
+				atomic.AddInt64(&q.totalDequeued, 1)
+
+				select {
+				case msgChan <- delivery:
+				case <-ctx.Done():
+					// Сообщение остается неподтвержденным и будет забрано через XAUTOCLAIM.
+					return
+				}
+			}
+		}
+	}()
+
+	return msgChan, nil
+}
+
+// read читает новые сообщения группы.
+func (q *RedisQueue) read(ctx context.Context) []redis.XMessage {
+	streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    q.config.Group,
+		Consumer: q.config.Consumer,
+		Streams:  []string{q.config.Stream, ">"},
+		Count:    redisReadCount,
+		Block:    redisReadBlock,
+	}).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+			log.Printf("Error reading Redis stream %s: %v", q.config.Stream, err)
+			time.Sleep(time.Second) // back-off при ошибках
+		}
+
+		return nil
+	}
+
+	if len(streams) == 0 {
+		return nil
+	}
+
+	return streams[0].Messages
+}
+
+// claim забирает сообщения, которые потребители группы не подтвердили дольше ClaimIdle.
+func (q *RedisQueue) claim(ctx context.Context) []redis.XMessage {
+	messages, _, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   q.config.Stream,
+		Group:    q.config.Group,
+		Consumer: q.config.Consumer,
+		MinIdle:  q.config.ClaimIdle,
+		Start:    "0",
+		Count:    redisReadCount,
+	}).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Error claiming pending messages of Redis stream %s: %v", q.config.Stream, err)
+		}
+
+		return nil
+	}
+
+	if len(messages) > 0 {
+		log.Printf("Claimed %d pending messages of Redis stream %s", len(messages), q.config.Stream)
+	}
+
+	return messages
+}
+
+// newDelivery декодирует сообщение stream'а. Нечитаемое сообщение подтверждается и отбрасывается.
+func (q *RedisQueue) newDelivery(ctx context.Context, message redis.XMessage, claimed bool) (*redisDelivery, bool) {
+	entry := redisEntry{attempt: 1}
+	entry.codec, _ = message.Values[codecHeader].(string)
+	entry.compression, _ = message.Values[compressionHeader].(string)
+	entry.data, _ = message.Values[redisDataField].(string)
+
+	if attempt, err := strconv.Atoi(fmt.Sprint(message.Values[redisAttemptField])); err == nil && attempt > 0 {
+		entry.attempt = attempt
+	}
+
+	var dataMsg models.DataMessage
+
+	data, err := decompressBody(entry.compression, []byte(entry.data))
+	if err == nil {
+		err = decodeMessage(entry.codec, data, &dataMsg)
+	}
+
+	if err != nil {
+		log.Printf("Failed to unmarshal Redis message %s, dropping: %v", message.ID, err)
+
+		_ = q.client.XAck(ctx, q.config.Stream, q.config.Group, message.ID).Err()
+
+		return nil, false
+	}
+
+	// Каждая доставка, после которой сообщение пришлось забирать через XAUTOCLAIM, - неудачная попытка.
+	if claimed {
+		if retries := q.retryCount(ctx, message.ID); retries > 1 {
+			entry.attempt += int(retries) - 1
+		}
+	}
+
+	return &redisDelivery{
+		queue: q,
+		id:    message.ID,
+		entry: entry,
+		msg:   &dataMsg,
+	}, true
+}
+
+// retryCount возвращает число доставок сообщения по данным XPENDING; 0, если оно неизвестно.
+func (q *RedisQueue) retryCount(ctx context.Context, id string) int64 {
+	pending, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: q.config.Stream,
+		Group:  q.config.Group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return 0
+	}
+
+	return pending[0].RetryCount
+}
+
+// releaseDelayed периодически переносит созревшие отложенные сообщения в stream.
+func (q *RedisQueue) releaseDelayed() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(redisDelayPoll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+			keys := []string{q.config.Stream, q.config.Stream + redisDelayedKey}
+
+			err := redisReleaseScript.Run(context.Background(), q.client, keys,
+				time.Now().UnixMilli(), redisDelayBatch, q.config.MaxLen).Err()
+			if err != nil {
+				log.Printf("Failed to release delayed messages of Redis stream %s: %v", q.config.Stream, err)
+			}
+		}
+	}
+}
+
+// DeadLetters реализует интерфейс DeadLetterProvider.
+func (q *RedisQueue) DeadLetters() DeadLetterQueue { //nolint:ireturn // interface by design
+	return q.deadLetters
+}
+
+// MaxAttempts реализует интерфейс DeadLetterProvider.
+func (q *RedisQueue) MaxAttempts() int {
+	return defaultMaxDeliveryAttempts
+}
+
+// Stats возвращает статистику очереди по XINFO GROUPS: Pending - сообщения, еще не выданные группе (lag),
+// AckPending - выданные, но не подтвержденные. Если Redis недоступен, CurrentSize равен -1.
+func (q *RedisQueue) Stats() Stats {
+	stats := Stats{
+		TotalEnqueued: atomic.LoadInt64(&q.totalEnqueued),
+		TotalDequeued: atomic.LoadInt64(&q.totalDequeued),
+		CurrentSize:   -1,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisStatsTimeout)
+	defer cancel()
+
+	groups, err := q.client.XInfoGroups(ctx, q.config.Stream).Result()
+	if err != nil {
+		return stats
+	}
+
+	for _, group := range groups {
+		if group.Name != q.config.Group {
+			continue
+		}
+
+		stats.Pending = max(group.Lag, 0)
+		stats.AckPending = group.Pending
+		stats.CurrentSize = int(stats.Pending + stats.AckPending)
+	}
+
+	if delayed, err := q.client.ZCard(ctx, q.config.Stream+redisDelayedKey).Result(); err == nil {
+		stats.DelayedSize = int(delayed)
+	}
+
+	return stats
+}
+
+// Close останавливает подписки и перенос отложенных сообщений, затем закрывает подключение.
+func (q *RedisQueue) Close() error {
+	var err error
+
+	q.closeOnce.Do(func() {
+		close(q.done)
+		q.wg.Wait()
+
+		if closeErr := q.client.Close(); closeErr != nil {
+			err = fmt.Errorf("%w: %w", ErrRedisQueueClose, closeErr)
+		}
+	})
+
+	return err
+}
+
+// redisDelivery - доставка сообщения stream'а; до подтверждения оно числится в pending-списке группы.
+type redisDelivery struct {
+	deliveryState
+
+	queue *RedisQueue
+	id    string
+	entry redisEntry
+	msg   *models.DataMessage
+}
+
+// Message реализует интерфейс Delivery.
+func (d *redisDelivery) Message() *models.DataMessage {
+	return d.msg
+}
+
+// Attempt реализует интерфейс Delivery.
+func (d *redisDelivery) Attempt() int {
+	return d.entry.attempt
+}
+
+// Ack реализует интерфейс Delivery.
+func (d *redisDelivery) Ack() error {
+	if err := d.settle(); err != nil {
+		return err
+	}
+
+	return d.ack()
+}
+
+func (d *redisDelivery) ack() error {
+	q := d.queue
+
+	if err := q.client.XAck(context.Background(), q.config.Stream, q.config.Group, d.id).Err(); err != nil {
+		return fmt.Errorf("failed to ack message: %w", err)
+	}
+
+	return nil
+}
+
+// Nack реализует интерфейс Delivery: копия сообщения со следующим номером попытки
+// добавляется в stream (или в отложенные при delay > 0) в одной транзакции с XACK исходного.
+func (d *redisDelivery) Nack(delay time.Duration) error {
+	if err := d.settle(); err != nil {
+		return err
+	}
+
+	q := d.queue
+	ctx := context.Background()
+
+	retry := d.entry
+	retry.attempt++
+
+	if _, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		q.add(ctx, pipe, retry, delay)
+		pipe.XAck(ctx, q.config.Stream, q.config.Group, d.id)
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to nack message: %w", err)
+	}
+
+	return nil
+}
+
+// InProgress реализует интерфейс Delivery: XCLAIM на себя сбрасывает время простоя,
+// и сообщение не забирается другими потребителями через XAUTOCLAIM.
+func (d *redisDelivery) InProgress() error {
+	q := d.queue
+
+	err := q.client.XClaimJustID(context.Background(), &redis.XClaimArgs{
+		Stream:   q.config.Stream,
+		Group:    q.config.Group,
+		Consumer: q.config.Consumer,
+		Messages: []string{d.id},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to mark message in progress: %w", err)
+	}
+
+	return nil
+}
+
+// Term реализует интерфейс Delivery.
+func (d *redisDelivery) Term() error {
+	if err := d.settle(); err != nil {
+		return err
+	}
+
+	return d.ack()
+}
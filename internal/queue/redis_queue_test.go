@@ -0,0 +1,192 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func newTestRedisQueue(t *testing.T, addr, consumer string) *RedisQueue {
+	t.Helper()
+
+	q, err := NewRedisQueue(RedisConfig{
+		Addr:      addr,
+		Stream:    "messages",
+		Group:     "processors",
+		Consumer:  consumer,
+		ClaimIdle: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Redis queue: %v", err)
+	}
+
+	t.Cleanup(func() { q.Close() })
+
+	return q
+}
+
+func receive(ctx context.Context, t *testing.T, deliveries <-chan Delivery, id string) Delivery {
+	t.Helper()
+
+	select {
+	case delivery := <-deliveries:
+		if delivery.Message().GetId() != id {
+			t.Fatalf("Expected message %s, got %s", id, delivery.Message().GetId())
+		}
+
+		return delivery
+	case <-ctx.Done():
+		t.Fatalf("Timeout waiting for message %s", id)
+
+		return nil
+	}
+}
+
+func TestRedisQueue_PublishSubscribeAck(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	q := newTestRedisQueue(t, miniredis.RunT(t).Addr(), "a")
+
+	if errs := q.PublishBatch(ctx, batchOf(2)); errs[0] != nil || errs[1] != nil {
+		t.Fatalf("Failed to publish batch: %v", errs)
+	}
+
+	deliveries, err := q.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	first := receive(ctx, t, deliveries, "0")
+	second := receive(ctx, t, deliveries, "1")
+
+	if stats := q.Stats(); stats.AckPending != 2 || stats.TotalEnqueued != 2 {
+		t.Errorf("Expected 2 unacknowledged of 2 enqueued messages, got %+v", stats)
+	}
+
+	if first.Attempt() != 1 {
+		t.Errorf("Expected first attempt, got %d", first.Attempt())
+	}
+
+	_ = first.Ack()
+	_ = second.Term()
+
+	if stats := q.Stats(); stats.AckPending != 0 {
+		t.Errorf("Expected no unacknowledged messages, got %d", stats.AckPending)
+	}
+
+	if err := first.Ack(); !errors.Is(err, ErrDeliverySettled) {
+		t.Errorf("Expected ErrDeliverySettled, got %v", err)
+	}
+}
+
+func TestRedisQueue_ClaimsStuckMessages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addr := miniredis.RunT(t).Addr()
+	crashed := newTestRedisQueue(t, addr, "crashed")
+
+	if err := crashed.Publish(ctx, &models.DataMessage{Id: "stuck"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	crashedCtx, stop := context.WithCancel(ctx)
+
+	deliveries, err := crashed.Subscribe(crashedCtx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	// Потребитель получает сообщение и пропадает, не подтвердив его.
+	receive(ctx, t, deliveries, "stuck")
+	stop()
+	time.Sleep(50 * time.Millisecond)
+
+	survivor := newTestRedisQueue(t, addr, "survivor")
+
+	deliveries, err = survivor.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	delivery := receive(ctx, t, deliveries, "stuck")
+	if delivery.Attempt() != 2 {
+		t.Errorf("Expected claimed message on attempt 2, got %d", delivery.Attempt())
+	}
+
+	if err := delivery.Ack(); err != nil {
+		t.Errorf("Failed to ack claimed message: %v", err)
+	}
+}
+
+func TestRedisQueue_NackWithDelay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	q := newTestRedisQueue(t, miniredis.RunT(t).Addr(), "a")
+
+	if err := q.Publish(ctx, &models.DataMessage{Id: "retry", Payload: []byte{0, '|', 0xff}}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	deliveries, err := q.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	if err := receive(ctx, t, deliveries, "retry").Nack(200 * time.Millisecond); err != nil {
+		t.Fatalf("Failed to nack: %v", err)
+	}
+
+	if stats := q.Stats(); stats.DelayedSize != 1 || stats.AckPending != 0 {
+		t.Errorf("Expected 1 delayed and no unacknowledged messages, got %+v", stats)
+	}
+
+	delivery := receive(ctx, t, deliveries, "retry")
+	if delivery.Attempt() != 2 {
+		t.Errorf("Expected attempt 2, got %d", delivery.Attempt())
+	}
+
+	if string(delivery.Message().GetPayload()) != string([]byte{0, '|', 0xff}) {
+		t.Errorf("Payload corrupted after delay: %v", delivery.Message().GetPayload())
+	}
+}
+
+func TestRedisDeadLetterQueue(t *testing.T) {
+	ctx := context.Background()
+
+	q := newTestRedisQueue(t, miniredis.RunT(t).Addr(), "a")
+	dlq := q.DeadLetters()
+
+	dl := &DeadLetter{Message: &models.DataMessage{Id: "poison"}, LastError: "boom", Attempts: 3}
+	if err := dlq.Put(ctx, dl); err != nil {
+		t.Fatalf("Failed to put dead letter: %v", err)
+	}
+
+	entries, err := dlq.List(ctx, 0)
+	if err != nil || len(entries) != 1 || entries[0].ID != dl.ID {
+		t.Fatalf("Expected dead letter %s, got %v (%v)", dl.ID, entries, err)
+	}
+
+	got, err := dlq.Get(ctx, dl.ID)
+	if err != nil || got.Message.GetId() != "poison" || got.LastError != "boom" {
+		t.Fatalf("Unexpected dead letter %+v (%v)", got, err)
+	}
+
+	if err := dlq.Delete(ctx, dl.ID); err != nil {
+		t.Fatalf("Failed to delete dead letter: %v", err)
+	}
+
+	if _, err := dlq.Get(ctx, dl.ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Expected ErrDeadLetterNotFound, got %v", err)
+	}
+
+	if err := dlq.Delete(ctx, "not-an-id"); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Expected ErrDeadLetterNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/config"
+)
+
+var ErrInvalidProviderOption = errors.New("invalid provider option")
+
+// ProviderConstructor creates a provider registered under a name.
+type ProviderConstructor func(opts ProviderOptions) (Provider, error)
+
+// ProviderOptions are passed to a provider constructor.
+type ProviderOptions struct {
+	// Name is the registered name the provider is created under.
+	Name ProviderType
+	// Config is the service configuration.
+	Config *config.Config
+	// Member reports that the provider is created as a member of a composite provider.
+	Member bool
+
+	factory *Factory
+}
+
+// WireFormat resolves the configured codec and compression, for providers that serialize messages.
+func (o ProviderOptions) WireFormat() (Codec, CompressionConfig, error) { //nolint:ireturn // registry returns interface
+	return o.factory.wireFormat()
+}
+
+// String returns the provider option key, set as "<name>.<key>=value" in QUEUE_PROVIDER_OPTIONS.
+func (o ProviderOptions) String(key, defaultValue string) string {
+	if value, ok := o.Config.QueueProviderOptions[string(o.Name)+"."+key]; ok {
+		return value
+	}
+
+	return defaultValue
+}
+
+// Int returns the provider option key parsed as an integer.
+func (o ProviderOptions) Int(key string, defaultValue int) (int, error) {
+	return parseProviderOption(o, key, defaultValue, strconv.Atoi)
+}
+
+// Duration returns the provider option key parsed by time.ParseDuration.
+func (o ProviderOptions) Duration(key string, defaultValue time.Duration) (time.Duration, error) {
+	return parseProviderOption(o, key, defaultValue, time.ParseDuration)
+}
+
+// Bool returns the provider option key parsed by strconv.ParseBool.
+func (o ProviderOptions) Bool(key string, defaultValue bool) (bool, error) {
+	return parseProviderOption(o, key, defaultValue, strconv.ParseBool)
+}
+
+// parseProviderOption parses a provider option; unset options return the default.
+func parseProviderOption[T any](o ProviderOptions, key string, defaultValue T, parse func(string) (T, error)) (T, error) {
+	raw, ok := o.Config.QueueProviderOptions[string(o.Name)+"."+key]
+	if !ok {
+		return defaultValue, nil
+	}
+
+	value, err := parse(raw)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%w: %s.%s=%q: %w", ErrInvalidProviderOption, o.Name, key, raw, err)
+	}
+
+	return value, nil
+}
+
+//nolint:gochecknoglobals // registry of providers shared by all factories
+var providers = struct {
+	sync.RWMutex
+	byName map[ProviderType]ProviderConstructor
+}{
+	byName: make(map[ProviderType]ProviderConstructor),
+}
+
+// Register adds a provider constructor to the registry.
+// Providers from other packages register in init, so QUEUE_TYPE and COMPOSITE_PROVIDERS can refer to them.
+// Like database/sql.Register, it panics if constructor is nil or the name is already registered,
+// including the names of built-in providers.
+func Register(name ProviderType, constructor ProviderConstructor) {
+	providers.Lock()
+	defer providers.Unlock()
+
+	if constructor == nil {
+		panic("queue: Register constructor is nil")
+	}
+
+	if _, dup := providers.byName[name]; dup {
+		panic("queue: Register called twice for provider " + string(name))
+	}
+
+	providers.byName[name] = constructor
+}
+
+// lookupProvider returns the constructor registered under name.
+func lookupProvider(name ProviderType) (ProviderConstructor, error) {
+	providers.RLock()
+	defer providers.RUnlock()
+
+	constructor, ok := providers.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s. Supported types: %v", ErrUnsupportedQueueType, name, providerNamesLocked())
+	}
+
+	return constructor, nil
+}
+
+// ProviderNames returns the names of registered providers.
+func ProviderNames() []string {
+	providers.RLock()
+	defer providers.RUnlock()
+
+	return providerNamesLocked()
+}
+
+func providerNamesLocked() []string {
+	names := make([]string, 0, len(providers.byName))
+	for name := range providers.byName {
+		names = append(names, string(name))
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// registerBuiltin registers a provider created by a Factory method.
+func registerBuiltin(name ProviderType, create func(f *Factory) (Provider, error)) {
+	Register(name, func(opts ProviderOptions) (Provider, error) {
+		return create(opts.factory)
+	})
+}
+
+//nolint:gochecknoinits // built-in providers are registered the same way as third-party ones
+func init() {
+	builtins := map[ProviderType]func(f *Factory) (Provider, error){
+		MemoryProviderType:       (*Factory).createMemoryProvider,
+		OptimizedProviderType:    (*Factory).createOptimizedProvider,
+		RingProviderType:         (*Factory).createRingProvider,
+		ShardedProviderType:      (*Factory).createShardedProvider,
+		PriorityProviderType:     (*Factory).createPriorityProvider,
+		NATSProviderType:         (*Factory).createNATSProvider,
+		NATSEmbeddedProviderType: (*Factory).createNATSEmbeddedProvider,
+		KafkaProviderType:        (*Factory).createKafkaProvider,
+		RedisProviderType:        (*Factory).createRedisProvider,
+		WALProviderType:          (*Factory).createWALProvider,
+		CompositeProviderType:    (*Factory).createCompositeProvider,
+	}
+
+	for name, create := range builtins {
+		registerBuiltin(name, create)
+	}
+}
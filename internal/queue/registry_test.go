@@ -0,0 +1,228 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/config"
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+const testProviderType ProviderType = "test-registry"
+
+// testProvider - сторонний провайдер поверх MemoryAdapter; запоминает опции, с которыми создан.
+type testProvider struct {
+	*MemoryAdapter
+
+	opts ProviderOptions
+}
+
+func registerTestProvider(t *testing.T) {
+	t.Helper()
+
+	Register(testProviderType, func(opts ProviderOptions) (Provider, error) {
+		size, err := opts.Int("size", 10)
+		if err != nil {
+			return nil, err
+		}
+
+		return &testProvider{MemoryAdapter: NewMemoryAdapter(size), opts: opts}, nil
+	})
+
+	t.Cleanup(func() {
+		providers.Lock()
+		delete(providers.byName, testProviderType)
+		providers.Unlock()
+	})
+}
+
+func TestRegistry_CreatesRegisteredProvider(t *testing.T) {
+	registerTestProvider(t)
+
+	if err := ValidateProviderType(string(testProviderType)); err != nil {
+		t.Fatalf("Expected registered provider to be valid, got %v", err)
+	}
+
+	cfg := &config.Config{
+		QueueType:            string(testProviderType),
+		QueueProviderOptions: map[string]string{"test-registry.size": "1"},
+	}
+
+	provider, err := NewFactory(cfg).CreateProvider()
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	defer provider.Close()
+
+	custom, ok := provider.(*testProvider)
+	if !ok {
+		t.Fatalf("Expected *testProvider, got %T", provider)
+	}
+
+	if custom.opts.Name != testProviderType || custom.opts.Member || custom.opts.Config != cfg {
+		t.Errorf("Unexpected provider options: %+v", custom.opts)
+	}
+
+	ctx := context.Background()
+	_ = provider.Publish(ctx, &models.DataMessage{Id: "1"})
+
+	if err := provider.Publish(ctx, &models.DataMessage{Id: "2"}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected queue size from provider options, got %v", err)
+	}
+}
+
+func TestRegistry_CompositeMember(t *testing.T) {
+	registerTestProvider(t)
+
+	cfg := &config.Config{
+		QueueType:          string(CompositeProviderType),
+		QueueSize:          10,
+		CompositeProviders: []string{string(MemoryProviderType), string(testProviderType)},
+		CompositeStrategy:  "fail-fast",
+	}
+
+	provider, err := NewFactory(cfg).CreateProvider()
+	if err != nil {
+		t.Fatalf("Failed to create composite provider: %v", err)
+	}
+	defer provider.Close()
+
+	composite, ok := provider.(*CompositeAdapter)
+	if !ok {
+		t.Fatalf("Expected *CompositeAdapter, got %T", provider)
+	}
+
+	member, ok := composite.providers[1].(*testProvider)
+	if !ok || !member.opts.Member {
+		t.Fatalf("Expected registered provider as composite member, got %T", composite.providers[1])
+	}
+
+	cfg.CompositeProviders = []string{string(CompositeProviderType)}
+	if _, err := NewFactory(cfg).CreateProvider(); !errors.Is(err, ErrUnsupportedQueueType) {
+		t.Errorf("Expected nested composite to be rejected, got %v", err)
+	}
+}
+
+func TestRegistry_RegisterPanicsOnDuplicate(t *testing.T) {
+	registerTestProvider(t)
+
+	errReplaced := errors.New("replaced constructor")
+	constructor := func(ProviderOptions) (Provider, error) { return nil, errReplaced }
+
+	for _, name := range []ProviderType{testProviderType, MemoryProviderType} {
+		t.Run(string(name), func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected Register to panic for duplicate provider %s", name)
+				}
+			}()
+
+			Register(name, constructor)
+		})
+	}
+
+	// Встроенный провайдер не подменен.
+	provider, err := NewFactory(&config.Config{QueueType: string(MemoryProviderType), QueueSize: 1}).CreateProvider()
+	if err != nil {
+		t.Fatalf("Expected built-in memory provider, got %v", err)
+	}
+
+	provider.Close()
+}
+
+func TestRegistry_RegisterPanicsOnNilConstructor(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected Register to panic for nil constructor")
+		}
+	}()
+
+	Register("test-nil", nil)
+}
+
+func TestRegistry_CompositeClosesCreatedMembersOnError(t *testing.T) {
+	var created []*MemoryAdapter
+
+	Register(testProviderType, func(ProviderOptions) (Provider, error) {
+		adapter := NewMemoryAdapter(1)
+		created = append(created, adapter)
+
+		return adapter, nil
+	})
+
+	t.Cleanup(func() {
+		providers.Lock()
+		delete(providers.byName, testProviderType)
+		providers.Unlock()
+	})
+
+	cfg := &config.Config{
+		QueueType:          string(CompositeProviderType),
+		CompositeProviders: []string{string(testProviderType), "missing"},
+		CompositeStrategy:  "fail-fast",
+	}
+
+	if _, err := NewFactory(cfg).CreateProvider(); !errors.Is(err, ErrUnsupportedQueueType) {
+		t.Fatalf("Expected ErrUnsupportedQueueType, got %v", err)
+	}
+
+	if len(created) != 1 {
+		t.Fatalf("Expected 1 created member, got %d", len(created))
+	}
+
+	if err := created[0].Publish(context.Background(), &models.DataMessage{Id: "late"}); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Expected created member to be closed, got %v", err)
+	}
+}
+
+func TestRegistry_UnknownProvider(t *testing.T) {
+	if err := ValidateProviderType("unknown"); !errors.Is(err, ErrUnsupportedQueueType) {
+		t.Errorf("Expected ErrUnsupportedQueueType, got %v", err)
+	}
+
+	cfg := &config.Config{QueueType: "unknown"}
+	if _, err := NewFactory(cfg).CreateProvider(); !errors.Is(err, ErrUnsupportedQueueType) {
+		t.Errorf("Expected ErrUnsupportedQueueType, got %v", err)
+	}
+
+	for _, name := range []ProviderType{MemoryProviderType, KafkaProviderType, CompositeProviderType} {
+		if err := ValidateProviderType(string(name)); err != nil {
+			t.Errorf("Expected built-in provider %s to be registered, got %v", name, err)
+		}
+	}
+}
+
+func TestProviderOptions_TypedValues(t *testing.T) {
+	opts := ProviderOptions{
+		Name: testProviderType,
+		Config: &config.Config{QueueProviderOptions: map[string]string{
+			"test-registry.bucket":  "events",
+			"test-registry.timeout": "250ms",
+			"test-registry.tls":     "true",
+			"test-registry.retries": "many",
+			"other.bucket":          "ignored",
+		}},
+	}
+
+	if got := opts.String("bucket", ""); got != "events" {
+		t.Errorf("Expected bucket events, got %q", got)
+	}
+
+	if got := opts.String("region", "local"); got != "local" {
+		t.Errorf("Expected default region, got %q", got)
+	}
+
+	if got, err := opts.Duration("timeout", time.Second); err != nil || got != 250*time.Millisecond {
+		t.Errorf("Expected timeout 250ms, got %v (%v)", got, err)
+	}
+
+	if got, err := opts.Bool("tls", false); err != nil || !got {
+		t.Errorf("Expected tls true, got %v (%v)", got, err)
+	}
+
+	if _, err := opts.Int("retries", 3); !errors.Is(err, ErrInvalidProviderOption) {
+		t.Errorf("Expected ErrInvalidProviderOption, got %v", err)
+	}
+}
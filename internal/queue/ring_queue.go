@@ -0,0 +1,390 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+const (
+	// ringSpinIterations - сколько попыток извлечения с runtime.Gosched делает потребитель перед парковкой.
+	ringSpinIterations = 64
+	// ringDequeueBatchSize - сколько сообщений Subscribe извлекает за один вызов DequeueBatch.
+	ringDequeueBatchSize = 64
+	ringMinCapacity      = 2
+	cacheLineSize        = 64
+)
+
+// ringSlot - ячейка кольцевого буфера. seq определяет, чья очередь работать с ячейкой:
+// seq == pos - ячейка свободна для записи позиции pos, seq == pos+1 - в ней сообщение позиции pos.
+type ringSlot struct {
+	seq atomic.Uint64
+	msg *models.DataMessage
+}
+
+// RingQueue - ограниченная lock-free MPMC очередь на кольцевом буфере (алгоритм Д. Вьюкова).
+// Enqueue и Dequeue не берут мьютексов: позиции записи и чтения сдвигаются через CAS, статистика атомарная.
+// Потребитель без сообщений сначала крутится (spin с runtime.Gosched), затем паркуется до сигнала производителя.
+type RingQueue struct {
+	_    [cacheLineSize]byte
+	tail atomic.Uint64 // позиция следующей записи
+	_    [cacheLineSize - 8]byte
+	head atomic.Uint64 // позиция следующего чтения
+	_    [cacheLineSize - 8]byte
+
+	slots []ringSlot
+	mask  uint64
+
+	waiters atomic.Int32  // число припаркованных потребителей
+	notify  chan struct{} // сигнал припаркованным потребителям, емкость 1
+	closed  atomic.Bool
+	done    chan struct{}
+	once    sync.Once
+
+	enqueued atomic.Int64
+	dequeued atomic.Int64
+
+	attempts    attemptTracker
+	delayed     *delayScheduler
+	deadLetters *MemoryDeadLetterQueue
+}
+
+// NewRingQueue создает очередь емкостью не меньше size (округляется вверх до степени двойки).
+func NewRingQueue(size int) *RingQueue {
+	capacity := uint64(max(size, ringMinCapacity))
+	capacity = 1 << bits.Len64(capacity-1)
+
+	q := &RingQueue{
+		slots:       make([]ringSlot, capacity),
+		mask:        capacity - 1,
+		notify:      make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		deadLetters: NewMemoryDeadLetterQueue(memoryDeadLetterQueueSize),
+	}
+
+	for i := range q.slots {
+		q.slots[i].seq.Store(uint64(i))
+	}
+
+	q.delayed = newDelayScheduler(q.releaseDelayed)
+
+	return q
+}
+
+// Cap возвращает емкость кольцевого буфера.
+func (q *RingQueue) Cap() int {
+	return len(q.slots)
+}
+
+// Publish реализует интерфейс Publisher.
+func (q *RingQueue) Publish(ctx context.Context, msg *models.DataMessage) error {
+	return q.Enqueue(ctx, msg)
+}
+
+// PublishBatch реализует интерфейс BatchPublisher.
+func (q *RingQueue) PublishBatch(ctx context.Context, msgs []*models.DataMessage) []error {
+	errs := make([]error, len(msgs))
+
+	for i, msg := range msgs {
+		errs[i] = q.Enqueue(ctx, msg)
+	}
+
+	return errs
+}
+
+// Enqueue добавляет сообщение в очередь (неблокирующий); при заполненном буфере возвращает ErrQueueFull.
+// Сообщение с deliver_at в будущем попадает в буфер только в момент доставки.
+func (q *RingQueue) Enqueue(ctx context.Context, msg *models.DataMessage) error {
+	if delay := deliveryDelay(msg); delay > 0 {
+		return q.enqueueDelayed(msg, delay)
+	}
+
+	if q.closed.Load() {
+		return ErrQueueClosed
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("enqueue canceled: %w", err)
+	}
+
+	if !q.tryEnqueue(msg) {
+		return ErrQueueFull
+	}
+
+	q.enqueued.Add(1)
+
+	if q.waiters.Load() > 0 {
+		q.wake()
+	}
+
+	return nil
+}
+
+// tryEnqueue занимает позицию записи и публикует сообщение в ячейке.
+func (q *RingQueue) tryEnqueue(msg *models.DataMessage) bool {
+	pos := q.tail.Load()
+
+	for {
+		slot := &q.slots[pos&q.mask]
+		diff := int64(slot.seq.Load() - pos) //nolint:gosec // разность позиций укладывается в int64
+
+		switch {
+		case diff == 0:
+			if q.tail.CompareAndSwap(pos, pos+1) {
+				slot.msg = msg
+				slot.seq.Store(pos + 1)
+
+				return true
+			}
+
+			pos = q.tail.Load()
+		case diff < 0:
+			// Ячейка еще не прочитана с прошлого круга - буфер заполнен.
+			return false
+		default:
+			pos = q.tail.Load()
+		}
+	}
+}
+
+// tryDequeue занимает позицию чтения и забирает сообщение из ячейки.
+func (q *RingQueue) tryDequeue() (*models.DataMessage, bool) {
+	pos := q.head.Load()
+
+	for {
+		slot := &q.slots[pos&q.mask]
+		diff := int64(slot.seq.Load() - (pos + 1)) //nolint:gosec // разность позиций укладывается в int64
+
+		switch {
+		case diff == 0:
+			if q.head.CompareAndSwap(pos, pos+1) {
+				msg := slot.msg
+				slot.msg = nil
+				slot.seq.Store(pos + q.mask + 1)
+
+				return msg, true
+			}
+
+			pos = q.head.Load()
+		case diff < 0:
+			// Запись в ячейку еще не опубликована - буфер пуст.
+			return nil, false
+		default:
+			pos = q.head.Load()
+		}
+	}
+}
+
+// enqueueDelayed откладывает сообщение. Отложенных сообщений не больше емкости очереди.
+func (q *RingQueue) enqueueDelayed(msg *models.DataMessage, delay time.Duration) error {
+	if q.closed.Load() {
+		return ErrQueueClosed
+	}
+
+	if q.delayed.len() >= len(q.slots) {
+		return ErrQueueFull
+	}
+
+	q.delayed.schedule(msg, time.Now().Add(delay))
+
+	return nil
+}
+
+// releaseDelayed переносит созревшее сообщение в очередь.
+func (q *RingQueue) releaseDelayed(msg *models.DataMessage) error {
+	return q.Enqueue(context.Background(), msg)
+}
+
+// requeue возвращает сообщение в очередь после Nack.
+func (q *RingQueue) requeue(msg *models.DataMessage, attempt int) error {
+	q.attempts.requeued(msg, attempt)
+
+	if err := q.Enqueue(context.Background(), msg); err != nil {
+		q.attempts.next(msg)
+
+		return err
+	}
+
+	return nil
+}
+
+// Dequeue извлекает сообщение из очереди (блокирующий).
+// После Close оставшиеся сообщения еще выдаются, затем возвращается ErrQueueClosed.
+func (q *RingQueue) Dequeue(ctx context.Context) (*models.DataMessage, error) {
+	var buf [1]*models.DataMessage
+
+	if _, err := q.DequeueBatch(ctx, buf[:]); err != nil {
+		return nil, err
+	}
+
+	return buf[0], nil
+}
+
+// DequeueBatch ждет хотя бы одно сообщение и забирает в buf сколько есть, но не больше len(buf).
+// Возвращает число извлеченных сообщений.
+func (q *RingQueue) DequeueBatch(ctx context.Context, buf []*models.DataMessage) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, fmt.Errorf("dequeue canceled: %w", err)
+		}
+
+		for range ringSpinIterations {
+			if n := q.drain(buf); n > 0 {
+				return n, nil
+			}
+
+			if q.closed.Load() {
+				// Повторная попытка: сообщение могло быть записано до закрытия.
+				if n := q.drain(buf); n > 0 {
+					return n, nil
+				}
+
+				return 0, ErrQueueClosed
+			}
+
+			runtime.Gosched()
+		}
+
+		if err := q.park(ctx); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// drain забирает в buf доступные сообщения и будит следующего потребителя, если сообщения остались.
+func (q *RingQueue) drain(buf []*models.DataMessage) int {
+	n := 0
+
+	for n < len(buf) {
+		msg, ok := q.tryDequeue()
+		if !ok {
+			break
+		}
+
+		buf[n] = msg
+		n++
+	}
+
+	if n > 0 {
+		q.dequeued.Add(int64(n))
+
+		if q.waiters.Load() > 0 && q.size() > 0 {
+			q.wake()
+		}
+	}
+
+	return n
+}
+
+// park усыпляет потребителя до сигнала производителя, закрытия очереди или отмены контекста.
+// Счетчик waiters увеличивается до повторной проверки буфера, поэтому сигнал не теряется:
+// производитель либо увидит waiters > 0, либо его сообщение увидит повторная проверка.
+func (q *RingQueue) park(ctx context.Context) error {
+	q.waiters.Add(1)
+	defer q.waiters.Add(-1)
+
+	if q.size() > 0 || q.closed.Load() {
+		return nil
+	}
+
+	select {
+	case <-q.notify:
+		return nil
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("dequeue canceled: %w", ctx.Err())
+	}
+}
+
+// wake будит одного припаркованного потребителя; он передаст сигнал дальше, если сообщения останутся.
+func (q *RingQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// size возвращает число сообщений в буфере (с учетом занятых, но еще не опубликованных позиций).
+func (q *RingQueue) size() int {
+	head := q.head.Load()
+	tail := q.tail.Load()
+
+	if tail <= head {
+		return 0
+	}
+
+	return int(tail - head) //nolint:gosec // не больше емкости буфера
+}
+
+// Subscribe реализует интерфейс Subscriber: сообщения извлекаются пачками по ringDequeueBatchSize.
+func (q *RingQueue) Subscribe(ctx context.Context) (<-chan Delivery, error) {
+	msgChan := make(chan Delivery, memoryQueueBufferSize)
+
+	go func() {
+		defer close(msgChan)
+
+		buf := make([]*models.DataMessage, ringDequeueBatchSize)
+
+		for {
+			n, err := q.DequeueBatch(ctx, buf)
+			if err != nil {
+				return
+			}
+
+			for i, msg := range buf[:n] {
+				buf[i] = nil
+
+				select {
+				case msgChan <- newMemoryDelivery(msg, q.attempts.next(msg), q.requeue):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return msgChan, nil
+}
+
+// DeadLetters реализует интерфейс DeadLetterProvider.
+func (q *RingQueue) DeadLetters() DeadLetterQueue { //nolint:ireturn // interface by design
+	return q.deadLetters
+}
+
+// MaxAttempts реализует интерфейс DeadLetterProvider.
+func (q *RingQueue) MaxAttempts() int {
+	return defaultMaxDeliveryAttempts
+}
+
+// Stats возвращает статистику очереди без блокировок.
+func (q *RingQueue) Stats() Stats {
+	return Stats{
+		TotalEnqueued: q.enqueued.Load(),
+		TotalDequeued: q.dequeued.Load(),
+		CurrentSize:   q.size(),
+		DelayedSize:   q.delayed.len(),
+	}
+}
+
+// Close закрывает очередь: новые сообщения не принимаются, припаркованные потребители просыпаются
+// и дочитывают буфер.
+func (q *RingQueue) Close() error {
+	q.once.Do(func() {
+		q.closed.Store(true)
+		close(q.done)
+		q.delayed.close()
+	})
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func TestRingQueue_FullQueue(t *testing.T) {
+	q := NewRingQueue(3)
+	defer q.Close()
+
+	if q.Cap() != 4 {
+		t.Fatalf("Expected capacity rounded up to 4, got %d", q.Cap())
+	}
+
+	for i, msg := range batchOf(5) {
+		err := q.Enqueue(context.Background(), msg)
+
+		switch {
+		case i < 4 && err != nil:
+			t.Fatalf("Enqueue %d: expected no error, got %v", i, err)
+		case i == 4 && !errors.Is(err, ErrQueueFull):
+			t.Fatalf("Expected ErrQueueFull, got %v", err)
+		}
+	}
+
+	buf := make([]*models.DataMessage, 10)
+
+	n, err := q.DequeueBatch(context.Background(), buf)
+	if err != nil || n != 4 {
+		t.Fatalf("Expected batch of 4 messages, got %d (%v)", n, err)
+	}
+
+	for i, msg := range buf[:n] {
+		if msg.GetId() != fmt.Sprint(i) {
+			t.Errorf("Expected message %d, got %s", i, msg.GetId())
+		}
+	}
+
+	if stats := q.Stats(); stats.TotalEnqueued != 4 || stats.TotalDequeued != 4 || stats.CurrentSize != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestRingQueue_ParkedConsumersWakeUp(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const (
+		producers = 4
+		consumers = 4
+		perWorker = 2000
+	)
+
+	q := NewRingQueue(64)
+	defer q.Close()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		received = make(map[string]bool)
+	)
+
+	for range consumers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			buf := make([]*models.DataMessage, 8)
+
+			for {
+				n, err := q.DequeueBatch(ctx, buf)
+				if err != nil {
+					return
+				}
+
+				mu.Lock()
+				for _, msg := range buf[:n] {
+					if received[msg.GetId()] {
+						t.Errorf("Message %s received twice", msg.GetId())
+					}
+
+					received[msg.GetId()] = true
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// Потребители успевают припарковаться до первой публикации.
+	time.Sleep(20 * time.Millisecond)
+
+	var producersWG sync.WaitGroup
+
+	for p := range producers {
+		producersWG.Add(1)
+
+		go func() {
+			defer producersWG.Done()
+
+			for i := range perWorker {
+				msg := &models.DataMessage{Id: fmt.Sprintf("%d-%d", p, i)}
+				for errors.Is(q.Enqueue(ctx, msg), ErrQueueFull) {
+					time.Sleep(time.Microsecond)
+				}
+			}
+		}()
+	}
+
+	producersWG.Wait()
+
+	for q.Stats().TotalDequeued < producers*perWorker && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	q.Close()
+	wg.Wait()
+
+	if len(received) != producers*perWorker {
+		t.Errorf("Expected %d messages, got %d", producers*perWorker, len(received))
+	}
+}
+
+func TestRingQueue_CloseDrainsBuffer(t *testing.T) {
+	q := NewRingQueue(4)
+
+	if err := q.Enqueue(context.Background(), &models.DataMessage{Id: "last"}); err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+
+	q.Close()
+
+	if err := q.Enqueue(context.Background(), &models.DataMessage{Id: "late"}); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Expected ErrQueueClosed, got %v", err)
+	}
+
+	msg, err := q.Dequeue(context.Background())
+	if err != nil || msg.GetId() != "last" {
+		t.Fatalf("Expected buffered message after close, got %v (%v)", msg, err)
+	}
+
+	if _, err := q.Dequeue(context.Background()); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Expected ErrQueueClosed, got %v", err)
+	}
+}
+
+func TestRingQueue_SubscribeNackRedelivers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	q := NewRingQueue(8)
+	defer q.Close()
+
+	deliveries, err := q.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	if err := q.Publish(ctx, &models.DataMessage{Id: "retry"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	if err := (<-deliveries).Nack(10 * time.Millisecond); err != nil {
+		t.Fatalf("Failed to nack: %v", err)
+	}
+
+	select {
+	case delivery := <-deliveries:
+		if delivery.Message().GetId() != "retry" || delivery.Attempt() != 2 {
+			t.Errorf("Expected message retry on attempt 2, got %s on attempt %d",
+				delivery.Message().GetId(), delivery.Attempt())
+		}
+	case <-ctx.Done():
+		t.Fatal("Timeout waiting for redelivery")
+	}
+}
@@ -0,0 +1,262 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/metrics"
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+// DefaultRouteName - имя маршрута для сообщений, не подошедших ни под одно правило.
+const DefaultRouteName = "default"
+
+var (
+	ErrInvalidRoute      = errors.New("invalid route")
+	ErrDuplicateRoute    = errors.New("duplicate route name")
+	ErrRoutingFileLoad   = errors.New("failed to load routing table")
+	ErrRouterUnavailable = errors.New("router has no publisher for subject")
+)
+
+// Route - правило маршрутизации: сообщение, подходящее под все заданные условия, публикуется в Subject.
+// Незаданные условия не проверяются.
+type Route struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+
+	Source string `json:"source,omitempty"`
+	// Metadata - требуемые значения ключей метаданных; пустое значение требует только наличия ключа.
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	MinPayloadSize int               `json:"minPayloadSize,omitempty"` // байт, включительно
+	MaxPayloadSize int               `json:"maxPayloadSize,omitempty"` // байт, включительно; 0 - без ограничения
+}
+
+// matches проверяет, подходит ли сообщение под правило.
+func (r Route) matches(msg *models.DataMessage) bool {
+	if r.Source != "" && msg.GetSource() != r.Source {
+		return false
+	}
+
+	for key, want := range r.Metadata {
+		value, ok := msg.GetMetadata()[key]
+		if !ok || (want != "" && value != want) {
+			return false
+		}
+	}
+
+	size := len(msg.GetPayload())
+	if size < r.MinPayloadSize {
+		return false
+	}
+
+	return r.MaxPayloadSize == 0 || size <= r.MaxPayloadSize
+}
+
+// RoutingTable - упорядоченный список правил; сообщение уходит по первому подошедшему правилу.
+type RoutingTable struct {
+	Routes []Route `json:"routes"`
+	// Default - subject маршрута по умолчанию; пусто - основная очередь.
+	Default string `json:"default,omitempty"`
+}
+
+// LoadRoutingTable читает таблицу маршрутизации из JSON-файла и проверяет ее.
+func LoadRoutingTable(path string) (RoutingTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RoutingTable{}, fmt.Errorf("%w: %w", ErrRoutingFileLoad, err)
+	}
+
+	var table RoutingTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return RoutingTable{}, fmt.Errorf("%w: %s: %w", ErrRoutingFileLoad, path, err)
+	}
+
+	if err := table.Validate(); err != nil {
+		return RoutingTable{}, err
+	}
+
+	return table, nil
+}
+
+// Validate проверяет правила: имена уникальны, subject задан, границы размера корректны.
+func (t RoutingTable) Validate() error {
+	names := make(map[string]struct{}, len(t.Routes))
+
+	for i, route := range t.Routes {
+		switch {
+		case route.Name == "" || route.Name == DefaultRouteName:
+			return fmt.Errorf("%w: route %d: name must be set and differ from %q", ErrInvalidRoute, i, DefaultRouteName)
+		case route.Subject == "":
+			return fmt.Errorf("%w: route %s: subject is required", ErrInvalidRoute, route.Name)
+		case route.MinPayloadSize < 0 || route.MaxPayloadSize < 0:
+			return fmt.Errorf("%w: route %s: payload size bounds must not be negative", ErrInvalidRoute, route.Name)
+		case route.MaxPayloadSize > 0 && route.MinPayloadSize > route.MaxPayloadSize:
+			return fmt.Errorf("%w: route %s: minPayloadSize exceeds maxPayloadSize", ErrInvalidRoute, route.Name)
+		}
+
+		if _, ok := names[route.Name]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateRoute, route.Name)
+		}
+
+		names[route.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+// Match возвращает имя маршрута и subject для сообщения. Пустой subject означает основную очередь.
+func (t RoutingTable) Match(msg *models.DataMessage) (string, string) {
+	for _, route := range t.Routes {
+		if route.matches(msg) {
+			return route.Name, route.Subject
+		}
+	}
+
+	return DefaultRouteName, t.Default
+}
+
+// Subjects возвращает subject'ы всех маршрутов без повторов.
+func (t RoutingTable) Subjects() []string {
+	seen := make(map[string]struct{}, len(t.Routes)+1)
+	subjects := make([]string, 0, len(t.Routes)+1)
+
+	for _, subject := range append(routeSubjects(t.Routes), t.Default) {
+		if _, ok := seen[subject]; ok || subject == "" {
+			continue
+		}
+
+		seen[subject] = struct{}{}
+		subjects = append(subjects, subject)
+	}
+
+	return subjects
+}
+
+func routeSubjects(routes []Route) []string {
+	subjects := make([]string, 0, len(routes))
+	for _, route := range routes {
+		subjects = append(subjects, route.Subject)
+	}
+
+	return subjects
+}
+
+// Router публикует сообщения в subject'ы брокера по таблице маршрутизации.
+// Сообщения маршрута по умолчанию без subject уходят в fallback (основную очередь).
+type Router struct {
+	table      RoutingTable
+	fallback   Publisher
+	publishers map[string]Publisher
+}
+
+// NewRouter создает publisher'ы брокера для всех subject'ов таблицы.
+func NewRouter(table RoutingTable, broker MessageBroker, fallback Publisher) (*Router, error) {
+	if err := table.Validate(); err != nil {
+		return nil, err
+	}
+
+	publishers := make(map[string]Publisher)
+
+	for _, subject := range table.Subjects() {
+		publisher, err := broker.CreatePublisher(subject)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create publisher for subject %s: %w", subject, err)
+		}
+
+		publishers[subject] = publisher
+	}
+
+	return &Router{
+		table:      table,
+		fallback:   fallback,
+		publishers: publishers,
+	}, nil
+}
+
+// Publish реализует интерфейс Publisher.
+func (r *Router) Publish(ctx context.Context, msg *models.DataMessage) error {
+	route, subject := r.table.Match(msg)
+
+	publisher := r.publisherFor(subject)
+	if publisher == nil {
+		metrics.QueueRoutedMessagesTotal.WithLabelValues(route, "failed").Inc()
+
+		return fmt.Errorf("%w: %q (route %s)", ErrRouterUnavailable, subject, route)
+	}
+
+	if err := publisher.Publish(ctx, msg); err != nil {
+		metrics.QueueRoutedMessagesTotal.WithLabelValues(route, "failed").Inc()
+
+		return fmt.Errorf("route %s: %w", route, err)
+	}
+
+	metrics.QueueRoutedMessagesTotal.WithLabelValues(route, "routed").Inc()
+
+	return nil
+}
+
+// publisherFor возвращает publisher subject'а; пустой subject - основная очередь.
+func (r *Router) publisherFor(subject string) Publisher { //nolint:ireturn // publisher of any broker
+	if subject == "" {
+		return r.fallback
+	}
+
+	return r.publishers[subject]
+}
+
+// PublishBatch реализует интерфейс BatchPublisher: пачка делится по маршрутам,
+// и каждый subject получает свою часть одной пачкой.
+func (r *Router) PublishBatch(ctx context.Context, msgs []*models.DataMessage) []error {
+	type group struct {
+		publisher Publisher
+		subject   string
+		routes    []string
+		indexes   []int
+		msgs      []*models.DataMessage
+	}
+
+	errs := make([]error, len(msgs))
+	groups := make(map[string]*group)
+
+	for i, msg := range msgs {
+		route, subject := r.table.Match(msg)
+
+		g, ok := groups[subject]
+		if !ok {
+			g = &group{publisher: r.publisherFor(subject), subject: subject}
+			groups[subject] = g
+		}
+
+		g.routes = append(g.routes, route)
+		g.indexes = append(g.indexes, i)
+		g.msgs = append(g.msgs, msg)
+	}
+
+	for _, g := range groups {
+		var results []error
+		if g.publisher == nil {
+			results = failBatch(len(g.msgs), fmt.Errorf("%w: %q", ErrRouterUnavailable, g.subject))
+		} else {
+			results = PublishBatch(ctx, g.publisher, g.msgs)
+		}
+
+		for k, err := range results {
+			route := g.routes[k]
+
+			if err != nil {
+				metrics.QueueRoutedMessagesTotal.WithLabelValues(route, "failed").Inc()
+
+				errs[g.indexes[k]] = fmt.Errorf("route %s: %w", route, err)
+
+				continue
+			}
+
+			metrics.QueueRoutedMessagesTotal.WithLabelValues(route, "routed").Inc()
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,155 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func TestRoutingTable_Match(t *testing.T) {
+	table := RoutingTable{
+		Routes: []Route{
+			{Name: "team-a", Subject: "team-a", Source: "service-a"},
+			{Name: "priority", Subject: "urgent", Metadata: map[string]string{"priority": "high"}},
+			{Name: "tenant", Subject: "tenants", Metadata: map[string]string{"tenant": ""}},
+			{Name: "large", Subject: "bulk", MinPayloadSize: 10},
+		},
+		Default: "common",
+	}
+
+	tests := []struct {
+		name    string
+		msg     *models.DataMessage
+		route   string
+		subject string
+	}{
+		{"source", &models.DataMessage{Source: "service-a", Payload: make([]byte, 100)}, "team-a", "team-a"},
+		{"metadata value", &models.DataMessage{Metadata: map[string]string{"priority": "high"}}, "priority", "urgent"},
+		{"metadata value mismatch", &models.DataMessage{Metadata: map[string]string{"priority": "low"}},
+			DefaultRouteName, "common"},
+		{"metadata key", &models.DataMessage{Metadata: map[string]string{"tenant": "acme"}}, "tenant", "tenants"},
+		{"payload size", &models.DataMessage{Payload: make([]byte, 10)}, "large", "bulk"},
+		{"default", &models.DataMessage{Source: "service-b", Payload: make([]byte, 9)}, DefaultRouteName, "common"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route, subject := table.Match(tt.msg)
+			if route != tt.route || subject != tt.subject {
+				t.Errorf("Expected route %s/%s, got %s/%s", tt.route, tt.subject, route, subject)
+			}
+		})
+	}
+}
+
+func TestRoutingTable_Validate(t *testing.T) {
+	tests := []struct {
+		name  string
+		table RoutingTable
+		err   error
+	}{
+		{"valid", RoutingTable{Routes: []Route{{Name: "a", Subject: "a", MinPayloadSize: 1, MaxPayloadSize: 2}}}, nil},
+		{"no name", RoutingTable{Routes: []Route{{Subject: "a"}}}, ErrInvalidRoute},
+		{"default name", RoutingTable{Routes: []Route{{Name: DefaultRouteName, Subject: "a"}}}, ErrInvalidRoute},
+		{"no subject", RoutingTable{Routes: []Route{{Name: "a"}}}, ErrInvalidRoute},
+		{"bad bounds", RoutingTable{Routes: []Route{{Name: "a", Subject: "a", MinPayloadSize: 3, MaxPayloadSize: 2}}},
+			ErrInvalidRoute},
+		{"duplicate", RoutingTable{Routes: []Route{{Name: "a", Subject: "a"}, {Name: "a", Subject: "b"}}},
+			ErrDuplicateRoute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.table.Validate(); !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestLoadRoutingTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.json")
+
+	data := `{"routes": [{"name": "team-a", "subject": "team-a", "source": "service-a"}], "default": "common"}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write routing file: %v", err)
+	}
+
+	table, err := LoadRoutingTable(path)
+	if err != nil {
+		t.Fatalf("Failed to load routing table: %v", err)
+	}
+
+	if len(table.Routes) != 1 || table.Routes[0].Source != "service-a" || table.Default != "common" {
+		t.Errorf("Unexpected routing table: %+v", table)
+	}
+
+	if _, err := LoadRoutingTable(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, ErrRoutingFileLoad) {
+		t.Errorf("Expected ErrRoutingFileLoad, got %v", err)
+	}
+}
+
+func TestRouter_Publish(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	broker := NewMemoryBroker(10)
+	if err := broker.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer broker.Disconnect()
+
+	fallback := NewMemoryAdapter(10)
+	defer fallback.Close()
+
+	table := RoutingTable{Routes: []Route{{Name: "team-a", Subject: "team-a", Source: "service-a"}}}
+
+	router, err := NewRouter(table, broker, fallback)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	if err := router.Publish(ctx, &models.DataMessage{Id: "routed", Source: "service-a"}); err != nil {
+		t.Fatalf("Failed to publish routed message: %v", err)
+	}
+
+	if err := router.Publish(ctx, &models.DataMessage{Id: "default", Source: "service-b"}); err != nil {
+		t.Fatalf("Failed to publish default message: %v", err)
+	}
+
+	subscriber, err := broker.CreateSubscriber("team-a")
+	if err != nil {
+		t.Fatalf("Failed to create subscriber: %v", err)
+	}
+
+	expectDelivery(ctx, t, subscriber, "routed")
+	expectDelivery(ctx, t, fallback, "default")
+}
+
+func expectDelivery(ctx context.Context, t *testing.T, subscriber Subscriber, id string) {
+	t.Helper()
+
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	deliveries, err := subscriber.Subscribe(subCtx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	select {
+	case delivery := <-deliveries:
+		if delivery.Message().GetId() != id {
+			t.Errorf("Expected message %s, got %s", id, delivery.Message().GetId())
+		}
+
+		_ = delivery.Ack()
+	case <-ctx.Done():
+		t.Fatalf("Timeout waiting for message %s", id)
+	}
+}
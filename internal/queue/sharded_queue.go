@@ -0,0 +1,417 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+// ShardKey определяет, по какому полю сообщения выбирается шард.
+type ShardKey string
+
+const (
+	// ShardBySource - шард по DataMessage.Source: сообщения одного источника обрабатываются по порядку.
+	ShardBySource ShardKey = "source"
+	// ShardByMetadata - шард по полю метаданных MetadataKey.
+	ShardByMetadata ShardKey = "metadata"
+)
+
+const defaultShards = 8
+
+var ErrInvalidShardedConfig = errors.New("invalid sharded queue config")
+
+// ShardedConfig - настройки шардированной очереди.
+type ShardedConfig struct {
+	Shards      int      // число шардов
+	Key         ShardKey // ключ шардирования; по умолчанию ShardBySource
+	MetadataKey string   // поле метаданных для ShardByMetadata
+	ShardSize   int      // емкость каждого шарда
+}
+
+// shard - FIFO одного шарда. Сообщения шарда выдает один диспетчер, по одному за раз.
+type shard struct {
+	messages chan *models.DataMessage
+	dispatch sync.Mutex   // удерживается диспетчером: две подписки не выдают сообщения шарда одновременно
+	head     *shardItem   // сообщение, не завершенное прошлым диспетчером; выдается первым
+	held     atomic.Int64 // сообщения, извлеченные из канала, но еще не завершенные
+}
+
+// shardItem - сообщение шарда вместе с номером попытки доставки.
+type shardItem struct {
+	msg     *models.DataMessage
+	attempt int
+}
+
+// ShardedQueue - in-memory очередь из нескольких шардов с порядком внутри ключа.
+// Сообщение попадает в шард по хешу ключа (Source или поле метаданных); сообщения без ключа
+// распределяются по ID. У шарда в обработке не больше одного сообщения: следующее выдается только
+// после Ack или Term предыдущего, а Nack оставляет сообщение в голове шарда до повторной доставки.
+// Разные шарды обрабатываются параллельно.
+type ShardedQueue struct {
+	cfg    ShardedConfig
+	shards []*shard
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+
+	enqueued atomic.Int64
+	dequeued atomic.Int64
+
+	delayed     *delayScheduler
+	deadLetters *MemoryDeadLetterQueue
+}
+
+// NewShardedQueue создает шардированную очередь.
+func NewShardedQueue(cfg ShardedConfig) (*ShardedQueue, error) {
+	if cfg.Shards <= 0 {
+		cfg.Shards = defaultShards
+	}
+
+	if cfg.ShardSize <= 0 {
+		return nil, fmt.Errorf("%w: shard size must be positive", ErrInvalidShardedConfig)
+	}
+
+	switch cfg.Key {
+	case "":
+		cfg.Key = ShardBySource
+	case ShardBySource:
+	case ShardByMetadata:
+		if cfg.MetadataKey == "" {
+			return nil, fmt.Errorf("%w: metadata shard key requires a metadata field", ErrInvalidShardedConfig)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported shard key %s", ErrInvalidShardedConfig, cfg.Key)
+	}
+
+	shards := make([]*shard, cfg.Shards)
+	for i := range shards {
+		shards[i] = &shard{messages: make(chan *models.DataMessage, cfg.ShardSize)}
+	}
+
+	q := &ShardedQueue{
+		cfg:         cfg,
+		shards:      shards,
+		done:        make(chan struct{}),
+		deadLetters: NewMemoryDeadLetterQueue(memoryDeadLetterQueueSize),
+	}
+	q.delayed = newDelayScheduler(q.releaseDelayed)
+
+	return q, nil
+}
+
+// key возвращает ключ шардирования сообщения; без ключа - ID сообщения.
+func (q *ShardedQueue) key(msg *models.DataMessage) string {
+	switch q.cfg.Key {
+	case ShardByMetadata:
+		if value := msg.GetMetadata()[q.cfg.MetadataKey]; value != "" {
+			return value
+		}
+	case ShardBySource:
+		if source := msg.GetSource(); source != "" {
+			return source
+		}
+	}
+
+	return msg.GetId()
+}
+
+// ShardOf возвращает номер шарда сообщения.
+func (q *ShardedQueue) ShardOf(msg *models.DataMessage) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(q.key(msg)))
+
+	return int(hash.Sum32() % uint32(len(q.shards))) //nolint:gosec // число шардов положительно
+}
+
+// Publish реализует интерфейс Publisher.
+func (q *ShardedQueue) Publish(ctx context.Context, msg *models.DataMessage) error {
+	if delay := deliveryDelay(msg); delay > 0 {
+		return q.enqueueDelayed(msg, delay)
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return q.publishLocked(ctx, msg)
+}
+
+// PublishBatch реализует интерфейс BatchPublisher: сообщения пачки добавляются под одной блокировкой.
+func (q *ShardedQueue) PublishBatch(ctx context.Context, msgs []*models.DataMessage) []error {
+	errs := make([]error, len(msgs))
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	for i, msg := range msgs {
+		if delay := deliveryDelay(msg); delay > 0 {
+			errs[i] = q.enqueueDelayedLocked(msg, delay)
+		} else {
+			errs[i] = q.publishLocked(ctx, msg)
+		}
+	}
+
+	return errs
+}
+
+// publishLocked добавляет сообщение в его шард (неблокирующий). Вызывается под read-lock.
+func (q *ShardedQueue) publishLocked(ctx context.Context, msg *models.DataMessage) error {
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.shards[q.ShardOf(msg)].messages <- msg:
+		q.enqueued.Add(1)
+
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("enqueue canceled: %w", ctx.Err())
+	default:
+		return ErrQueueFull
+	}
+}
+
+// enqueueDelayed откладывает сообщение: в шард оно попадает в момент доставки.
+func (q *ShardedQueue) enqueueDelayed(msg *models.DataMessage, delay time.Duration) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return q.enqueueDelayedLocked(msg, delay)
+}
+
+// enqueueDelayedLocked откладывает сообщение. Отложенных сообщений не больше емкости одного шарда.
+func (q *ShardedQueue) enqueueDelayedLocked(msg *models.DataMessage, delay time.Duration) error {
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	if q.delayed.len() >= q.cfg.ShardSize {
+		return ErrQueueFull
+	}
+
+	q.delayed.schedule(msg, time.Now().Add(delay))
+
+	return nil
+}
+
+// releaseDelayed переносит созревшее сообщение в шард.
+func (q *ShardedQueue) releaseDelayed(msg *models.DataMessage) error {
+	return q.Publish(context.Background(), msg)
+}
+
+// Subscribe реализует интерфейс Subscriber: у каждого шарда свой диспетчер, который выдает
+// следующее сообщение шарда только после завершения предыдущего.
+func (q *ShardedQueue) Subscribe(ctx context.Context) (<-chan Delivery, error) {
+	msgChan := make(chan Delivery, len(q.shards))
+
+	var wg sync.WaitGroup
+
+	for _, s := range q.shards {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			q.dispatch(ctx, s, msgChan)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(msgChan)
+	}()
+
+	return msgChan, nil
+}
+
+// dispatch выдает сообщения шарда по одному до отмены контекста или закрытия очереди.
+// Сообщение, не завершенное к остановке, остается в голове шарда для следующей подписки
+// (доставка at-least-once: оно может быть выдано повторно).
+func (q *ShardedQueue) dispatch(ctx context.Context, s *shard, out chan<- Delivery) {
+	s.dispatch.Lock()
+	defer s.dispatch.Unlock()
+
+	for {
+		item := s.head
+		s.head = nil
+
+		if item == nil {
+			select {
+			case msg := <-s.messages:
+				if msg == nil {
+					return
+				}
+
+				q.dequeued.Add(1)
+				s.held.Add(1)
+
+				item = &shardItem{msg: msg, attempt: 1}
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if !q.deliver(ctx, item, out) {
+			s.head = item
+
+			return
+		}
+
+		s.held.Add(-1)
+	}
+}
+
+// deliver выдает сообщение и ждет его завершения; после Nack повторяет доставку через заданную задержку.
+// Возвращает false, если подписка или очередь остановлены до завершения сообщения.
+func (q *ShardedQueue) deliver(ctx context.Context, item *shardItem, out chan<- Delivery) bool {
+	for {
+		delivery := &shardDelivery{
+			msg:     item.msg,
+			attempt: item.attempt,
+			outcome: make(chan time.Duration, 1),
+		}
+
+		select {
+		case out <- delivery:
+		case <-ctx.Done():
+			return false
+		}
+
+		var retryDelay time.Duration
+
+		select {
+		case retryDelay = <-delivery.outcome:
+		case <-ctx.Done():
+			return false
+		}
+
+		if retryDelay < 0 {
+			return true
+		}
+
+		item.attempt++
+
+		if retryDelay > 0 && !q.wait(ctx, retryDelay) {
+			return false
+		}
+	}
+}
+
+// wait ждет delay; false - если подписка или очередь остановлены раньше.
+func (q *ShardedQueue) wait(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-q.done:
+		return false
+	}
+}
+
+// DeadLetters реализует интерфейс DeadLetterProvider.
+func (q *ShardedQueue) DeadLetters() DeadLetterQueue { //nolint:ireturn // interface by design
+	return q.deadLetters
+}
+
+// MaxAttempts реализует интерфейс DeadLetterProvider.
+func (q *ShardedQueue) MaxAttempts() int {
+	return defaultMaxDeliveryAttempts
+}
+
+// Stats возвращает статистику очереди; ShardSizes - глубина каждого шарда,
+// включая выданное, но еще не завершенное сообщение.
+func (q *ShardedQueue) Stats() Stats {
+	stats := Stats{
+		TotalEnqueued: q.enqueued.Load(),
+		TotalDequeued: q.dequeued.Load(),
+		DelayedSize:   q.delayed.len(),
+		ShardSizes:    make([]int, len(q.shards)),
+	}
+
+	for i, s := range q.shards {
+		stats.ShardSizes[i] = len(s.messages) + int(s.held.Load())
+		stats.CurrentSize += stats.ShardSizes[i]
+	}
+
+	return stats
+}
+
+// Close закрывает очередь; диспетчеры выдают оставшиеся сообщения шардов и завершаются.
+func (q *ShardedQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.done)
+
+		for _, s := range q.shards {
+			close(s.messages)
+		}
+
+		q.delayed.close()
+	}
+
+	return nil
+}
+
+// shardDelivery - доставка ShardedQueue. Завершение передается диспетчеру шарда через outcome:
+// отрицательное значение - Ack или Term, иначе задержка повторной доставки после Nack.
+type shardDelivery struct {
+	deliveryState
+
+	msg     *models.DataMessage
+	attempt int
+	outcome chan time.Duration
+}
+
+// Message реализует интерфейс Delivery.
+func (d *shardDelivery) Message() *models.DataMessage {
+	return d.msg
+}
+
+// Attempt реализует интерфейс Delivery.
+func (d *shardDelivery) Attempt() int {
+	return d.attempt
+}
+
+// Ack реализует интерфейс Delivery.
+func (d *shardDelivery) Ack() error {
+	return d.finish(-1)
+}
+
+// Nack реализует интерфейс Delivery: сообщение остается в голове шарда и выдается снова через delay.
+func (d *shardDelivery) Nack(delay time.Duration) error {
+	return d.finish(max(delay, 0))
+}
+
+// InProgress реализует интерфейс Delivery. Для in-memory очередей таймаута подтверждения нет.
+func (d *shardDelivery) InProgress() error {
+	return nil
+}
+
+// Term реализует интерфейс Delivery.
+func (d *shardDelivery) Term() error {
+	return d.finish(-1)
+}
+
+// finish завершает доставку и передает результат диспетчеру шарда.
+func (d *shardDelivery) finish(retryDelay time.Duration) error {
+	if err := d.settle(); err != nil {
+		return err
+	}
+
+	d.outcome <- retryDelay
+
+	return nil
+}
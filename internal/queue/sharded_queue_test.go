@@ -0,0 +1,220 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func newTestShardedQueue(t *testing.T, cfg ShardedConfig) *ShardedQueue {
+	t.Helper()
+
+	q, err := NewShardedQueue(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create sharded queue: %v", err)
+	}
+
+	t.Cleanup(func() { q.Close() })
+
+	return q
+}
+
+func nextShardDelivery(ctx context.Context, t *testing.T, deliveries <-chan Delivery) Delivery {
+	t.Helper()
+
+	select {
+	case delivery := <-deliveries:
+		return delivery
+	case <-ctx.Done():
+		t.Fatal("Timeout waiting for delivery")
+
+		return nil
+	}
+}
+
+func TestShardedQueue_PerKeyOrdering(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const (
+		sources   = 6
+		perSource = 50
+		workers   = 8
+	)
+
+	q := newTestShardedQueue(t, ShardedConfig{Shards: 4, ShardSize: sources * perSource})
+
+	for i := range perSource {
+		for s := range sources {
+			msg := &models.DataMessage{Id: fmt.Sprint(i), Source: fmt.Sprintf("source-%d", s)}
+			if err := q.Publish(ctx, msg); err != nil {
+				t.Fatalf("Failed to publish: %v", err)
+			}
+		}
+	}
+
+	deliveries, err := q.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	var (
+		mu        sync.Mutex
+		processed = make(map[string][]string)
+		wg        sync.WaitGroup
+	)
+
+	// Воркеры обрабатывают сообщения с разной скоростью, но порядок внутри источника сохраняется.
+	for range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for delivery := range deliveries {
+				time.Sleep(time.Duration(rand.IntN(200)) * time.Microsecond) //nolint:gosec // тестовая задержка
+
+				msg := delivery.Message()
+
+				mu.Lock()
+				processed[msg.GetSource()] = append(processed[msg.GetSource()], msg.GetId())
+				mu.Unlock()
+
+				_ = delivery.Ack()
+			}
+		}()
+	}
+
+	for q.Stats().CurrentSize > 0 && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	wg.Wait()
+
+	for source, ids := range processed {
+		if len(ids) != perSource {
+			t.Errorf("Source %s: expected %d messages, got %d", source, perSource, len(ids))
+		}
+
+		for i, id := range ids {
+			if id != fmt.Sprint(i) {
+				t.Fatalf("Source %s processed out of order: %v", source, ids)
+			}
+		}
+	}
+}
+
+func TestShardedQueue_NackKeepsMessageAtHead(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	q := newTestShardedQueue(t, ShardedConfig{Shards: 2, ShardSize: 10, Key: ShardByMetadata, MetadataKey: "tenant"})
+
+	for _, id := range []string{"first", "second"} {
+		msg := &models.DataMessage{Id: id, Metadata: map[string]string{"tenant": "acme"}}
+		if err := q.Publish(ctx, msg); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+
+	deliveries, err := q.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	if err := nextShardDelivery(ctx, t, deliveries).Nack(20 * time.Millisecond); err != nil {
+		t.Fatalf("Failed to nack: %v", err)
+	}
+
+	delivery := nextShardDelivery(ctx, t, deliveries)
+	if delivery.Message().GetId() != "first" || delivery.Attempt() != 2 {
+		t.Fatalf("Expected first on attempt 2, got %s on attempt %d", delivery.Message().GetId(), delivery.Attempt())
+	}
+
+	if stats := q.Stats(); stats.CurrentSize != 2 {
+		t.Errorf("Expected 2 messages in the shard while first is processed, got %+v", stats)
+	}
+
+	_ = delivery.Term()
+
+	if err := delivery.Ack(); !errors.Is(err, ErrDeliverySettled) {
+		t.Errorf("Expected ErrDeliverySettled, got %v", err)
+	}
+
+	if delivery := nextShardDelivery(ctx, t, deliveries); delivery.Message().GetId() != "second" {
+		t.Errorf("Expected second, got %s", delivery.Message().GetId())
+	}
+}
+
+func TestShardedQueue_ResubscribeResumesUnfinishedMessage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	q := newTestShardedQueue(t, ShardedConfig{Shards: 1, ShardSize: 10})
+
+	_ = q.Publish(ctx, &models.DataMessage{Id: "unfinished", Source: "a"})
+
+	subCtx, stop := context.WithCancel(ctx)
+
+	deliveries, err := q.Subscribe(subCtx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	nextShardDelivery(ctx, t, deliveries)
+	stop()
+
+	for range deliveries {
+	}
+
+	deliveries, err = q.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	if delivery := nextShardDelivery(ctx, t, deliveries); delivery.Message().GetId() != "unfinished" {
+		t.Errorf("Expected unfinished message to be redelivered, got %s", delivery.Message().GetId())
+	}
+}
+
+func TestShardedQueue_StatsReportShardDepth(t *testing.T) {
+	q := newTestShardedQueue(t, ShardedConfig{Shards: 3, ShardSize: 10})
+
+	msgs := []*models.DataMessage{
+		{Id: "1", Source: "a"},
+		{Id: "2", Source: "a"},
+		{Id: "3", Source: "b"},
+	}
+
+	if errs := q.PublishBatch(context.Background(), msgs); errs[0] != nil || errs[1] != nil || errs[2] != nil {
+		t.Fatalf("Failed to publish batch: %v", errs)
+	}
+
+	stats := q.Stats()
+	if len(stats.ShardSizes) != 3 || stats.CurrentSize != 3 || stats.TotalEnqueued != 3 {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+
+	if got := stats.ShardSizes[q.ShardOf(msgs[0])]; got < 2 {
+		t.Errorf("Expected both messages of source a in one shard, shard depth %d", got)
+	}
+}
+
+func TestShardedQueue_InvalidConfig(t *testing.T) {
+	for _, cfg := range []ShardedConfig{
+		{ShardSize: 0},
+		{ShardSize: 10, Key: ShardByMetadata},
+		{ShardSize: 10, Key: "id"},
+	} {
+		if _, err := NewShardedQueue(cfg); !errors.Is(err, ErrInvalidShardedConfig) {
+			t.Errorf("Config %+v: expected ErrInvalidShardedConfig, got %v", cfg, err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// walDeadLetterDir - подкаталог WAL_DIR с записями DLQ.
+	walDeadLetterDir = "dlq"
+	walDeadLetterExt = ".json"
+)
+
+// WALDeadLetterQueue - DLQ WAL-провайдера на диске: каждая запись хранится в отдельном JSON-файле
+// каталога <WAL_DIR>/dlq и переживает рестарт. При переполнении вытесняются самые старые записи.
+type WALDeadLetterQueue struct {
+	dir   string
+	fsync bool
+
+	mu       sync.Mutex
+	capacity int
+	nextID   uint64
+	entries  []*DeadLetter // в порядке ID
+}
+
+// NewWALDeadLetterQueue открывает DLQ в каталоге dir и загружает сохраненные записи.
+func NewWALDeadLetterQueue(dir string, capacity int, fsync bool) (*WALDeadLetterQueue, error) {
+	if err := os.MkdirAll(dir, walDirPerm); err != nil {
+		return nil, fmt.Errorf("failed to create WAL dead-letter directory: %w", err)
+	}
+
+	q := &WALDeadLetterQueue{
+		dir:      dir,
+		fsync:    fsync,
+		capacity: capacity,
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// load читает записи каталога; nextID продолжается с наибольшего сохраненного ID.
+func (q *WALDeadLetterQueue) load() error {
+	files, err := os.ReadDir(q.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read WAL dead-letter directory: %w", err)
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, walDeadLetterExt) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, walDeadLetterExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(q.dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to read dead letter %d: %w", id, err)
+		}
+
+		var dl DeadLetter
+		if err := json.Unmarshal(data, &dl); err != nil {
+			return fmt.Errorf("failed to unmarshal dead letter %d: %w", id, err)
+		}
+
+		dl.ID = strconv.FormatUint(id, 10)
+		q.entries = append(q.entries, &dl)
+		q.nextID = max(q.nextID, id)
+	}
+
+	sort.Slice(q.entries, func(i, j int) bool {
+		return walDeadLetterID(q.entries[i]) < walDeadLetterID(q.entries[j])
+	})
+
+	return nil
+}
+
+// Put реализует интерфейс DeadLetterQueue. Запись сохраняется на диск до возврата.
+func (q *WALDeadLetterQueue) Put(_ context.Context, dl *DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	id := q.nextID + 1
+
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+
+	if err := writeWALFile(q.path(id), data, q.fsync); err != nil {
+		return fmt.Errorf("failed to write dead letter: %w", err)
+	}
+
+	q.nextID = id
+	dl.ID = strconv.FormatUint(id, 10)
+
+	if len(q.entries) >= q.capacity {
+		log.Printf("Dead-letter queue is full, evicting message %s", q.entries[0].Message.GetId())
+
+		if err := q.remove(0); err != nil {
+			log.Printf("Failed to evict dead letter %s: %v", q.entries[0].ID, err)
+		}
+	}
+
+	q.entries = append(q.entries, dl)
+
+	return nil
+}
+
+// List реализует интерфейс DeadLetterQueue.
+func (q *WALDeadLetterQueue) List(_ context.Context, limit int) ([]*DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := len(q.entries)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+
+	result := make([]*DeadLetter, n)
+	copy(result, q.entries[:n])
+
+	return result, nil
+}
+
+// Get реализует интерфейс DeadLetterQueue.
+func (q *WALDeadLetterQueue) Get(_ context.Context, id string) (*DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, dl := range q.entries {
+		if dl.ID == id {
+			return dl, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+}
+
+// Delete реализует интерфейс DeadLetterQueue.
+func (q *WALDeadLetterQueue) Delete(_ context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, dl := range q.entries {
+		if dl.ID == id {
+			return q.remove(i)
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+}
+
+// remove удаляет i-ю запись с диска и из памяти. Вызывается под q.mu.
+func (q *WALDeadLetterQueue) remove(i int) error {
+	err := os.Remove(q.path(walDeadLetterID(q.entries[i])))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete dead letter: %w", err)
+	}
+
+	q.entries = append(q.entries[:i], q.entries[i+1:]...)
+
+	return nil
+}
+
+func (q *WALDeadLetterQueue) path(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, walDeadLetterExt))
+}
+
+// walDeadLetterID возвращает числовой ID записи; ID присваивает только WALDeadLetterQueue.
+func walDeadLetterID(dl *DeadLetter) uint64 {
+	id, _ := strconv.ParseUint(dl.ID, 10, 64)
+
+	return id
+}
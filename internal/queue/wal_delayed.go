@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+const (
+	// walDelayedDir - подкаталог WAL_DIR с записями, ожидающими deliver_at.
+	walDelayedDir = "delayed"
+	walDelayedExt = ".rec"
+)
+
+// walHeldRecord - запись, отложенная до deliver_at. path - файл записи в <WAL_DIR>/delayed;
+// пустой path - файл записать не удалось, и запись остается неподтвержденной в логе.
+type walHeldRecord struct {
+	rec  walRecord
+	path string
+}
+
+func walDelayedPath(dir string, offset uint64) string {
+	return filepath.Join(dir, walDelayedDir, fmt.Sprintf("%020d%s", offset, walDelayedExt))
+}
+
+// hold откладывает прочитанную запись до deliver_at. Запись сохраняется в отдельный файл
+// и подтверждается в логе, поэтому долгая задержка не держит checkpoint.
+func (q *WALQueue) hold(rec walRecord) {
+	deliverAt, _ := DeliverAt(rec.msg)
+	held := walHeldRecord{rec: rec, path: walDelayedPath(q.cfg.Dir, rec.offset)}
+
+	frame, err := encodeWALRecord(rec.msg, rec.attempt)
+	if err == nil {
+		err = writeWALFile(held.path, frame, q.cfg.SyncPolicy != WALSyncNone)
+	}
+
+	if err != nil {
+		log.Printf("Failed to persist delayed WAL record %d, keeping it unacknowledged: %v", rec.offset, err)
+
+		held.path = ""
+	}
+
+	q.mu.Lock()
+	q.held[rec.msg] = held
+	q.mu.Unlock()
+
+	if held.path != "" {
+		q.ack(rec.offset)
+	}
+
+	q.delayed.schedule(rec.msg, deliverAt)
+}
+
+// releaseDelayed дописывает созревшую запись в конец лога, откуда ее получат потребители.
+func (q *WALQueue) releaseDelayed(msg *models.DataMessage) error {
+	q.mu.Lock()
+	held, ok := q.held[msg]
+	delete(q.held, msg)
+	q.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	if held.path == "" {
+		if err := q.redeliver(held.rec, held.rec.attempt); err != nil {
+			q.abandon(held.rec, err)
+		}
+
+		return nil
+	}
+
+	// Если дописать не удалось, файл остается и запись будет отложена снова после рестарта.
+	if err := q.append(held.rec.msg, held.rec.attempt); err != nil {
+		return err
+	}
+
+	if err := os.Remove(held.path); err != nil {
+		log.Printf("Failed to remove delayed WAL record %s: %v", held.path, err)
+	}
+
+	return nil
+}
+
+// loadDelayed восстанавливает отложенные записи после рестарта.
+func (q *WALQueue) loadDelayed() error {
+	dir := filepath.Join(q.cfg.Dir, walDelayedDir)
+
+	if err := os.MkdirAll(dir, walDirPerm); err != nil {
+		return fmt.Errorf("failed to create WAL delayed directory: %w", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read WAL delayed directory: %w", err)
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, walDelayedExt) {
+			continue
+		}
+
+		offset, err := strconv.ParseUint(strings.TrimSuffix(name, walDelayedExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read delayed WAL record %d: %w", offset, err)
+		}
+
+		frame, err := readWALFrame(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to read delayed WAL record %d: %w", offset, err)
+		}
+
+		attempt, msg, err := decodeWALRecord(frame)
+		if err != nil {
+			return err
+		}
+
+		q.mu.Lock()
+		q.held[msg] = walHeldRecord{rec: walRecord{offset: offset, attempt: attempt, msg: msg}, path: path}
+		q.mu.Unlock()
+
+		deliverAt, ok := DeliverAt(msg)
+		if !ok {
+			deliverAt = time.Now()
+		}
+
+		q.delayed.schedule(msg, deliverAt)
+	}
+
+	return nil
+}
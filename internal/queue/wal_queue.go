@@ -0,0 +1,822 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+// WALSyncPolicy определяет, когда записи WAL сбрасываются на диск (fsync).
+type WALSyncPolicy string
+
+const (
+	// WALSyncAlways - fsync после каждой записи: максимальная надежность, минимальная скорость.
+	WALSyncAlways WALSyncPolicy = "always"
+	// WALSyncInterval - fsync фоновой горутиной раз в SyncInterval.
+	WALSyncInterval WALSyncPolicy = "interval"
+	// WALSyncNone - fsync выполняет ОС; при падении узла теряются несброшенные записи.
+	WALSyncNone WALSyncPolicy = "none"
+)
+
+const (
+	walCheckpointFile      = "consumer.offset"
+	walDeliveryBufferSize  = 100
+	defaultWALSegmentSize  = 64 << 20
+	defaultWALSyncInterval = 100 * time.Millisecond
+
+	// walReadRetryMin и walReadRetryMax ограничивают паузу перед повторным чтением после ошибки.
+	walReadRetryMin = 100 * time.Millisecond
+	walReadRetryMax = 5 * time.Second
+)
+
+var ErrUnsupportedWALSyncPolicy = errors.New("unsupported WAL sync policy")
+
+// WALConfig - настройки дискового WAL-провайдера.
+type WALConfig struct {
+	Dir            string
+	SegmentSize    int64
+	SyncPolicy     WALSyncPolicy
+	SyncInterval   time.Duration
+	RetainSegments int // сколько полностью прочитанных сегментов хранить после checkpoint'а
+}
+
+// WALQueue - очередь на основе сегментированного append-only лога на диске.
+// Offset потребителя сохраняется в checkpoint: после рестарта доставка продолжается
+// с первого неподтвержденного сообщения (at-least-once).
+type WALQueue struct {
+	cfg WALConfig
+
+	mu         sync.Mutex
+	segments   []walSegment
+	active     *os.File
+	activeSize int64
+	next       uint64        // offset следующей записи
+	dirty      bool          // есть записи без fsync
+	signal     chan struct{} // закрывается при появлении новых записей или закрытии
+
+	readFile   *os.File
+	readBuf    *bufio.Reader
+	readBase   uint64 // base сегмента, открытого для чтения
+	readOffset uint64 // offset следующей записи для чтения
+
+	inflight     map[uint64]struct{}
+	committed    uint64 // все записи ниже этого offset подтверждены
+	checkpointed uint64
+
+	// Записи с deliver_at в будущем ждут в <Dir>/delayed и по таймеру delayed дописываются в конец лога.
+	delayed *delayScheduler
+	held    map[*models.DataMessage]walHeldRecord
+
+	totalEnqueued int64
+	totalDequeued int64
+	corrupted     int64 // пропущенные поврежденные записи
+
+	closed      bool
+	done        chan struct{}
+	wg          sync.WaitGroup
+	deadLetters *WALDeadLetterQueue
+}
+
+// NewWALQueue открывает (или создает) WAL в каталоге cfg.Dir и восстанавливает состояние после падения.
+func NewWALQueue(cfg WALConfig) (*WALQueue, error) {
+	if cfg.SegmentSize <= 0 {
+		cfg.SegmentSize = defaultWALSegmentSize
+	}
+
+	if cfg.SyncInterval <= 0 {
+		cfg.SyncInterval = defaultWALSyncInterval
+	}
+
+	switch cfg.SyncPolicy {
+	case WALSyncAlways, WALSyncInterval, WALSyncNone:
+	case "":
+		cfg.SyncPolicy = WALSyncInterval
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedWALSyncPolicy, cfg.SyncPolicy)
+	}
+
+	if err := os.MkdirAll(cfg.Dir, walDirPerm); err != nil {
+		return nil, fmt.Errorf("failed to create WAL directory: %w", err)
+	}
+
+	// DLQ хранится рядом с сегментами: запись DLQ переживает рестарт, как и подтверждение (Term) оригинала.
+	deadLetters, err := NewWALDeadLetterQueue(
+		filepath.Join(cfg.Dir, walDeadLetterDir), memoryDeadLetterQueueSize, cfg.SyncPolicy != WALSyncNone)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &WALQueue{
+		cfg:         cfg,
+		signal:      make(chan struct{}),
+		inflight:    make(map[uint64]struct{}),
+		held:        make(map[*models.DataMessage]walHeldRecord),
+		done:        make(chan struct{}),
+		deadLetters: deadLetters,
+	}
+
+	q.delayed = newDelayScheduler(q.releaseDelayed)
+
+	if err := q.recover(); err != nil {
+		return nil, err
+	}
+
+	if err := q.loadDelayed(); err != nil {
+		q.delayed.close()
+		q.active.Close()
+
+		return nil, err
+	}
+
+	if cfg.SyncPolicy != WALSyncAlways {
+		q.wg.Add(1)
+
+		go q.runFlusher()
+	}
+
+	return q, nil
+}
+
+// recover открывает сегменты, обрезает оборванную запись и загружает checkpoint.
+func (q *WALQueue) recover() error {
+	segments, err := listWALSegments(q.cfg.Dir)
+	if err != nil {
+		return err
+	}
+
+	if len(segments) == 0 {
+		segments = []walSegment{{base: 0, path: walSegmentPath(q.cfg.Dir, 0)}}
+	}
+
+	last := segments[len(segments)-1]
+
+	records, size, err := q.recoverLastSegment(last)
+	if err != nil {
+		return err
+	}
+
+	active, err := os.OpenFile(last.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, walFilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to open WAL segment: %w", err)
+	}
+
+	q.segments = segments
+	q.active = active
+	q.activeSize = size
+	q.next = last.base + records
+
+	committed, ok, err := readWALCheckpoint(filepath.Join(q.cfg.Dir, walCheckpointFile))
+	if err != nil {
+		active.Close()
+
+		return err
+	}
+
+	if !ok || committed < segments[0].base {
+		committed = segments[0].base
+	}
+
+	if committed > q.next {
+		committed = q.next
+	}
+
+	q.committed = committed
+	q.checkpointed = committed
+	q.readOffset = committed
+
+	log.Printf("WAL recovered from %s: %d segments, next offset %d, committed offset %d",
+		q.cfg.Dir, len(segments), q.next, committed)
+
+	return nil
+}
+
+func (q *WALQueue) recoverLastSegment(last walSegment) (uint64, int64, error) {
+	if _, err := os.Stat(last.path); errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+
+	return recoverWALSegment(last.path)
+}
+
+// Publish реализует интерфейс Publisher: запись добавляется в конец активного сегмента.
+func (q *WALQueue) Publish(_ context.Context, msg *models.DataMessage) error {
+	return q.append(msg, 1)
+}
+
+func (q *WALQueue) append(msg *models.DataMessage, attempt int) error {
+	frame, err := encodeWALRecord(msg, attempt)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	if err := q.writeFrame(frame); err != nil {
+		return err
+	}
+
+	if err := q.syncWritten(); err != nil {
+		return err
+	}
+
+	q.notify()
+
+	return nil
+}
+
+// PublishBatch реализует интерфейс BatchPublisher: записи пачки пишутся под одной блокировкой,
+// а при политике always сегмент синхронизируется один раз на пачку.
+func (q *WALQueue) PublishBatch(_ context.Context, msgs []*models.DataMessage) []error {
+	errs := make([]error, len(msgs))
+	frames := make([][]byte, len(msgs))
+
+	for i, msg := range msgs {
+		frames[i], errs[i] = encodeWALRecord(msg, 1)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	written := make([]int, 0, len(msgs))
+
+	for i, frame := range frames {
+		if errs[i] != nil {
+			continue
+		}
+
+		if q.closed {
+			errs[i] = ErrQueueClosed
+
+			continue
+		}
+
+		if err := q.writeFrame(frame); err != nil {
+			errs[i] = err
+
+			continue
+		}
+
+		written = append(written, i)
+	}
+
+	if len(written) == 0 {
+		return errs
+	}
+
+	if err := q.syncWritten(); err != nil {
+		for _, i := range written {
+			errs[i] = err
+		}
+	}
+
+	q.notify()
+
+	return errs
+}
+
+// writeFrame дописывает запись в активный сегмент, открывая новый при переполнении. Вызывается под q.mu.
+func (q *WALQueue) writeFrame(frame []byte) error {
+	if q.activeSize >= q.cfg.SegmentSize {
+		if err := q.rollSegment(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := q.active.Write(frame); err != nil {
+		return fmt.Errorf("failed to write WAL record: %w", err)
+	}
+
+	q.activeSize += int64(len(frame))
+	q.next++
+	q.totalEnqueued++
+
+	return nil
+}
+
+// syncWritten применяет политику синхронизации к записанным записям. Вызывается под q.mu.
+func (q *WALQueue) syncWritten() error {
+	if q.cfg.SyncPolicy != WALSyncAlways {
+		q.dirty = true
+
+		return nil
+	}
+
+	if err := q.active.Sync(); err != nil {
+		return fmt.Errorf("failed to sync WAL segment: %w", err)
+	}
+
+	return nil
+}
+
+// rollSegment закрывает заполненный сегмент и начинает новый. Вызывается под q.mu.
+func (q *WALQueue) rollSegment() error {
+	if err := q.active.Sync(); err != nil {
+		return fmt.Errorf("failed to sync WAL segment: %w", err)
+	}
+
+	if err := q.active.Close(); err != nil {
+		return fmt.Errorf("failed to close WAL segment: %w", err)
+	}
+
+	segment := walSegment{base: q.next, path: walSegmentPath(q.cfg.Dir, q.next)}
+
+	active, err := os.OpenFile(segment.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, walFilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create WAL segment: %w", err)
+	}
+
+	q.segments = append(q.segments, segment)
+	q.active = active
+	q.activeSize = 0
+	q.dirty = false
+
+	return nil
+}
+
+// notify будит ожидающих читателей. Вызывается под q.mu.
+func (q *WALQueue) notify() {
+	close(q.signal)
+	q.signal = make(chan struct{})
+}
+
+// Subscribe реализует интерфейс Subscriber. Несколько подписок делят один курсор чтения.
+// Ошибка чтения не завершает подписку: чтение повторяется с экспоненциальной паузой.
+func (q *WALQueue) Subscribe(ctx context.Context) (<-chan Delivery, error) {
+	msgChan := make(chan Delivery, walDeliveryBufferSize)
+
+	go func() {
+		defer close(msgChan)
+
+		retryDelay := walReadRetryMin
+
+		for {
+			rec, wait, err := q.readNext()
+			if errors.Is(err, ErrQueueClosed) {
+				return
+			}
+
+			if err != nil {
+				log.Printf("WAL read failed, retrying in %v: %v", retryDelay, err)
+
+				select {
+				case <-time.After(retryDelay):
+					retryDelay = min(retryDelay*2, walReadRetryMax)
+
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			retryDelay = walReadRetryMin
+
+			if rec != nil && deliveryDelay(rec.msg) > 0 {
+				q.hold(*rec)
+
+				continue
+			}
+
+			if rec == nil {
+				select {
+				case <-wait:
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case msgChan <- &walDelivery{queue: q, rec: *rec}:
+			case <-ctx.Done():
+				// Запись уже отмечена как выданная: возвращаем ее в конец лога.
+				if err := q.redeliver(*rec, rec.attempt); err != nil {
+					q.abandon(*rec, err)
+				}
+
+				return
+			}
+		}
+	}()
+
+	return msgChan, nil
+}
+
+// readNext читает следующую запись. Если новых записей нет, возвращает канал ожидания.
+func (q *WALQueue) readNext() (*walRecord, <-chan struct{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil, nil, ErrQueueClosed
+	}
+
+	if q.readOffset >= q.next {
+		return nil, q.signal, nil
+	}
+
+	rec, err := q.readRecord()
+	if err != nil {
+		// Позиция читателя после ошибки не определена: следующая попытка откроет сегмент заново.
+		q.closeReader()
+
+		return nil, nil, err
+	}
+
+	if rec == nil {
+		return nil, q.signal, nil
+	}
+
+	return rec, nil, nil
+}
+
+// readRecord читает запись с offset'ом readOffset и отмечает ее выданной; nil - записи прочитаны до конца.
+// Вызывается под q.mu.
+func (q *WALQueue) readRecord() (*walRecord, error) {
+	for {
+		if q.readOffset >= q.next {
+			return nil, nil
+		}
+
+		if q.readFile == nil {
+			if err := q.openReader(); err != nil {
+				return nil, err
+			}
+		}
+
+		data, err := readWALFrame(q.readBuf)
+		if errors.Is(err, io.EOF) {
+			// Конец сегмента: следующая запись - первая в следующем сегменте.
+			q.closeReader()
+
+			if !q.hasSegment(q.readOffset) {
+				return nil, fmt.Errorf("%w: missing WAL segment for offset %d", ErrWALCorruptRecord, q.readOffset)
+			}
+
+			continue
+		}
+
+		if errors.Is(err, errWALChecksumMismatch) {
+			q.skipCorrupt(err)
+
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read WAL record %d: %w", q.readOffset, err)
+		}
+
+		attempt, msg, err := decodeWALRecord(data)
+		if err != nil {
+			q.skipCorrupt(err)
+
+			continue
+		}
+
+		rec := &walRecord{offset: q.readOffset, attempt: attempt, msg: msg}
+		q.inflight[rec.offset] = struct{}{}
+		q.readOffset++
+		q.totalDequeued++
+
+		return rec, nil
+	}
+}
+
+// skipCorrupt пропускает запись, кадр которой прочитан, но сообщение восстановить нельзя
+// (не совпал CRC или не декодируется protobuf). Запись считается подтвержденной, чтобы не держать
+// чтение следующих записей. Вызывается под q.mu.
+func (q *WALQueue) skipCorrupt(err error) {
+	log.Printf("Skipping corrupt WAL record %d: %v", q.readOffset, err)
+
+	q.readOffset++
+	q.corrupted++
+}
+
+// openReader открывает сегмент, содержащий readOffset, и пропускает предшествующие записи.
+func (q *WALQueue) openReader() error {
+	segment := q.segments[0]
+
+	for _, s := range q.segments {
+		if s.base > q.readOffset {
+			break
+		}
+
+		segment = s
+	}
+
+	file, err := os.Open(segment.path)
+	if err != nil {
+		return fmt.Errorf("failed to open WAL segment for reading: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+
+	for offset := segment.base; offset < q.readOffset; offset++ {
+		// Поврежденные записи перед readOffset уже пропущены при чтении.
+		if _, err := readWALFrame(reader); err != nil && !errors.Is(err, errWALChecksumMismatch) {
+			file.Close()
+
+			return fmt.Errorf("failed to seek WAL segment to offset %d: %w", q.readOffset, err)
+		}
+	}
+
+	q.readFile = file
+	q.readBuf = reader
+	q.readBase = segment.base
+
+	return nil
+}
+
+func (q *WALQueue) hasSegment(base uint64) bool {
+	for _, s := range q.segments {
+		if s.base == base {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (q *WALQueue) closeReader() {
+	if q.readFile != nil {
+		q.readFile.Close()
+		q.readFile = nil
+		q.readBuf = nil
+	}
+}
+
+// ack подтверждает запись и сдвигает committed offset до первой неподтвержденной записи.
+func (q *WALQueue) ack(offset uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.inflight, offset)
+
+	committed := q.readOffset
+	for pending := range q.inflight {
+		if pending < committed {
+			committed = pending
+		}
+	}
+
+	if committed <= q.committed {
+		return
+	}
+
+	q.committed = committed
+
+	if q.cfg.SyncPolicy == WALSyncAlways {
+		if err := q.checkpoint(); err != nil {
+			log.Printf("Failed to write WAL checkpoint: %v", err)
+		}
+	}
+}
+
+// redeliver дописывает копию записи в конец лога и подтверждает оригинал.
+// Если дописать не удалось, оригинал остается неподтвержденным, а ошибка возвращается вызывающему.
+func (q *WALQueue) redeliver(rec walRecord, attempt int) error {
+	if err := q.append(rec.msg, attempt); err != nil {
+		return fmt.Errorf("failed to requeue WAL record %d: %w", rec.offset, err)
+	}
+
+	q.ack(rec.offset)
+
+	return nil
+}
+
+// abandon переносит выданную запись, которую не удалось вернуть в лог, в DLQ и подтверждает ее,
+// чтобы она не держала checkpoint. Если не удалась и запись в DLQ, запись остается неподтвержденной
+// и будет доставлена после рестарта.
+func (q *WALQueue) abandon(rec walRecord, cause error) {
+	log.Printf("Moving WAL record %d to the dead-letter queue: %v", rec.offset, cause)
+
+	dl := &DeadLetter{
+		Message:   rec.msg,
+		LastError: cause.Error(),
+		Attempts:  rec.attempt,
+		FailedAt:  time.Now(),
+	}
+
+	if err := q.deadLetters.Put(context.Background(), dl); err != nil {
+		log.Printf("Failed to dead-letter WAL record %d, keeping it unacknowledged: %v", rec.offset, err)
+
+		return
+	}
+
+	q.ack(rec.offset)
+}
+
+// checkpoint сохраняет committed offset и удаляет прочитанные сегменты. Вызывается под q.mu.
+func (q *WALQueue) checkpoint() error {
+	if q.committed == q.checkpointed {
+		return nil
+	}
+
+	path := filepath.Join(q.cfg.Dir, walCheckpointFile)
+	if err := writeWALCheckpoint(path, q.committed, q.cfg.SyncPolicy != WALSyncNone); err != nil {
+		return err
+	}
+
+	q.checkpointed = q.committed
+	q.applyRetention()
+
+	return nil
+}
+
+// applyRetention удаляет сегменты, все записи которых ниже checkpoint'а,
+// оставляя cfg.RetainSegments последних из них. Активный сегмент не удаляется.
+func (q *WALQueue) applyRetention() {
+	consumed := 0
+	for i := 0; i+1 < len(q.segments) && q.segments[i+1].base <= q.checkpointed; i++ {
+		consumed++
+	}
+
+	removable := consumed - q.cfg.RetainSegments
+	if removable <= 0 {
+		return
+	}
+
+	for _, segment := range q.segments[:removable] {
+		if segment.base == q.readBase {
+			q.closeReader()
+		}
+
+		if err := os.Remove(segment.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove WAL segment %s: %v", segment.path, err)
+		}
+	}
+
+	q.segments = q.segments[removable:]
+}
+
+// runFlusher периодически выполняет fsync (для политики interval) и сохраняет checkpoint.
+func (q *WALQueue) runFlusher() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.cfg.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+			q.mu.Lock()
+			if err := q.flush(); err != nil {
+				log.Printf("WAL flush failed: %v", err)
+			}
+			q.mu.Unlock()
+		}
+	}
+}
+
+// flush сбрасывает активный сегмент на диск и сохраняет checkpoint. Вызывается под q.mu.
+func (q *WALQueue) flush() error {
+	if q.dirty && q.cfg.SyncPolicy != WALSyncNone {
+		if err := q.active.Sync(); err != nil {
+			return fmt.Errorf("failed to sync WAL segment: %w", err)
+		}
+	}
+
+	q.dirty = false
+
+	return q.checkpoint()
+}
+
+// DeadLetters реализует интерфейс DeadLetterProvider.
+func (q *WALQueue) DeadLetters() DeadLetterQueue { //nolint:ireturn // interface by design
+	return q.deadLetters
+}
+
+// MaxAttempts реализует интерфейс DeadLetterProvider.
+func (q *WALQueue) MaxAttempts() int {
+	return defaultMaxDeliveryAttempts
+}
+
+// Stats возвращает статистику очереди. CurrentSize - записи, еще не подтвержденные потребителем.
+func (q *WALQueue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return Stats{
+		TotalEnqueued: q.totalEnqueued,
+		TotalDequeued: q.totalDequeued,
+		CurrentSize:   int(q.next - q.committed), //nolint:gosec // bounded by queue length
+		DelayedSize:   len(q.held),
+		Dropped:       q.corrupted,
+	}
+}
+
+// Close сбрасывает данные на диск, сохраняет checkpoint и закрывает файлы.
+func (q *WALQueue) Close() error {
+	q.mu.Lock()
+
+	if q.closed {
+		q.mu.Unlock()
+
+		return nil
+	}
+
+	q.closed = true
+	q.notify()
+	close(q.done)
+	q.mu.Unlock()
+
+	q.delayed.close()
+	q.wg.Wait()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var errs []error
+
+	if err := q.flush(); err != nil {
+		errs = append(errs, err)
+	}
+
+	q.closeReader()
+
+	if err := q.active.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close WAL segment: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// walDelivery - доставка записи WAL. Ack сдвигает checkpoint, Nack дописывает копию в лог.
+type walDelivery struct {
+	deliveryState
+
+	queue *WALQueue
+	rec   walRecord
+}
+
+// Message реализует интерфейс Delivery.
+func (d *walDelivery) Message() *models.DataMessage {
+	return d.rec.msg
+}
+
+// Attempt реализует интерфейс Delivery.
+func (d *walDelivery) Attempt() int {
+	return d.rec.attempt
+}
+
+// Ack реализует интерфейс Delivery.
+func (d *walDelivery) Ack() error {
+	if err := d.settle(); err != nil {
+		return err
+	}
+
+	d.queue.ack(d.rec.offset)
+
+	return nil
+}
+
+// Nack реализует интерфейс Delivery: копия с deliver_at дописывается в лог и ждет,
+// как любая отложенная запись. Оригинал не меняется и подтверждается после записи копии.
+func (d *walDelivery) Nack(delay time.Duration) error {
+	if err := d.settle(); err != nil {
+		return err
+	}
+
+	rec := d.rec
+	rec.msg = cloneMessage(d.rec.msg)
+	SetDelay(rec.msg, delay)
+
+	if err := d.queue.redeliver(rec, rec.attempt+1); err != nil {
+		d.settled.Store(false)
+
+		return fmt.Errorf("%w: %w", ErrRequeueFailed, err)
+	}
+
+	return nil
+}
+
+// InProgress реализует интерфейс Delivery. У WAL нет таймаута подтверждения.
+func (d *walDelivery) InProgress() error {
+	return nil
+}
+
+// Term реализует интерфейс Delivery.
+func (d *walDelivery) Term() error {
+	if err := d.settle(); err != nil {
+		return err
+	}
+
+	d.queue.ack(d.rec.offset)
+
+	return nil
+}
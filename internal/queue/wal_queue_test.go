@@ -0,0 +1,473 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+)
+
+func receiveWAL(t *testing.T, ch <-chan Delivery) Delivery {
+	t.Helper()
+
+	select {
+	case delivery, ok := <-ch:
+		if !ok {
+			t.Fatal("Delivery channel closed unexpectedly")
+		}
+
+		return delivery
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for WAL delivery")
+
+		return nil
+	}
+}
+
+func TestWALQueue_RedeliversUnackedAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	cfg := WALConfig{Dir: dir, SyncPolicy: WALSyncAlways}
+
+	q, err := NewWALQueue(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+
+	for i := range 3 {
+		if err := q.Publish(context.Background(), &models.DataMessage{Id: fmt.Sprintf("msg-%d", i)}); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, _ := q.Subscribe(ctx)
+
+	first := receiveWAL(t, ch)
+	if first.Message().GetId() != "msg-0" {
+		t.Fatalf("Expected msg-0, got %s", first.Message().GetId())
+	}
+
+	if err := first.Ack(); err != nil {
+		t.Fatalf("Failed to ack: %v", err)
+	}
+
+	// msg-1 получено, но не подтверждено.
+	receiveWAL(t, ch)
+	cancel()
+
+	if err := q.Close(); err != nil {
+		t.Fatalf("Failed to close WAL: %v", err)
+	}
+
+	reopened, err := NewWALQueue(cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen WAL: %v", err)
+	}
+	defer reopened.Close()
+
+	ch, _ = reopened.Subscribe(context.Background())
+
+	delivery := receiveWAL(t, ch)
+	if delivery.Message().GetId() != "msg-1" {
+		t.Fatalf("Expected redelivery of msg-1, got %s", delivery.Message().GetId())
+	}
+}
+
+func TestWALQueue_TruncatesTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	cfg := WALConfig{Dir: dir, SyncPolicy: WALSyncNone}
+
+	q, err := NewWALQueue(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+
+	if err := q.Publish(context.Background(), &models.DataMessage{Id: "intact"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	q.Close()
+
+	// Имитируем падение посреди записи: половина кадра в конце сегмента.
+	frame, _ := encodeWALRecord(&models.DataMessage{Id: "torn"}, 1)
+
+	file, err := os.OpenFile(walSegmentPath(dir, 0), os.O_WRONLY|os.O_APPEND, walFilePerm)
+	if err != nil {
+		t.Fatalf("Failed to open segment: %v", err)
+	}
+
+	file.Write(frame[:len(frame)/2])
+	file.Close()
+
+	reopened, err := NewWALQueue(cfg)
+	if err != nil {
+		t.Fatalf("Failed to recover WAL: %v", err)
+	}
+	defer reopened.Close()
+
+	if size := reopened.Stats().CurrentSize; size != 1 {
+		t.Fatalf("Expected 1 recovered record, got %d", size)
+	}
+
+	if err := reopened.Publish(context.Background(), &models.DataMessage{Id: "after"}); err != nil {
+		t.Fatalf("Failed to publish after recovery: %v", err)
+	}
+
+	ch, _ := reopened.Subscribe(context.Background())
+
+	for _, want := range []string{"intact", "after"} {
+		delivery := receiveWAL(t, ch)
+		if delivery.Message().GetId() != want {
+			t.Fatalf("Expected %s, got %s", want, delivery.Message().GetId())
+		}
+
+		delivery.Ack()
+	}
+}
+
+func TestWALQueue_RollsAndRemovesConsumedSegments(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := NewWALQueue(WALConfig{Dir: dir, SegmentSize: 1, SyncPolicy: WALSyncAlways})
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+	defer q.Close()
+
+	for i := range 4 {
+		if err := q.Publish(context.Background(), &models.DataMessage{Id: fmt.Sprintf("msg-%d", i)}); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+
+	segments, _ := listWALSegments(dir)
+	if len(segments) != 4 {
+		t.Fatalf("Expected 4 segments, got %d", len(segments))
+	}
+
+	ch, _ := q.Subscribe(context.Background())
+
+	for range 3 {
+		receiveWAL(t, ch).Ack()
+	}
+
+	segments, _ = listWALSegments(dir)
+	if len(segments) != 1 || segments[0].base != 3 {
+		t.Fatalf("Expected only the segment with unacked msg-3, got %+v", segments)
+	}
+
+	delivery := receiveWAL(t, ch)
+	if delivery.Message().GetId() != "msg-3" {
+		t.Fatalf("Expected msg-3, got %s", delivery.Message().GetId())
+	}
+}
+
+func TestWALQueue_NackAppendsNextAttempt(t *testing.T) {
+	q, err := NewWALQueue(WALConfig{Dir: t.TempDir(), SyncPolicy: WALSyncAlways})
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+	defer q.Close()
+
+	if err := q.Publish(context.Background(), &models.DataMessage{Id: "retry"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	ch, _ := q.Subscribe(context.Background())
+
+	if err := receiveWAL(t, ch).Nack(0); err != nil {
+		t.Fatalf("Failed to nack: %v", err)
+	}
+
+	delivery := receiveWAL(t, ch)
+	if delivery.Message().GetId() != "retry" || delivery.Attempt() != 2 {
+		t.Fatalf("Expected retry with attempt 2, got %s attempt %d", delivery.Message().GetId(), delivery.Attempt())
+	}
+}
+
+func TestWALQueue_DeadLettersSurviveRestart(t *testing.T) {
+	ctx := context.Background()
+	cfg := WALConfig{Dir: t.TempDir(), SyncPolicy: WALSyncAlways}
+
+	q, err := NewWALQueue(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+
+	if err := q.DeadLetters().Put(ctx, &DeadLetter{Message: &models.DataMessage{Id: "dead"}, LastError: "boom"}); err != nil {
+		t.Fatalf("Failed to put dead letter: %v", err)
+	}
+
+	q.Close()
+
+	reopened, err := NewWALQueue(cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen WAL: %v", err)
+	}
+	defer reopened.Close()
+
+	dlq := reopened.DeadLetters()
+
+	entries, err := dlq.List(ctx, 0)
+	if err != nil || len(entries) != 1 || entries[0].ID != "1" || entries[0].Message.GetId() != "dead" ||
+		entries[0].LastError != "boom" {
+		t.Fatalf("Expected dead letter after restart, got %v (%v)", entries, err)
+	}
+
+	next := &DeadLetter{Message: &models.DataMessage{Id: "next"}}
+	if err := dlq.Put(ctx, next); err != nil || next.ID != "2" {
+		t.Fatalf("Expected ID to continue after restart, got %q (%v)", next.ID, err)
+	}
+
+	if err := dlq.Delete(ctx, "1"); err != nil {
+		t.Fatalf("Failed to delete dead letter: %v", err)
+	}
+
+	if _, err := dlq.Get(ctx, "1"); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Expected ErrDeadLetterNotFound after delete, got %v", err)
+	}
+}
+
+func TestWALQueue_RetriesReadErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := NewWALQueue(WALConfig{Dir: dir, SyncPolicy: WALSyncAlways})
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+	defer q.Close()
+
+	if err := q.Publish(context.Background(), &models.DataMessage{Id: "recovered"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	// Портим длину кадра: границу записи не определить, и чтение завершается ошибкой, пока запись не восстановлена.
+	path := walSegmentPath(dir, 0)
+
+	segment, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read segment: %v", err)
+	}
+
+	corrupted := append([]byte(nil), segment...)
+	corrupted[0] ^= 0xff
+
+	if err := os.WriteFile(path, corrupted, walFilePerm); err != nil {
+		t.Fatalf("Failed to corrupt segment: %v", err)
+	}
+
+	ch, _ := q.Subscribe(context.Background())
+
+	select {
+	case delivery, ok := <-ch:
+		t.Fatalf("Expected no delivery while the record is corrupt, got %v (open: %v)", delivery, ok)
+	case <-time.After(2 * walReadRetryMin):
+	}
+
+	if err := os.WriteFile(path, segment, walFilePerm); err != nil {
+		t.Fatalf("Failed to restore segment: %v", err)
+	}
+
+	if delivery := receiveWAL(t, ch); delivery.Message().GetId() != "recovered" {
+		t.Fatalf("Expected recovered, got %s", delivery.Message().GetId())
+	}
+}
+
+func TestWALQueue_SkipsCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := NewWALQueue(WALConfig{Dir: dir, SyncPolicy: WALSyncAlways})
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+	defer q.Close()
+
+	ctx := context.Background()
+
+	var frameSize int
+
+	for i, id := range []string{"first", "corrupt", "last"} {
+		if err := q.Publish(ctx, &models.DataMessage{Id: id}); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+
+		if i == 0 {
+			info, err := os.Stat(walSegmentPath(dir, 0))
+			if err != nil {
+				t.Fatalf("Failed to stat segment: %v", err)
+			}
+
+			frameSize = int(info.Size())
+		}
+	}
+
+	// Портим байт данных второй записи в середине сегмента: ее CRC не совпадает.
+	path := walSegmentPath(dir, 0)
+
+	segment, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read segment: %v", err)
+	}
+
+	segment[frameSize+walFrameHeaderSize+walAttemptSize] ^= 0xff
+
+	if err := os.WriteFile(path, segment, walFilePerm); err != nil {
+		t.Fatalf("Failed to corrupt segment: %v", err)
+	}
+
+	ch, _ := q.Subscribe(ctx)
+
+	for _, id := range []string{"first", "last"} {
+		delivery := receiveWAL(t, ch)
+		if delivery.Message().GetId() != id {
+			t.Fatalf("Expected %s, got %s", id, delivery.Message().GetId())
+		}
+
+		if err := delivery.Ack(); err != nil {
+			t.Fatalf("Failed to ack: %v", err)
+		}
+	}
+
+	if stats := q.Stats(); stats.Dropped != 1 || stats.CurrentSize != 0 {
+		t.Errorf("Expected the corrupt record to be skipped and committed, got %+v", stats)
+	}
+}
+
+func TestWALQueue_NackReturnsRequeueFailure(t *testing.T) {
+	q, err := NewWALQueue(WALConfig{Dir: t.TempDir(), SyncPolicy: WALSyncAlways})
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+	defer q.Close()
+
+	if err := q.Publish(context.Background(), &models.DataMessage{Id: "retry"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	ch, _ := q.Subscribe(context.Background())
+	delivery := receiveWAL(t, ch)
+
+	// Закрытый активный сегмент: дописать копию записи нельзя.
+	q.mu.Lock()
+	q.active.Close()
+	q.mu.Unlock()
+
+	if err := delivery.Nack(0); !errors.Is(err, ErrRequeueFailed) {
+		t.Fatalf("Expected ErrRequeueFailed, got %v", err)
+	}
+
+	// Доставка осталась неподтвержденной: ее можно перенести в DLQ.
+	if err := delivery.Term(); err != nil {
+		t.Fatalf("Expected delivery to stay unsettled, got %v", err)
+	}
+
+	if stats := q.Stats(); stats.CurrentSize != 0 {
+		t.Errorf("Expected record to be committed after Term, got %+v", stats)
+	}
+}
+
+func TestWALQueue_HoldsDelayedRecords(t *testing.T) {
+	ctx := context.Background()
+	cfg := WALConfig{Dir: t.TempDir(), SyncPolicy: WALSyncAlways}
+
+	q, err := NewWALQueue(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+
+	start := time.Now()
+
+	delayed := &models.DataMessage{Id: "delayed"}
+	SetDelay(delayed, 200*time.Millisecond)
+
+	later := &models.DataMessage{Id: "later"}
+	SetDelay(later, time.Hour)
+
+	for _, msg := range []*models.DataMessage{delayed, later, {Id: "immediate"}} {
+		if err := q.Publish(ctx, msg); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+
+	ch, _ := q.Subscribe(ctx)
+
+	if delivery := receiveWAL(t, ch); delivery.Message().GetId() != "immediate" {
+		t.Fatalf("Expected immediate message first, got %s", delivery.Message().GetId())
+	} else {
+		delivery.Ack()
+	}
+
+	if stats := q.Stats(); stats.DelayedSize != 2 {
+		t.Errorf("Expected 2 delayed records, got %+v", stats)
+	}
+
+	delivery := receiveWAL(t, ch)
+	if delivery.Message().GetId() != "delayed" {
+		t.Fatalf("Expected delayed message, got %s", delivery.Message().GetId())
+	}
+
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("Delayed message delivered too early: %v", elapsed)
+	}
+
+	delivery.Ack()
+	q.Close()
+
+	// Отложенная запись хранится отдельно от лога и после рестарта снова ждет deliver_at;
+	// подтвержденные записи за ней повторно не доставляются.
+	reopened, err := NewWALQueue(cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen WAL: %v", err)
+	}
+	defer reopened.Close()
+
+	ch, _ = reopened.Subscribe(ctx)
+
+	select {
+	case delivery := <-ch:
+		t.Fatalf("Expected message delayed for an hour to be held, got %s", delivery.Message().GetId())
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if stats := reopened.Stats(); stats.DelayedSize != 1 {
+		t.Errorf("Expected 1 delayed record after restart, got %+v", stats)
+	}
+}
+
+func TestWALQueue_NackWithDelayPostponesRedelivery(t *testing.T) {
+	q, err := NewWALQueue(WALConfig{Dir: t.TempDir(), SyncPolicy: WALSyncAlways})
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+	defer q.Close()
+
+	if err := q.Publish(context.Background(), &models.DataMessage{Id: "retry"}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	ch, _ := q.Subscribe(context.Background())
+
+	first := receiveWAL(t, ch)
+	start := time.Now()
+
+	if err := first.Nack(100 * time.Millisecond); err != nil {
+		t.Fatalf("Failed to nack: %v", err)
+	}
+
+	if _, ok := DeliverAt(first.Message()); ok {
+		t.Errorf("Expected original message to stay unchanged")
+	}
+
+	delivery := receiveWAL(t, ch)
+	if delivery.Attempt() != 2 {
+		t.Fatalf("Expected attempt 2, got %d", delivery.Attempt())
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("Message redelivered too early: %v", elapsed)
+	}
+}
@@ -0,0 +1,248 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/stsolovey/diplom-distributed-system/internal/models"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	walSegmentExt      = ".log"
+	walFrameHeaderSize = 8 // длина данных (uint32) + CRC32 данных (uint32)
+	walAttemptSize     = 4 // номер попытки доставки (uint32) в начале данных записи
+	walMaxRecordSize   = 64 << 20
+	walFilePerm        = 0o644
+	walDirPerm         = 0o755
+)
+
+var ErrWALCorruptRecord = errors.New("corrupt WAL record")
+
+// errWALChecksumMismatch - CRC кадра не совпал; кадр прочитан целиком, чтение можно продолжить со следующего.
+var errWALChecksumMismatch = fmt.Errorf("%w: checksum mismatch", ErrWALCorruptRecord)
+
+// walSegment - файл сегмента WAL. Имя файла - offset первой записи сегмента.
+type walSegment struct {
+	base uint64
+	path string
+}
+
+// walRecord - запись WAL: сообщение, его offset и номер попытки доставки.
+type walRecord struct {
+	offset  uint64
+	attempt int
+	msg     *models.DataMessage
+}
+
+func walSegmentPath(dir string, base uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", base, walSegmentExt))
+}
+
+// listWALSegments возвращает сегменты каталога, отсортированные по base.
+func listWALSegments(dir string) ([]walSegment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WAL directory: %w", err)
+	}
+
+	var segments []walSegment
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, walSegmentExt) {
+			continue
+		}
+
+		base, err := strconv.ParseUint(strings.TrimSuffix(name, walSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		segments = append(segments, walSegment{base: base, path: filepath.Join(dir, name)})
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i].base < segments[j].base })
+
+	return segments, nil
+}
+
+// encodeWALRecord кодирует сообщение в кадр: [длина][CRC32][попытка][protobuf].
+func encodeWALRecord(msg *models.DataMessage, attempt int) ([]byte, error) {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal WAL record: %w", err)
+	}
+
+	dataLen := walAttemptSize + len(payload)
+	frame := make([]byte, walFrameHeaderSize+dataLen)
+	data := frame[walFrameHeaderSize:]
+
+	binary.BigEndian.PutUint32(data, uint32(attempt)) //nolint:gosec // attempts are small
+	copy(data[walAttemptSize:], payload)
+
+	binary.BigEndian.PutUint32(frame, uint32(dataLen)) //nolint:gosec // bounded by walMaxRecordSize
+	binary.BigEndian.PutUint32(frame[4:], crc32.ChecksumIEEE(data))
+
+	return frame, nil
+}
+
+// readWALFrame читает один кадр. io.EOF - чистый конец сегмента,
+// io.ErrUnexpectedEOF или ErrWALCorruptRecord - оборванная или поврежденная запись;
+// errWALChecksumMismatch (вариант ErrWALCorruptRecord) - кадр прочитан, но данные повреждены.
+func readWALFrame(r io.Reader) ([]byte, error) {
+	var header [walFrameHeaderSize]byte
+
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err //nolint:wrapcheck // io.EOF is a sentinel for callers
+	}
+
+	dataLen := binary.BigEndian.Uint32(header[:])
+	if dataLen < walAttemptSize || dataLen > walMaxRecordSize {
+		return nil, ErrWALCorruptRecord
+	}
+
+	data := make([]byte, dataLen)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		return nil, err //nolint:wrapcheck // io errors are sentinels for callers
+	}
+
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, errWALChecksumMismatch
+	}
+
+	return data, nil
+}
+
+// decodeWALRecord декодирует данные кадра.
+func decodeWALRecord(data []byte) (int, *models.DataMessage, error) {
+	attempt := int(binary.BigEndian.Uint32(data))
+
+	var msg models.DataMessage
+	if err := proto.Unmarshal(data[walAttemptSize:], &msg); err != nil {
+		return 0, nil, fmt.Errorf("%w: %w", ErrWALCorruptRecord, err)
+	}
+
+	return attempt, &msg, nil
+}
+
+// recoverWALSegment проверяет сегмент после рестарта и обрезает оборванный хвост.
+// Возвращает число целых записей и размер валидной части файла.
+func recoverWALSegment(path string) (uint64, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open WAL segment: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+
+	var (
+		records uint64
+		size    int64
+		readErr error
+	)
+
+	for {
+		data, err := readWALFrame(reader)
+		if err != nil {
+			readErr = err
+
+			break
+		}
+
+		records++
+		size += int64(walFrameHeaderSize + len(data))
+	}
+
+	file.Close()
+
+	if errors.Is(readErr, io.EOF) {
+		return records, size, nil
+	}
+
+	if !errors.Is(readErr, io.ErrUnexpectedEOF) && !errors.Is(readErr, ErrWALCorruptRecord) {
+		return 0, 0, fmt.Errorf("failed to read WAL segment: %w", readErr)
+	}
+
+	// Запись, оборванная при падении процесса, никогда не была подтверждена издателю.
+	if err := os.Truncate(path, size); err != nil {
+		return 0, 0, fmt.Errorf("failed to truncate WAL segment: %w", err)
+	}
+
+	return records, size, nil
+}
+
+// writeWALCheckpoint атомарно сохраняет offset потребителя.
+func writeWALCheckpoint(path string, offset uint64, fsync bool) error {
+	if err := writeWALFile(path, []byte(strconv.FormatUint(offset, 10)), fsync); err != nil {
+		return fmt.Errorf("failed to write WAL checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// writeWALFile атомарно записывает файл: запись во временный файл и rename.
+func writeWALFile(path string, data []byte, fsync bool) error {
+	tmpPath := path + ".tmp"
+
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, walFilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if fsync {
+		if err := file.Sync(); err != nil {
+			file.Close()
+
+			return fmt.Errorf("failed to sync file: %w", err)
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+
+	return nil
+}
+
+// readWALCheckpoint читает сохраненный offset потребителя; ok=false, если checkpoint'а нет.
+func readWALCheckpoint(path string) (uint64, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, false, nil
+		}
+
+		return 0, false, fmt.Errorf("failed to read WAL checkpoint: %w", err)
+	}
+
+	offset, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid WAL checkpoint: %w", err)
+	}
+
+	return offset, true, nil
+}
@@ -1,12 +1,37 @@
 #!/bin/bash
 
 # Script to switch queue implementation between memory and NATS
-# Usage: ./switch-queue.sh [memory|nats]
+# Usage: ./switch-queue.sh [memory|nats] [--live]
+#   --live  migrate the running processor without restart (POST /admin/queue/migrate);
+#           any registered queue type is accepted, progress is polled from /stats;
+#           abort with: curl -X POST $PROCESSOR_URL/admin/queue/migrate/abort
 
 set -e
 
 QUEUE_TYPE=${1:-memory}
 
+if [ "$2" = "--live" ]; then
+    PROCESSOR_URL=${PROCESSOR_URL:-http://localhost:8082}
+
+    echo "Migrating running processor at $PROCESSOR_URL to $QUEUE_TYPE queue..."
+    curl -sf -X POST "$PROCESSOR_URL/admin/queue/migrate" \
+        -H 'Content-Type: application/json' \
+        -d "{\"queueType\":\"$QUEUE_TYPE\"}" > /dev/null
+
+    while true; do
+        MIGRATION=$(curl -sf "$PROCESSOR_URL/stats" | jq -c '.migration')
+        PHASE=$(echo "$MIGRATION" | jq -r '.Phase')
+        echo "  $MIGRATION"
+
+        case "$PHASE" in
+            completed) echo "Queue migration completed: now using $QUEUE_TYPE"; exit 0 ;;
+            failed) echo "Error: queue migration failed and was rolled back: $(echo "$MIGRATION" | jq -r '.Error')"; exit 1 ;;
+        esac
+
+        sleep 2
+    done
+fi
+
 if [ "$QUEUE_TYPE" != "memory" ] && [ "$QUEUE_TYPE" != "nats" ]; then
     echo "Error: Queue type must be 'memory' or 'nats'"
     echo "Usage: $0 [memory|nats]"